@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -10,7 +11,9 @@ import (
 	"github.com/intermernet/raceviz/internal/api"
 	"github.com/intermernet/raceviz/internal/config"
 	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/dem"
 	"github.com/intermernet/raceviz/internal/email"
+	"github.com/intermernet/raceviz/internal/mapmatch"
 	"github.com/intermernet/raceviz/internal/realtime"
 
 	"github.com/go-chi/chi/v5"
@@ -57,6 +60,28 @@ func main() {
 
 	log.Println("INFO: Realtime Hub and Email Service initialized.")
 
+	// The road/trail network for map matching is optional. Loading a large extract
+	// can take a while, so it is done once at startup.
+	var mapNetwork *mapmatch.Network
+	if cfg.OsmExtractPath != "" {
+		mapNetwork, err = mapmatch.LoadPBF(cfg.OsmExtractPath)
+		if err != nil {
+			log.Fatalf("FATAL: Failed to load OpenStreetMap extract: %v", err)
+		}
+		log.Printf("INFO: Map matching network loaded from %s (%d segments).", cfg.OsmExtractPath, mapNetwork.SegmentCount())
+	}
+
+	// DEM tiles for elevation correction are also optional. Only the tile index is
+	// built here; elevation samples are loaded when a track first needs them.
+	var demSource *dem.Source
+	if cfg.DemPath != "" {
+		demSource, err = dem.Open(cfg.DemPath)
+		if err != nil {
+			log.Fatalf("FATAL: Failed to open DEM tiles: %v", err)
+		}
+		log.Printf("INFO: Elevation model indexed from %s (%d tiles).", cfg.DemPath, demSource.TileCount())
+	}
+
 	// --- 3. Initialize Database Service ---
 	// The database service manages all connections and ensures thread-safe writes.
 	// We pass the full path to the main database file.
@@ -80,10 +105,18 @@ func main() {
 
 	log.Println("INFO: Main database schema verified.")
 
+	// Group databases are created on demand, so existing ones may predate the
+	// current schema. Upgrade them in place before serving any requests.
+	if err := dbService.MigrateGroupDBs(); err != nil {
+		log.Fatalf("FATAL: Failed to migrate group databases: %v", err)
+	}
+
+	log.Println("INFO: Group database schemas verified.")
+
 	// --- 5. Set Up API Server and Routes ---
 	// Create a new instance of our API server, injecting the dependencies it needs
 	// (like the config and the database service).
-	serverAPI := api.NewServer(cfg, dbService, broker, emailService)
+	serverAPI := api.NewServer(cfg, dbService, broker, emailService, mapNetwork, demSource)
 
 	// Create a new Chi router. Chi is a lightweight and powerful router for Go.
 	router := chi.NewRouter()
@@ -94,6 +127,30 @@ func main() {
 
 	log.Println("INFO: API routes registered.")
 
+	// Live tracks are written out to GPX files in the background once their
+	// event has ended.
+	go serverAPI.RunLiveFinalizer(context.Background(), time.Minute)
+
+	// Racers in running live events are checked for safety alerts every minute.
+	go serverAPI.RunSafetyMonitor(context.Background(), time.Minute)
+
+	// Spectator streams receive live positions at most once per second,
+	// however often the trackers report.
+	go broker.RunEventFlusher(context.Background(), time.Second)
+
+	// Raw NMEA streams from GPS receivers can be fed in over TCP or UDP as the
+	// live track of a single racer.
+	for network, addr := range map[string]string{"tcp": cfg.NmeaTCPAddr, "udp": cfg.NmeaUDPAddr} {
+		if addr == "" {
+			continue
+		}
+		go func(network, addr string) {
+			if err := serverAPI.ServeNMEA(context.Background(), network, addr, cfg.NmeaDeviceToken); err != nil {
+				log.Fatalf("FATAL: Failed to start NMEA %s listener on %s: %v", network, addr, err)
+			}
+		}(network, addr)
+	}
+
 	// --- 6. Start the HTTP Server ---
 	// Announce the server is starting and on which address.
 	log.Printf("INFO: RaceViz server starting on %s", cfg.ServerAddr)
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/igc"
+
+	"github.com/go-chi/chi/v5"
+	gpxgo "github.com/tkrajina/gpxgo/gpx"
+)
+
+// Limits of a bulk import.
+const (
+	maxBulkImportSize  = 100 << 20 // Bytes in the whole request
+	maxBulkImportFiles = 200
+	maxTrackFileSize   = 10 << 20  // Bytes in one track file, as for single uploads
+	maxUnpackedSize    = 200 << 20 // Bytes unpacked from all the ZIP archives together
+)
+
+// bulkImportResult reports what became of one file of a bulk import.
+type bulkImportResult struct {
+	File   string         `json:"file"`
+	Status string         `json:"status"` // "created" or "failed"
+	Racer  *RacerResponse `json:"racer,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Bulk import result statuses.
+const (
+	bulkImportCreated = "created"
+	bulkImportFailed  = "failed"
+)
+
+// bulkImportFile is one track file of a bulk import, taken from the request or
+// from a ZIP archive in it.
+type bulkImportFile struct {
+	name string
+	data []byte
+	err  error // Set if the file couldn't be read
+}
+
+// handleBulkImportRacers creates a racer for each track file uploaded, e.g. the
+// files collected after a club ride. Files are sent as a multipart form, any
+// number to a field, and ZIP archives of track files are unpacked. Each racer
+// is named from the track's GPX metadata name, track name or author, or else
+// the file name, and gets a colour distinct from the event's other racers.
+// Every file is validated like a single upload; files that fail are reported
+// without stopping the rest of the batch.
+func (s *Server) handleBulkImportRacers(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid event ID"), http.StatusBadRequest)
+		return
+	}
+	event, err := s.db.GetEventByID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.errorJSON(w, errors.New("upload is too large (max 100MB)"), http.StatusBadRequest)
+		return
+	}
+	files, err := bulkImportFiles(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(files) == 0 {
+		s.errorJSON(w, errors.New("no track files uploaded"), http.StatusBadRequest)
+		return
+	}
+	if len(files) > maxBulkImportFiles {
+		s.errorJSON(w, fmt.Errorf("too many files (max %d)", maxBulkImportFiles), http.StatusBadRequest)
+		return
+	}
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	usedColors := make(map[string]bool, len(racers))
+	for _, racer := range racers {
+		usedColors[racer.TrackColor] = true
+	}
+
+	report := make([]bulkImportResult, len(files))
+	var created []*database.Racer
+	var turnpoints []igc.Waypoint
+	for i, f := range files {
+		report[i] = bulkImportResult{File: f.name, Status: bulkImportFailed}
+		if f.err != nil {
+			report[i].Error = f.err.Error()
+			continue
+		}
+		upload, err := readTrackUpload(event, "", f.data)
+		if err != nil {
+			report[i].Error = err.Error()
+			continue
+		}
+
+		color := distinctColor(usedColors)
+		var racer *database.Racer
+		err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+			var err error
+			racer, err = s.db.AddRacerToEvent(tx, event.ID, userID, importedRacerName(upload.gpx, f.name), color, sql.NullString{})
+			return err
+		})
+		if err != nil {
+			report[i].Error = "failed to add racer to event"
+			continue
+		}
+		trackFile, err := s.storeTrackFile(event, racer, userID, f.name, upload.gpxBytes)
+		if err != nil {
+			report[i].Error = err.Error()
+			// Don't leave a racer without the track they were created for.
+			if err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error { return s.db.DeleteRacer(tx, racer.ID) }); err != nil {
+				log.Printf("WARN: could not remove racer %d after a failed import: %v", racer.ID, err)
+			}
+			continue
+		}
+
+		usedColors[color] = true
+		racer.GpxFilePath, racer.TrackFileCount = sql.NullString{String: trackFile.FilePath, Valid: true}, 1
+		resp := toRacerResponse(racer)
+		report[i].Status, report[i].Racer = bulkImportCreated, &resp
+		created = append(created, racer)
+		if turnpoints == nil {
+			turnpoints = upload.turnpoints
+		}
+	}
+
+	if len(created) > 0 {
+		for _, racer := range created {
+			if err := s.storeRacerSpatialData(groupDB, event, racer.ID); err != nil {
+				log.Printf("WARN: could not update spatial data for racer %d: %v", racer.ID, err)
+			}
+		}
+		if err := s.refreshEventSpatialData(groupDB, event); err != nil {
+			log.Printf("WARN: could not update spatial data for event %d: %v", event.ID, err)
+		}
+		if len(turnpoints) > 0 {
+			if err := s.applyDeclaredTask(groupDB, event, turnpoints); err != nil {
+				log.Printf("WARN: could not set checkpoints of event %d from IGC task: %v", event.ID, err)
+			}
+		}
+		// One at a time, as concurrent updates would contend for the group database.
+		go func() {
+			for _, racer := range created {
+				if err := s.updateBestEfforts(groupDB, event, racer, false); err != nil {
+					log.Printf("WARN: could not update best efforts of racer %d in event %d: %v", racer.ID, event.ID, err)
+				}
+			}
+		}()
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"created": len(created),
+		"failed":  len(files) - len(created),
+		"results": report,
+	})
+}
+
+// bulkImportFiles collects the files of a bulk import from a parsed multipart
+// form, in field name order, unpacking ZIP archives.
+func bulkImportFiles(r *http.Request) ([]bulkImportFile, error) {
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var files []bulkImportFile
+	unpackBudget := int64(maxUnpackedSize)
+	for _, field := range fields {
+		for _, header := range r.MultipartForm.File[field] {
+			name := path.Base(header.Filename)
+			if header.Size > maxTrackFileSize && !isZipName(name) {
+				files = append(files, bulkImportFile{name: name, err: errors.New("file is too large (max 10MB)")})
+				continue
+			}
+			file, err := header.Open()
+			if err != nil {
+				files = append(files, bulkImportFile{name: name, err: errors.New("could not read uploaded file")})
+				continue
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				files = append(files, bulkImportFile{name: name, err: errors.New("could not read uploaded file")})
+				continue
+			}
+
+			if !isZipName(name) && !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+				files = append(files, bulkImportFile{name: name, data: data})
+				continue
+			}
+			unpacked, err := unzipTrackFiles(data, maxBulkImportFiles-len(files), &unpackBudget)
+			if err != nil {
+				return nil, fmt.Errorf("could not read ZIP archive %s: %w", name, err)
+			}
+			files = append(files, unpacked...)
+		}
+	}
+	return files, nil
+}
+
+// unzipTrackFiles returns the files in a ZIP archive, skipping directories and
+// the hidden files archivers add. Archives with more than maxFiles entries are
+// rejected before anything is unpacked, and unpacking stops with an error once
+// more than budget bytes have been unpacked; budget is reduced by what was.
+func unzipTrackFiles(data []byte, maxFiles int, budget *int64) ([]bulkImportFile, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(archive.File) > maxFiles {
+		return nil, fmt.Errorf("too many files (max %d)", maxBulkImportFiles)
+	}
+	var files []bulkImportFile
+	for _, entry := range archive.File {
+		name := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		if entry.UncompressedSize64 > maxTrackFileSize {
+			files = append(files, bulkImportFile{name: name, err: errors.New("file is too large (max 10MB)")})
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			files = append(files, bulkImportFile{name: name, err: errors.New("could not unpack file")})
+			continue
+		}
+		// The header's size can't be trusted, so stop reading past the limits.
+		content, err := io.ReadAll(io.LimitReader(rc, min(maxTrackFileSize, *budget)+1))
+		rc.Close()
+		if int64(len(content)) > *budget {
+			return nil, errors.New("archives unpack to more than 200MB")
+		}
+		*budget -= int64(len(content))
+		switch {
+		case err != nil:
+			files = append(files, bulkImportFile{name: name, err: errors.New("could not unpack file")})
+		case len(content) > maxTrackFileSize:
+			files = append(files, bulkImportFile{name: name, err: errors.New("file is too large (max 10MB)")})
+		default:
+			files = append(files, bulkImportFile{name: name, data: content})
+		}
+	}
+	return files, nil
+}
+
+// isZipName reports whether a file name has a ZIP extension.
+func isZipName(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".zip")
+}
+
+// importedRacerName names a racer created from a track file: the GPX metadata
+// name, the track's name or the author, or else the file name.
+func importedRacerName(doc *gpxgo.GPX, fileName string) string {
+	candidates := []string{doc.Name}
+	if len(doc.Tracks) > 0 {
+		candidates = append(candidates, doc.Tracks[0].Name)
+	}
+	candidates = append(candidates, doc.AuthorName)
+	for _, name := range candidates {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+// distinctColor returns a track colour not in used, spreading hues by the
+// golden angle so that each new colour stands apart from the ones before it.
+func distinctColor(used map[string]bool) string {
+	for i := len(used); ; i++ {
+		color := hslColor(math.Mod(float64(i)*137.508, 360), 0.7, 0.5)
+		if !used[color] {
+			return color
+		}
+	}
+}
+
+// hslColor converts a hue in degrees, saturation and lightness to a hex colour.
+func hslColor(h, s, l float64) string {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return fmt.Sprintf("#%02x%02x%02x", int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255)))
+}
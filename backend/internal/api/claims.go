@@ -0,0 +1,419 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/realtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// claimPending is the status of a claim that has yet to be decided.
+const claimPending = "pending"
+
+// --- Structs for JSON Payloads ---
+
+// claimRacerPayload asks for a racer entry to be linked to the requesting user.
+type claimRacerPayload struct {
+	Message string `json:"message"` // Optional note for whoever decides the claim
+}
+
+// myRaceResponse is one of a user's races, from any of their groups.
+type myRaceResponse struct {
+	GroupID   int64         `json:"groupId"`
+	GroupName string        `json:"groupName"`
+	Event     EventResponse `json:"event"`
+	Racer     RacerResponse `json:"racer"`
+	Status    string        `json:"status"` // "finished", "dnf", "dns" or "dsq"
+	Time      float64       `json:"time"`   // Seconds, for finishers
+}
+
+// --- HTTP Handlers ---
+
+// handleClaimRacer asks for a racer entry to be linked to the requesting
+// member's account. The user who added the racer or the event owner decides
+// the claim; when one of them claims the racer, it is approved at once.
+func (s *Server) handleClaimRacer(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	event, racer, ok := s.loadRacerFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+
+	var payload claimRacerPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Message = strings.TrimSpace(payload.Message)
+
+	if racer.UserID.Valid {
+		if racer.UserID.Int64 == userID {
+			s.errorJSON(w, errors.New("racer is already linked to your account"), http.StatusConflict)
+		} else {
+			s.errorJSON(w, errors.New("racer is already linked to another user"), http.StatusConflict)
+		}
+		return
+	}
+	if _, err := s.db.GetPendingRacerClaim(groupDB, racer.ID, userID); err == nil {
+		s.errorJSON(w, errors.New("you already have a pending claim on this racer"), http.StatusConflict)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	approve := canDecideClaim(userID, event, racer)
+	var claim *database.RacerClaim
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		// Another claim may have been approved since the racer was loaded.
+		current, err := s.db.GetRacerByID(tx, racer.ID)
+		if err != nil {
+			return err
+		}
+		if current.UserID.Valid {
+			return database.ErrRacerLinked
+		}
+		claim, err = s.db.CreateRacerClaim(tx, racer.ID, event.ID, userID, payload.Message)
+		if err != nil || !approve {
+			return err
+		}
+		if err := s.db.DecideRacerClaim(tx, claim, true, userID, time.Now().UTC()); err != nil {
+			return err
+		}
+		claim, err = s.db.GetRacerClaimByID(tx, claim.ID)
+		return err
+	})
+	if errors.Is(err, database.ErrRacerLinked) {
+		s.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to claim racer"), http.StatusInternalServerError)
+		return
+	}
+
+	if approve {
+		s.refreshBestEfforts(groupDB, event, racer.ID, false)
+	} else {
+		s.notifyClaimDeciders(event, racer, claim)
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"claim": s.racerClaimResponse(claim, racer.RacerName)})
+}
+
+// handleGetRacerClaims lists the claims the requesting member made in a group,
+// and the claims they can decide, pending claims first.
+func (s *Server) handleGetRacerClaims(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	claims, err := s.db.GetRacerClaimsForUser(groupDB, userID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	userIDs := make(map[int64]struct{})
+	for _, c := range claims {
+		userIDs[c.UserID] = struct{}{}
+	}
+	users, err := s.db.GetUsersByIDs(s.db.GetMainDB(), userIDs)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not retrieve user data"), http.StatusInternalServerError)
+		return
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	list := make([]RacerClaimResponse, 0, len(claims))
+	for _, c := range claims {
+		var racerName string
+		if racer, err := s.db.GetRacerByID(groupDB, c.RacerID); err == nil {
+			racerName = racer.RacerName
+		}
+		list = append(list, toRacerClaimResponse(c, racerName, usernames[c.UserID]))
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"claims": list})
+}
+
+// handleApproveRacerClaim links a racer to the user who claimed them.
+func (s *Server) handleApproveRacerClaim(w http.ResponseWriter, r *http.Request) {
+	s.decideRacerClaim(w, r, true)
+}
+
+// handleRejectRacerClaim turns down a claim on a racer.
+func (s *Server) handleRejectRacerClaim(w http.ResponseWriter, r *http.Request) {
+	s.decideRacerClaim(w, r, false)
+}
+
+// decideRacerClaim approves or rejects a pending claim. Only the user who
+// added the racer or the event owner can decide it. The claimant is notified.
+func (s *Server) decideRacerClaim(w http.ResponseWriter, r *http.Request, approve bool) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	claimID, err := strconv.ParseInt(chi.URLParam(r, "claimID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid claim ID"), http.StatusBadRequest)
+		return
+	}
+	claim, err := s.db.GetRacerClaimByID(groupDB, claimID)
+	if err != nil {
+		s.errorJSON(w, errors.New("claim not found"), http.StatusNotFound)
+		return
+	}
+	event, err := s.db.GetEventByID(groupDB, claim.EventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+	racer, err := s.db.GetRacerByID(groupDB, claim.RacerID)
+	if err != nil {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return
+	}
+	if !canDecideClaim(userID, event, racer) {
+		s.errorJSON(w, errors.New("forbidden: only the user who added the racer or the event owner can decide claims"), http.StatusForbidden)
+		return
+	}
+	if claim.Status != claimPending {
+		s.errorJSON(w, errors.New("claim has already been decided"), http.StatusConflict)
+		return
+	}
+	if approve && racer.UserID.Valid {
+		s.errorJSON(w, errors.New("racer is already linked to a user"), http.StatusConflict)
+		return
+	}
+
+	// DecideRacerClaim only touches a claim that is still pending and a racer
+	// that is still unlinked, so a claim decided in the meantime is caught here.
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		if err := s.db.DecideRacerClaim(tx, claim, approve, userID, time.Now().UTC()); err != nil {
+			return err
+		}
+		claim, err = s.db.GetRacerClaimByID(tx, claim.ID)
+		return err
+	})
+	if errors.Is(err, database.ErrClaimDecided) || errors.Is(err, database.ErrRacerLinked) {
+		s.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to decide claim"), http.StatusInternalServerError)
+		return
+	}
+
+	if approve {
+		s.refreshBestEfforts(groupDB, event, racer.ID, false)
+	}
+	s.broker.NotifyUser(claim.UserID, realtime.Message{
+		Type: "racer_claim_decided",
+		Payload: map[string]interface{}{
+			"groupId":   groupID,
+			"eventId":   event.ID,
+			"eventName": event.Name,
+			"racerId":   racer.ID,
+			"racerName": racer.RacerName,
+			"claimId":   claim.ID,
+			"status":    claim.Status,
+		},
+	})
+	s.writeJSON(w, http.StatusOK, envelope{"claim": s.racerClaimResponse(claim, racer.RacerName)})
+}
+
+// handleUnlinkRacer removes the link between a racer and a user account. The
+// linked user, the user who added the racer or the event owner can unlink it.
+func (s *Server) handleUnlinkRacer(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	_, racer, ok := s.loadRacerFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+	if !racer.UserID.Valid {
+		s.errorJSON(w, errors.New("racer is not linked to a user"), http.StatusBadRequest)
+		return
+	}
+	if userID != racer.UserID.Int64 && !canDecideClaim(userID, event, racer) {
+		s.errorJSON(w, errors.New("forbidden: you cannot unlink this racer"), http.StatusForbidden)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.SetRacerUser(tx, racer.ID, sql.NullInt64{})
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to unlink racer"), http.StatusInternalServerError)
+		return
+	}
+	racer.UserID = sql.NullInt64{}
+	s.refreshBestEfforts(groupDB, event, racer.ID, false)
+
+	s.writeJSON(w, http.StatusOK, envelope{"racer": toRacerResponse(racer)})
+}
+
+// handleGetMyRaces lists the races of the requesting user across all of their
+// groups: every racer entry linked to their account, newest event first.
+// Since each group keeps its events in its own database, every group the user
+// belongs to is searched in turn.
+func (s *Server) handleGetMyRaces(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groups, err := s.db.GetGroupsByUserID(s.db.GetMainDB(), userID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	type race struct {
+		response myRaceResponse
+		event    *database.Event
+	}
+	var races []race
+	for _, group := range groups {
+		groupDB, err := s.db.GetGroupDB(group.ID)
+		if err != nil {
+			log.Printf("WARN: could not open database for group %d while listing races: %v", group.ID, err)
+			continue
+		}
+		racers, err := s.db.GetRacersByUserID(groupDB, userID)
+		if err != nil {
+			log.Printf("WARN: could not list races of user %d in group %d: %v", userID, group.ID, err)
+			continue
+		}
+		for _, racer := range racers {
+			event, err := s.db.GetEventByID(groupDB, racer.EventID)
+			if err != nil {
+				continue
+			}
+			list, err := s.eventResults(groupDB, event, []*database.Racer{racer})
+			if err != nil {
+				log.Printf("WARN: could not work out result of racer %d in event %d: %v", racer.ID, event.ID, err)
+				continue
+			}
+			resp := myRaceResponse{
+				GroupID:   group.ID,
+				GroupName: group.Name,
+				Event:     toEventResponse(event),
+				Racer:     toRacerResponse(racer),
+				Status:    list[0].Status,
+			}
+			if list[0].Finished() {
+				resp.Time = list[0].Elapsed.Seconds()
+			}
+			races = append(races, race{response: resp, event: event})
+		}
+	}
+
+	// Newest first, followed by undated time trials.
+	sort.SliceStable(races, func(i, j int) bool {
+		a, b := races[i].event.StartDate, races[j].event.StartDate
+		if a.Valid != b.Valid {
+			return a.Valid
+		}
+		return a.Valid && a.Time.After(b.Time)
+	})
+	list := make([]myRaceResponse, len(races))
+	for i, race := range races {
+		list[i] = race.response
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"races": list})
+}
+
+// --- Helpers ---
+
+// loadRacerFromURL loads the event and racer named in the URL from a group's
+// database. On failure the error response has already been written.
+func (s *Server) loadRacerFromURL(w http.ResponseWriter, r *http.Request, groupDB *sql.DB) (*database.Event, *database.Racer, bool) {
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid event ID"), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	racerID, err := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid racer ID"), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	event, err := s.db.GetEventByID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return nil, nil, false
+	}
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return nil, nil, false
+	}
+	return event, racer, true
+}
+
+// canDecideClaim reports whether a user decides the claims on a racer: the
+// user who added the racer or the event owner.
+func canDecideClaim(userID int64, event *database.Event, racer *database.Racer) bool {
+	return userID == racer.UploaderUserID || userID == event.CreatorUserID
+}
+
+// canManageRacer reports whether a user may manage a racer's device and track
+// files: the event owner, the user who added the racer or the user linked to them.
+func canManageRacer(userID int64, event *database.Event, racer *database.Racer) bool {
+	return canDecideClaim(userID, event, racer) || (racer.UserID.Valid && userID == racer.UserID.Int64)
+}
+
+// notifyClaimDeciders tells the user who added a racer and the event owner
+// about a new claim on the racer.
+func (s *Server) notifyClaimDeciders(event *database.Event, racer *database.Racer, claim *database.RacerClaim) {
+	message := realtime.Message{
+		Type: "racer_claim",
+		Payload: map[string]interface{}{
+			"groupId":   event.GroupID,
+			"eventId":   event.ID,
+			"eventName": event.Name,
+			"racerId":   racer.ID,
+			"racerName": racer.RacerName,
+			"claimId":   claim.ID,
+			"userId":    claim.UserID,
+			"message":   claim.Message,
+		},
+	}
+	s.broker.NotifyUser(racer.UploaderUserID, message)
+	if event.CreatorUserID != racer.UploaderUserID {
+		s.broker.NotifyUser(event.CreatorUserID, message)
+	}
+}
+
+// racerClaimResponse converts a claim to its DTO, with the claimant's username.
+func (s *Server) racerClaimResponse(claim *database.RacerClaim, racerName string) RacerClaimResponse {
+	var username string
+	if user, err := s.db.GetUserByID(s.db.GetMainDB(), claim.UserID); err == nil {
+		username = user.Username
+	}
+	return toRacerClaimResponse(claim, racerName, username)
+}
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/sailing"
+	"github.com/intermernet/raceviz/internal/sport"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultCheckpointRadius is used when a checkpoint is saved without a radius.
+const defaultCheckpointRadius = 25.0 // Meters
+
+// --- Structs for JSON Payloads ---
+
+// checkpointPayload defines a single checkpoint in a course update.
+type checkpointPayload struct {
+	Name   string   `json:"name"`
+	Lat    float64  `json:"lat"`
+	Lon    float64  `json:"lon"`
+	Radius *float64 `json:"radius,omitempty"` // Meters, defaults to defaultCheckpointRadius
+}
+
+// replaceCheckpointsPayload defines the structure for replacing an event's checkpoints.
+// The checkpoints are given in course order.
+type replaceCheckpointsPayload struct {
+	Checkpoints []checkpointPayload `json:"checkpoints"`
+}
+
+// windSamplePayload defines a single wind observation in a time series.
+type windSamplePayload struct {
+	Timestamp time.Time `json:"timestamp"`
+	Direction float64   `json:"direction"`
+	Speed     *float64  `json:"speed,omitempty"`
+}
+
+// setWindPayload defines the structure for setting an event's wind. Either a
+// constant Direction (and optional Speed) or a Series is given; if neither is,
+// the wind is cleared.
+type setWindPayload struct {
+	Direction *float64            `json:"direction,omitempty"` // Degrees true the wind is blowing from
+	Speed     *float64            `json:"speed,omitempty"`     // Knots
+	Series    []windSamplePayload `json:"series,omitempty"`
+}
+
+// --- HTTP Handlers ---
+
+// handleGetCheckpoints returns an event's checkpoints in course order to the
+// members of its group.
+func (s *Server) handleGetCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if _, _, _, ok := s.loadGroupForMember(w, r); !ok {
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	checkpoints, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"checkpoints": toCheckpointResponseList(checkpoints)})
+}
+
+// handleReplaceCheckpoints replaces the checkpoints of an event.
+// Only the event creator can change the course.
+func (s *Server) handleReplaceCheckpoints(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	if event.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the event creator can change the course"), http.StatusForbidden)
+		return
+	}
+
+	var payload replaceCheckpointsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+
+	checkpoints := make([]*database.Checkpoint, len(payload.Checkpoints))
+	for i, cp := range payload.Checkpoints {
+		if cp.Lat < -90 || cp.Lat > 90 || cp.Lon < -180 || cp.Lon > 180 {
+			s.errorJSON(w, fmt.Errorf("checkpoint %d has an invalid location", i+1), http.StatusBadRequest)
+			return
+		}
+		radius := defaultCheckpointRadius
+		if cp.Radius != nil {
+			if *cp.Radius <= 0 {
+				s.errorJSON(w, fmt.Errorf("checkpoint %d must have a positive radius", i+1), http.StatusBadRequest)
+				return
+			}
+			radius = *cp.Radius
+		}
+		name := cp.Name
+		if name == "" {
+			name = fmt.Sprintf("Checkpoint %d", i+1)
+		}
+		checkpoints[i] = &database.Checkpoint{Name: name, Lat: cp.Lat, Lon: cp.Lon, Radius: radius}
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ReplaceCheckpoints(tx, event.ID, checkpoints)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to save checkpoints"), http.StatusInternalServerError)
+		return
+	}
+	s.invalidatePredictor(event)
+
+	s.writeJSON(w, http.StatusOK, envelope{"checkpoints": toCheckpointResponseList(checkpoints)})
+}
+
+// handleGetCourses lists the courses of a group, without their geometry.
+func (s *Server) handleGetCourses(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+
+	courses, err := s.db.GetCourses(groupDB)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"courses": toCourseResponseList(courses)})
+}
+
+// handleCreateCourse creates a course from an uploaded GPX route or track.
+// Any member of the group can add a course.
+func (s *Server) handleCreateCourse(w http.ResponseWriter, r *http.Request) {
+	groupID, _, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB max file size
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		s.errorJSON(w, errors.New("file is too large (max 10MB)"), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("gpxFile")
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid file upload"), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	gpxBytes, err := io.ReadAll(file)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not read uploaded file"), http.StatusInternalServerError)
+		return
+	}
+	line, err := gpx.ParseCourse(gpxBytes)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid GPX file format"), http.StatusBadRequest)
+		return
+	}
+	if len(line) < 2 {
+		s.errorJSON(w, errors.New("GPX file must contain a route or track with at least two points"), http.StatusBadRequest)
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+
+	course := &database.Course{
+		Name:          name,
+		Geometry:      make([][2]float64, len(line)),
+		Distance:      gpx.PathDistance(line),
+		CreatorUserID: userID,
+	}
+	for i, p := range line {
+		course.Geometry[i] = [2]float64{p.Lat, p.Lon}
+	}
+
+	var newCourse *database.Course
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		var err error
+		newCourse, err = s.db.CreateCourse(tx, course)
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to create course"), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, envelope{"course": toCourseResponse(newCourse)})
+}
+
+// handleGetCourse returns a single course including its geometry.
+func (s *Server) handleGetCourse(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	courseID, err := strconv.ParseInt(chi.URLParam(r, "courseID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid course ID"), http.StatusBadRequest)
+		return
+	}
+
+	course, err := s.db.GetCourseByID(groupDB, courseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("course not found"), http.StatusNotFound)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"course": toCourseResponse(course)})
+}
+
+// handleDeleteCourse deletes a course. Events run on it keep their checkpoints
+// but no longer have a course line. Only the course creator can delete it.
+func (s *Server) handleDeleteCourse(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	courseID, err := strconv.ParseInt(chi.URLParam(r, "courseID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid course ID"), http.StatusBadRequest)
+		return
+	}
+
+	course, err := s.db.GetCourseByID(groupDB, courseID)
+	if err != nil {
+		s.errorJSON(w, errors.New("course not found"), http.StatusNotFound)
+		return
+	}
+	if course.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the course creator can delete this course"), http.StatusForbidden)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.DeleteCourse(tx, courseID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete course"), http.StatusInternalServerError)
+		return
+	}
+	s.invalidateGroupPredictors(groupID)
+
+	s.writeJSON(w, http.StatusOK, envelope{"message": "course deleted successfully"})
+}
+
+// handleGetWind returns the wind entered for an event to the members of its group.
+func (s *Server) handleGetWind(w http.ResponseWriter, r *http.Request) {
+	if _, _, _, ok := s.loadGroupForMember(w, r); !ok {
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	samples, err := s.db.GetWindByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"wind": toWindResponseList(samples)})
+}
+
+// handleSetWind sets the wind for a sailing event, either as a constant
+// direction or as a time series. Only the event creator can change it.
+func (s *Server) handleSetWind(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	if event.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the event creator can set the wind"), http.StatusForbidden)
+		return
+	}
+	if event.Sport != sport.Sailing {
+		s.errorJSON(w, errors.New("wind can only be set for sailing events"), http.StatusBadRequest)
+		return
+	}
+
+	var payload setWindPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+
+	var samples []*database.WindSample
+	switch {
+	case payload.Direction != nil && len(payload.Series) > 0:
+		s.errorJSON(w, errors.New("provide either a constant direction or a series, not both"), http.StatusBadRequest)
+		return
+
+	case payload.Direction != nil:
+		if err := validateWind(*payload.Direction, payload.Speed); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		samples = append(samples, &database.WindSample{
+			Direction: *payload.Direction,
+			Speed:     toNullFloat64(payload.Speed),
+		})
+
+	case len(payload.Series) > 0:
+		// Time trial tracks are re-timed to a common start, so wall-clock wind
+		// observations can't be matched to them.
+		if event.EventType == "time_trial" {
+			s.errorJSON(w, errors.New("time trials only support a constant wind direction"), http.StatusBadRequest)
+			return
+		}
+		for i, sample := range payload.Series {
+			if sample.Timestamp.IsZero() {
+				s.errorJSON(w, fmt.Errorf("wind sample %d has no timestamp", i+1), http.StatusBadRequest)
+				return
+			}
+			if err := validateWind(sample.Direction, sample.Speed); err != nil {
+				s.errorJSON(w, fmt.Errorf("wind sample %d: %w", i+1, err), http.StatusBadRequest)
+				return
+			}
+			samples = append(samples, &database.WindSample{
+				Timestamp: sql.NullTime{Time: sample.Timestamp.UTC(), Valid: true},
+				Direction: sample.Direction,
+				Speed:     toNullFloat64(sample.Speed),
+			})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].Timestamp.Time.Before(samples[j].Timestamp.Time) })
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ReplaceWind(tx, event.ID, samples)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to save wind"), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"wind": toWindResponseList(samples)})
+}
+
+// --- Helpers ---
+
+// validateWind checks a wind direction (degrees) and optional speed (knots).
+func validateWind(direction float64, speed *float64) error {
+	if direction < 0 || direction >= 360 {
+		return errors.New("wind direction must be between 0 and 360 degrees")
+	}
+	if speed != nil && *speed < 0 {
+		return errors.New("wind speed cannot be negative")
+	}
+	return nil
+}
+
+// toNullFloat64 converts an optional value into its nullable database form.
+func toNullFloat64(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+// sailingInputs converts an event's stored wind and checkpoints into the form
+// used by the sailing analysis. The wind is nil if none has been entered.
+func sailingInputs(samples []*database.WindSample, checkpoints []*database.Checkpoint) (*sailing.Wind, []sailing.Mark) {
+	windSamples := make([]sailing.WindSample, len(samples))
+	for i, ws := range samples {
+		windSamples[i] = sailing.WindSample{Time: ws.Timestamp.Time, Direction: ws.Direction}
+	}
+
+	marks := make([]sailing.Mark, len(checkpoints))
+	for i, cp := range checkpoints {
+		marks[i] = sailing.Mark{Name: cp.Name, Lat: cp.Lat, Lon: cp.Lon, Radius: cp.Radius}
+	}
+	return sailing.NewWind(windSamples), marks
+}
+
+// loadGroupForMember parses the groupID URL parameter, checks that the
+// requesting user is a member of the group and opens the group's database. If
+// anything fails, the error response has already been written and ok is false.
+func (s *Server) loadGroupForMember(w http.ResponseWriter, r *http.Request) (groupID int64, groupDB *sql.DB, userID int64, ok bool) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return 0, nil, 0, false
+	}
+	groupID, err = strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid group ID"), http.StatusBadRequest)
+		return 0, nil, 0, false
+	}
+
+	isMember, err := s.db.IsUserGroupMember(s.db.GetMainDB(), groupID, userID)
+	if err != nil || !isMember {
+		s.errorJSON(w, errors.New("forbidden: you are not a member of this group"), http.StatusForbidden)
+		return 0, nil, 0, false
+	}
+
+	groupDB, err = s.db.GetGroupDB(groupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return 0, nil, 0, false
+	}
+	return groupID, groupDB, userID, true
+}
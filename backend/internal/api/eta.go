@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/sport"
+)
+
+// predictorEntry holds the ETA predictor of a live event once it is built.
+// The predictor is nil for an event without a course to measure progress along.
+type predictorEntry struct {
+	ready     chan struct{} // Closed once predictor and err are set
+	predictor *live.Predictor
+	err       error
+}
+
+// eventPredictor returns the ETA predictor of a live event, building it on
+// first use. Only the first caller for an event builds it, without holding
+// predictorsMu, so live events don't wait for each other; later callers wait
+// for it to be ready. It returns nil if the event has no course to measure
+// progress along.
+func (s *Server) eventPredictor(groupDB *sql.DB, event *database.Event) (*live.Predictor, error) {
+	key := eventKey(event)
+	s.predictorsMu.Lock()
+	entry, ok := s.predictors[key]
+	if !ok {
+		entry = &predictorEntry{ready: make(chan struct{})}
+		s.predictors[key] = entry
+	}
+	s.predictorsMu.Unlock()
+
+	if ok {
+		<-entry.ready
+		return entry.predictor, entry.err
+	}
+
+	entry.predictor, entry.err = s.buildPredictor(groupDB, event)
+	if entry.err != nil {
+		// Let the next position try again.
+		s.predictorsMu.Lock()
+		if s.predictors[key] == entry {
+			delete(s.predictors, key)
+		}
+		s.predictorsMu.Unlock()
+	}
+	close(entry.ready)
+	return entry.predictor, entry.err
+}
+
+// buildPredictor builds the ETA predictor of a live event from the event's
+// course and checkpoints and replays the positions received so far. It returns
+// nil if the event has no course to measure progress along.
+func (s *Server) buildPredictor(groupDB *sql.DB, event *database.Event) (*live.Predictor, error) {
+	course, err := s.liveCourse(groupDB, event)
+	if err != nil || course == nil {
+		return nil, err
+	}
+
+	predictor := live.NewPredictor(course, sport.Get(event.Sport).MaxSpeed)
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, racer := range racers {
+		positions, err := s.db.GetLivePositions(groupDB, racer.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range positions {
+			predictor.Update(racer.ID, p.Timestamp, p.Lat, p.Lon)
+		}
+	}
+	return predictor, nil
+}
+
+// publishPrediction refines a racer's ETA prediction with a new position and
+// queues it for the event's spectators.
+func (s *Server) publishPrediction(groupDB *sql.DB, event *database.Event, position *database.LivePosition) {
+	predictor, err := s.eventPredictor(groupDB, event)
+	if err != nil {
+		log.Printf("WARN: could not build ETA predictor for event %d: %v", event.ID, err)
+		return
+	}
+	if predictor == nil {
+		return
+	}
+	prediction := predictor.Update(position.RacerID, position.Timestamp, position.Lat, position.Lon)
+	s.broker.QueueEventUpdate(eventKey(event), "predictions", position.RacerID, prediction)
+}
+
+// invalidatePredictor discards an event's predictor after its course or
+// checkpoints change, so that the next position rebuilds it, or once the event
+// is finalized and no more positions arrive.
+func (s *Server) invalidatePredictor(event *database.Event) {
+	s.predictorsMu.Lock()
+	defer s.predictorsMu.Unlock()
+	delete(s.predictors, eventKey(event))
+}
+
+// invalidateGroupPredictors discards the predictors of every event in a group,
+// e.g. after one of its courses is deleted.
+func (s *Server) invalidateGroupPredictors(groupID int64) {
+	s.predictorsMu.Lock()
+	defer s.predictorsMu.Unlock()
+	for key := range s.predictors {
+		if key.GroupID == groupID {
+			delete(s.predictors, key)
+		}
+	}
+}
+
+// liveCourse builds the course used to measure progress in a live event: the
+// event's course line if it has one, otherwise its checkpoints joined by
+// straight legs.
+func (s *Server) liveCourse(groupDB *sql.DB, event *database.Event) (*live.Course, error) {
+	var line []gpx.TrackPoint
+	if event.CourseID.Valid {
+		course, err := s.db.GetCourseByID(groupDB, event.CourseID.Int64)
+		if err != nil {
+			return nil, err
+		}
+		line = courseLine(course)
+	}
+
+	checkpoints, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	liveCheckpoints := make([]live.Checkpoint, len(checkpoints))
+	for i, cp := range checkpoints {
+		liveCheckpoints[i] = live.Checkpoint{Sequence: cp.Sequence, Name: cp.Name, Lat: cp.Lat, Lon: cp.Lon}
+	}
+	return live.NewCourse(line, liveCheckpoints), nil
+}
+
+// courseLine converts a stored course geometry into track points.
+func courseLine(course *database.Course) []gpx.TrackPoint {
+	line := make([]gpx.TrackPoint, len(course.Geometry))
+	for i, ll := range course.Geometry {
+		line[i] = gpx.TrackPoint{Lat: ll[0], Lon: ll[1]}
+	}
+	return line
+}
@@ -12,7 +12,14 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/dem"
+	"github.com/intermernet/raceviz/internal/gliding"
 	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/handicap"
+	"github.com/intermernet/raceviz/internal/sailing"
+	"github.com/intermernet/raceviz/internal/sport"
+	"github.com/intermernet/raceviz/internal/teams"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -26,11 +33,69 @@ type createEventPayload struct {
 	StartDate string `json:"startDate,omitempty"`
 	EndDate   string `json:"endDate,omitempty"`
 	EventType string `json:"eventType"` // "race" or "time_trial"
+	Sport     string `json:"sport,omitempty"`
+	CourseID  int64  `json:"courseId,omitempty"` // One of the group's courses
+
+	// Optional processing settings.
+	MapMatching   bool   `json:"mapMatching,omitempty"`
+	ElevationMode string `json:"elevationMode,omitempty"` // "gps" (default), "dem" or "blend"
+}
+
+// updateEventPayload defines the structure for updating an event's settings.
+// Fields that are omitted (null) are left unchanged.
+type updateEventPayload struct {
+	Name          *string `json:"name"`
+	Sport         *string `json:"sport"`
+	MapMatching   *bool   `json:"mapMatching"`
+	ElevationMode *string `json:"elevationMode"`
+	CourseID      *int64  `json:"courseId"` // 0 detaches the event from its course
+
+	// Safety alert thresholds for live tracking; 0 turns an alert off.
+	StationaryAlertMinutes *int     `json:"stationaryAlertMinutes"`
+	OffCourseAlertMeters   *float64 `json:"offCourseAlertMeters"`
+	OffCourseAlertMinutes  *int     `json:"offCourseAlertMinutes"` // 0 alerts on the first position off course
+	SilenceAlertMinutes    *int     `json:"silenceAlertMinutes"`
+
+	// Team scoring. A zero exchange zone radius removes the exchange zone.
+	TeamScoring  *string              `json:"teamScoring"` // "sum", "first" or "relay"
+	TeamCounted  *int                 `json:"teamCounted"`
+	ExchangeZone *exchangeZonePayload `json:"exchangeZone"`
+
+	// Handicapping. An empty age-grading table uses the default one.
+	HandicapSystem    *string              `json:"handicapSystem"` // "", "factor", "age", "class" or "pursuit"
+	AgeGrades         *[]database.AgeGrade `json:"ageGrades"`
+	ClassCoefficients *map[string]float64  `json:"classCoefficients"`
+
+	// Self-service registration.
+	Registration *registrationSettingsPayload `json:"registration"`
+}
+
+// exchangeZonePayload is where the legs of a relay are handed over.
+type exchangeZonePayload struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Radius float64 `json:"radius"` // Meters
 }
 
 // addRacerPayload defines the structure for adding a racer to an event.
 type addRacerPayload struct {
 	RacerName string `json:"racerName"`
+	racerDetailsPayload
+}
+
+// racerDetailsPayload holds a racer's optional entry details. When updating a
+// racer, omitted fields are left unchanged.
+type racerDetailsPayload struct {
+	Bib         *string `json:"bib"`
+	Category    *string `json:"category"`
+	Club        *string `json:"club"`
+	Nationality *string `json:"nationality"` // 2 or 3 letter country code
+
+	// Handicap details. A zero factor or age removes it.
+	HandicapFactor *float64 `json:"handicapFactor"`
+	Age            *int64   `json:"age"`
+	Class          *string  `json:"class"`
+	StartOffset    *float64 `json:"startOffset"` // Seconds after the event start, for pursuits
 }
 
 // publicEventDataResponse is the DTO for the public-facing map data.
@@ -39,6 +104,24 @@ type publicEventDataResponse struct {
 	Users  []UserResponse  `json:"users"`
 	Racers []RacerResponse `json:"racers"`
 	Paths  []gpx.TrackPath `json:"paths"`
+
+	// Course and conditions. Sailing analysis is only present for sailing
+	// events once a wind direction has been entered, and gliding analysis for
+	// gliding events with altitudes.
+	Course      *CourseResponse      `json:"course,omitempty"`
+	Checkpoints []CheckpointResponse `json:"checkpoints"`
+	Wind        []WindSampleResponse `json:"wind,omitempty"`
+	Sailing     []*sailing.Stats     `json:"sailing,omitempty"`
+	Gliding     []*gliding.Stats     `json:"gliding,omitempty"`
+
+	// Teams and their standings, if the event has teams. For relays, each
+	// team's legs show which racer is on course at any time of the replay.
+	Teams         []TeamResponse   `json:"teams,omitempty"`
+	TeamStandings []teams.Standing `json:"teamStandings,omitempty"`
+
+	// Ghosts the signed-in viewer races against in a time trial. They are
+	// replayed with the racers but never ranked.
+	Ghosts []ghostTrackResponse `json:"ghosts,omitempty"`
 }
 
 // --- HTTP Handlers ---
@@ -142,7 +225,54 @@ func (s *Server) handleCreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newEvent, err := s.db.CreateEvent(groupDB, groupID, payload.Name, startDate, endDate, payload.EventType, creatorID)
+	if payload.MapMatching && s.mapNetwork == nil {
+		s.errorJSON(w, errors.New("map matching is not available on this server"), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Sport == "" {
+		payload.Sport = sport.Generic
+	}
+	if !sport.Valid(payload.Sport) {
+		s.errorJSON(w, errors.New("unknown sport"), http.StatusBadRequest)
+		return
+	}
+
+	if payload.ElevationMode == "" {
+		payload.ElevationMode = dem.ModeGPS
+	}
+	if err := s.validateElevationMode(payload.ElevationMode); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if payload.CourseID != 0 {
+		if _, err := s.db.GetCourseByID(groupDB, payload.CourseID); err != nil {
+			s.errorJSON(w, errors.New("course not found"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	event := &database.Event{
+		GroupID:       groupID,
+		Name:          payload.Name,
+		EventType:     payload.EventType,
+		Sport:         payload.Sport,
+		CreatorUserID: creatorID,
+		MapMatching:   payload.MapMatching,
+		ElevationMode: payload.ElevationMode,
+	}
+	if startDate != nil {
+		event.StartDate = sql.NullTime{Time: *startDate, Valid: true}
+	}
+	if endDate != nil {
+		event.EndDate = sql.NullTime{Time: *endDate, Valid: true}
+	}
+	if payload.CourseID != 0 {
+		event.CourseID = sql.NullInt64{Int64: payload.CourseID, Valid: true}
+	}
+
+	newEvent, err := s.db.CreateEvent(groupDB, event)
 	if err != nil {
 		s.errorJSON(w, errors.New("failed to create event"), http.StatusInternalServerError)
 		return
@@ -152,6 +282,221 @@ func (s *Server) handleCreateEvent(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusCreated, envelope{"event": eventResponse})
 }
 
+// handleUpdateEvent updates the settings of an existing event.
+// Only the event creator can change an event.
+func (s *Server) handleUpdateEvent(w http.ResponseWriter, r *http.Request) {
+	updaterID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid group ID"), http.StatusBadRequest)
+		return
+	}
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid event ID"), http.StatusBadRequest)
+		return
+	}
+
+	var payload updateEventPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+
+	groupDB, err := s.db.GetGroupDB(groupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := s.db.GetEventByID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+	if event.CreatorUserID != updaterID {
+		s.errorJSON(w, errors.New("forbidden: only the event creator can update this event"), http.StatusForbidden)
+		return
+	}
+	before := *event
+
+	// Apply only the fields that were provided.
+	if payload.Name != nil {
+		if *payload.Name == "" {
+			s.errorJSON(w, errors.New("name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		event.Name = *payload.Name
+	}
+	if payload.Sport != nil {
+		if !sport.Valid(*payload.Sport) {
+			s.errorJSON(w, errors.New("unknown sport"), http.StatusBadRequest)
+			return
+		}
+		event.Sport = *payload.Sport
+	}
+	if payload.MapMatching != nil {
+		if *payload.MapMatching && s.mapNetwork == nil {
+			s.errorJSON(w, errors.New("map matching is not available on this server"), http.StatusBadRequest)
+			return
+		}
+		event.MapMatching = *payload.MapMatching
+	}
+	if payload.ElevationMode != nil {
+		if err := s.validateElevationMode(*payload.ElevationMode); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		event.ElevationMode = *payload.ElevationMode
+	}
+	previousCourse := event.CourseID
+	if payload.CourseID != nil {
+		if *payload.CourseID == 0 {
+			event.CourseID = sql.NullInt64{}
+		} else {
+			if _, err := s.db.GetCourseByID(groupDB, *payload.CourseID); err != nil {
+				s.errorJSON(w, errors.New("course not found"), http.StatusBadRequest)
+				return
+			}
+			event.CourseID = sql.NullInt64{Int64: *payload.CourseID, Valid: true}
+		}
+	}
+	if payload.StationaryAlertMinutes != nil {
+		if *payload.StationaryAlertMinutes < 0 {
+			s.errorJSON(w, errors.New("stationaryAlertMinutes cannot be negative"), http.StatusBadRequest)
+			return
+		}
+		event.StationaryAlertMinutes = *payload.StationaryAlertMinutes
+	}
+	if payload.OffCourseAlertMeters != nil {
+		if *payload.OffCourseAlertMeters < 0 {
+			s.errorJSON(w, errors.New("offCourseAlertMeters cannot be negative"), http.StatusBadRequest)
+			return
+		}
+		event.OffCourseAlertMeters = *payload.OffCourseAlertMeters
+	}
+	if payload.OffCourseAlertMinutes != nil {
+		if *payload.OffCourseAlertMinutes < 0 {
+			s.errorJSON(w, errors.New("offCourseAlertMinutes cannot be negative"), http.StatusBadRequest)
+			return
+		}
+		event.OffCourseAlertMinutes = *payload.OffCourseAlertMinutes
+	}
+	if payload.SilenceAlertMinutes != nil {
+		if *payload.SilenceAlertMinutes < 0 {
+			s.errorJSON(w, errors.New("silenceAlertMinutes cannot be negative"), http.StatusBadRequest)
+			return
+		}
+		event.SilenceAlertMinutes = *payload.SilenceAlertMinutes
+	}
+	if payload.TeamScoring != nil {
+		if !teams.ValidScoring(*payload.TeamScoring) {
+			s.errorJSON(w, errors.New("teamScoring must be 'sum', 'first' or 'relay'"), http.StatusBadRequest)
+			return
+		}
+		event.TeamScoring = *payload.TeamScoring
+	}
+	if payload.TeamCounted != nil {
+		if *payload.TeamCounted < 1 {
+			s.errorJSON(w, errors.New("teamCounted must be at least 1"), http.StatusBadRequest)
+			return
+		}
+		event.TeamCounted = *payload.TeamCounted
+	}
+	if zone := payload.ExchangeZone; zone != nil {
+		switch {
+		case zone.Radius == 0:
+			event.ExchangeLat, event.ExchangeLon = sql.NullFloat64{}, sql.NullFloat64{}
+		case zone.Radius < 0 || zone.Lat < -90 || zone.Lat > 90 || zone.Lon < -180 || zone.Lon > 180:
+			s.errorJSON(w, errors.New("invalid exchange zone"), http.StatusBadRequest)
+			return
+		default:
+			event.ExchangeLat = sql.NullFloat64{Float64: zone.Lat, Valid: true}
+			event.ExchangeLon = sql.NullFloat64{Float64: zone.Lon, Valid: true}
+			event.ExchangeRadius = zone.Radius
+		}
+	}
+
+	if payload.HandicapSystem != nil {
+		if !handicap.ValidSystem(*payload.HandicapSystem) {
+			s.errorJSON(w, errors.New("handicapSystem must be '', 'factor', 'age', 'class' or 'pursuit'"), http.StatusBadRequest)
+			return
+		}
+		if *payload.HandicapSystem == handicap.SystemPursuit && event.EventType != "race" {
+			s.errorJSON(w, errors.New("pursuit handicaps need a mass start race"), http.StatusBadRequest)
+			return
+		}
+		event.HandicapSystem = *payload.HandicapSystem
+	}
+	if payload.AgeGrades != nil {
+		if err := handicap.ValidateAgeGrades(handicapAgeGrades(*payload.AgeGrades)); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		event.AgeGrades = *payload.AgeGrades
+	}
+	if payload.ClassCoefficients != nil {
+		if err := handicap.ValidateClasses(*payload.ClassCoefficients); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		event.ClassCoefficients = *payload.ClassCoefficients
+	}
+	if payload.Registration != nil {
+		if err := applyRegistrationSettings(event, *payload.Registration); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		if err := s.db.UpdateEvent(tx, event); err != nil {
+			return err
+		}
+		return s.recordHandicapRuleChanges(tx, updaterID, &before, event)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to update event"), http.StatusInternalServerError)
+		return
+	}
+	s.invalidatePredictor(event)
+	if event.CourseID != previousCourse {
+		// Course results count towards course records.
+		go s.refreshEventBestEfforts(groupDB, event)
+	}
+	if payload.Registration != nil {
+		// A raised capacity gives places to the waitlist.
+		if err := s.fillEventPlaces(event); err != nil {
+			log.Printf("WARN: could not promote the waitlist of event %d: %v", event.ID, err)
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"event": toEventResponse(event)})
+}
+
+// handleGetSports lists the available sports and the metrics and display units
+// used for each of them.
+func (s *Server) handleGetSports(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, envelope{"sports": sport.All()})
+}
+
+// validateElevationMode checks that an elevation mode is known and, for modes
+// that need terrain data, that DEM tiles have been configured on this server.
+func (s *Server) validateElevationMode(mode string) error {
+	if !dem.ValidMode(mode) {
+		return errors.New("elevationMode must be 'gps', 'dem' or 'blend'")
+	}
+	if mode != dem.ModeGPS && s.demSource == nil {
+		return errors.New("elevation correction is not available on this server")
+	}
+	return nil
+}
+
 // handleDeleteEvent handles deleting an event, its racers, and their associated GPX files.
 func (s *Server) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
 	deleterID, err := s.getUserIDFromContext(r)
@@ -179,30 +524,42 @@ func (s *Server) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	racers, err := s.db.GetRacersByEventID(groupDB, eventID)
+	trackFiles, err := s.db.GetTrackFilesByEventID(groupDB, eventID)
 	if err != nil {
-		s.errorJSON(w, errors.New("could not retrieve racers for cleanup"), http.StatusInternalServerError)
+		s.errorJSON(w, errors.New("could not retrieve track files for cleanup"), http.StatusInternalServerError)
 		return
 	}
 
-	if err := s.db.DeleteEvent(groupDB, eventID); err != nil {
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.DeleteEvent(tx, eventID)
+	})
+	if err != nil {
 		s.errorJSON(w, errors.New("failed to delete event records"), http.StatusInternalServerError)
 		return
 	}
+	s.invalidatePredictor(event)
+	err = s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		if err := s.db.DeleteUploadLinksForEvent(tx, groupID, eventID); err != nil {
+			return err
+		}
+		return s.db.DeleteDeviceTokensForEvent(tx, groupID, eventID)
+	})
+	if err != nil {
+		log.Printf("WARN: failed to revoke device tokens and upload links for event %d: %v", eventID, err)
+	}
 
-	for _, racer := range racers {
-		if racer.GpxFilePath.Valid {
-			filePath := filepath.Join(s.config.GpxPath, racer.GpxFilePath.String)
-			if err := os.Remove(filePath); err != nil {
-				log.Printf("WARN: failed to delete gpx file %s: %v", filePath, err)
-			}
+	for _, f := range trackFiles {
+		filePath := filepath.Join(s.config.GpxPath, f.FilePath)
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("WARN: failed to delete gpx file %s: %v", filePath, err)
 		}
 	}
 
 	s.writeJSON(w, http.StatusOK, envelope{"message": "event deleted successfully"})
 }
 
-// handleGetPublicEventData provides all necessary data for the map view.
+// handleGetPublicEventData provides all necessary data for the map view. A
+// signed-in viewer also gets the ghosts they picked.
 func (s *Server) handleGetPublicEventData(w http.ResponseWriter, r *http.Request) {
 	groupID, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
 	if err != nil {
@@ -238,6 +595,9 @@ func (s *Server) handleGetPublicEventData(w http.ResponseWriter, r *http.Request
 	uploaderIDs := make(map[int64]struct{})
 	for _, racer := range racers {
 		uploaderIDs[racer.UploaderUserID] = struct{}{}
+		if racer.UserID.Valid {
+			uploaderIDs[racer.UserID.Int64] = struct{}{}
+		}
 	}
 	dbUsers, err := s.db.GetUsersByIDs(s.db.GetMainDB(), uploaderIDs)
 	if err != nil {
@@ -246,36 +606,130 @@ func (s *Server) handleGetPublicEventData(w http.ResponseWriter, r *http.Request
 	}
 	userResponses := toUserResponseList(dbUsers)
 
+	checkpoints, err := s.db.GetCheckpointsByEventID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	windSamples, err := s.db.GetWindByEventID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	var course *CourseResponse
+	if event.CourseID.Valid {
+		dbCourse, err := s.db.GetCourseByID(groupDB, event.CourseID.Int64)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		courseResponse := toCourseResponse(dbCourse)
+		course = &courseResponse
+	}
+
+	var wind *sailing.Wind
+	var marks []sailing.Mark
+	if event.Sport == sport.Sailing {
+		wind, marks = sailingInputs(windSamples, checkpoints)
+	}
+
 	racerColorMap := make(map[int64]string)
 	for _, racer := range racers {
 		racerColorMap[racer.ID] = racer.TrackColor
 	}
 
 	var trackPaths []gpx.TrackPath
+	var sailingStats []*sailing.Stats
+	var glidingStats []*gliding.Stats
+	racerPaths := make(map[int64]*gpx.TrackPath, len(racers))
 	for _, racer := range racers {
-		if !racer.GpxFilePath.Valid {
-			continue
-		}
-		fullPath := filepath.Join(s.config.GpxPath, racer.GpxFilePath.String)
-		processedPath, err := gpx.ProcessFile(fullPath, event.EventType, racer.ID)
+		processedPath, err := s.processRacerTrack(event, racer)
 		if err != nil {
-			log.Printf("WARN: could not process GPX file %s for event %d: %v", racer.GpxFilePath.String, event.ID, err)
+			log.Printf("WARN: could not process track of racer %d for event %d: %v", racer.ID, event.ID, err)
 			continue
 		}
+		racerPaths[racer.ID] = processedPath
 		if processedPath != nil {
 			if color, ok := racerColorMap[racer.ID]; ok {
 				processedPath.TrackColor = color
 			}
+			if stats := sailing.Analyze(processedPath, wind, marks); stats != nil {
+				sailingStats = append(sailingStats, stats)
+			}
+			if event.Sport == sport.Gliding {
+				if stats := gliding.Analyze(processedPath); stats != nil {
+					glidingStats = append(glidingStats, stats)
+				}
+			}
 			trackPaths = append(trackPaths, *processedPath)
 		}
 	}
 
+	eventTeams, err := s.db.GetTeamsByEventID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	teamStandings, err := s.teamStandings(groupDB, event, eventTeams, racers, racerPaths)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
 	response := publicEventDataResponse{
 		Event:  toEventResponse(event),
 		Users:  userResponses,
 		Racers: racerResponses,
 		Paths:  trackPaths,
+
+		Course:      course,
+		Checkpoints: toCheckpointResponseList(checkpoints),
+		Wind:        toWindResponseList(windSamples),
+		Sailing:     sailingStats,
+		Gliding:     glidingStats,
+
+		Teams:         toTeamResponseList(eventTeams, racers),
+		TeamStandings: teamStandings,
+	}
+	if viewerID, err := s.getUserIDFromContext(r); err == nil {
+		response.Ghosts, err = s.ghostTracks(groupDB, event, viewerID, racerPaths)
+		if err != nil {
+			log.Printf("WARN: could not load ghosts of user %d for event %d: %v", viewerID, event.ID, err)
+		}
 	}
 
 	s.writeJSON(w, http.StatusOK, response)
 }
+
+// loadEventFromURL parses the groupID and eventID URL parameters and loads the
+// event from the group's database. If anything fails, the error response has
+// already been written and ok is false.
+func (s *Server) loadEventFromURL(w http.ResponseWriter, r *http.Request) (groupDB *sql.DB, event *database.Event, ok bool) {
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid group ID"), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid event ID"), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	groupDB, err = s.db.GetGroupDB(groupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	event, err = s.db.GetEventByID(groupDB, eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+			return nil, nil, false
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return groupDB, event, true
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/results"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Structs for JSON Payloads ---
+
+// addGhostPayload picks a racer from another event on the same course to race against.
+type addGhostPayload struct {
+	SourceRacerID int64 `json:"sourceRacerId"`
+}
+
+// ghostCandidate is a past effort on an event's course that can be raced as a ghost.
+type ghostCandidate struct {
+	RacerID      int64     `json:"racerId"`
+	RacerName    string    `json:"racerName"`
+	EventID      int64     `json:"eventId"`
+	EventName    string    `json:"eventName"`
+	Time         float64   `json:"time"` // Seconds
+	StartedAt    time.Time `json:"startedAt"`
+	Own          bool      `json:"own"`          // Raced by the same user as the racer
+	CourseRecord bool      `json:"courseRecord"` // The fastest effort on the course
+}
+
+// ghostTrackResponse is a ghost in an event's replay, aligned to start with
+// the racer it is raced against. Ghosts are never ranked.
+type ghostTrackResponse struct {
+	GhostResponse
+	Path gpx.TrackPath `json:"path"`
+}
+
+// --- HTTP Handlers ---
+
+// handleGetGhostCandidates lists the past efforts on a time trial's course that
+// a racer can race against, fastest first: the racer's own earlier efforts and
+// everyone else's, including the course record.
+func (s *Server) handleGetGhostCandidates(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	if !s.checkGhostEvent(w, event) {
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+	efforts, err := s.db.GetCourseEfforts(groupDB, event.CourseID.Int64, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	candidates := []ghostCandidate{}
+	for _, e := range efforts {
+		source, err := s.db.GetRacerByID(groupDB, e.RacerID)
+		if err != nil {
+			continue
+		}
+		sourceEvent, err := s.db.GetEventByID(groupDB, e.EventID)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, ghostCandidate{
+			RacerID:      source.ID,
+			RacerName:    source.RacerName,
+			EventID:      sourceEvent.ID,
+			EventName:    sourceEvent.Name,
+			Time:         e.Seconds,
+			StartedAt:    e.StartedAt.UTC(),
+			Own:          racer.UserID.Valid && e.UserID == racer.UserID.Int64,
+			CourseRecord: e.Seconds == efforts[0].Seconds,
+		})
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"candidates": candidates})
+}
+
+// handleGetGhosts lists the ghosts the requesting user races a racer against.
+func (s *Server) handleGetGhosts(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+	ghosts, err := s.db.GetGhosts(groupDB, event.ID, userID, racer.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	list := make([]GhostResponse, 0, len(ghosts))
+	for _, g := range ghosts {
+		source, sourceEvent, err := s.ghostSource(groupDB, g)
+		if err != nil {
+			continue
+		}
+		list = append(list, toGhostResponse(g, source, sourceEvent))
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"ghosts": list})
+}
+
+// handleAddGhost picks a racer from another event on the same course as a
+// ghost to race a time trial racer against. The ghost shows in the requesting
+// user's replay of the event.
+func (s *Server) handleAddGhost(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	if !s.checkGhostEvent(w, event) {
+		return
+	}
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+
+	var payload addGhostPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	source, err := s.db.GetRacerByID(groupDB, payload.SourceRacerID)
+	if err != nil {
+		s.errorJSON(w, errors.New("ghost racer not found"), http.StatusBadRequest)
+		return
+	}
+	sourceEvent, err := s.db.GetEventByID(groupDB, source.EventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("ghost racer not found"), http.StatusBadRequest)
+		return
+	}
+	if sourceEvent.ID == event.ID {
+		s.errorJSON(w, errors.New("the ghost must come from another event"), http.StatusBadRequest)
+		return
+	}
+	if sourceEvent.CourseID != event.CourseID {
+		s.errorJSON(w, errors.New("the ghost must come from an event on the same course"), http.StatusBadRequest)
+		return
+	}
+	if source.TrackFileCount == 0 {
+		s.errorJSON(w, errors.New("the ghost racer has no track"), http.StatusBadRequest)
+		return
+	}
+	existing, err := s.db.GetGhosts(groupDB, event.ID, userID, racer.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	for _, g := range existing {
+		if g.SourceRacerID == source.ID {
+			s.errorJSON(w, errors.New("this ghost has already been added"), http.StatusConflict)
+			return
+		}
+	}
+
+	var ghost *database.Ghost
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		var err error
+		ghost, err = s.db.AddGhost(tx, &database.Ghost{EventID: event.ID, RacerID: racer.ID, UserID: userID, SourceRacerID: source.ID})
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to add ghost"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"ghost": toGhostResponse(ghost, source, sourceEvent)})
+}
+
+// handleDeleteGhost removes one of the requesting user's ghosts.
+func (s *Server) handleDeleteGhost(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+	ghostID, err := strconv.ParseInt(chi.URLParam(r, "ghostID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid ghost ID"), http.StatusBadRequest)
+		return
+	}
+	ghost, err := s.db.GetGhostByID(groupDB, ghostID)
+	if err != nil || ghost.RacerID != racer.ID || ghost.UserID != userID {
+		s.errorJSON(w, errors.New("ghost not found"), http.StatusNotFound)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.DeleteGhost(tx, ghost.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete ghost"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "ghost deleted successfully"})
+}
+
+// --- Helpers ---
+
+// checkGhostEvent checks that ghosts can be raced in an event: a time trial on
+// a course. On failure the error response has already been written.
+func (s *Server) checkGhostEvent(w http.ResponseWriter, event *database.Event) bool {
+	if event.EventType != "time_trial" {
+		s.errorJSON(w, errors.New("ghosts can only be raced in time trials"), http.StatusBadRequest)
+		return false
+	}
+	if !event.CourseID.Valid {
+		s.errorJSON(w, errors.New("the event must have a course to race ghosts on"), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// ghostSource loads the racer a ghost replays and their event.
+func (s *Server) ghostSource(groupDB database.DBorTx, g *database.Ghost) (*database.Racer, *database.Event, error) {
+	source, err := s.db.GetRacerByID(groupDB, g.SourceRacerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sourceEvent, err := s.db.GetEventByID(groupDB, source.EventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, sourceEvent, nil
+}
+
+// ghostTracks returns the ghosts a viewer picked in a time trial, each aligned
+// with the racer it is raced against. Tracks start together as time trials are
+// normalized, or pass the first gate together if the event has gate timing.
+// racerPaths holds the processed tracks of the event's racers.
+func (s *Server) ghostTracks(groupDB database.DBorTx, event *database.Event, userID int64, racerPaths map[int64]*gpx.TrackPath) ([]ghostTrackResponse, error) {
+	if event.EventType != "time_trial" || !event.CourseID.Valid {
+		return nil, nil
+	}
+	ghosts, err := s.db.GetGhosts(groupDB, event.ID, userID, 0)
+	if err != nil || len(ghosts) == 0 {
+		return nil, err
+	}
+	checkpoints, err := s.resultCheckpoints(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []ghostTrackResponse
+	for _, g := range ghosts {
+		source, sourceEvent, err := s.ghostSource(groupDB, g)
+		if err != nil || sourceEvent.CourseID != event.CourseID {
+			continue // The ghost's event has since moved to another course.
+		}
+		path, err := s.processRacerTrack(sourceEvent, source)
+		if err != nil {
+			log.Printf("WARN: could not process ghost track of racer %d for event %d: %v", source.ID, event.ID, err)
+			continue
+		}
+		if path == nil || len(path.Points) == 0 {
+			continue
+		}
+
+		// A racer without a track yet starts at the epoch, like every normalized time trial.
+		start := time.Unix(0, 0).UTC()
+		if own := racerPaths[g.RacerID]; own != nil && len(own.Points) > 0 {
+			start = gateStart(own.Points, checkpoints)
+		}
+		shift := start.Sub(gateStart(path.Points, checkpoints))
+		for i := range path.Points {
+			path.Points[i].Timestamp = path.Points[i].Timestamp.Add(shift)
+		}
+		tracks = append(tracks, ghostTrackResponse{GhostResponse: toGhostResponse(g, source, sourceEvent), Path: *path})
+	}
+	return tracks, nil
+}
+
+// gateStart returns when a track starts for a time trial: when it first passes
+// the start gate if the course has gate timing (at least two checkpoints), or
+// else its first point.
+func gateStart(points []gpx.TrackPoint, checkpoints []results.Checkpoint) time.Time {
+	if len(checkpoints) >= 2 {
+		if passed := results.PassTimes(points, checkpoints); len(passed) > 0 {
+			return passed[0]
+		}
+	}
+	return points[0].Timestamp
+}
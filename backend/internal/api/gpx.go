@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -11,11 +13,23 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/igc"
+	"github.com/intermernet/raceviz/internal/nmea"
+	"github.com/intermernet/raceviz/internal/sport"
+
 	"github.com/go-chi/chi/v5"
-	"github.com/tkrajina/gpxgo/gpx"
+	gpxgo "github.com/tkrajina/gpxgo/gpx"
 )
 
+// igcTurnpointRadius is the cylinder radius given to turnpoints taken from an
+// IGC task declaration, which doesn't include radii.
+const igcTurnpointRadius = 400.0 // Meters
+
 // handleGpxUpload processes a GPX file upload for a specific racer in an event.
+// NMEA 0183 logs and IGC flight logs are also accepted and stored as GPX. The
+// file is added to the end of the racer's track files.
 // It performs authorization, validation based on event type, file storage, and updates the database.
 func (s *Server) handleGpxUpload(w http.ResponseWriter, r *http.Request) {
 	// --- 1. Authentication & Authorization ---
@@ -61,13 +75,13 @@ func (s *Server) handleGpxUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	racer, err := s.db.GetRacerByID(groupDB, racerID)
-	if err != nil {
+	if err != nil || racer.EventID != event.ID {
 		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
 		return
 	}
 
-	if uploaderID != racer.UploaderUserID && uploaderID != event.CreatorUserID {
-		s.errorJSON(w, errors.New("forbidden: you can only upload files for racers you created or as the event owner"), http.StatusForbidden)
+	if !canManageRacer(uploaderID, event, racer) {
+		s.errorJSON(w, errors.New("forbidden: you can only upload files for racers you created or raced as, or as the event owner"), http.StatusForbidden)
 		return
 	}
 
@@ -78,7 +92,7 @@ func (s *Server) handleGpxUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, _, err := r.FormFile("gpxFile")
+	file, header, err := r.FormFile("gpxFile")
 	if err != nil {
 		s.errorJSON(w, errors.New("invalid file upload"), http.StatusBadRequest)
 		return
@@ -86,29 +100,116 @@ func (s *Server) handleGpxUpload(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// --- 5. GPX Data Validation ---
-	gpxBytes, err := io.ReadAll(file)
+	data, err := io.ReadAll(file)
 	if err != nil {
 		s.errorJSON(w, errors.New("could not read uploaded file"), http.StatusInternalServerError)
 		return
 	}
+	upload, err := readTrackUpload(event, racer.RacerName, data)
+	if err != nil {
+		var uploadErr *trackUploadError
+		if errors.As(err, &uploadErr) {
+			s.errorJSON(w, uploadErr.err, uploadErr.status)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
 
-	gpxData, err := gpx.ParseBytes(gpxBytes)
+	// --- 6. Store the File & Update Database Record ---
+	trackFile, err := s.storeTrackFile(event, racer, uploaderID, filepath.Base(header.Filename), upload.gpxBytes)
 	if err != nil {
-		s.errorJSON(w, errors.New("invalid GPX file format"), http.StatusBadRequest)
+		s.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
+	newFileName := trackFile.FilePath
+
+	// Keep the event's bounding box and the spatial search index up to date.
+	if err := s.refreshRacerSpatialData(groupDB, event, racer.ID); err != nil {
+		log.Printf("WARN: could not update spatial data for event %d: %v", eventID, err)
+	}
+	if len(upload.turnpoints) > 0 {
+		if err := s.applyDeclaredTask(groupDB, event, upload.turnpoints); err != nil {
+			log.Printf("WARN: could not set checkpoints of event %d from IGC task: %v", eventID, err)
+		}
+	}
+	s.refreshBestEfforts(groupDB, event, racerID, true)
+
+	// --- 7. Success Response ---
+	s.writeJSON(w, http.StatusCreated, envelope{
+		"message":   "GPX file uploaded and linked to racer successfully",
+		"gpxPath":   newFileName,
+		"trackFile": toTrackFileResponse(trackFile),
+	})
+}
+
+// trackUpload is an uploaded track file, converted to GPX and validated.
+type trackUpload struct {
+	gpxBytes   []byte
+	gpx        *gpxgo.GPX
+	turnpoints []igc.Waypoint // Of a task declared in an IGC file
+}
+
+// trackUploadError is an uploaded track file that was rejected, with the HTTP
+// status that describes why.
+type trackUploadError struct {
+	status int
+	err    error
+}
+
+func (e *trackUploadError) Error() string { return e.err.Error() }
+
+// readTrackUpload converts an uploaded track file to GPX and validates it for
+// an event. NMEA and IGC logs are converted to a track called trackName; IGC
+// logs use the pilot's name if trackName is empty. Files that are rejected
+// return a *trackUploadError.
+func readTrackUpload(event *database.Event, trackName string, gpxBytes []byte) (*trackUpload, error) {
+	upload := &trackUpload{}
+
+	// Loggers that only record raw NMEA sentences are converted to GPX, so the
+	// rest of the pipeline only deals with one format. Logs without dates are
+	// assumed to be from the day of the race.
+	if nmea.IsLog(gpxBytes) {
+		points, err := nmea.ReadLog(bytes.NewReader(gpxBytes), event.StartDate.Time)
+		if err != nil {
+			return nil, &trackUploadError{http.StatusBadRequest, fmt.Errorf("invalid NMEA log: %w", err)}
+		}
+		if gpxBytes, err = gpx.Encode(trackName, points); err != nil {
+			return nil, errors.New("could not convert NMEA log")
+		}
+	}
+
+	// IGC flight logs are converted the same way. A task declared in the log
+	// becomes the event's course if it doesn't have checkpoints yet.
+	if igc.IsFile(gpxBytes) {
+		flight, err := igc.Decode(gpxBytes, event.StartDate.Time)
+		if err != nil {
+			return nil, &trackUploadError{http.StatusBadRequest, fmt.Errorf("invalid IGC file: %w", err)}
+		}
+		name := trackName
+		if name == "" {
+			name = flight.Pilot
+		}
+		if gpxBytes, err = gpx.Encode(name, flight.TrackPoints(flight.PreferredAltitude())); err != nil {
+			return nil, errors.New("could not convert IGC file")
+		}
+		upload.turnpoints = flight.Task.Turnpoints()
+	}
+
+	gpxData, err := gpxgo.ParseBytes(gpxBytes)
+	if err != nil {
+		return nil, &trackUploadError{http.StatusBadRequest, errors.New("invalid GPX file format")}
+	}
 
 	if len(gpxData.Tracks) == 0 || len(gpxData.Tracks[0].Segments) == 0 || len(gpxData.Tracks[0].Segments[0].Points) == 0 {
-		s.errorJSON(w, errors.New("GPX file contains no track points"), http.StatusBadRequest)
-		return
+		return nil, &trackUploadError{http.StatusBadRequest, errors.New("GPX file contains no track points")}
 	}
 
 	// --- Conditional Date Validation ---
 	// Only perform the strict date check if the event is a "race".
 	if event.EventType == "race" {
 		if !event.StartDate.Valid || !event.EndDate.Valid {
-			s.errorJSON(w, errors.New("cannot upload to a race event with no date range"), http.StatusInternalServerError)
-			return
+			return nil, errors.New("cannot upload to a race event with no date range")
 		}
 
 		firstPointTime := gpxData.Tracks[0].Segments[0].Points[0].Timestamp
@@ -119,46 +220,119 @@ func (s *Server) handleGpxUpload(w http.ResponseWriter, r *http.Request) {
 		if firstPointTime.Before(event.StartDate.Time.Add(-buffer)) || lastPointTime.After(event.EndDate.Time.Add(buffer)) {
 			msg := fmt.Sprintf("GPX track times are outside the event dates (%s to %s)",
 				event.StartDate.Time.Format(time.RFC822), event.EndDate.Time.Format(time.RFC822))
-			s.errorJSON(w, errors.New(msg), http.StatusBadRequest)
-			return
+			return nil, &trackUploadError{http.StatusBadRequest, errors.New(msg)}
 		}
 	}
 	// For "time_trial" events, no date validation is performed.
 
-	// --- 6. Store the File ---
-	if racer.GpxFilePath.Valid && racer.GpxFilePath.String != "" {
-		oldPath := filepath.Join(s.config.GpxPath, racer.GpxFilePath.String)
-		if err := os.Remove(oldPath); err != nil {
-			log.Printf("WARN: could not remove old gpx file %s: %v", oldPath, err)
-		}
-	}
+	upload.gpxBytes, upload.gpx = gpxBytes, gpxData
+	return upload, nil
+}
 
-	newFileName := fmt.Sprintf("group_%d_event_%d_racer_%d_%d.gpx", groupID, eventID, racerID, time.Now().UnixNano())
+// storeTrackFile saves a validated GPX file to disk and adds it to the end of
+// a racer's track files.
+func (s *Server) storeTrackFile(event *database.Event, racer *database.Racer, uploaderID int64, originalName string, gpxBytes []byte) (*database.TrackFile, error) {
+	newFileName := fmt.Sprintf("group_%d_event_%d_racer_%d_%d.gpx", event.GroupID, event.ID, racer.ID, time.Now().UnixNano())
 	newFilePath := filepath.Join(s.config.GpxPath, newFileName)
 
-	dst, err := os.Create(newFilePath)
+	if err := os.WriteFile(newFilePath, gpxBytes, 0644); err != nil {
+		return nil, errors.New("could not write file to disk")
+	}
+
+	var trackFile *database.TrackFile
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		var err error
+		trackFile, err = s.db.AddTrackFile(tx, racer.ID, uploaderID, newFileName, originalName)
+		return err
+	})
 	if err != nil {
-		s.errorJSON(w, errors.New("could not save file"), http.StatusInternalServerError)
-		return
+		os.Remove(newFilePath) // Attempt to clean up the file if the DB update fails.
+		return nil, errors.New("could not update racer record in database")
 	}
-	defer dst.Close()
+	return trackFile, nil
+}
 
-	if _, err := dst.Write(gpxBytes); err != nil {
-		s.errorJSON(w, errors.New("could not write file to disk"), http.StatusInternalServerError)
-		return
+// applyDeclaredTask uses the turnpoints of a task declared in an IGC file as
+// the event's checkpoints, unless the event already has checkpoints.
+func (s *Server) applyDeclaredTask(groupDB *sql.DB, event *database.Event, turnpoints []igc.Waypoint) error {
+	existing, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil || len(existing) > 0 {
+		return err
 	}
 
-	// --- 7. Update Database Record ---
-	err = s.db.UpdateRacerGpxFile(groupDB, racerID, newFileName)
+	checkpoints := make([]*database.Checkpoint, len(turnpoints))
+	for i, tp := range turnpoints {
+		name := tp.Name
+		if name == "" {
+			name = fmt.Sprintf("Turnpoint %d", i+1)
+		}
+		checkpoints[i] = &database.Checkpoint{Name: name, Lat: tp.Lat, Lon: tp.Lon, Radius: igcTurnpointRadius}
+	}
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ReplaceCheckpoints(tx, event.ID, checkpoints)
+	})
 	if err != nil {
-		os.Remove(newFilePath) // Attempt to clean up the file if the DB update fails.
-		s.errorJSON(w, errors.New("could not update racer record in database"), http.StatusInternalServerError)
-		return
+		return err
+	}
+	s.invalidatePredictor(event)
+	return nil
+}
+
+// readRacerTrack stitches a racer's stored track files together, in order, into
+// a single path. It returns nil for racers without track files.
+func (s *Server) readRacerTrack(groupDB database.DBorTx, event *database.Event, racer *database.Racer) (*gpx.TrackPath, error) {
+	if racer.TrackFileCount == 0 {
+		return nil, nil
+	}
+	files, err := s.db.GetTrackFilesByRacerID(groupDB, racer.ID)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(s.config.GpxPath, f.FilePath)
 	}
+	return gpx.ProcessFiles(paths, event.EventType, racer.ID)
+}
 
-	// --- 8. Success Response ---
-	s.writeJSON(w, http.StatusCreated, envelope{
-		"message": "GPX file uploaded and linked to racer successfully",
-		"gpxPath": newFileName,
-	})
+// processRacerTrack runs a racer's stored track files through the full processing
+// pipeline for an event: parsing, stitching and time normalization, followed by
+// any optional steps enabled for the event (map matching and elevation
+// correction) and the sport-specific spike filter and metrics. Racers without
+// track files use their live track, if they have one. It returns nil for racers
+// without a track or with an empty track.
+func (s *Server) processRacerTrack(event *database.Event, racer *database.Racer) (*gpx.TrackPath, error) {
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	var path *gpx.TrackPath
+	if racer.TrackFileCount > 0 {
+		path, err = s.readRacerTrack(groupDB, event, racer)
+		if err != nil || path == nil {
+			return path, err
+		}
+	} else {
+		points, err := s.liveTrackPoints(groupDB, racer.ID)
+		if err != nil || len(points) == 0 {
+			return nil, err
+		}
+		path = gpx.NewTrackPath(racer.ID, points)
+	}
+
+	profile := sport.Get(event.Sport)
+
+	// Remove GPS spikes before anything else, so they can't pull the track off the
+	// network. Then snap to the network, so that terrain lookups use the corrected
+	// positions. Metrics are calculated last, from the final points.
+	profile.FilterSpikes(path)
+	if event.MapMatching && s.mapNetwork != nil {
+		s.mapNetwork.MatchPath(path)
+	}
+	if s.demSource != nil {
+		s.demSource.Apply(path, event.ElevationMode)
+	}
+	profile.CalculateMetrics(path)
+
+	return path, nil
 }
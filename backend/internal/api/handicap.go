@@ -0,0 +1,272 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/handicap"
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/results"
+)
+
+// Timings results can be ranked on.
+const (
+	timingRaw      = "raw"
+	timingAdjusted = "adjusted"
+)
+
+// --- Structs for JSON Payloads ---
+
+// pursuitStartsPayload works out the staggered starts of a pursuit.
+type pursuitStartsPayload struct {
+	Basis         string  `json:"basis"`         // "factor", "age" or "class": the handicap the starts are based on
+	ReferenceTime float64 `json:"referenceTime"` // Seconds expected of a racer with a factor of 1
+}
+
+// liveRankingEntry is a racer's place in the live ranking of an event. Times
+// are in seconds; racers still out on the course are ranked on their
+// projected finish times.
+type liveRankingEntry struct {
+	Rank         int     `json:"rank"` // 0 for racers who are neither finished nor racing
+	RacerID      int64   `json:"racerId"`
+	RacerName    string  `json:"racerName"`
+	Bib          string  `json:"bib"`
+	Category     string  `json:"category"`
+	Status       string  `json:"status"` // "finished", "racing", "dnf", "dns" or "dsq"
+	Projected    bool    `json:"projected"`
+	Time         float64 `json:"time"` // The time ranked on, raw or adjusted
+	RawTime      float64 `json:"rawTime"`
+	AdjustedTime float64 `json:"adjustedTime"`
+	Gap          float64 `json:"gap"`
+	Remaining    float64 `json:"remaining,omitempty"` // Meters to the finish, for racers still racing
+}
+
+// liveStatusRacing is the live ranking status of a racer still out on the course.
+const liveStatusRacing = "racing"
+
+// --- HTTP Handlers ---
+
+// handleSetPursuitStarts works out the start offset of every racer in a pursuit
+// from their handicap, so that racers who ride to their handicap finish
+// together. It replaces any offsets set by hand.
+func (s *Server) handleSetPursuitStarts(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	if event.HandicapSystem != handicap.SystemPursuit {
+		s.errorJSON(w, errors.New("the event's handicap system must be 'pursuit'"), http.StatusBadRequest)
+		return
+	}
+
+	var payload pursuitStartsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	switch payload.Basis {
+	case handicap.SystemFactor, handicap.SystemAge, handicap.SystemClass:
+	default:
+		s.errorJSON(w, errors.New("basis must be 'factor', 'age' or 'class'"), http.StatusBadRequest)
+		return
+	}
+	if payload.ReferenceTime <= 0 {
+		s.errorJSON(w, errors.New("referenceTime must be positive"), http.StatusBadRequest)
+		return
+	}
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	entrants := make(map[int64]handicap.Entrant, len(racers))
+	for _, racer := range racers {
+		entrants[racer.ID] = racerEntrant(racer)
+	}
+	offsets := handicap.PursuitStarts(seconds(payload.ReferenceTime), payload.Basis, handicapRules(event), entrants)
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		for _, racer := range racers {
+			before := *racer
+			racer.StartOffset = offsets[racer.ID].Seconds()
+			if err := s.db.UpdateRacerDetails(tx, racer); err != nil {
+				return err
+			}
+			if err := s.recordScoringChanges(tx, event.CreatorUserID, &before, racer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to set pursuit starts"), http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(racers, func(i, j int) bool { return racers[i].StartOffset < racers[j].StartOffset })
+	s.writeJSON(w, http.StatusOK, envelope{"racers": toRacerResponseList(racers)})
+}
+
+// handleGetLiveRanking ranks the racers of an event as it unfolds, on raw or
+// handicap adjusted times. Finishers are ranked on their results, and racers
+// still on the course on the finish times projected from their live progress.
+// Like the other results, it is public, but only while the event accepts live
+// positions; afterwards its results are final.
+func (s *Server) handleGetLiveRanking(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	if !eventAcceptsLiveData(event, time.Now()) {
+		s.errorJSON(w, errors.New("the event is not live"), http.StatusConflict)
+		return
+	}
+	timing, ok := s.resultTiming(w, r, event)
+	if !ok {
+		return
+	}
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	list, err := s.eventResults(groupDB, event, racers)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	predictions := make(map[int64]*live.Prediction)
+	predictor, err := s.eventPredictor(groupDB, event)
+	if err != nil {
+		log.Printf("WARN: could not build ETA predictor for event %d: %v", event.ID, err)
+	}
+	if predictor != nil {
+		for _, p := range predictor.Predictions() {
+			predictions[p.RacerID] = p
+		}
+	}
+
+	rules := handicapRules(event)
+	entries := make([]liveRankingEntry, len(racers))
+	for i, racer := range racers {
+		res := list[i]
+		e := liveRankingEntry{
+			RacerID:   racer.ID,
+			RacerName: racer.RacerName,
+			Bib:       racer.Bib,
+			Category:  racer.Category,
+			Status:    res.Status,
+		}
+		raw := res.Elapsed
+		if p := predictions[racer.ID]; !res.Finished() && p != nil && p.FinishETA != nil && racer.LiveStatus != liveStatusDNF &&
+			res.Status != results.StatusDSQ {
+			start := res.Start
+			if event.EventType == "race" && event.StartDate.Valid {
+				start = racerStart(event, racer)
+			}
+			if !start.IsZero() && p.FinishETA.After(start) {
+				e.Status, e.Projected, e.Remaining = liveStatusRacing, true, p.Remaining
+				raw = p.FinishETA.Sub(start)
+			}
+		}
+		if e.Status == results.StatusFinished || e.Status == liveStatusRacing {
+			e.RawTime = raw.Seconds()
+			e.AdjustedTime = rules.Adjust(raw, racerEntrant(racer)).Seconds()
+			e.Time = e.RawTime
+			if timing == timingAdjusted {
+				e.Time = e.AdjustedTime
+			}
+		}
+		entries[i] = e
+	}
+	rankLive(entries)
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"event":   toEventResponse(event),
+		"timing":  timing,
+		"ranking": entries,
+	})
+}
+
+// rankLive sorts a live ranking with the finished and racing racers first,
+// fastest first, followed by the DNFs, the DNSs and the disqualified, and
+// numbers the ranked racers. Equal times share a rank.
+func rankLive(entries []liveRankingEntry) {
+	order := map[string]int{results.StatusFinished: 0, liveStatusRacing: 0, results.StatusDNF: 1, results.StatusDNS: 2, results.StatusDSQ: 3}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if order[a.Status] != order[b.Status] {
+			return order[a.Status] < order[b.Status]
+		}
+		return order[a.Status] == 0 && a.Time < b.Time
+	})
+	for i := range entries {
+		e := &entries[i]
+		if order[e.Status] != 0 {
+			continue
+		}
+		e.Rank = i + 1
+		if i > 0 && entries[i-1].Time == e.Time {
+			e.Rank = entries[i-1].Rank
+		}
+		e.Gap = e.Time - entries[0].Time
+	}
+}
+
+// resultTiming reads the timing query parameter, "raw" or "adjusted", for
+// ranking an event's results. It defaults to adjusted times for events with a
+// handicap system and raw times otherwise.
+func (s *Server) resultTiming(w http.ResponseWriter, r *http.Request, event *database.Event) (string, bool) {
+	timing := r.URL.Query().Get("timing")
+	switch timing {
+	case "":
+		return defaultTiming(event), true
+	case timingRaw, timingAdjusted:
+		return timing, true
+	}
+	s.errorJSON(w, errors.New("timing must be 'raw' or 'adjusted'"), http.StatusBadRequest)
+	return "", false
+}
+
+// defaultTiming returns the timing an event's results are ranked on by default.
+func defaultTiming(event *database.Event) string {
+	if event.HandicapSystem != handicap.SystemNone {
+		return timingAdjusted
+	}
+	return timingRaw
+}
+
+// handicapRules returns how an event handicaps its racers.
+func handicapRules(event *database.Event) handicap.Rules {
+	return handicap.Rules{
+		System:    event.HandicapSystem,
+		AgeGrades: handicapAgeGrades(event.AgeGrades),
+		Classes:   event.ClassCoefficients,
+	}
+}
+
+// handicapAgeGrades converts an event's age-grading table.
+func handicapAgeGrades(grades []database.AgeGrade) []handicap.AgeGrade {
+	list := make([]handicap.AgeGrade, len(grades))
+	for i, g := range grades {
+		list[i] = handicap.AgeGrade{MinAge: g.MinAge, MaxAge: g.MaxAge, Factor: g.Factor}
+	}
+	return list
+}
+
+// racerEntrant returns what a racer is handicapped on.
+func racerEntrant(racer *database.Racer) handicap.Entrant {
+	return handicap.Entrant{
+		Factor:      racer.HandicapFactor.Float64,
+		Age:         int(racer.Age.Int64),
+		Class:       racer.Class,
+		StartOffset: seconds(racer.StartOffset),
+	}
+}
@@ -0,0 +1,509 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/realtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// liveTimeBuffer is how far outside an event's dates a reported position may
+	// be timestamped, matching the tolerance applied to uploaded GPX files.
+	liveTimeBuffer = time.Hour
+	// liveGracePeriod is how long after an event ends reports are still
+	// accepted, so that devices can deliver positions they buffered while offline.
+	// The live tracks are turned into GPX files once it has passed.
+	liveGracePeriod = 15 * time.Minute
+)
+
+// Live race statuses of a racer. A racer without a status hasn't started yet.
+const (
+	liveStatusStarted  = "started"
+	liveStatusFinished = "finished"
+	liveStatusDNF      = "dnf"
+)
+
+// setLiveStatusPayload defines the structure for overriding a racer's live status.
+type setLiveStatusPayload struct {
+	Status string `json:"status"` // "", "started", "finished" or "dnf"
+}
+
+// handleLiveIngest records a position report from a live tracking device. It
+// accepts the OsmAnd protocol used by OsmAnd and Traccar Client, as a query
+// string or form body, as well as Traccar Client's JSON body. The device
+// identifier is the racer's device token, which is the only authentication.
+func (s *Server) handleLiveIngest(w http.ResponseWriter, r *http.Request) {
+	// --- 1. Decode the Report ---
+	now := time.Now().UTC()
+	var report *live.Report
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method == http.MethodPost && mediaType == "application/json" {
+		body, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if readErr != nil {
+			s.errorJSON(w, errors.New("could not read request body"), http.StatusBadRequest)
+			return
+		}
+		report, err = live.ParseJSON(body, now)
+	} else {
+		if parseErr := r.ParseForm(); parseErr != nil {
+			s.errorJSON(w, errors.New("could not parse position report"), http.StatusBadRequest)
+			return
+		}
+		report, err = live.ParseQuery(r.Form, now)
+	}
+	if err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// --- 2. Record the Position ---
+	if err := s.recordLiveReport(report, now); err != nil {
+		var ingestErr *liveIngestError
+		if errors.As(err, &ingestErr) {
+			s.errorJSON(w, ingestErr.err, ingestErr.status)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"message": "position recorded"})
+}
+
+// liveIngestError is a rejected position report, with the HTTP status that
+// describes why.
+type liveIngestError struct {
+	status int
+	err    error
+}
+
+func (e *liveIngestError) Error() string { return e.err.Error() }
+
+// recordLiveReport authenticates a decoded position report by its device
+// token, stores it and notifies spectators. Reports that are rejected return a
+// *liveIngestError.
+func (s *Server) recordLiveReport(report *live.Report, now time.Time) error {
+	// --- 1. Authenticate the Device ---
+	token, err := s.db.GetDeviceToken(s.db.GetMainDB(), report.DeviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &liveIngestError{http.StatusUnauthorized, errors.New("unknown device")}
+		}
+		return err
+	}
+
+	groupDB, err := s.db.GetGroupDB(token.GroupID)
+	if err != nil {
+		return errors.New("group database not found")
+	}
+	event, err := s.db.GetEventByID(groupDB, token.EventID)
+	if err != nil {
+		return &liveIngestError{http.StatusNotFound, errors.New("event not found")}
+	}
+
+	// --- 2. Check the Event is Live ---
+	if !eventAcceptsLiveData(event, now) {
+		return &liveIngestError{http.StatusForbidden, errors.New("event is not live")}
+	}
+	if report.Time.Before(event.StartDate.Time.Add(-liveTimeBuffer)) || report.Time.After(event.EndDate.Time.Add(liveTimeBuffer)) {
+		return &liveIngestError{http.StatusBadRequest, errors.New("position time is outside the event dates")}
+	}
+
+	// --- 3. Store the Position ---
+	position := &database.LivePosition{
+		RacerID:   token.RacerID,
+		Timestamp: report.Time,
+		Lat:       report.Lat,
+		Lon:       report.Lon,
+		Altitude:  toNullFloat64(report.Altitude),
+		Speed:     toNullFloat64(report.Speed),
+		Bearing:   toNullFloat64(report.Bearing),
+		Accuracy:  toNullFloat64(report.Accuracy),
+		Battery:   toNullFloat64(report.Battery),
+	}
+	if err := s.db.AddLivePosition(groupDB, position); err != nil {
+		return errors.New("could not store position")
+	}
+
+	// --- 4. Notify Spectators ---
+	// Positions are coalesced and sent at a fixed rate; state changes go out at once.
+	s.broker.QueueEventUpdate(eventKey(event), "positions", position.RacerID, toLivePositionResponse(position))
+	racer, err := s.updateLiveRaceState(groupDB, event, position)
+	if err != nil {
+		log.Printf("WARN: could not update race state of racer %d: %v", position.RacerID, err)
+	} else if racer.LiveStatus != liveStatusFinished && racer.LiveStatus != liveStatusDNF {
+		s.publishPrediction(groupDB, event, position)
+	}
+	return nil
+}
+
+// handleCreateDeviceToken issues a new device token for a racer, revoking any
+// previous one. The token is entered as the device identifier in the tracking app.
+func (s *Server) handleCreateDeviceToken(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	if event.EventType != "race" || !event.StartDate.Valid || !event.EndDate.Valid {
+		s.errorJSON(w, errors.New("live tracking is only available for races with a start and end date"), http.StatusBadRequest)
+		return
+	}
+	if event.LiveFinalizedAt.Valid || time.Now().After(event.EndDate.Time.Add(liveGracePeriod)) {
+		s.errorJSON(w, errors.New("event has already ended"), http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		s.errorJSON(w, errors.New("could not generate device token"), http.StatusInternalServerError)
+		return
+	}
+	token := &database.DeviceToken{
+		Token:   hex.EncodeToString(b),
+		GroupID: event.GroupID,
+		EventID: event.ID,
+		RacerID: racer.ID,
+	}
+
+	err := s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.ReplaceDeviceToken(tx, token)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("could not save device token"), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, envelope{"deviceToken": token.Token})
+}
+
+// handleGetDeviceToken returns a racer's current device token.
+func (s *Server) handleGetDeviceToken(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := s.db.GetDeviceTokenForRacer(s.db.GetMainDB(), event.GroupID, racer.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("no device token has been issued for this racer"), http.StatusNotFound)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"deviceToken": token.Token})
+}
+
+// handleDeleteDeviceToken revokes a racer's device token.
+func (s *Server) handleDeleteDeviceToken(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.DeleteDeviceTokenForRacer(tx, event.GroupID, racer.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("could not revoke device token"), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"message": "device token revoked"})
+}
+
+// handleSetLiveStatus lets the event creator override a racer's live status,
+// e.g. to record a DNF reported by the racer or to correct a missed finish.
+func (s *Server) handleSetLiveStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	if event.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the event creator can change a racer's status"), http.StatusForbidden)
+		return
+	}
+	racerID, err := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid racer ID"), http.StatusBadRequest)
+		return
+	}
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return
+	}
+
+	var payload setLiveStatusPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	switch payload.Status {
+	case "", liveStatusStarted, liveStatusFinished, liveStatusDNF:
+	default:
+		s.errorJSON(w, errors.New("status must be '', 'started', 'finished' or 'dnf'"), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.setLiveStatus(groupDB, event, racer, payload.Status, time.Now().UTC()); err != nil {
+		s.errorJSON(w, errors.New("could not update racer status"), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"racer": toRacerResponse(racer)})
+}
+
+// loadManagedRacer loads the event and racer named in the URL and checks that
+// the user may manage the racer's device and track files: the event creator,
+// the user who added the racer or the user linked to them. On failure the error response has already been written.
+func (s *Server) loadManagedRacer(w http.ResponseWriter, r *http.Request) (*database.Event, *database.Racer, bool) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	racerID, err := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid racer ID"), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	if !canManageRacer(userID, event, racer) {
+		s.errorJSON(w, errors.New("forbidden: you can only manage racers you created or raced as, or as the event owner"), http.StatusForbidden)
+		return nil, nil, false
+	}
+	return event, racer, true
+}
+
+// eventAcceptsLiveData reports whether position reports for an event are
+// accepted at time now: it must be a dated race that has not been finalized,
+// between an hour before the start and the end of the grace period.
+func eventAcceptsLiveData(event *database.Event, now time.Time) bool {
+	if event.EventType != "race" || !event.StartDate.Valid || !event.EndDate.Valid || event.LiveFinalizedAt.Valid {
+		return false
+	}
+	return !now.Before(event.StartDate.Time.Add(-liveTimeBuffer)) && !now.After(event.EndDate.Time.Add(liveGracePeriod))
+}
+
+// updateLiveRaceState advances a racer's live race state after a new position:
+// the racer has started once a position is reported after the event start, and
+// finishes on reaching the last of the event's checkpoints in order. Finished
+// and DNF racers are left unchanged. It returns the updated racer.
+func (s *Server) updateLiveRaceState(groupDB *sql.DB, event *database.Event, position *database.LivePosition) (*database.Racer, error) {
+	racer, err := s.db.GetRacerByID(groupDB, position.RacerID)
+	if err != nil {
+		return nil, err
+	}
+	if racer.LiveStatus == liveStatusFinished || racer.LiveStatus == liveStatusDNF {
+		return racer, nil
+	}
+	if racer.LiveStatus == "" {
+		if position.Timestamp.Before(event.StartDate.Time) {
+			return racer, nil
+		}
+		if err := s.setLiveStatus(groupDB, event, racer, liveStatusStarted, position.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	checkpoints, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil || len(checkpoints) == 0 {
+		return racer, err
+	}
+	reached := racer.LiveCheckpoints
+	here := gpx.TrackPoint{Lat: position.Lat, Lon: position.Lon}
+	for reached < len(checkpoints) {
+		cp := checkpoints[reached]
+		if here.DistanceTo(&gpx.TrackPoint{Lat: cp.Lat, Lon: cp.Lon}) > cp.Radius {
+			break
+		}
+		reached++
+	}
+	if reached == racer.LiveCheckpoints {
+		return racer, nil
+	}
+
+	racer.LiveCheckpoints = reached
+	if reached == len(checkpoints) {
+		return racer, s.setLiveStatus(groupDB, event, racer, liveStatusFinished, position.Timestamp)
+	}
+	return racer, s.db.UpdateRacerLiveState(groupDB, racer)
+}
+
+// setLiveStatus stores a racer's new live status and tells the event's spectators.
+func (s *Server) setLiveStatus(groupDB *sql.DB, event *database.Event, racer *database.Racer, status string, at time.Time) error {
+	racer.LiveStatus = status
+	racer.LiveStatusAt = sql.NullTime{Time: at, Valid: true}
+	if err := s.db.UpdateRacerLiveState(groupDB, racer); err != nil {
+		return err
+	}
+	s.broker.PublishEvent(eventKey(event), realtime.Message{Type: "race_state", Payload: toRaceStateResponse(racer)})
+	return nil
+}
+
+// eventKey identifies an event's spectator stream.
+func eventKey(event *database.Event) realtime.EventKey {
+	return realtime.EventKey{GroupID: event.GroupID, EventID: event.ID}
+}
+
+// liveTrackPoints loads a racer's live positions as track points.
+func (s *Server) liveTrackPoints(groupDB database.DBorTx, racerID int64) ([]gpx.TrackPoint, error) {
+	positions, err := s.db.GetLivePositions(groupDB, racerID)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]gpx.TrackPoint, len(positions))
+	for i, p := range positions {
+		points[i] = gpx.TrackPoint{Lat: p.Lat, Lon: p.Lon, Timestamp: p.Timestamp}
+		if p.Altitude.Valid {
+			ele := p.Altitude.Float64
+			points[i].Ele = &ele
+		}
+	}
+	return points, nil
+}
+
+// RunLiveFinalizer periodically turns the live tracks of events that have ended
+// into GPX files, until ctx is cancelled.
+func (s *Server) RunLiveFinalizer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.finalizeLiveEvents(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finalizeLiveEvents writes a GPX file for every racer of an ended live event
+// who doesn't already have one, then marks the event as finalized and revokes
+// its device tokens.
+func (s *Server) finalizeLiveEvents(now time.Time) {
+	groupIDs, err := s.db.GetAllGroupIDs(s.db.GetMainDB())
+	if err != nil {
+		log.Printf("ERROR: live finalizer could not list groups: %v", err)
+		return
+	}
+
+	for _, groupID := range groupIDs {
+		groupDB, err := s.db.GetGroupDB(groupID)
+		if err != nil {
+			log.Printf("ERROR: live finalizer could not open group %d: %v", groupID, err)
+			continue
+		}
+		events, err := s.db.GetUnfinalizedLiveEvents(groupDB)
+		if err != nil {
+			log.Printf("ERROR: live finalizer could not list events for group %d: %v", groupID, err)
+			continue
+		}
+
+		for _, event := range events {
+			if !event.EndDate.Valid || now.Before(event.EndDate.Time.Add(liveGracePeriod)) {
+				continue
+			}
+			if err := s.finalizeLiveEvent(groupDB, event, now); err != nil {
+				log.Printf("ERROR: could not finalize live tracks for event %d in group %d: %v", event.ID, groupID, err)
+				continue
+			}
+			s.invalidatePredictor(event)
+			log.Printf("INFO: Finalized live tracks for event %d in group %d.", event.ID, groupID)
+		}
+	}
+}
+
+// finalizeLiveEvent writes the GPX files for a single ended event.
+func (s *Server) finalizeLiveEvent(groupDB *sql.DB, event *database.Event, now time.Time) error {
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		return err
+	}
+	checkpoints, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, racer := range racers {
+		// With a course to follow, anyone still racing when the event ends did not finish.
+		if racer.LiveStatus == liveStatusStarted && len(checkpoints) > 0 {
+			if err := s.setLiveStatus(groupDB, event, racer, liveStatusDNF, event.EndDate.Time); err != nil {
+				return err
+			}
+		}
+
+		// Files uploaded by the racer take precedence over the live track.
+		if racer.TrackFileCount > 0 {
+			continue
+		}
+		points, err := s.liveTrackPoints(groupDB, racer.ID)
+		if err != nil {
+			return err
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		fileName := fmt.Sprintf("group_%d_event_%d_racer_%d_%d.gpx", event.GroupID, event.ID, racer.ID, now.UnixNano())
+		if err := gpx.WriteFile(filepath.Join(s.config.GpxPath, fileName), racer.RacerName, points); err != nil {
+			return err
+		}
+		if _, err := s.db.AddTrackFile(groupDB, racer.ID, racer.UploaderUserID, fileName, "live.gpx"); err != nil {
+			return err
+		}
+		if err := s.storeRacerSpatialData(groupDB, event, racer.ID); err != nil {
+			log.Printf("WARN: could not update spatial data for racer %d: %v", racer.ID, err)
+		}
+	}
+
+	if err := s.refreshEventSpatialData(groupDB, event); err != nil {
+		log.Printf("WARN: could not update spatial data for event %d: %v", event.ID, err)
+	}
+	s.refreshEventBestEfforts(groupDB, event)
+	if err := s.db.SetEventLiveFinalized(groupDB, event.ID, now); err != nil {
+		return err
+	}
+	return s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.DeleteDeviceTokensForEvent(tx, event.GroupID, event.ID)
+	})
+}
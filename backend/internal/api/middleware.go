@@ -24,24 +24,8 @@ const userContextKey = contextKey("userID")
 // If the token is missing or invalid, it terminates the request with a 401 Unauthorized error.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := ""
-
 		// --- TOKEN EXTRACTION LOGIC ---
-
-		// 1. First, try to extract the token from the standard "Authorization" header.
-		// This is the primary method for standard REST API calls.
-		authHeader := r.Header.Get("Authorization")
-		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) == 2 && strings.ToLower(headerParts[0]) == "bearer" {
-			tokenString = headerParts[1]
-		}
-
-		// 2. If the token was not found in the header, fall back to checking the URL query.
-		// This is necessary for authenticating connections like Server-Sent Events (SSE),
-		// where setting custom headers is not straightforward.
-		if tokenString == "" {
-			tokenString = r.URL.Query().Get("token")
-		}
+		tokenString := requestToken(r)
 
 		// If no token was found in either location, reject the request.
 		if tokenString == "" {
@@ -73,6 +57,36 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// optionalAuthMiddleware is like authMiddleware for public routes that show
+// more to signed-in users. A valid token puts the user ID in the request's
+// context; without one, or with an invalid one, the request goes on anonymously.
+func (s *Server) optionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokenString := requestToken(r); tokenString != "" {
+			if claims, err := auth.ValidateJWT(tokenString, s.config.JwtSecret); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey, claims.UserID))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestToken extracts the JWT from a request, or returns "" if it has none.
+func requestToken(r *http.Request) string {
+	// 1. First, try to extract the token from the standard "Authorization" header.
+	// This is the primary method for standard REST API calls.
+	authHeader := r.Header.Get("Authorization")
+	headerParts := strings.Split(authHeader, " ")
+	if len(headerParts) == 2 && strings.ToLower(headerParts[0]) == "bearer" {
+		return headerParts[1]
+	}
+
+	// 2. If the token was not found in the header, fall back to checking the URL query.
+	// This is necessary for authenticating connections like Server-Sent Events (SSE),
+	// where setting custom headers is not straightforward.
+	return r.URL.Query().Get("token")
+}
+
 // getUserIDFromContext is a helper function for our API handlers. It safely retrieves
 // the authenticated user's ID from the request context.
 // This should only be called by handlers that are protected by the authMiddleware.
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/sport"
 )
 
 // UserResponse is the DTO for a user's public profile.
@@ -52,10 +54,25 @@ type RacerResponse struct {
 	ID             int64   `json:"id"`
 	EventID        int64   `json:"eventId"`
 	UploaderUserID int64   `json:"uploaderUserId"`
+	UserID         *int64  `json:"userId"` // The user who raced, once linked
 	RacerName      string  `json:"racerName"`
 	TrackColor     string  `json:"trackColor"`
 	TrackAvatarURL *string `json:"trackAvatarUrl,omitempty"`
-	GpxFilePath    *string `json:"gpxFilePath"`
+	GpxFilePath    *string `json:"gpxFilePath"`    // The racer's first track file
+	TrackFileCount int     `json:"trackFileCount"` // Number of files the track is stitched from
+	Bib            string  `json:"bib"`
+	Category       string  `json:"category"`
+	Club           string  `json:"club"`
+	Nationality    string  `json:"nationality"`
+
+	HandicapFactor *float64 `json:"handicapFactor"`
+	Age            *int64   `json:"age"`
+	Class          string   `json:"class"`
+	StartOffset    float64  `json:"startOffset"` // Seconds after the event start, for pursuits
+
+	LiveStatus string `json:"liveStatus,omitempty"` // "started", "finished" or "dnf" during a live event
+	TeamID     *int64 `json:"teamId"`
+	Leg        *int64 `json:"leg,omitempty"` // Relay leg
 }
 
 // toRacerResponse is a "mapper" function that converts our internal database model
@@ -71,14 +88,47 @@ func toRacerResponse(racer *database.Racer) RacerResponse {
 		gpxPath = &racer.GpxFilePath.String
 	}
 
+	var teamID, leg *int64
+	if racer.TeamID.Valid {
+		teamID = &racer.TeamID.Int64
+	}
+	if racer.Leg.Valid {
+		leg = &racer.Leg.Int64
+	}
+	var handicapFactor *float64
+	if racer.HandicapFactor.Valid {
+		handicapFactor = &racer.HandicapFactor.Float64
+	}
+	var age *int64
+	if racer.Age.Valid {
+		age = &racer.Age.Int64
+	}
+	var userID *int64
+	if racer.UserID.Valid {
+		userID = &racer.UserID.Int64
+	}
+
 	return RacerResponse{
 		ID:             racer.ID,
 		EventID:        racer.EventID,
 		UploaderUserID: racer.UploaderUserID,
+		UserID:         userID,
 		RacerName:      racer.RacerName,
 		TrackColor:     racer.TrackColor,
 		TrackAvatarURL: avatarURL, // This was missing from the DTO struct
 		GpxFilePath:    gpxPath,
+		TrackFileCount: racer.TrackFileCount,
+		Bib:            racer.Bib,
+		Category:       racer.Category,
+		Club:           racer.Club,
+		Nationality:    racer.Nationality,
+		HandicapFactor: handicapFactor,
+		Age:            age,
+		Class:          racer.Class,
+		StartOffset:    racer.StartOffset,
+		LiveStatus:     racer.LiveStatus,
+		TeamID:         teamID,
+		Leg:            leg,
 	}
 }
 
@@ -100,8 +150,64 @@ type EventResponse struct {
 	StartDate     *string `json:"startDate"` // Pointer to handle null
 	EndDate       *string `json:"endDate"`   // Pointer to handle null
 	EventType     string  `json:"eventType"`
+	Sport         string  `json:"sport"`
 	CreatorUserID int64   `json:"creatorUserId"`
 	HasGpxData    bool    `json:"hasGpxData"`
+	MapMatching   bool    `json:"mapMatching"`
+	ElevationMode string  `json:"elevationMode"`
+	CourseID      *int64  `json:"courseId"`
+	StageRaceID   *int64  `json:"stageRaceId"`
+	StageNumber   *int64  `json:"stageNumber"`
+
+	// Team scoring: "sum" or "first" of the teamCounted best finishers, or "relay".
+	TeamScoring  string                `json:"teamScoring"`
+	TeamCounted  int                   `json:"teamCounted"`
+	ExchangeZone *ExchangeZoneResponse `json:"exchangeZone"` // Where relay legs are handed over
+
+	// Handicapping: "", "factor", "age", "class" or "pursuit". An empty
+	// age-grading table means the default one is used.
+	HandicapSystem    string              `json:"handicapSystem"`
+	AgeGrades         []database.AgeGrade `json:"ageGrades"`
+	ClassCoefficients map[string]float64  `json:"classCoefficients"`
+
+	// Self-service registration by group members.
+	Registration RegistrationSettingsResponse `json:"registration"`
+
+	// Safety alert thresholds for live tracking; zero means the alert is off.
+	StationaryAlertMinutes int     `json:"stationaryAlertMinutes"`
+	OffCourseAlertMeters   float64 `json:"offCourseAlertMeters"`
+	OffCourseAlertMinutes  int     `json:"offCourseAlertMinutes"`
+	SilenceAlertMinutes    int     `json:"silenceAlertMinutes"`
+
+	// SportProfile describes the metrics computed for this event's tracks and how to display them.
+	SportProfile *sport.Profile `json:"sportProfile"`
+
+	// Spatial data is only present once tracks have been processed for the event.
+	Bounds        *gpx.Bounds       `json:"bounds,omitempty"`
+	StartLocation *LocationResponse `json:"startLocation,omitempty"`
+}
+
+// RegistrationSettingsResponse is the DTO for how members register for an event.
+type RegistrationSettingsResponse struct {
+	Enabled   bool                            `json:"enabled"`
+	OpensAt   *time.Time                      `json:"opensAt"`
+	ClosesAt  *time.Time                      `json:"closesAt"` // The event start if null
+	Capacity  int                             `json:"capacity"` // 0 for unlimited
+	Approval  bool                            `json:"approval"` // Registrations wait for the owner's approval
+	Questions []database.RegistrationQuestion `json:"questions"`
+}
+
+// ExchangeZoneResponse is the DTO for the exchange zone of a relay.
+type ExchangeZoneResponse struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Radius float64 `json:"radius"` // Meters
+}
+
+// LocationResponse is the DTO for a single geographic coordinate.
+type LocationResponse struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
 }
 
 // toEventResponse is a "mapper" function that converts our internal database model
@@ -118,6 +224,49 @@ func toEventResponse(event *database.Event) EventResponse {
 		endDate = &e
 	}
 
+	var bounds *gpx.Bounds
+	if event.MinLat.Valid && event.MinLon.Valid && event.MaxLat.Valid && event.MaxLon.Valid {
+		bounds = &gpx.Bounds{
+			MinLat: event.MinLat.Float64,
+			MinLon: event.MinLon.Float64,
+			MaxLat: event.MaxLat.Float64,
+			MaxLon: event.MaxLon.Float64,
+		}
+	}
+
+	var startLocation *LocationResponse
+	if event.StartLat.Valid && event.StartLon.Valid {
+		startLocation = &LocationResponse{Lat: event.StartLat.Float64, Lon: event.StartLon.Float64}
+	}
+
+	var courseID *int64
+	if event.CourseID.Valid {
+		courseID = &event.CourseID.Int64
+	}
+	var stageRaceID, stageNumber *int64
+	if event.StageRaceID.Valid {
+		stageRaceID, stageNumber = &event.StageRaceID.Int64, &event.StageNumber.Int64
+	}
+	var exchangeZone *ExchangeZoneResponse
+	if event.ExchangeLat.Valid && event.ExchangeLon.Valid {
+		exchangeZone = &ExchangeZoneResponse{Lat: event.ExchangeLat.Float64, Lon: event.ExchangeLon.Float64, Radius: event.ExchangeRadius}
+	}
+	registration := RegistrationSettingsResponse{
+		Enabled:   event.RegistrationEnabled,
+		Capacity:  event.RegistrationCapacity,
+		Approval:  event.RegistrationApproval,
+		Questions: event.RegistrationQuestions,
+	}
+	if event.RegistrationOpensAt.Valid {
+		registration.OpensAt = &event.RegistrationOpensAt.Time
+	}
+	if event.RegistrationClosesAt.Valid {
+		registration.ClosesAt = &event.RegistrationClosesAt.Time
+	}
+	if registration.Questions == nil {
+		registration.Questions = []database.RegistrationQuestion{}
+	}
+
 	return EventResponse{
 		ID:            event.ID,
 		GroupID:       event.GroupID,
@@ -125,9 +274,578 @@ func toEventResponse(event *database.Event) EventResponse {
 		StartDate:     startDate,
 		EndDate:       endDate,
 		EventType:     event.EventType,
+		Sport:         event.Sport,
+		SportProfile:  sport.Get(event.Sport),
 		CreatorUserID: event.CreatorUserID,
 		HasGpxData:    event.HasGpxData,
+		MapMatching:   event.MapMatching,
+		ElevationMode: event.ElevationMode,
+		CourseID:      courseID,
+		StageRaceID:   stageRaceID,
+		StageNumber:   stageNumber,
+
+		TeamScoring:  event.TeamScoring,
+		TeamCounted:  event.TeamCounted,
+		ExchangeZone: exchangeZone,
+
+		HandicapSystem:    event.HandicapSystem,
+		AgeGrades:         event.AgeGrades,
+		ClassCoefficients: event.ClassCoefficients,
+
+		Registration: registration,
+
+		StationaryAlertMinutes: event.StationaryAlertMinutes,
+		OffCourseAlertMeters:   event.OffCourseAlertMeters,
+		OffCourseAlertMinutes:  event.OffCourseAlertMinutes,
+		SilenceAlertMinutes:    event.SilenceAlertMinutes,
+
+		Bounds:        bounds,
+		StartLocation: startLocation,
+	}
+}
+
+// CourseResponse is the DTO for a course. Geometry is only included when a
+// single course is requested.
+type CourseResponse struct {
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	Distance      float64      `json:"distance"` // Meters
+	CreatorUserID int64        `json:"creatorUserId"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	Geometry      [][2]float64 `json:"geometry,omitempty"` // [lat, lon] pairs
+}
+
+// toCourseResponse converts a database course to its DTO.
+func toCourseResponse(course *database.Course) CourseResponse {
+	return CourseResponse{
+		ID:            course.ID,
+		Name:          course.Name,
+		Distance:      course.Distance,
+		CreatorUserID: course.CreatorUserID,
+		CreatedAt:     course.CreatedAt,
+		Geometry:      course.Geometry,
+	}
+}
+
+// toCourseResponseList converts a slice of database courses.
+func toCourseResponseList(courses []*database.Course) []CourseResponse {
+	responseList := make([]CourseResponse, len(courses))
+	for i, course := range courses {
+		responseList[i] = toCourseResponse(course)
+	}
+	return responseList
+}
+
+// RacerClaimResponse is the DTO for a claim on a racer entry.
+type RacerClaimResponse struct {
+	ID        int64      `json:"id"`
+	RacerID   int64      `json:"racerId"`
+	RacerName string     `json:"racerName"`
+	EventID   int64      `json:"eventId"`
+	UserID    int64      `json:"userId"`
+	Username  string     `json:"username"`
+	Status    string     `json:"status"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DecidedBy *int64     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+}
+
+// toRacerClaimResponse converts a database claim to its DTO.
+func toRacerClaimResponse(c *database.RacerClaim, racerName, username string) RacerClaimResponse {
+	resp := RacerClaimResponse{
+		ID:        c.ID,
+		RacerID:   c.RacerID,
+		RacerName: racerName,
+		EventID:   c.EventID,
+		UserID:    c.UserID,
+		Username:  username,
+		Status:    c.Status,
+		Message:   c.Message,
+		CreatedAt: c.CreatedAt,
+	}
+	if c.DecidedBy.Valid {
+		resp.DecidedBy = &c.DecidedBy.Int64
+	}
+	if c.DecidedAt.Valid {
+		resp.DecidedAt = &c.DecidedAt.Time
+	}
+	return resp
+}
+
+// RegistrationResponse is the DTO for a member's registration for an event.
+type RegistrationResponse struct {
+	ID               int64             `json:"id"`
+	EventID          int64             `json:"eventId"`
+	UserID           int64             `json:"userId"`
+	Username         string            `json:"username"`
+	RacerID          *int64            `json:"racerId"` // Set while the registration is confirmed
+	RacerName        string            `json:"racerName"`
+	Status           string            `json:"status"`
+	WaitlistPosition int               `json:"waitlistPosition,omitempty"` // 1-based, while waitlisted
+	Answers          map[string]string `json:"answers"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+// toRegistrationResponse converts a database registration to its DTO.
+func toRegistrationResponse(reg *database.Registration, username string, waitlistPosition int) RegistrationResponse {
+	resp := RegistrationResponse{
+		ID:               reg.ID,
+		EventID:          reg.EventID,
+		UserID:           reg.UserID,
+		Username:         username,
+		RacerName:        reg.RacerName,
+		Status:           reg.Status,
+		WaitlistPosition: waitlistPosition,
+		Answers:          reg.Answers,
+		CreatedAt:        reg.CreatedAt,
+		UpdatedAt:        reg.UpdatedAt,
+	}
+	if reg.RacerID.Valid {
+		resp.RacerID = &reg.RacerID.Int64
+	}
+	if resp.Answers == nil {
+		resp.Answers = map[string]string{}
+	}
+	return resp
+}
+
+// GhostResponse is the DTO for a ghost, with the racer it replays.
+type GhostResponse struct {
+	ID              int64     `json:"id"`
+	RacerID         int64     `json:"racerId"` // The racer the ghost is raced against
+	SourceRacerID   int64     `json:"sourceRacerId"`
+	SourceRacerName string    `json:"sourceRacerName"`
+	SourceEventID   int64     `json:"sourceEventId"`
+	SourceEventName string    `json:"sourceEventName"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// toGhostResponse converts a database ghost to its DTO.
+func toGhostResponse(g *database.Ghost, source *database.Racer, sourceEvent *database.Event) GhostResponse {
+	return GhostResponse{
+		ID:              g.ID,
+		RacerID:         g.RacerID,
+		SourceRacerID:   source.ID,
+		SourceRacerName: source.RacerName,
+		SourceEventID:   sourceEvent.ID,
+		SourceEventName: sourceEvent.Name,
+		CreatedAt:       g.CreatedAt,
+	}
+}
+
+// SegmentResponse is the DTO for a segment.
+type SegmentResponse struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	StartLat      float64   `json:"startLat"`
+	StartLon      float64   `json:"startLon"`
+	EndLat        float64   `json:"endLat"`
+	EndLon        float64   `json:"endLon"`
+	Radius        float64   `json:"radius"` // Meters
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// toSegmentResponse converts a database segment to its DTO.
+func toSegmentResponse(seg *database.Segment) SegmentResponse {
+	return SegmentResponse{
+		ID:            seg.ID,
+		Name:          seg.Name,
+		StartLat:      seg.StartLat,
+		StartLon:      seg.StartLon,
+		EndLat:        seg.EndLat,
+		EndLon:        seg.EndLon,
+		Radius:        seg.Radius,
+		CreatorUserID: seg.CreatorUserID,
+		CreatedAt:     seg.CreatedAt,
+	}
+}
+
+// toSegmentResponseList converts a slice of database segments.
+func toSegmentResponseList(segments []*database.Segment) []SegmentResponse {
+	responseList := make([]SegmentResponse, len(segments))
+	for i, seg := range segments {
+		responseList[i] = toSegmentResponse(seg)
+	}
+	return responseList
+}
+
+// StageRaceResponse is the DTO for a stage race.
+type StageRaceResponse struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	TimeBonuses   []int     `json:"timeBonuses"` // Seconds
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// toStageRaceResponse converts a database stage race to its DTO.
+func toStageRaceResponse(sr *database.StageRace) StageRaceResponse {
+	return StageRaceResponse{
+		ID:            sr.ID,
+		Name:          sr.Name,
+		TimeBonuses:   sr.TimeBonuses,
+		CreatorUserID: sr.CreatorUserID,
+		CreatedAt:     sr.CreatedAt,
+	}
+}
+
+// toStageRaceResponseList converts a slice of database stage races.
+func toStageRaceResponseList(stageRaces []*database.StageRace) []StageRaceResponse {
+	responseList := make([]StageRaceResponse, len(stageRaces))
+	for i, sr := range stageRaces {
+		responseList[i] = toStageRaceResponse(sr)
+	}
+	return responseList
+}
+
+// SeriesResponse is the DTO for a season series.
+type SeriesResponse struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	PointsTable   []int     `json:"pointsTable"`
+	DropWorst     int       `json:"dropWorst"`
+	TieBreakers   []string  `json:"tieBreakers"`
+	MatchBy       string    `json:"matchBy"`
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// toSeriesResponse converts a database series to its DTO.
+func toSeriesResponse(series *database.Series) SeriesResponse {
+	return SeriesResponse{
+		ID:            series.ID,
+		Name:          series.Name,
+		PointsTable:   series.PointsTable,
+		DropWorst:     series.DropWorst,
+		TieBreakers:   series.TieBreakers,
+		MatchBy:       series.MatchBy,
+		CreatorUserID: series.CreatorUserID,
+		CreatedAt:     series.CreatedAt,
+	}
+}
+
+// toSeriesResponseList converts a slice of database series.
+func toSeriesResponseList(list []*database.Series) []SeriesResponse {
+	responseList := make([]SeriesResponse, len(list))
+	for i, series := range list {
+		responseList[i] = toSeriesResponse(series)
+	}
+	return responseList
+}
+
+// TeamResponse is the DTO for a team, with the IDs of its members.
+type TeamResponse struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"eventId"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	RacerIDs  []int64   `json:"racerIds"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// toTeamResponse converts a database team to its DTO. Its members are picked
+// from racers.
+func toTeamResponse(team *database.Team, racers []*database.Racer) TeamResponse {
+	racerIDs := []int64{}
+	for _, racer := range racers {
+		if racer.TeamID.Valid && racer.TeamID.Int64 == team.ID {
+			racerIDs = append(racerIDs, racer.ID)
+		}
+	}
+	return TeamResponse{
+		ID:        team.ID,
+		EventID:   team.EventID,
+		Name:      team.Name,
+		Color:     team.Color,
+		RacerIDs:  racerIDs,
+		CreatedAt: team.CreatedAt,
+	}
+}
+
+// toTeamResponseList converts a slice of database teams.
+func toTeamResponseList(teams []*database.Team, racers []*database.Racer) []TeamResponse {
+	responseList := make([]TeamResponse, len(teams))
+	for i, team := range teams {
+		responseList[i] = toTeamResponse(team, racers)
+	}
+	return responseList
+}
+
+// OfficialResultResponse is the DTO for a racer's official result: their
+// recorded result, the officials' overrides and their penalties. Times are in seconds.
+type OfficialResultResponse struct {
+	RacerID        int64                   `json:"racerId"`
+	ComputedStatus string                  `json:"computedStatus"`
+	ComputedTime   float64                 `json:"computedTime"`
+	StatusOverride string                  `json:"statusOverride,omitempty"`
+	TimeOverride   *float64                `json:"timeOverride,omitempty"`
+	Penalties      float64                 `json:"penalties"` // Total; negative for a net bonus
+	PenaltyList    []ResultPenaltyResponse `json:"penaltyList"`
+	ComputedAt     time.Time               `json:"computedAt"`
+	UpdatedAt      time.Time               `json:"updatedAt"`
+}
+
+// toOfficialResultResponse converts a database official result to its DTO. The
+// racer's penalties are picked from penalties.
+func toOfficialResultResponse(o *database.OfficialResult, penalties []*database.ResultPenalty) OfficialResultResponse {
+	resp := OfficialResultResponse{
+		RacerID:        o.RacerID,
+		ComputedStatus: o.ComputedStatus,
+		ComputedTime:   o.ComputedTime,
+		StatusOverride: o.StatusOverride,
+		Penalties:      o.Penalties,
+		PenaltyList:    []ResultPenaltyResponse{},
+		ComputedAt:     o.ComputedAt,
+		UpdatedAt:      o.UpdatedAt,
+	}
+	if o.TimeOverride.Valid {
+		resp.TimeOverride = &o.TimeOverride.Float64
+	}
+	for _, p := range penalties {
+		if p.RacerID == o.RacerID {
+			resp.PenaltyList = append(resp.PenaltyList, toResultPenaltyResponse(p))
+		}
+	}
+	return resp
+}
+
+// ResultPenaltyResponse is the DTO for a time penalty or bonus.
+type ResultPenaltyResponse struct {
+	ID        int64     `json:"id"`
+	RacerID   int64     `json:"racerId"`
+	Seconds   float64   `json:"seconds"`
+	Reason    string    `json:"reason"`
+	UserID    int64     `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// toResultPenaltyResponse converts a database penalty to its DTO.
+func toResultPenaltyResponse(p *database.ResultPenalty) ResultPenaltyResponse {
+	return ResultPenaltyResponse{
+		ID:        p.ID,
+		RacerID:   p.RacerID,
+		Seconds:   p.Seconds,
+		Reason:    p.Reason,
+		UserID:    p.UserID,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// ResultChangeResponse is the DTO for an entry in the audit trail of an
+// event's results.
+type ResultChangeResponse struct {
+	ID        int64     `json:"id"`
+	RacerID   *int64    `json:"racerId,omitempty"`
+	UserID    int64     `json:"userId"`
+	Username  string    `json:"username"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"oldValue"`
+	NewValue  string    `json:"newValue"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// toResultChangeResponse converts a database result change to its DTO.
+func toResultChangeResponse(c *database.ResultChange, username string) ResultChangeResponse {
+	resp := ResultChangeResponse{
+		ID:        c.ID,
+		UserID:    c.UserID,
+		Username:  username,
+		Field:     c.Field,
+		OldValue:  c.OldValue,
+		NewValue:  c.NewValue,
+		Reason:    c.Reason,
+		CreatedAt: c.CreatedAt,
+	}
+	if c.RacerID.Valid {
+		resp.RacerID = &c.RacerID.Int64
+	}
+	return resp
+}
+
+// TrackFileResponse is the DTO for one of the files a racer's track is stitched from.
+type TrackFileResponse struct {
+	ID             int64     `json:"id"`
+	Position       int       `json:"position"`
+	FilePath       string    `json:"filePath"`
+	OriginalName   string    `json:"originalName"`
+	UploaderUserID int64     `json:"uploaderUserId"`
+	UploadedAt     time.Time `json:"uploadedAt"`
+}
+
+// toTrackFileResponse converts a database track file to its DTO.
+func toTrackFileResponse(f *database.TrackFile) TrackFileResponse {
+	return TrackFileResponse{
+		ID:             f.ID,
+		Position:       f.Position,
+		FilePath:       f.FilePath,
+		OriginalName:   f.OriginalName,
+		UploaderUserID: f.UploaderUserID,
+		UploadedAt:     f.UploadedAt,
+	}
+}
+
+// toTrackFileResponseList converts a slice of database track files.
+func toTrackFileResponseList(files []*database.TrackFile) []TrackFileResponse {
+	responseList := make([]TrackFileResponse, len(files))
+	for i, f := range files {
+		responseList[i] = toTrackFileResponse(f)
+	}
+	return responseList
+}
+
+// CheckpointResponse is the DTO for a checkpoint on an event's course.
+type CheckpointResponse struct {
+	ID       int64   `json:"id"`
+	Sequence int     `json:"sequence"`
+	Name     string  `json:"name"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Radius   float64 `json:"radius"`
+}
+
+// toCheckpointResponseList converts a slice of database checkpoints.
+func toCheckpointResponseList(checkpoints []*database.Checkpoint) []CheckpointResponse {
+	responseList := make([]CheckpointResponse, len(checkpoints))
+	for i, cp := range checkpoints {
+		responseList[i] = CheckpointResponse{
+			ID:       cp.ID,
+			Sequence: cp.Sequence,
+			Name:     cp.Name,
+			Lat:      cp.Lat,
+			Lon:      cp.Lon,
+			Radius:   cp.Radius,
+		}
+	}
+	return responseList
+}
+
+// WindSampleResponse is the DTO for a wind observation. Timestamp is null for a
+// constant wind.
+type WindSampleResponse struct {
+	Timestamp *time.Time `json:"timestamp"`
+	Direction float64    `json:"direction"`
+	Speed     *float64   `json:"speed"`
+}
+
+// toWindResponseList converts a slice of database wind samples.
+func toWindResponseList(samples []*database.WindSample) []WindSampleResponse {
+	responseList := make([]WindSampleResponse, len(samples))
+	for i, ws := range samples {
+		resp := WindSampleResponse{Direction: ws.Direction}
+		if ws.Timestamp.Valid {
+			t := ws.Timestamp.Time
+			resp.Timestamp = &t
+		}
+		if ws.Speed.Valid {
+			speed := ws.Speed.Float64
+			resp.Speed = &speed
+		}
+		responseList[i] = resp
+	}
+	return responseList
+}
+
+// LivePositionResponse is the DTO for a racer's live position, as sent to spectators.
+type LivePositionResponse struct {
+	RacerID   int64     `json:"racerId"`
+	Timestamp time.Time `json:"timestamp"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Altitude  *float64  `json:"altitude,omitempty"`
+	Speed     *float64  `json:"speed,omitempty"`   // m/s
+	Bearing   *float64  `json:"bearing,omitempty"` // Degrees true
+}
+
+// toLivePositionResponse converts a stored live position into its public DTO.
+// Device details such as battery level and accuracy are not exposed.
+func toLivePositionResponse(p *database.LivePosition) LivePositionResponse {
+	resp := LivePositionResponse{RacerID: p.RacerID, Timestamp: p.Timestamp, Lat: p.Lat, Lon: p.Lon}
+	if p.Altitude.Valid {
+		resp.Altitude = &p.Altitude.Float64
+	}
+	if p.Speed.Valid {
+		resp.Speed = &p.Speed.Float64
+	}
+	if p.Bearing.Valid {
+		resp.Bearing = &p.Bearing.Float64
+	}
+	return resp
+}
+
+// RaceStateResponse is the DTO for a racer's live race state.
+type RaceStateResponse struct {
+	RacerID     int64      `json:"racerId"`
+	Status      string     `json:"status"`      // "", "started", "finished" or "dnf"
+	Checkpoints int        `json:"checkpoints"` // Number of checkpoints reached
+	Timestamp   *time.Time `json:"timestamp"`   // When the status last changed
+}
+
+// toRaceStateResponse extracts the live race state of a racer.
+func toRaceStateResponse(racer *database.Racer) RaceStateResponse {
+	resp := RaceStateResponse{RacerID: racer.ID, Status: racer.LiveStatus, Checkpoints: racer.LiveCheckpoints}
+	if racer.LiveStatusAt.Valid {
+		t := racer.LiveStatusAt.Time
+		resp.Timestamp = &t
+	}
+	return resp
+}
+
+// SafetyIncidentResponse is the DTO for a safety incident, as sent to the event owner.
+type SafetyIncidentResponse struct {
+	ID             int64      `json:"id"`
+	EventID        int64      `json:"eventId"`
+	RacerID        int64      `json:"racerId"`
+	RacerName      string     `json:"racerName"`
+	Type           string     `json:"type"`   // "stationary", "off_course" or "no_signal"
+	Status         string     `json:"status"` // "open", "acknowledged" or "resolved"
+	Since          time.Time  `json:"since"`  // When the condition started
+	DetectedAt     time.Time  `json:"detectedAt"`
+	Lat            float64    `json:"lat"` // Last known position
+	Lon            float64    `json:"lon"`
+	Distance       *float64   `json:"distance,omitempty"` // Meters off course
+	AcknowledgedBy *int64     `json:"acknowledgedBy"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	ResolvedBy     *int64     `json:"resolvedBy"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	Note           string     `json:"note"`
+}
+
+// toSafetyIncidentResponse converts a database incident. racerName may be empty
+// if the racer is unknown.
+func toSafetyIncidentResponse(inc *database.SafetyIncident, racerName string) SafetyIncidentResponse {
+	resp := SafetyIncidentResponse{
+		ID:         inc.ID,
+		EventID:    inc.EventID,
+		RacerID:    inc.RacerID,
+		RacerName:  racerName,
+		Type:       inc.Type,
+		Status:     inc.Status,
+		Since:      inc.Since,
+		DetectedAt: inc.DetectedAt,
+		Lat:        inc.Lat,
+		Lon:        inc.Lon,
+		Note:       inc.Note,
+	}
+	if inc.Distance.Valid {
+		resp.Distance = &inc.Distance.Float64
+	}
+	if inc.AcknowledgedBy.Valid {
+		resp.AcknowledgedBy = &inc.AcknowledgedBy.Int64
+	}
+	if inc.AcknowledgedAt.Valid {
+		resp.AcknowledgedAt = &inc.AcknowledgedAt.Time
+	}
+	if inc.ResolvedBy.Valid {
+		resp.ResolvedBy = &inc.ResolvedBy.Int64
+	}
+	if inc.ResolvedAt.Valid {
+		resp.ResolvedAt = &inc.ResolvedAt.Time
 	}
+	return resp
 }
 
 // toEventResponseList is a helper to convert a slice of database events.
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/nmea"
+)
+
+// nmeaMinInterval is the shortest time between positions recorded from an NMEA
+// stream. Receivers often send several fixes a second, far more than spectators
+// or the stored live track need.
+const nmeaMinInterval = time.Second
+
+// nmeaStreamIdle is how long a UDP sender may go quiet before its stream is
+// forgotten, and maxNMEAStreams the most UDP senders tracked at once. Senders
+// are only identified by their address, which can roam or be spoofed.
+// The same limits apply to TCP connections, which are closed after going quiet
+// for nmeaStreamIdle and refused while maxNMEAStreams are open.
+const (
+	nmeaStreamIdle = 10 * time.Minute
+	maxNMEAStreams = 256
+)
+
+// ServeNMEA listens for NMEA 0183 sentences on a TCP or UDP address and records
+// the fixes as live positions of the racer the device token was issued to,
+// until ctx is cancelled. network is "tcp" or "udp". It only returns an error
+// if the address can't be listened on.
+func (s *Server) ServeNMEA(ctx context.Context, network, addr, deviceToken string) error {
+	switch network {
+	case "tcp":
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			ln.Close()
+		}()
+		log.Printf("INFO: Listening for NMEA streams on tcp %s.", ln.Addr())
+		slots := make(chan struct{}, maxNMEAStreams)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Printf("WARN: NMEA listener could not accept connection: %v", err)
+				continue
+			}
+			select {
+			case slots <- struct{}{}:
+			default:
+				log.Printf("WARN: NMEA listener refused %s: too many connections.", conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer func() { <-slots }()
+				s.serveNMEAConn(conn, deviceToken)
+			}()
+		}
+
+	case "udp":
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		log.Printf("INFO: Listening for NMEA streams on udp %s.", conn.LocalAddr())
+		// Each sender gets its own stream, as datagrams from several receivers
+		// may be interleaved.
+		streams := make(map[string]*nmeaStream)
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Printf("WARN: NMEA listener could not read datagram: %v", err)
+				continue
+			}
+			now := time.Now()
+			stream, ok := streams[from.String()]
+			if !ok {
+				evictNMEAStreams(streams, now)
+				stream = &nmeaStream{server: s, deviceToken: deviceToken, source: "udp " + from.String()}
+				streams[from.String()] = stream
+			}
+			stream.lastSeen = now
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				stream.handle(line)
+			}
+			stream.flush()
+		}
+
+	default:
+		return errors.New("network must be tcp or udp")
+	}
+}
+
+// evictNMEAStreams makes room for a new UDP sender: it forgets the senders that
+// have been idle for nmeaStreamIdle and, if there are still maxNMEAStreams, the
+// one heard from least recently.
+func evictNMEAStreams(streams map[string]*nmeaStream, now time.Time) {
+	var oldest string
+	for addr, stream := range streams {
+		if now.Sub(stream.lastSeen) > nmeaStreamIdle {
+			delete(streams, addr)
+			continue
+		}
+		if oldest == "" || stream.lastSeen.Before(streams[oldest].lastSeen) {
+			oldest = addr
+		}
+	}
+	if len(streams) >= maxNMEAStreams {
+		delete(streams, oldest)
+	}
+}
+
+// serveNMEAConn reads sentences from a TCP connection until it is closed or
+// sends nothing for nmeaStreamIdle.
+func (s *Server) serveNMEAConn(conn net.Conn, deviceToken string) {
+	defer conn.Close()
+	stream := &nmeaStream{server: s, deviceToken: deviceToken, source: "tcp " + conn.RemoteAddr().String()}
+	log.Printf("INFO: NMEA stream connected from %s.", conn.RemoteAddr())
+
+	scanner := bufio.NewScanner(conn)
+	conn.SetReadDeadline(time.Now().Add(nmeaStreamIdle))
+	for scanner.Scan() {
+		stream.handle(scanner.Text())
+		conn.SetReadDeadline(time.Now().Add(nmeaStreamIdle))
+	}
+	stream.flush()
+	log.Printf("INFO: NMEA stream from %s closed.", conn.RemoteAddr())
+}
+
+// nmeaStream turns the sentences from one receiver into live reports. It is
+// only used by the goroutine reading from that receiver.
+type nmeaStream struct {
+	server      *Server
+	deviceToken string
+	source      string
+
+	decoder  nmea.Decoder
+	lastTime time.Time
+	lastErr  string
+	lastSeen time.Time // When the last datagram arrived; only used for UDP
+}
+
+// handle decodes one sentence and records the fix it completes, if any.
+func (st *nmeaStream) handle(line string) {
+	fix, err := st.decoder.Decode(line)
+	if err != nil || fix == nil {
+		return
+	}
+	st.record(fix)
+}
+
+// flush records the fix being assembled. Datagrams and connections usually end
+// with a complete fix, so waiting for the next one would only add latency.
+func (st *nmeaStream) flush() {
+	if fix := st.decoder.Flush(); fix != nil {
+		st.record(fix)
+	}
+}
+
+// record submits a fix as a live report, at most once per nmeaMinInterval.
+// Repeated errors (e.g. while the event hasn't started) are only logged once.
+func (st *nmeaStream) record(fix *nmea.Fix) {
+	now := time.Now().UTC()
+	t := fix.TimeNear(now)
+	if !st.lastTime.IsZero() && t.Sub(st.lastTime) < nmeaMinInterval {
+		return
+	}
+
+	report := &live.Report{
+		DeviceID: st.deviceToken,
+		Time:     t,
+		Lat:      fix.Lat,
+		Lon:      fix.Lon,
+		Altitude: fix.Altitude,
+		Speed:    fix.Speed,
+		Bearing:  fix.Course,
+	}
+	if err := st.server.recordLiveReport(report, now); err != nil {
+		if err.Error() != st.lastErr {
+			log.Printf("WARN: NMEA position from %s rejected: %v", st.source, err)
+			st.lastErr = err.Error()
+		}
+		return
+	}
+	st.lastTime, st.lastErr = t, ""
+}
@@ -0,0 +1,544 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/results"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Fields of the result audit trail.
+const (
+	changeComputed = "computed" // The racer's result was recorded from their track
+	changeStatus   = "status"
+	changeTime     = "time"
+	changePenalty  = "penalty"
+
+	// Details that handicaps are scored by, which move adjusted results.
+	changeHandicapFactor = "handicapFactor"
+	changeAge            = "age"
+	changeClass          = "class"
+	changeStartOffset    = "startOffset"
+
+	// Handicap rules of the whole event.
+	changeHandicapSystem    = "handicapSystem"
+	changeAgeGrades         = "ageGrades"
+	changeClassCoefficients = "classCoefficients"
+)
+
+// --- Structs for JSON Payloads ---
+
+// officialResultPayload overrides a racer's recorded result. Fields left out
+// are unchanged.
+type officialResultPayload struct {
+	Status    *string  `json:"status"`    // An empty status removes the override
+	Time      *float64 `json:"time"`      // Seconds
+	ClearTime bool     `json:"clearTime"` // Removes the time override
+	Reason    string   `json:"reason"`
+}
+
+// resultPenaltyPayload gives a racer a time penalty, or a bonus if negative.
+type resultPenaltyPayload struct {
+	Seconds float64 `json:"seconds"`
+	Reason  string  `json:"reason"`
+}
+
+// --- HTTP Handlers ---
+
+// handleComputeOfficialResults records the result of every racer in an event as
+// computed from their tracks now. Later track changes don't affect the official
+// results until they are computed again; the officials' overrides and penalties
+// are kept.
+func (s *Server) handleComputeOfficialResults(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	checkpoints, err := s.resultCheckpoints(groupDB, event)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	computed := make([]*results.Result, len(racers))
+	for i, racer := range racers {
+		computed[i] = s.racerResult(event, racer, checkpoints)
+	}
+
+	now := time.Now().UTC()
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		official, err := s.db.GetOfficialResultsByEventID(tx, event.ID)
+		if err != nil {
+			return err
+		}
+		for _, res := range computed {
+			status, seconds := res.Status, res.Elapsed.Seconds()
+			old := ""
+			if o, ok := official[res.RacerID]; ok {
+				if o.ComputedStatus == status && o.ComputedTime == seconds {
+					continue
+				}
+				old = formatRecorded(o.ComputedStatus, o.ComputedTime)
+			}
+			if err := s.db.SaveComputedResult(tx, event.ID, res.RacerID, status, seconds, now); err != nil {
+				return err
+			}
+			err := s.db.AddResultChange(tx, &database.ResultChange{
+				EventID:  event.ID,
+				RacerID:  sql.NullInt64{Int64: res.RacerID, Valid: true},
+				UserID:   userID,
+				Field:    changeComputed,
+				OldValue: old,
+				NewValue: formatRecorded(status, seconds),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to compute official results"), http.StatusInternalServerError)
+		return
+	}
+	s.writeOfficialResults(w, groupDB, event, defaultTiming(event))
+}
+
+// handleSetOfficialResult overrides the status or time of a racer's official
+// result. The racer's result is recorded first if it hasn't been yet.
+func (s *Server) handleSetOfficialResult(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, racer, userID, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var payload officialResultPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Reason = strings.TrimSpace(payload.Reason)
+	if payload.Status != nil && *payload.Status != "" && !results.ValidStatus(*payload.Status) {
+		s.errorJSON(w, errors.New("status must be one of finished, dnf, dns or dsq"), http.StatusBadRequest)
+		return
+	}
+	if payload.Time != nil && *payload.Time <= 0 {
+		s.errorJSON(w, errors.New("time must be positive"), http.StatusBadRequest)
+		return
+	}
+	computed, err := s.unrecordedResult(groupDB, event, racer)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		o, err := s.recordOfficialResult(tx, event, racer, computed, userID)
+		if err != nil {
+			return err
+		}
+		status, timeOverride := o.StatusOverride, o.TimeOverride
+		if payload.Status != nil {
+			status = *payload.Status
+		}
+		if payload.ClearTime {
+			timeOverride = sql.NullFloat64{}
+		}
+		if payload.Time != nil {
+			timeOverride = sql.NullFloat64{Float64: *payload.Time, Valid: true}
+		}
+		finalStatus := o.ComputedStatus
+		if status != "" {
+			finalStatus = status
+		}
+		if finalStatus == results.StatusFinished && o.ComputedStatus != results.StatusFinished && !timeOverride.Valid {
+			return errOfficialNeedsTime
+		}
+
+		if err := s.db.SetResultOverrides(tx, racer.ID, status, timeOverride); err != nil {
+			return err
+		}
+		racerID := sql.NullInt64{Int64: racer.ID, Valid: true}
+		if status != o.StatusOverride {
+			err := s.db.AddResultChange(tx, &database.ResultChange{
+				EventID: event.ID, RacerID: racerID, UserID: userID, Field: changeStatus,
+				OldValue: o.StatusOverride, NewValue: status, Reason: payload.Reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if timeOverride != o.TimeOverride {
+			err := s.db.AddResultChange(tx, &database.ResultChange{
+				EventID: event.ID, RacerID: racerID, UserID: userID, Field: changeTime,
+				OldValue: formatOverrideTime(o.TimeOverride), NewValue: formatOverrideTime(timeOverride), Reason: payload.Reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errOfficialNeedsTime) {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to update official result"), http.StatusInternalServerError)
+		return
+	}
+	s.writeOfficialResult(w, http.StatusOK, groupDB, event, racer.ID)
+}
+
+// errOfficialNeedsTime is returned when a racer without a computed time is
+// declared a finisher without a time override.
+var errOfficialNeedsTime = errors.New("a time is required to declare a racer without a computed time finished")
+
+// handleAddResultPenalty gives a racer a time penalty, or a bonus if the
+// seconds are negative. A reason is required.
+func (s *Server) handleAddResultPenalty(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, racer, userID, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var payload resultPenaltyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Reason = strings.TrimSpace(payload.Reason)
+	if payload.Seconds == 0 {
+		s.errorJSON(w, errors.New("seconds must not be zero"), http.StatusBadRequest)
+		return
+	}
+	if payload.Reason == "" {
+		s.errorJSON(w, errors.New("reason is required"), http.StatusBadRequest)
+		return
+	}
+	computed, err := s.unrecordedResult(groupDB, event, racer)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		if _, err := s.recordOfficialResult(tx, event, racer, computed, userID); err != nil {
+			return err
+		}
+		_, err := s.db.AddResultPenalty(tx, &database.ResultPenalty{
+			EventID: event.ID, RacerID: racer.ID, Seconds: payload.Seconds, Reason: payload.Reason, UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+		return s.db.AddResultChange(tx, &database.ResultChange{
+			EventID: event.ID, RacerID: sql.NullInt64{Int64: racer.ID, Valid: true}, UserID: userID, Field: changePenalty,
+			NewValue: formatPenalty(payload.Seconds), Reason: payload.Reason,
+		})
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to add penalty"), http.StatusInternalServerError)
+		return
+	}
+	s.writeOfficialResult(w, http.StatusCreated, groupDB, event, racer.ID)
+}
+
+// handleDeleteResultPenalty withdraws a penalty or bonus.
+func (s *Server) handleDeleteResultPenalty(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, racer, userID, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+	penaltyID, err := strconv.ParseInt(chi.URLParam(r, "penaltyID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid penalty ID"), http.StatusBadRequest)
+		return
+	}
+	penalty, err := s.db.GetResultPenaltyByID(groupDB, penaltyID)
+	if err != nil || penalty.RacerID != racer.ID {
+		s.errorJSON(w, errors.New("penalty not found"), http.StatusNotFound)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		if err := s.db.DeleteResultPenalty(tx, penalty.ID); err != nil {
+			return err
+		}
+		return s.db.AddResultChange(tx, &database.ResultChange{
+			EventID: event.ID, RacerID: sql.NullInt64{Int64: racer.ID, Valid: true}, UserID: userID, Field: changePenalty,
+			OldValue: formatPenalty(penalty.Seconds), Reason: penalty.Reason,
+		})
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete penalty"), http.StatusInternalServerError)
+		return
+	}
+	s.writeOfficialResult(w, http.StatusOK, groupDB, event, racer.ID)
+}
+
+// handleGetResultChanges returns the audit trail of an event's results, newest
+// first, to the members of its group.
+func (s *Server) handleGetResultChanges(w http.ResponseWriter, r *http.Request) {
+	if _, _, _, ok := s.loadGroupForMember(w, r); !ok {
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := s.db.GetResultChangesByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	userIDs := make(map[int64]struct{})
+	for _, c := range changes {
+		userIDs[c.UserID] = struct{}{}
+	}
+	users, err := s.db.GetUsersByIDs(s.db.GetMainDB(), userIDs)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	list := make([]ResultChangeResponse, len(changes))
+	for i, c := range changes {
+		list[i] = toResultChangeResponse(c, usernames[c.UserID])
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"changes": list})
+}
+
+// handleGetOfficialResults returns the official results of an event with the
+// officials' decisions for each racer. Like the other results, they are public.
+func (s *Server) handleGetOfficialResults(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	timing, ok := s.resultTiming(w, r, event)
+	if !ok {
+		return
+	}
+	s.writeOfficialResults(w, groupDB, event, timing)
+}
+
+// writeOfficialResults writes the ranked results of an event with the
+// officials' decisions.
+func (s *Server) writeOfficialResults(w http.ResponseWriter, groupDB *sql.DB, event *database.Event, timing string) {
+	entries, err := s.resultTable(groupDB, event, timing)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	official, err := s.db.GetOfficialResultsByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	penalties, err := s.db.GetResultPenaltiesByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	decisions := []OfficialResultResponse{}
+	for _, e := range entries {
+		if o, ok := official[e.RacerID]; ok {
+			decisions = append(decisions, toOfficialResultResponse(o, penalties))
+		}
+	}
+	s.writeJSON(w, http.StatusOK, envelope{
+		"event":     toEventResponse(event),
+		"timing":    timing,
+		"results":   entries,
+		"decisions": decisions,
+	})
+}
+
+// writeOfficialResult writes a racer's official result with their penalties.
+func (s *Server) writeOfficialResult(w http.ResponseWriter, status int, groupDB *sql.DB, event *database.Event, racerID int64) {
+	o, err := s.db.GetOfficialResult(groupDB, racerID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	penalties, err := s.db.GetResultPenaltiesByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, status, envelope{"officialResult": toOfficialResultResponse(o, penalties)})
+}
+
+// unrecordedResult works out a racer's result from their track if the
+// officials haven't recorded it yet, so it can be recorded along with their
+// first decision. It returns nil if the result is already recorded.
+func (s *Server) unrecordedResult(groupDB *sql.DB, event *database.Event, racer *database.Racer) (*results.Result, error) {
+	_, err := s.db.GetOfficialResult(groupDB, racer.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	checkpoints, err := s.resultCheckpoints(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+	return s.racerResult(event, racer, checkpoints), nil
+}
+
+// recordOfficialResult returns a racer's official result, first recording res,
+// their result from unrecordedResult, if not nil.
+func (s *Server) recordOfficialResult(tx *sql.Tx, event *database.Event, racer *database.Racer, res *results.Result, userID int64) (*database.OfficialResult, error) {
+	if res == nil {
+		return s.db.GetOfficialResult(tx, racer.ID)
+	}
+	status, seconds := res.Status, res.Elapsed.Seconds()
+	if err := s.db.SaveComputedResult(tx, event.ID, racer.ID, status, seconds, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	err := s.db.AddResultChange(tx, &database.ResultChange{
+		EventID:  event.ID,
+		RacerID:  sql.NullInt64{Int64: racer.ID, Valid: true},
+		UserID:   userID,
+		Field:    changeComputed,
+		NewValue: formatRecorded(status, seconds),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.db.GetOfficialResult(tx, racer.ID)
+}
+
+// recordScoringChanges adds the changes to the details that a racer's
+// handicap is scored by to the audit trail of their event's results. before
+// is nil for a new racer.
+func (s *Server) recordScoringChanges(tx *sql.Tx, userID int64, before, after *database.Racer) error {
+	var old database.Racer
+	if before != nil {
+		old = *before
+	}
+	changes := []struct{ field, old, new string }{
+		{changeHandicapFactor, formatHandicapFactor(old.HandicapFactor), formatHandicapFactor(after.HandicapFactor)},
+		{changeAge, formatAge(old.Age), formatAge(after.Age)},
+		{changeClass, old.Class, after.Class},
+		{changeStartOffset, formatStartOffset(old.StartOffset), formatStartOffset(after.StartOffset)},
+	}
+	for _, c := range changes {
+		if c.old == c.new {
+			continue
+		}
+		err := s.db.AddResultChange(tx, &database.ResultChange{
+			EventID: after.EventID, RacerID: sql.NullInt64{Int64: after.ID, Valid: true}, UserID: userID, Field: c.field,
+			OldValue: c.old, NewValue: c.new,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordHandicapRuleChanges adds the changes to the rules an event's racers
+// are handicapped by to the audit trail of the event's results.
+func (s *Server) recordHandicapRuleChanges(tx *sql.Tx, userID int64, before, after *database.Event) error {
+	changes := []struct{ field, old, new string }{
+		{changeHandicapSystem, before.HandicapSystem, after.HandicapSystem},
+		{changeAgeGrades, formatJSON(before.AgeGrades), formatJSON(after.AgeGrades)},
+		{changeClassCoefficients, formatJSON(before.ClassCoefficients), formatJSON(after.ClassCoefficients)},
+	}
+	for _, c := range changes {
+		if c.old == c.new {
+			continue
+		}
+		err := s.db.AddResultChange(tx, &database.ResultChange{
+			EventID: after.ID, UserID: userID, Field: c.field, OldValue: c.old, NewValue: c.new,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatRecorded describes a recorded result for the audit trail.
+func formatRecorded(status string, seconds float64) string {
+	if status != results.StatusFinished {
+		return status
+	}
+	return fmt.Sprintf("%s %.1fs", status, seconds)
+}
+
+// formatOverrideTime describes a time override for the audit trail.
+func formatOverrideTime(t sql.NullFloat64) string {
+	if !t.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%.1fs", t.Float64)
+}
+
+// formatPenalty describes a penalty or bonus for the audit trail.
+func formatPenalty(seconds float64) string {
+	return fmt.Sprintf("%+.1fs", seconds)
+}
+
+// formatHandicapFactor describes a handicap factor for the audit trail.
+func formatHandicapFactor(factor sql.NullFloat64) string {
+	if !factor.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%g", factor.Float64)
+}
+
+// formatAge describes a racer's age for the audit trail.
+func formatAge(age sql.NullInt64) string {
+	if !age.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%d", age.Int64)
+}
+
+// formatStartOffset describes a start offset for the audit trail.
+func formatStartOffset(offset float64) string {
+	if offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("+%.1fs", offset)
+}
+
+// formatJSON describes an age-grading table or class coefficients for the
+// audit trail. Empty tables are described as nothing.
+func formatJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	switch string(data) {
+	case "null", "[]", "{}":
+		return ""
+	}
+	return string(data)
+}
@@ -12,9 +12,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/intermernet/raceviz/internal/database"
+
 	"github.com/go-chi/chi/v5"
 )
 
@@ -52,6 +56,15 @@ func (s *Server) handleAddRacer(w http.ResponseWriter, r *http.Request) {
 		s.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
+	event, err := s.db.GetEventByID(groupDB, eventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+	if payload.setsScoring() && adderID != event.CreatorUserID {
+		s.errorJSON(w, errScoringOwnerOnly, http.StatusForbidden)
+		return
+	}
 
 	// --- COLOR GENERATION LOGIC ---
 	// 1. Get existing colors to ensure uniqueness.
@@ -75,8 +88,26 @@ func (s *Server) handleAddRacer(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	details := &database.Racer{}
+	if err := applyRacerDetails(details, payload.racerDetailsPayload, existingRacers); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
 	// Do not set a default track avatar. Let the frontend's fallback logic handle it.
-	newRacer, err := s.db.AddRacerToEvent(groupDB, eventID, adderID, payload.RacerName, newColor, sql.NullString{})
+	var newRacer *database.Racer
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		newRacer, err = s.db.AddRacerToEvent(tx, eventID, adderID, payload.RacerName, newColor, sql.NullString{})
+		if err != nil {
+			return err
+		}
+		newRacer.Bib, newRacer.Category, newRacer.Club, newRacer.Nationality = details.Bib, details.Category, details.Club, details.Nationality
+		newRacer.HandicapFactor, newRacer.Age, newRacer.Class, newRacer.StartOffset = details.HandicapFactor, details.Age, details.Class, details.StartOffset
+		if err := s.db.UpdateRacerDetails(tx, newRacer); err != nil {
+			return err
+		}
+		return s.recordScoringChanges(tx, adderID, nil, newRacer)
+	})
 	if err != nil {
 		s.errorJSON(w, errors.New("failed to add racer to event"), http.StatusInternalServerError)
 		return
@@ -120,45 +151,134 @@ func (s *Server) handleGetRacersForEvent(w http.ResponseWriter, r *http.Request)
 	//s.writeJSON(w, http.StatusOK, envelope{"racers": racers})
 }
 
-// handleUpdateRacerColor handles requests to change a racer's color.
-func (s *Server) handleUpdateRacerColor(w http.ResponseWriter, r *http.Request) {
-	// Simple auth: just check if the user is a group member.
-	adderID, err := s.getUserIDFromContext(r)
+// handleUpdateRacer handles requests to change a racer's color or entry
+// details. The event owner, the user who added the racer and the user linked
+// to them can do so, but only the event owner can change the details that
+// handicaps are scored by.
+func (s *Server) handleUpdateRacer(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
 	if err != nil {
 		s.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
-	groupID, _ := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
-	isMember, err := s.db.IsUserGroupMember(s.db.GetMainDB(), groupID, adderID)
-	if err != nil || !isMember {
-		s.errorJSON(w, errors.New("forbidden: you are not a member of this group"), http.StatusForbidden)
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
 		return
 	}
-
-	racerID, _ := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	groupID, racerID := event.GroupID, racer.ID
 
 	var payload struct {
-		Color string `json:"color"`
+		Color *string `json:"color"`
+		racerDetailsPayload
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		s.errorJSON(w, errors.New("invalid request body"), http.StatusBadRequest)
 		return
 	}
+	if payload.setsScoring() && userID != event.CreatorUserID {
+		s.errorJSON(w, errScoringOwnerOnly, http.StatusForbidden)
+		return
+	}
 
 	groupDB, err := s.db.GetGroupDB(groupID)
 	if err != nil {
 		s.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
+	otherRacers, err := s.db.GetRacersByEventID(groupDB, racer.EventID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	before := *racer
+	if err := applyRacerDetails(racer, payload.racerDetailsPayload, otherRacers); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
 
-	if err := s.db.UpdateRacerColor(groupDB, racerID, payload.Color); err != nil {
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		if payload.Color != nil {
+			if err := s.db.UpdateRacerColor(tx, racerID, *payload.Color); err != nil {
+				return err
+			}
+			racer.TrackColor = *payload.Color
+		}
+		if err := s.db.UpdateRacerDetails(tx, racer); err != nil {
+			return err
+		}
+		return s.recordScoringChanges(tx, userID, &before, racer)
+	})
+	if err != nil {
 		s.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, envelope{"message": "color updated successfully"})
+	s.writeJSON(w, http.StatusOK, envelope{"message": "racer updated successfully", "racer": toRacerResponse(racer)})
+}
+
+// applyRacerDetails validates the details given for a racer and sets them.
+// Bibs must be unique among the other racers of the event, nationalities are
+// stored as upper case country codes and handicaps cannot be negative.
+func applyRacerDetails(racer *database.Racer, payload racerDetailsPayload, eventRacers []*database.Racer) error {
+	if payload.Bib != nil {
+		bib := strings.TrimSpace(*payload.Bib)
+		for _, other := range eventRacers {
+			if bib != "" && other.ID != racer.ID && other.Bib == bib {
+				return fmt.Errorf("bib %s is already taken by %s", bib, other.RacerName)
+			}
+		}
+		racer.Bib = bib
+	}
+	if payload.Category != nil {
+		racer.Category = strings.TrimSpace(*payload.Category)
+	}
+	if payload.Club != nil {
+		racer.Club = strings.TrimSpace(*payload.Club)
+	}
+	if payload.Nationality != nil {
+		nationality := strings.ToUpper(strings.TrimSpace(*payload.Nationality))
+		if nationality != "" && !countryCodePattern.MatchString(nationality) {
+			return errors.New("nationality must be a 2 or 3 letter country code")
+		}
+		racer.Nationality = nationality
+	}
+	if payload.HandicapFactor != nil {
+		if *payload.HandicapFactor < 0 {
+			return errors.New("handicapFactor cannot be negative")
+		}
+		racer.HandicapFactor = sql.NullFloat64{Float64: *payload.HandicapFactor, Valid: *payload.HandicapFactor > 0}
+	}
+	if payload.Age != nil {
+		if *payload.Age < 0 || *payload.Age > 150 {
+			return errors.New("age must be between 0 and 150")
+		}
+		racer.Age = sql.NullInt64{Int64: *payload.Age, Valid: *payload.Age > 0}
+	}
+	if payload.Class != nil {
+		racer.Class = strings.TrimSpace(*payload.Class)
+	}
+	if payload.StartOffset != nil {
+		if *payload.StartOffset < 0 {
+			return errors.New("startOffset cannot be negative")
+		}
+		racer.StartOffset = *payload.StartOffset
+	}
+	return nil
+}
+
+// errScoringOwnerOnly is returned when someone other than the event owner
+// tries to set the details that handicaps are scored by.
+var errScoringOwnerOnly = errors.New("forbidden: only the event owner can set handicapFactor, age, class and startOffset")
+
+// setsScoring reports whether the payload sets any of the details that
+// handicaps are scored by, which move adjusted results and pursuit starts.
+func (p racerDetailsPayload) setsScoring() bool {
+	return p.HandicapFactor != nil || p.Age != nil || p.Class != nil || p.StartOffset != nil
 }
 
+// countryCodePattern matches ISO 3166 alpha-2 and alpha-3 (or IOC) country codes.
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2,3}$`)
+
 // handleUpdateRacerAvatar handles requests to change a specific racer's avatar.
 func (s *Server) handleUpdateRacerAvatar(w http.ResponseWriter, r *http.Request) {
 	// Auth: Check if the user is a member of the group.
@@ -275,10 +395,11 @@ func (s *Server) handleDeleteRacer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Get the GPX file path BEFORE deleting the DB record.
-	gpxPathToDelete := ""
-	if racer.GpxFilePath.Valid {
-		gpxPathToDelete = racer.GpxFilePath.String
+	// 1. Get the GPX file paths BEFORE deleting the DB records.
+	trackFiles, err := s.db.GetTrackFilesByRacerID(groupDB, racerID)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not retrieve track files for cleanup"), http.StatusInternalServerError)
+		return
 	}
 
 	// 2. Delete the racer record from the database.
@@ -287,11 +408,23 @@ func (s *Server) handleDeleteRacer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. If a file was associated, delete it from the filesystem.
-	if gpxPathToDelete != "" {
-		fullPath := filepath.Join(s.config.GpxPath, gpxPathToDelete)
-		if err := os.Remove(fullPath); err != nil {
-			log.Printf("WARN: failed to delete gpx file %s: %v", fullPath, err)
+	// The racer's tracking device can no longer report positions.
+	s.revokeRacerAccess(groupID, racerID)
+	// A registered racer's place goes to the waitlist.
+	if err := s.releaseRacerRegistration(event, racerID); err != nil {
+		log.Printf("WARN: could not release the registration of racer %d: %v", racerID, err)
+	}
+
+	// 3. If files were associated, delete them from the filesystem.
+	if len(trackFiles) > 0 {
+		for _, f := range trackFiles {
+			fullPath := filepath.Join(s.config.GpxPath, f.FilePath)
+			if err := os.Remove(fullPath); err != nil {
+				log.Printf("WARN: failed to delete gpx file %s: %v", fullPath, err)
+			}
+		}
+		if err := s.refreshEventSpatialData(groupDB, event); err != nil {
+			log.Printf("WARN: could not update spatial data for event %d: %v", eventID, err)
 		}
 	}
 
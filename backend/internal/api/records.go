@@ -0,0 +1,503 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/realtime"
+	"github.com/intermernet/raceviz/internal/records"
+	"github.com/intermernet/raceviz/internal/results"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultSegmentRadius is how close a track must come to a segment's start and
+// end if no radius is given.
+const defaultSegmentRadius = 25.0 // Meters
+
+// --- Structs for JSON Payloads ---
+
+// segmentPayload defines a new segment.
+type segmentPayload struct {
+	Name     string  `json:"name"`
+	StartLat float64 `json:"startLat"`
+	StartLon float64 `json:"startLon"`
+	EndLat   float64 `json:"endLat"`
+	EndLon   float64 `json:"endLon"`
+	Radius   float64 `json:"radius"` // Meters; defaults to 25
+}
+
+// recordFlag marks a best effort in an event's results that set a record.
+type recordFlag struct {
+	Kind         string  `json:"kind"`  // "distance", "course" or "segment"
+	RefID        int64   `json:"refId"` // Meters, or the course or segment ID
+	Name         string  `json:"name"`
+	Time         float64 `json:"time"`         // Seconds
+	NewPR        bool    `json:"newPr"`        // Faster than the racer's user ever went before
+	CourseRecord bool    `json:"courseRecord"` // Faster than anyone in the group before; courses and segments only
+}
+
+// recordResponse is the fastest effort ever over a distance, course or segment.
+type recordResponse struct {
+	Kind      string    `json:"kind"`
+	RefID     int64     `json:"refId"`
+	Name      string    `json:"name"`
+	Time      float64   `json:"time"` // Seconds
+	StartedAt time.Time `json:"startedAt"`
+	RacerID   int64     `json:"racerId"`
+	RacerName string    `json:"racerName"`
+	EventID   int64     `json:"eventId"`
+	EventName string    `json:"eventName"`
+	UserID    int64     `json:"userId"`
+	Username  string    `json:"username"`
+}
+
+// --- HTTP Handlers ---
+
+// handleGetSegments lists a group's segments.
+func (s *Server) handleGetSegments(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	segments, err := s.db.GetSegments(groupDB)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"segments": toSegmentResponseList(segments)})
+}
+
+// handleCreateSegment adds a segment to a group. The best efforts of every
+// racer in the group are timed over it in the background.
+func (s *Server) handleCreateSegment(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var payload segmentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		s.errorJSON(w, errors.New("name is required"), http.StatusBadRequest)
+		return
+	}
+	for _, c := range [][2]float64{{payload.StartLat, payload.StartLon}, {payload.EndLat, payload.EndLon}} {
+		if c[0] < -90 || c[0] > 90 || c[1] < -180 || c[1] > 180 {
+			s.errorJSON(w, errors.New("invalid segment start or end"), http.StatusBadRequest)
+			return
+		}
+	}
+	if payload.Radius < 0 {
+		s.errorJSON(w, errors.New("radius cannot be negative"), http.StatusBadRequest)
+		return
+	}
+	if payload.Radius == 0 {
+		payload.Radius = defaultSegmentRadius
+	}
+
+	var seg *database.Segment
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		var err error
+		seg, err = s.db.CreateSegment(tx, &database.Segment{
+			Name:     payload.Name,
+			StartLat: payload.StartLat, StartLon: payload.StartLon,
+			EndLat: payload.EndLat, EndLon: payload.EndLon,
+			Radius:        payload.Radius,
+			CreatorUserID: userID,
+		})
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to create segment"), http.StatusInternalServerError)
+		return
+	}
+	go s.refreshGroupBestEfforts(groupID, groupDB)
+
+	s.writeJSON(w, http.StatusCreated, envelope{"segment": toSegmentResponse(seg)})
+}
+
+// handleDeleteSegment deletes a segment and its efforts. Only the segment
+// creator can delete it.
+func (s *Server) handleDeleteSegment(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	segmentID, err := strconv.ParseInt(chi.URLParam(r, "segmentID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid segment ID"), http.StatusBadRequest)
+		return
+	}
+	seg, err := s.db.GetSegmentByID(groupDB, segmentID)
+	if err != nil {
+		s.errorJSON(w, errors.New("segment not found"), http.StatusNotFound)
+		return
+	}
+	if seg.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the segment creator can delete this segment"), http.StatusForbidden)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.DeleteSegment(tx, seg.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete segment"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "segment deleted successfully"})
+}
+
+// handleGetGroupRecords returns the all-time records of a group: the fastest
+// effort ever on each course and segment, and over each standard distance.
+func (s *Server) handleGetGroupRecords(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	s.writeRecords(w, groupDB, 0)
+}
+
+// handleGetPersonalRecords returns a user's personal bests in a group: their
+// fastest effort on each course and segment and over each standard distance.
+// Without a userId query parameter, the requesting user's are returned.
+func (s *Server) handleGetPersonalRecords(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	if q := r.URL.Query().Get("userId"); q != "" {
+		id, err := strconv.ParseInt(q, 10, 64)
+		if err != nil {
+			s.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+			return
+		}
+		userID = id
+	}
+	s.writeRecords(w, groupDB, userID)
+}
+
+// writeRecords writes the fastest efforts in a group, or of one user if
+// userID isn't zero.
+func (s *Server) writeRecords(w http.ResponseWriter, groupDB *sql.DB, userID int64) {
+	efforts, err := s.db.GetRecordEfforts(groupDB, userID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	names, err := s.effortNames(groupDB)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	userIDs := make(map[int64]struct{})
+	for _, e := range efforts {
+		userIDs[e.UserID] = struct{}{}
+	}
+	users, err := s.db.GetUsersByIDs(s.db.GetMainDB(), userIDs)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	list := []recordResponse{}
+	for _, e := range efforts {
+		racer, err := s.db.GetRacerByID(groupDB, e.RacerID)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		event, err := s.db.GetEventByID(groupDB, e.EventID)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		list = append(list, recordResponse{
+			Kind:      e.Kind,
+			RefID:     e.RefID,
+			Name:      names.name(e.Kind, e.RefID),
+			Time:      e.Seconds,
+			StartedAt: e.StartedAt.UTC(),
+			RacerID:   racer.ID,
+			RacerName: racer.RacerName,
+			EventID:   event.ID,
+			EventName: event.Name,
+			UserID:    e.UserID,
+			Username:  usernames[e.UserID],
+		})
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"records": list})
+}
+
+// --- Best efforts ---
+
+// updateBestEfforts times a racer's track over the standard distances, the
+// event's course and the group's segments, and replaces their best efforts.
+// Efforts only count as personal bests of the user linked to the racer; those
+// of a racer without one still count towards course records. With notify, the
+// racer's user is told about any personal or course record the new efforts set.
+func (s *Server) updateBestEfforts(groupDB *sql.DB, event *database.Event, racer *database.Racer, notify bool) error {
+	path, err := s.processRacerTrack(event, racer)
+	if err != nil {
+		return err
+	}
+	segments, err := s.db.GetSegments(groupDB)
+	if err != nil {
+		return err
+	}
+
+	var found []records.Effort
+	if path != nil && len(path.Points) > 0 {
+		// Time trial tracks are normalized to start at the epoch; efforts are
+		// compared across events by when they really started.
+		var shift time.Duration
+		if event.EventType == "time_trial" && racer.TrackFileCount > 0 {
+			start, err := s.recordedTrackStart(groupDB, racer)
+			if err != nil {
+				return err
+			}
+			if !start.IsZero() {
+				shift = start.Sub(path.Points[0].Timestamp)
+			}
+		}
+
+		found = records.DistanceEfforts(path.Points)
+		for _, seg := range segments {
+			e, ok := records.SegmentEffort(path.Points, records.Segment{
+				ID:     seg.ID,
+				Start:  gpx.TrackPoint{Lat: seg.StartLat, Lon: seg.StartLon},
+				End:    gpx.TrackPoint{Lat: seg.EndLat, Lon: seg.EndLon},
+				Radius: seg.Radius,
+			})
+			if ok {
+				found = append(found, e)
+			}
+		}
+		for i := range found {
+			found[i].Start = found[i].Start.Add(shift)
+		}
+
+		if event.CourseID.Valid {
+			checkpoints, err := s.resultCheckpoints(groupDB, event)
+			if err != nil {
+				return err
+			}
+			if res := trackResult(event, racer, path, checkpoints); res.Status == results.StatusFinished {
+				start := res.Start
+				if racer.LiveStatus != liveStatusFinished {
+					start = start.Add(shift) // Timed from the track, not a live finish
+				}
+				found = append(found, records.Effort{Kind: records.KindCourse, RefID: event.CourseID.Int64, Start: start, Time: res.Elapsed})
+			}
+		}
+	}
+
+	before, err := s.racerRecordFlags(groupDB, event, racer)
+	if err != nil {
+		return err
+	}
+	efforts := make([]*database.BestEffort, len(found))
+	for i, e := range found {
+		efforts[i] = &database.BestEffort{
+			EventID:   event.ID,
+			UserID:    racer.UserID.Int64,
+			Kind:      e.Kind,
+			RefID:     e.RefID,
+			Seconds:   e.Time.Seconds(),
+			StartedAt: e.Start.UTC(),
+		}
+	}
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ReplaceBestEfforts(tx, racer.ID, efforts)
+	})
+	if err != nil || !notify || !racer.UserID.Valid {
+		return err
+	}
+
+	after, err := s.racerRecordFlags(groupDB, event, racer)
+	if err != nil {
+		return err
+	}
+	for key, flag := range after {
+		old := before[key]
+		if flag.NewPR && !old.NewPR {
+			s.notifyRecord(event, racer, "personal_record", flag)
+		}
+		if flag.CourseRecord && !old.CourseRecord {
+			s.notifyRecord(event, racer, "course_record", flag)
+		}
+	}
+	return nil
+}
+
+// recordedTrackStart returns the time of the first point in a racer's track
+// files, as recorded. It returns the zero time if their files are empty.
+func (s *Server) recordedTrackStart(groupDB *sql.DB, racer *database.Racer) (time.Time, error) {
+	files, err := s.db.GetTrackFilesByRacerID(groupDB, racer.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, f := range files {
+		points, err := gpx.ReadFile(filepath.Join(s.config.GpxPath, f.FilePath))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(points) > 0 {
+			return points[0].Timestamp, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// notifyRecord tells a racer's user about a record they set.
+func (s *Server) notifyRecord(event *database.Event, racer *database.Racer, messageType string, flag recordFlag) {
+	s.broker.NotifyUser(racer.UserID.Int64, realtime.Message{
+		Type: messageType,
+		Payload: map[string]interface{}{
+			"groupId":   event.GroupID,
+			"eventId":   event.ID,
+			"eventName": event.Name,
+			"racerId":   racer.ID,
+			"racerName": racer.RacerName,
+			"record":    flag,
+		},
+	})
+}
+
+// refreshBestEfforts updates a racer's best efforts in the background, e.g.
+// after their track changed. Failures are only logged.
+func (s *Server) refreshBestEfforts(groupDB *sql.DB, event *database.Event, racerID int64, notify bool) {
+	go func() {
+		// Reload the racer, whose track files have changed.
+		racer, err := s.db.GetRacerByID(groupDB, racerID)
+		if err == nil {
+			err = s.updateBestEfforts(groupDB, event, racer, notify)
+		}
+		if err != nil {
+			log.Printf("WARN: could not update best efforts of racer %d in event %d: %v", racerID, event.ID, err)
+		}
+	}()
+}
+
+// refreshEventBestEfforts updates the best efforts of every racer in an event,
+// e.g. after it changed course. Failures are only logged.
+func (s *Server) refreshEventBestEfforts(groupDB *sql.DB, event *database.Event) {
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		log.Printf("WARN: could not load racers of event %d for best efforts: %v", event.ID, err)
+		return
+	}
+	for _, racer := range racers {
+		if err := s.updateBestEfforts(groupDB, event, racer, false); err != nil {
+			log.Printf("WARN: could not update best efforts of racer %d in event %d: %v", racer.ID, event.ID, err)
+		}
+	}
+}
+
+// refreshGroupBestEfforts updates the best efforts of every racer in a group,
+// e.g. after a segment was added.
+func (s *Server) refreshGroupBestEfforts(groupID int64, groupDB *sql.DB) {
+	events, err := s.db.GetEventsByGroupID(groupDB, groupID)
+	if err != nil {
+		log.Printf("WARN: could not load events of group %d for best efforts: %v", groupID, err)
+		return
+	}
+	for _, event := range events {
+		s.refreshEventBestEfforts(groupDB, event)
+	}
+}
+
+// racerRecordFlags returns the records set by a racer's best efforts, keyed by
+// kind and reference.
+func (s *Server) racerRecordFlags(groupDB *sql.DB, event *database.Event, racer *database.Racer) (map[string]recordFlag, error) {
+	flags, err := s.eventRecordFlags(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]recordFlag)
+	for _, flag := range flags[racer.ID] {
+		byKey[fmt.Sprintf("%s:%d", flag.Kind, flag.RefID)] = flag
+	}
+	return byKey, nil
+}
+
+// eventRecordFlags returns the records set by the best efforts in an event,
+// by racer. Efforts that didn't set a record are left out.
+func (s *Server) eventRecordFlags(groupDB database.DBorTx, event *database.Event) (map[int64][]recordFlag, error) {
+	efforts, err := s.db.GetBestEffortsByEventID(groupDB, event.ID)
+	if err != nil || len(efforts) == 0 {
+		return nil, err
+	}
+	names, err := s.effortNames(groupDB)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[int64][]recordFlag)
+	for _, e := range efforts {
+		flag := recordFlag{Kind: e.Kind, RefID: e.RefID, Name: names.name(e.Kind, e.RefID), Time: e.Seconds}
+		flag.NewPR = e.UserBefore.Valid && e.Seconds < e.UserBefore.Float64
+		flag.CourseRecord = e.Kind != records.KindDistance && e.Seconds == e.EventBest &&
+			(!e.RecordBefore.Valid || e.Seconds < e.RecordBefore.Float64)
+		if flag.NewPR || flag.CourseRecord {
+			flags[e.RacerID] = append(flags[e.RacerID], flag)
+		}
+	}
+	return flags, nil
+}
+
+// effortNames names the distances, courses and segments efforts are timed over.
+type effortNames struct {
+	courses  map[int64]string
+	segments map[int64]string
+}
+
+func (n effortNames) name(kind string, refID int64) string {
+	switch kind {
+	case records.KindCourse:
+		return n.courses[refID]
+	case records.KindSegment:
+		return n.segments[refID]
+	}
+	return records.DistanceName(int(refID))
+}
+
+// effortNames loads the names of a group's courses and segments.
+func (s *Server) effortNames(groupDB database.DBorTx) (effortNames, error) {
+	names := effortNames{courses: make(map[int64]string), segments: make(map[int64]string)}
+	courses, err := s.db.GetCourses(groupDB)
+	if err != nil {
+		return names, err
+	}
+	for _, c := range courses {
+		names.courses[c.ID] = c.Name
+	}
+	segments, err := s.db.GetSegments(groupDB)
+	if err != nil {
+		return names, err
+	}
+	for _, seg := range segments {
+		names.segments[seg.ID] = seg.Name
+	}
+	return names, nil
+}
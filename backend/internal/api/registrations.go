@@ -0,0 +1,693 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/realtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Registration statuses. Confirmed registrations have a racer in the event;
+// pending ones wait for the owner's approval and waitlisted ones for a place.
+const (
+	registrationPending    = "pending"
+	registrationConfirmed  = "confirmed"
+	registrationWaitlisted = "waitlisted"
+	registrationRejected   = "rejected"
+	registrationWithdrawn  = "withdrawn"
+)
+
+// errRegistrationRaced is returned when a registration's racer can't be taken
+// out of an event because they have already uploaded a track.
+var errRegistrationRaced = errors.New("the racer already has a track; delete the racer instead")
+
+// --- Structs for JSON Payloads ---
+
+// registrationSettingsPayload sets how members register for an event. All
+// settings are replaced.
+type registrationSettingsPayload struct {
+	Enabled   bool                            `json:"enabled"`
+	OpensAt   string                          `json:"opensAt"`  // RFC 3339; empty to open straight away
+	ClosesAt  string                          `json:"closesAt"` // RFC 3339; empty to close when the event starts
+	Capacity  int                             `json:"capacity"` // 0 for unlimited
+	Approval  bool                            `json:"approval"`
+	Questions []database.RegistrationQuestion `json:"questions"` // IDs are assigned if empty
+}
+
+// registerPayload enters the requesting member into an event.
+type registerPayload struct {
+	RacerName string            `json:"racerName"` // Defaults to the member's username
+	Answers   map[string]string `json:"answers"`   // By question ID
+}
+
+// registrationInfo tells a member whether and how they can register for an event.
+type registrationInfo struct {
+	RegistrationSettingsResponse
+	Open       bool `json:"open"`
+	Confirmed  int  `json:"confirmed"`  // Racers in the event
+	SpotsLeft  *int `json:"spotsLeft"`  // Null if the capacity is unlimited
+	Waitlisted int  `json:"waitlisted"` // Registrations waiting for a place
+}
+
+// --- HTTP Handlers ---
+
+// handleGetRegistration tells the requesting member about registration for an
+// event: whether it's open, the places left, the questions to answer, and
+// their own registration if they have one.
+func (s *Server) handleGetRegistration(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	_, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	info, err := s.registrationInfo(groupDB, event, time.Now())
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := envelope{"registration": info, "myRegistration": nil}
+	reg, err := s.db.GetRegistration(groupDB, event.ID, userID)
+	if err == nil {
+		mine, err := s.registrationResponse(groupDB, reg)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		resp["myRegistration"] = mine
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRegister enters the requesting member into an event while its
+// registration is open. They become a racer linked to their account straight
+// away if there is a place, are waitlisted if the event is full, or wait for
+// the owner's approval if the event requires it.
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	_, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	if !registrationOpen(event, time.Now()) {
+		s.errorJSON(w, errors.New("registration for this event is not open"), http.StatusBadRequest)
+		return
+	}
+
+	var payload registerPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	answers, err := validateAnswers(event.RegistrationQuestions, payload.Answers)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	racerName := strings.TrimSpace(payload.RacerName)
+	if racerName == "" {
+		user, err := s.db.GetUserByID(s.db.GetMainDB(), userID)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		racerName = user.Username
+	}
+
+	var reg *database.Registration
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		previous, err := s.db.GetRegistration(tx, event.ID, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if previous != nil {
+			switch previous.Status {
+			case registrationRejected:
+				return &registrationError{http.StatusForbidden, errors.New("your registration for this event was rejected")}
+			case registrationPending, registrationConfirmed, registrationWaitlisted:
+				return &registrationError{http.StatusConflict, errors.New("you have already registered for this event")}
+			}
+		}
+
+		reg = &database.Registration{EventID: event.ID, UserID: userID, RacerName: racerName, Answers: answers, Status: registrationPending}
+		if previous != nil {
+			reg.ID = previous.ID
+			reg, err = s.db.RenewRegistration(tx, reg)
+		} else {
+			reg, err = s.db.CreateRegistration(tx, reg)
+		}
+		if err != nil || event.RegistrationApproval {
+			return err
+		}
+		return s.admitRegistration(tx, event, reg)
+	})
+	if err != nil {
+		var regErr *registrationError
+		if errors.As(err, &regErr) {
+			s.errorJSON(w, regErr.err, regErr.status)
+			return
+		}
+		s.errorJSON(w, errors.New("failed to register"), http.StatusInternalServerError)
+		return
+	}
+
+	if reg.Status == registrationPending {
+		s.broker.NotifyUser(event.CreatorUserID, realtime.Message{
+			Type: "registration_pending",
+			Payload: map[string]interface{}{
+				"groupId":        event.GroupID,
+				"eventId":        event.ID,
+				"eventName":      event.Name,
+				"registrationId": reg.ID,
+				"racerName":      reg.RacerName,
+			},
+		})
+	}
+	resp, err := s.registrationResponse(groupDB, reg)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"registration": resp})
+}
+
+// handleWithdrawRegistration withdraws the requesting member's registration.
+// A confirmed registration's racer leaves the event, and their place goes to
+// the first on the waitlist.
+func (s *Server) handleWithdrawRegistration(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	_, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	reg, err := s.db.GetRegistration(groupDB, event.ID, userID)
+	if err != nil || (reg.Status != registrationPending && reg.Status != registrationConfirmed && reg.Status != registrationWaitlisted) {
+		s.errorJSON(w, errors.New("you are not registered for this event"), http.StatusNotFound)
+		return
+	}
+	s.endRegistration(w, groupDB, event, reg, registrationWithdrawn)
+}
+
+// handleGetRegistrations lists the registrations for an event, with their
+// answers, for the event owner.
+func (s *Server) handleGetRegistrations(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	registrations, err := s.db.GetRegistrationsByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	list := make([]RegistrationResponse, 0, len(registrations))
+	waitlisted := 0
+	for _, reg := range registrations {
+		var position int
+		if reg.Status == registrationWaitlisted {
+			waitlisted++
+			position = waitlisted
+		}
+		var username string
+		if user, err := s.db.GetUserByID(s.db.GetMainDB(), reg.UserID); err == nil {
+			username = user.Username
+		}
+		list = append(list, toRegistrationResponse(reg, username, position))
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"registrations": list})
+}
+
+// handleApproveRegistration lets the event owner approve a pending
+// registration. The registrant gets a place if one is left, or else joins the
+// waitlist.
+func (s *Server) handleApproveRegistration(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, reg, ok := s.loadOwnedRegistration(w, r)
+	if !ok {
+		return
+	}
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		// Check the registration again, as another approval may have got in first.
+		current, err := s.db.GetRegistrationByID(tx, reg.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != registrationPending {
+			return &registrationError{http.StatusConflict, fmt.Errorf("registration is already %s", current.Status)}
+		}
+		reg = current
+		return s.admitRegistration(tx, event, reg)
+	})
+	if err != nil {
+		var regErr *registrationError
+		if errors.As(err, &regErr) {
+			s.errorJSON(w, regErr.err, regErr.status)
+			return
+		}
+		s.errorJSON(w, errors.New("failed to approve registration"), http.StatusInternalServerError)
+		return
+	}
+	s.notifyRegistration(event, reg)
+	resp, err := s.registrationResponse(groupDB, reg)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"registration": resp})
+}
+
+// handleRejectRegistration lets the event owner reject a registration. A
+// confirmed registration's racer leaves the event, and their place goes to the
+// first on the waitlist.
+func (s *Server) handleRejectRegistration(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, reg, ok := s.loadOwnedRegistration(w, r)
+	if !ok {
+		return
+	}
+	if reg.Status == registrationRejected || reg.Status == registrationWithdrawn {
+		s.errorJSON(w, fmt.Errorf("registration is already %s", reg.Status), http.StatusConflict)
+		return
+	}
+	s.endRegistration(w, groupDB, event, reg, registrationRejected)
+}
+
+// --- Helpers ---
+
+// registrationError is a registration that can't be made, with the HTTP
+// status that describes why.
+type registrationError struct {
+	status int
+	err    error
+}
+
+func (e *registrationError) Error() string { return e.err.Error() }
+
+// loadOwnedRegistration loads the event and registration named in the URL for
+// the event owner. On failure the error response has already been written.
+func (s *Server) loadOwnedRegistration(w http.ResponseWriter, r *http.Request) (*sql.DB, *database.Event, *database.Registration, bool) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	registrationID, err := strconv.ParseInt(chi.URLParam(r, "registrationID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid registration ID"), http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	reg, err := s.db.GetRegistrationByID(groupDB, registrationID)
+	if err != nil || reg.EventID != event.ID {
+		s.errorJSON(w, errors.New("registration not found"), http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	return groupDB, event, reg, true
+}
+
+// endRegistration withdraws or rejects a registration, taking its racer out of
+// the event and giving their place to the first on the waitlist, and writes
+// the response. Registrants are told when the owner rejects them or gives
+// them a place. The registration is read again before it is changed, as it may
+// have changed since reg was loaded.
+func (s *Server) endRegistration(w http.ResponseWriter, groupDB *sql.DB, event *database.Event, reg *database.Registration, status string) {
+	var racerID sql.NullInt64
+	var promoted []*database.Registration
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		current, err := s.db.GetRegistrationByID(tx, reg.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status == registrationRejected || current.Status == registrationWithdrawn {
+			return &registrationError{http.StatusConflict, fmt.Errorf("registration is already %s", current.Status)}
+		}
+		racerID = current.RacerID
+		if racerID.Valid {
+			files, err := s.db.GetTrackFilesByRacerID(tx, racerID.Int64)
+			if err != nil {
+				return err
+			}
+			if len(files) > 0 {
+				return errRegistrationRaced
+			}
+			if err := s.db.DeleteRacer(tx, racerID.Int64); err != nil {
+				return err
+			}
+		}
+		if err := s.db.SetRegistrationStatus(tx, reg.ID, status, sql.NullInt64{}); err != nil {
+			return err
+		}
+		if reg, err = s.db.GetRegistrationByID(tx, reg.ID); err != nil {
+			return err
+		}
+		promoted, err = s.promoteWaitlist(tx, event)
+		return err
+	})
+	if err != nil {
+		var regErr *registrationError
+		if errors.As(err, &regErr) {
+			s.errorJSON(w, regErr.err, regErr.status)
+			return
+		}
+		if errors.Is(err, errRegistrationRaced) {
+			s.errorJSON(w, err, http.StatusConflict)
+			return
+		}
+		s.errorJSON(w, errors.New("failed to update registration"), http.StatusInternalServerError)
+		return
+	}
+	if racerID.Valid {
+		s.revokeRacerAccess(event.GroupID, racerID.Int64)
+	}
+
+	if status == registrationRejected {
+		s.notifyRegistration(event, reg)
+	}
+	for _, p := range promoted {
+		s.notifyRegistration(event, p)
+	}
+	resp, err := s.registrationResponse(groupDB, reg)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"registration": resp})
+}
+
+// releaseRacerRegistration withdraws the registration a deleted racer was
+// entered by, if any, and gives their place to the first on the waitlist.
+func (s *Server) releaseRacerRegistration(event *database.Event, racerID int64) error {
+	var promoted []*database.Registration
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		reg, err := s.db.GetRegistrationByRacerID(tx, racerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.db.SetRegistrationStatus(tx, reg.ID, registrationWithdrawn, sql.NullInt64{}); err != nil {
+			return err
+		}
+		promoted, err = s.promoteWaitlist(tx, event)
+		return err
+	})
+	for _, p := range promoted {
+		s.notifyRegistration(event, p)
+	}
+	return err
+}
+
+// fillEventPlaces gives any places left in an event to the first on its
+// waitlist, e.g. after its capacity was raised.
+func (s *Server) fillEventPlaces(event *database.Event) error {
+	var promoted []*database.Registration
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		var err error
+		promoted, err = s.promoteWaitlist(tx, event)
+		return err
+	})
+	for _, p := range promoted {
+		s.notifyRegistration(event, p)
+	}
+	return err
+}
+
+// admitRegistration confirms a registration if the event has a place left,
+// entering the registrant as a racer linked to their account, or else
+// waitlists it. reg is updated to match.
+func (s *Server) admitRegistration(tx *sql.Tx, event *database.Event, reg *database.Registration) error {
+	racers, err := s.db.GetRacersByEventID(tx, event.ID)
+	if err != nil {
+		return err
+	}
+	if event.RegistrationCapacity > 0 && len(racers) >= event.RegistrationCapacity {
+		if err := s.db.SetRegistrationStatus(tx, reg.ID, registrationWaitlisted, sql.NullInt64{}); err != nil {
+			return err
+		}
+		reg.Status = registrationWaitlisted
+		return nil
+	}
+
+	usedColors := make(map[string]bool, len(racers))
+	for _, racer := range racers {
+		usedColors[racer.TrackColor] = true
+	}
+	racer, err := s.db.AddRacerToEvent(tx, event.ID, reg.UserID, reg.RacerName, distinctColor(usedColors), sql.NullString{})
+	if err != nil {
+		return err
+	}
+	racerID := sql.NullInt64{Int64: racer.ID, Valid: true}
+	if err := s.db.SetRacerUser(tx, racer.ID, sql.NullInt64{Int64: reg.UserID, Valid: true}); err != nil {
+		return err
+	}
+	if err := s.db.SetRegistrationStatus(tx, reg.ID, registrationConfirmed, racerID); err != nil {
+		return err
+	}
+	reg.Status, reg.RacerID = registrationConfirmed, racerID
+	return nil
+}
+
+// promoteWaitlist confirms waitlisted registrations, in the order they were
+// made, while the event has places left. It returns the registrations promoted.
+func (s *Server) promoteWaitlist(tx *sql.Tx, event *database.Event) ([]*database.Registration, error) {
+	registrations, err := s.db.GetRegistrationsByEventID(tx, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []*database.Registration
+	for _, reg := range registrations {
+		if reg.Status != registrationWaitlisted {
+			continue
+		}
+		if err := s.admitRegistration(tx, event, reg); err != nil {
+			return nil, err
+		}
+		if reg.Status != registrationConfirmed {
+			break // The event is full again.
+		}
+		promoted = append(promoted, reg)
+	}
+	return promoted, nil
+}
+
+// notifyRegistration tells a registrant that their registration's status
+// changed, over SSE and by email.
+func (s *Server) notifyRegistration(event *database.Event, reg *database.Registration) {
+	payload := map[string]interface{}{
+		"groupId":        event.GroupID,
+		"eventId":        event.ID,
+		"eventName":      event.Name,
+		"registrationId": reg.ID,
+		"status":         reg.Status,
+	}
+	if reg.RacerID.Valid {
+		payload["racerId"] = reg.RacerID.Int64
+	}
+	s.broker.NotifyUser(reg.UserID, realtime.Message{Type: "registration_status", Payload: payload})
+
+	user, err := s.db.GetUserByID(s.db.GetMainDB(), reg.UserID)
+	if err != nil {
+		log.Printf("ERROR: Could not look up user %d for registration email: %v", reg.UserID, err)
+		return
+	}
+	var update string
+	switch reg.Status {
+	case registrationConfirmed:
+		update = fmt.Sprintf("Your registration for '%s' is confirmed. You're in!", event.Name)
+	case registrationWaitlisted:
+		update = fmt.Sprintf("Your registration for '%s' was approved, but the event is full, so you're on the waitlist. We'll let you know if a place opens up.", event.Name)
+	case registrationRejected:
+		update = fmt.Sprintf("Your registration for '%s' was not accepted.", event.Name)
+	default:
+		return
+	}
+	eventLink := fmt.Sprintf("%s/groups/%d/events/%d", s.config.FrontendURL, event.GroupID, event.ID)
+	// Send in the background so a slow mail server doesn't hold up the request.
+	go func() {
+		if err := s.email.SendRegistrationEmail(user.Email, event.Name, update, eventLink); err != nil {
+			log.Printf("ERROR: Failed to send registration email for registration %d: %v", reg.ID, err)
+		}
+	}()
+}
+
+// registrationInfo describes the state of an event's registration.
+func (s *Server) registrationInfo(groupDB *sql.DB, event *database.Event, now time.Time) (*registrationInfo, error) {
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	registrations, err := s.db.GetRegistrationsByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	info := &registrationInfo{
+		RegistrationSettingsResponse: toEventResponse(event).Registration,
+		Open:                         registrationOpen(event, now),
+		Confirmed:                    len(racers),
+	}
+	for _, reg := range registrations {
+		if reg.Status == registrationWaitlisted {
+			info.Waitlisted++
+		}
+	}
+	if event.RegistrationCapacity > 0 {
+		left := max(event.RegistrationCapacity-len(racers), 0)
+		info.SpotsLeft = &left
+	}
+	return info, nil
+}
+
+// registrationResponse converts a registration to its DTO, with the
+// registrant's username and their place on the waitlist.
+func (s *Server) registrationResponse(groupDB database.DBorTx, reg *database.Registration) (RegistrationResponse, error) {
+	var position int
+	if reg.Status == registrationWaitlisted {
+		registrations, err := s.db.GetRegistrationsByEventID(groupDB, reg.EventID)
+		if err != nil {
+			return RegistrationResponse{}, err
+		}
+		for _, other := range registrations {
+			if other.Status == registrationWaitlisted {
+				position++
+			}
+			if other.ID == reg.ID {
+				break
+			}
+		}
+	}
+	var username string
+	if user, err := s.db.GetUserByID(s.db.GetMainDB(), reg.UserID); err == nil {
+		username = user.Username
+	}
+	return toRegistrationResponse(reg, username, position), nil
+}
+
+// revokeRacerAccess revokes the device token and guest upload links of a
+// racer who left an event.
+func (s *Server) revokeRacerAccess(groupID, racerID int64) {
+	err := s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		if err := s.db.DeleteUploadLinksForRacer(tx, groupID, racerID); err != nil {
+			return err
+		}
+		return s.db.DeleteDeviceTokenForRacer(tx, groupID, racerID)
+	})
+	if err != nil {
+		log.Printf("WARN: failed to revoke device token and upload links for racer %d: %v", racerID, err)
+	}
+}
+
+// registrationOpen reports whether members can register for an event: it
+// takes registrations, they have opened, and neither the closing time nor the
+// event start has passed.
+func registrationOpen(event *database.Event, now time.Time) bool {
+	if !event.RegistrationEnabled {
+		return false
+	}
+	if event.RegistrationOpensAt.Valid && now.Before(event.RegistrationOpensAt.Time) {
+		return false
+	}
+	if event.RegistrationClosesAt.Valid {
+		return now.Before(event.RegistrationClosesAt.Time)
+	}
+	return !event.StartDate.Valid || now.Before(event.StartDate.Time)
+}
+
+// applyRegistrationSettings validates an event's registration settings and
+// sets them.
+func applyRegistrationSettings(event *database.Event, payload registrationSettingsPayload) error {
+	var opensAt, closesAt sql.NullTime
+	if payload.OpensAt != "" {
+		t, err := time.Parse(time.RFC3339, payload.OpensAt)
+		if err != nil {
+			return errors.New("registration opensAt must be an RFC 3339 time")
+		}
+		opensAt = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	if payload.ClosesAt != "" {
+		t, err := time.Parse(time.RFC3339, payload.ClosesAt)
+		if err != nil {
+			return errors.New("registration closesAt must be an RFC 3339 time")
+		}
+		closesAt = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	if opensAt.Valid && closesAt.Valid && !opensAt.Time.Before(closesAt.Time) {
+		return errors.New("registration must open before it closes")
+	}
+	if payload.Capacity < 0 {
+		return errors.New("registration capacity cannot be negative")
+	}
+
+	questions := make([]database.RegistrationQuestion, 0, len(payload.Questions))
+	seen := make(map[string]bool)
+	for i, q := range payload.Questions {
+		q.ID = strings.TrimSpace(q.ID)
+		if q.ID == "" {
+			q.ID = fmt.Sprintf("q%d", i+1)
+		}
+		q.Label = strings.TrimSpace(q.Label)
+		if q.Label == "" {
+			return fmt.Errorf("registration question %d needs a label", i+1)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("registration question ID %s is used twice", q.ID)
+		}
+		seen[q.ID] = true
+		var options []string
+		for _, option := range q.Options {
+			if option = strings.TrimSpace(option); option != "" && !slices.Contains(options, option) {
+				options = append(options, option)
+			}
+		}
+		q.Options = options
+		questions = append(questions, q)
+	}
+
+	event.RegistrationEnabled = payload.Enabled
+	event.RegistrationOpensAt, event.RegistrationClosesAt = opensAt, closesAt
+	event.RegistrationCapacity = payload.Capacity
+	event.RegistrationApproval = payload.Approval
+	event.RegistrationQuestions = questions
+	return nil
+}
+
+// validateAnswers checks a registrant's answers to an event's registration
+// questions and returns them trimmed, leaving out empty answers.
+func validateAnswers(questions []database.RegistrationQuestion, answers map[string]string) (map[string]string, error) {
+	valid := make(map[string]string, len(questions))
+	for _, q := range questions {
+		answer := strings.TrimSpace(answers[q.ID])
+		switch {
+		case answer == "" && q.Required:
+			return nil, fmt.Errorf("an answer to '%s' is required", q.Label)
+		case answer == "":
+			continue
+		case len(q.Options) > 0 && !slices.Contains(q.Options, answer):
+			return nil, fmt.Errorf("the answer to '%s' must be one of: %s", q.Label, strings.Join(q.Options, ", "))
+		}
+		valid[q.ID] = answer
+	}
+	for id := range answers {
+		if !slices.ContainsFunc(questions, func(q database.RegistrationQuestion) bool { return q.ID == id }) {
+			return nil, fmt.Errorf("unknown registration question %s", id)
+		}
+	}
+	return valid, nil
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/results"
+)
+
+// eventResults works out the result of every racer in an event, in the same
+// order as racers. Once the officials have recorded a racer's result, its
+// recorded status and time are used with their decisions applied.
+func (s *Server) eventResults(groupDB database.DBorTx, event *database.Event, racers []*database.Racer) ([]*results.Result, error) {
+	checkpoints, err := s.resultCheckpoints(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+	official, err := s.db.GetOfficialResultsByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*results.Result, len(racers))
+	for i, racer := range racers {
+		list[i] = s.racerResult(event, racer, checkpoints)
+		if o, ok := official[racer.ID]; ok {
+			list[i] = officialResult(list[i], o)
+		}
+	}
+	return list, nil
+}
+
+// officialResult applies the officials' decisions to a racer's recorded result.
+// computed supplies the start and finish of the racer's track.
+func officialResult(computed *results.Result, o *database.OfficialResult) *results.Result {
+	recorded := *computed
+	recorded.Status = o.ComputedStatus
+	recorded.Elapsed = seconds(o.ComputedTime)
+	decision := results.Decision{Status: o.StatusOverride, Penalties: seconds(o.Penalties)}
+	if o.TimeOverride.Valid {
+		decision.Elapsed = seconds(o.TimeOverride.Float64)
+	}
+	return decision.Apply(&recorded)
+}
+
+// seconds converts a time in seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// resultCheckpoints returns the checkpoints of an event, for timing results.
+func (s *Server) resultCheckpoints(groupDB database.DBorTx, event *database.Event) ([]results.Checkpoint, error) {
+	dbCheckpoints, err := s.db.GetCheckpointsByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]results.Checkpoint, len(dbCheckpoints))
+	for i, cp := range dbCheckpoints {
+		checkpoints[i] = results.Checkpoint{Lat: cp.Lat, Lon: cp.Lon, Radius: cp.Radius}
+	}
+	return checkpoints, nil
+}
+
+// racerResult works out a racer's result in an event from their track.
+func (s *Server) racerResult(event *database.Event, racer *database.Racer, checkpoints []results.Checkpoint) *results.Result {
+	path, err := s.processRacerTrack(event, racer)
+	if err != nil {
+		log.Printf("WARN: could not process track of racer %d for event %d: %v", racer.ID, event.ID, err)
+	}
+	return trackResult(event, racer, path, checkpoints)
+}
+
+// trackResult works out a racer's result in an event from their processed
+// track, which is nil if they have none.
+//
+// A finish recorded during live tracking is used as is. Otherwise the racer's
+// track must pass all of the event's checkpoints in order, and finishes at the
+// last one; without checkpoints the track finishes at its last point. Races are
+// timed from the racer's start (see racerStart), time trials from the first
+// checkpoint if there are at least two, or else from the first point of the track.
+func trackResult(event *database.Event, racer *database.Racer, path *gpx.TrackPath, checkpoints []results.Checkpoint) *results.Result {
+	res := &results.Result{RacerID: racer.ID, Status: results.StatusDNS}
+
+	switch {
+	case racer.LiveStatus == liveStatusDNF:
+		res.Status = results.StatusDNF
+		return res
+	case racer.LiveStatus == liveStatusFinished && racer.LiveStatusAt.Valid && event.StartDate.Valid:
+		res.Status = results.StatusFinished
+		res.Start, res.Finish = racerStart(event, racer), racer.LiveStatusAt.Time
+		res.Elapsed = res.Finish.Sub(res.Start)
+		return res
+	}
+
+	if path == nil || len(path.Points) == 0 {
+		return res
+	}
+	points := path.Points
+
+	res.Status = results.StatusDNF
+	res.Start, res.Finish = points[0].Timestamp, points[len(points)-1].Timestamp
+	if len(checkpoints) > 0 {
+		passed := results.PassTimes(points, checkpoints)
+		if len(passed) < len(checkpoints) {
+			return res
+		}
+		res.Finish = passed[len(passed)-1]
+		if event.EventType == "time_trial" && len(passed) >= 2 {
+			res.Start = passed[0]
+		}
+	}
+	if start := racerStart(event, racer); event.EventType == "race" && event.StartDate.Valid && start.Before(res.Finish) {
+		res.Start = start
+	}
+	res.Status = results.StatusFinished
+	res.Elapsed = res.Finish.Sub(res.Start)
+	return res
+}
+
+// racerStart returns when a racer starts a race: the event start, delayed by
+// the racer's start offset if they have one, as in a pursuit.
+func racerStart(event *database.Event, racer *database.Racer) time.Time {
+	return event.StartDate.Time.Add(seconds(racer.StartOffset))
+}
+
+// resultEntry is a racer's line in an event's results. Times are in seconds.
+type resultEntry struct {
+	Rank         int          `json:"rank"`         // Overall; 0 if the racer did not finish
+	CategoryRank int          `json:"categoryRank"` // Within the racer's category
+	RacerID      int64        `json:"racerId"`
+	RacerName    string       `json:"racerName"`
+	Bib          string       `json:"bib"`
+	Category     string       `json:"category"`
+	Club         string       `json:"club"`
+	Nationality  string       `json:"nationality"`
+	Status       string       `json:"status"`
+	Time         float64      `json:"time"`         // The time ranked on, raw or adjusted
+	RawTime      float64      `json:"rawTime"`      // As raced
+	AdjustedTime float64      `json:"adjustedTime"` // After the event's handicap; the raw time without one
+	Gap          float64      `json:"gap"`          // Behind the winner
+	CategoryGap  float64      `json:"categoryGap"`  // Behind the category winner
+	Records      []recordFlag `json:"records"`      // Personal and course records set in the event
+}
+
+// categoryPodium is the podium of one category.
+type categoryPodium struct {
+	Category string        `json:"category"`
+	Podium   []resultEntry `json:"podium"`
+}
+
+// podiumPlaces is the number of places on a podium. Ties can put more racers on it.
+const podiumPlaces = 3
+
+// handleGetEventResults returns the results of an event in overall order, with
+// each racer's place in their category. With a category query parameter, only
+// that category's racers are listed. Like the event map data, results are public.
+func (s *Server) handleGetEventResults(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	timing, ok := s.resultTiming(w, r, event)
+	if !ok {
+		return
+	}
+	entries, err := s.resultTable(groupDB, event, timing)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if category := strings.TrimSpace(r.URL.Query().Get("category")); category != "" {
+		filtered := []resultEntry{}
+		for _, e := range entries {
+			if strings.EqualFold(e.Category, category) {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"event":      toEventResponse(event),
+		"timing":     timing,
+		"categories": resultCategories(entries),
+		"results":    entries,
+	})
+}
+
+// handleGetEventPodium returns the first finishers of an event overall and in
+// each category.
+func (s *Server) handleGetEventPodium(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	timing, ok := s.resultTiming(w, r, event)
+	if !ok {
+		return
+	}
+	entries, err := s.resultTable(groupDB, event, timing)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	overall := []resultEntry{}
+	for _, e := range entries {
+		if e.Rank > 0 && e.Rank <= podiumPlaces {
+			overall = append(overall, e)
+		}
+	}
+	categories := []categoryPodium{}
+	for _, category := range resultCategories(entries) {
+		podium := categoryPodium{Category: category, Podium: []resultEntry{}}
+		for _, e := range entries {
+			if e.Category == category && e.CategoryRank > 0 && e.CategoryRank <= podiumPlaces {
+				podium.Podium = append(podium.Podium, e)
+			}
+		}
+		sort.SliceStable(podium.Podium, func(i, j int) bool { return podium.Podium[i].CategoryRank < podium.Podium[j].CategoryRank })
+		categories = append(categories, podium)
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"event":      toEventResponse(event),
+		"timing":     timing,
+		"overall":    overall,
+		"categories": categories,
+	})
+}
+
+// resultTable ranks the racers of an event overall and within their
+// categories, on their raw or handicap adjusted times. Entries are in overall order.
+func (s *Server) resultTable(groupDB database.DBorTx, event *database.Event, timing string) ([]resultEntry, error) {
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.eventResults(groupDB, event, racers)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*database.Racer, len(racers))
+	for _, racer := range racers {
+		byID[racer.ID] = racer
+	}
+	records, err := s.eventRecordFlags(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rank adjusted copies, keeping the raw times.
+	rules := handicapRules(event)
+	raw := make(map[int64]*results.Result, len(list))
+	adjusted := make(map[int64]time.Duration, len(list))
+	for i, res := range list {
+		raw[res.RacerID] = res
+		adjusted[res.RacerID] = rules.Adjust(res.Elapsed, racerEntrant(byID[res.RacerID]))
+		if timing == timingAdjusted {
+			copied := *res
+			copied.Elapsed = adjusted[res.RacerID]
+			list[i] = &copied
+		}
+	}
+
+	// Rank copies of each category's results, so the overall ranks are kept.
+	categoryResults := make(map[string][]*results.Result)
+	for _, res := range list {
+		category := byID[res.RacerID].Category
+		copied := *res
+		categoryResults[category] = append(categoryResults[category], &copied)
+	}
+	categoryRanks := make(map[int64]*results.Result, len(list))
+	for _, group := range categoryResults {
+		results.Rank(group)
+		for _, res := range group {
+			categoryRanks[res.RacerID] = res
+		}
+	}
+	results.Rank(list)
+
+	entries := make([]resultEntry, len(list))
+	var winner float64
+	categoryWinners := make(map[string]float64)
+	for i, res := range list {
+		racer := byID[res.RacerID]
+		e := resultEntry{
+			Rank:         res.Rank,
+			CategoryRank: categoryRanks[res.RacerID].Rank,
+			RacerID:      racer.ID,
+			RacerName:    racer.RacerName,
+			Bib:          racer.Bib,
+			Category:     racer.Category,
+			Club:         racer.Club,
+			Nationality:  racer.Nationality,
+			Status:       res.Status,
+			Records:      records[racer.ID],
+		}
+		if e.Records == nil {
+			e.Records = []recordFlag{}
+		}
+		if res.Finished() {
+			e.Time = res.Elapsed.Seconds()
+			e.RawTime = raw[res.RacerID].Elapsed.Seconds()
+			e.AdjustedTime = adjusted[res.RacerID].Seconds()
+			if res.Rank == 1 {
+				winner = e.Time
+			}
+			if e.CategoryRank == 1 {
+				categoryWinners[racer.Category] = e.Time
+			}
+			e.Gap = e.Time - winner
+			e.CategoryGap = e.Time - categoryWinners[racer.Category]
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// resultCategories returns the distinct non-empty categories of some results, sorted.
+func resultCategories(entries []resultEntry) []string {
+	seen := make(map[string]bool)
+	categories := []string{}
+	for _, e := range entries {
+		if e.Category != "" && !seen[e.Category] {
+			seen[e.Category] = true
+			categories = append(categories, e.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
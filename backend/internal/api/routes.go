@@ -39,7 +39,25 @@ func (s *Server) RegisterRoutes(r *chi.Mux) {
 		r.Get("/auth/google/callback", s.handleGoogleCallback)
 
 		// Public data routes
-		r.Get("/events/{groupID}/{eventID}/public", s.handleGetPublicEventData)
+		r.Get("/sports", s.handleGetSports)
+		r.With(s.optionalAuthMiddleware).Get("/events/{groupID}/{eventID}/public", s.handleGetPublicEventData)
+		r.Get("/events/{groupID}/{eventID}/live", s.handleEventStream)
+		r.Get("/events/{groupID}/{eventID}/results", s.handleGetEventResults)
+		r.Get("/events/{groupID}/{eventID}/podium", s.handleGetEventPodium)
+		r.Get("/events/{groupID}/{eventID}/results/official", s.handleGetOfficialResults)
+		r.Get("/events/{groupID}/{eventID}/results/csv", s.handleExportResults)
+		r.Get("/events/{groupID}/{eventID}/live/ranking", s.handleGetLiveRanking)
+		r.Get("/stage-races/{groupID}/{stageRaceID}/standings", s.handleGetStageRaceStandings)
+		r.Get("/series/{groupID}/{seriesID}/standings", s.handleGetSeriesStandings)
+
+		// Live tracking ingest. Devices authenticate with their device token
+		// rather than a JWT, so these sit outside the authenticated group.
+		r.Get("/live/ingest", s.handleLiveIngest)
+		r.Post("/live/ingest", s.handleLiveIngest)
+
+		// Guest uploads authenticate with the token of their upload link.
+		r.Get("/upload-links/{token}", s.handleGetGuestUpload)
+		r.Post("/upload-links/{token}", s.handleGuestUpload)
 
 		// --- Authenticated REST Routes ---
 		// This nested group uses our custom authMiddleware. Every route defined
@@ -56,6 +74,7 @@ func (s *Server) RegisterRoutes(r *chi.Mux) {
 			r.Patch("/users/me", s.handleUpdateMyProfile)
 			r.Delete("/users/me", s.handleDeleteMyProfile)
 			r.Put("/users/me/avatar", s.handleUpdateMyAvatar)
+			r.Get("/users/me/races", s.handleGetMyRaces)
 
 			// Group Routes
 			r.Get("/groups", s.handleGetMyGroups)
@@ -72,17 +91,111 @@ func (s *Server) RegisterRoutes(r *chi.Mux) {
 			r.Post("/invitations/{invitationID}/decline", s.handleDeclineInvitation)
 
 			// Event Routes
+			r.Get("/events/search", s.handleSearchEvents)
 			r.Get("/groups/{groupID}/events/{eventID}", s.handleGetEventDetails)
 			r.Post("/groups/{groupID}/events", s.handleCreateEvent)
+			r.Patch("/groups/{groupID}/events/{eventID}", s.handleUpdateEvent)
 			r.Delete("/groups/{groupID}/events/{eventID}", s.handleDeleteEvent)
 
+			// Course & Conditions Routes
+			r.Get("/groups/{groupID}/courses", s.handleGetCourses)
+			r.Post("/groups/{groupID}/courses", s.handleCreateCourse)
+			r.Get("/groups/{groupID}/courses/{courseID}", s.handleGetCourse)
+			r.Delete("/groups/{groupID}/courses/{courseID}", s.handleDeleteCourse)
+			r.Get("/groups/{groupID}/events/{eventID}/checkpoints", s.handleGetCheckpoints)
+			r.Put("/groups/{groupID}/events/{eventID}/checkpoints", s.handleReplaceCheckpoints)
+			r.Get("/groups/{groupID}/events/{eventID}/wind", s.handleGetWind)
+			r.Put("/groups/{groupID}/events/{eventID}/wind", s.handleSetWind)
+
+			// Segment & Record Routes
+			r.Get("/groups/{groupID}/segments", s.handleGetSegments)
+			r.Post("/groups/{groupID}/segments", s.handleCreateSegment)
+			r.Delete("/groups/{groupID}/segments/{segmentID}", s.handleDeleteSegment)
+			r.Get("/groups/{groupID}/records", s.handleGetGroupRecords)
+			r.Get("/groups/{groupID}/personal-records", s.handleGetPersonalRecords)
+
+			// Stage Race Routes
+			r.Get("/groups/{groupID}/stage-races", s.handleGetStageRaces)
+			r.Post("/groups/{groupID}/stage-races", s.handleCreateStageRace)
+			r.Get("/groups/{groupID}/stage-races/{stageRaceID}", s.handleGetStageRace)
+			r.Patch("/groups/{groupID}/stage-races/{stageRaceID}", s.handleUpdateStageRace)
+			r.Delete("/groups/{groupID}/stage-races/{stageRaceID}", s.handleDeleteStageRace)
+			r.Put("/groups/{groupID}/stage-races/{stageRaceID}/stages", s.handleSetStages)
+			r.Put("/groups/{groupID}/stage-races/{stageRaceID}/riders", s.handleSetStageRider)
+
+			// Series Routes
+			r.Get("/groups/{groupID}/series", s.handleGetAllSeries)
+			r.Post("/groups/{groupID}/series", s.handleCreateSeries)
+			r.Get("/groups/{groupID}/series/{seriesID}", s.handleGetSeries)
+			r.Patch("/groups/{groupID}/series/{seriesID}", s.handleUpdateSeries)
+			r.Delete("/groups/{groupID}/series/{seriesID}", s.handleDeleteSeries)
+			r.Put("/groups/{groupID}/series/{seriesID}/events", s.handleSetSeriesEvents)
+			r.Put("/groups/{groupID}/series/{seriesID}/riders", s.handleSetSeriesRider)
+			r.Put("/groups/{groupID}/series/{seriesID}/categories", s.handleSetSeriesCategory)
+
+			// Safety Incident Routes
+			r.Get("/groups/{groupID}/events/{eventID}/incidents", s.handleGetIncidents)
+			r.Post("/groups/{groupID}/events/{eventID}/incidents/{incidentID}/acknowledge", s.handleAcknowledgeIncident)
+			r.Post("/groups/{groupID}/events/{eventID}/incidents/{incidentID}/resolve", s.handleResolveIncident)
+
 			// Racer & GPX Routes
 			r.Get("/groups/{groupID}/events/{eventID}/racers", s.handleGetRacersForEvent)
 			r.Post("/groups/{groupID}/events/{eventID}/racers", s.handleAddRacer)
+			r.Post("/groups/{groupID}/events/{eventID}/racers/import", s.handleBulkImportRacers)
+			r.Get("/groups/{groupID}/events/{eventID}/racers/csv", s.handleExportStartList)
+			r.Post("/groups/{groupID}/events/{eventID}/racers/csv", s.handleImportStartList)
 			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}", s.handleDeleteRacer)
 			r.Post("/groups/{groupID}/events/{eventID}/racers/{racerID}/gpx", s.handleGpxUpload)
-			r.Patch("/groups/{groupID}/events/{eventID}/racers/{racerID}", s.handleUpdateRacerColor)
+			r.Get("/groups/{groupID}/events/{eventID}/racers/{racerID}/files", s.handleGetTrackFiles)
+			r.Put("/groups/{groupID}/events/{eventID}/racers/{racerID}/files/order", s.handleReorderTrackFiles)
+			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}/files/{fileID}", s.handleDeleteTrackFile)
+			r.Patch("/groups/{groupID}/events/{eventID}/racers/{racerID}", s.handleUpdateRacer)
 			r.Put("/groups/{groupID}/events/{eventID}/racers/{racerID}/avatar", s.handleUpdateRacerAvatar)
+			r.Get("/groups/{groupID}/events/{eventID}/racers/{racerID}/device-token", s.handleGetDeviceToken)
+			r.Post("/groups/{groupID}/events/{eventID}/racers/{racerID}/device-token", s.handleCreateDeviceToken)
+			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}/device-token", s.handleDeleteDeviceToken)
+			r.Put("/groups/{groupID}/events/{eventID}/racers/{racerID}/live-status", s.handleSetLiveStatus)
+			r.Get("/groups/{groupID}/events/{eventID}/racers/{racerID}/upload-links", s.handleGetUploadLinks)
+			r.Post("/groups/{groupID}/events/{eventID}/racers/{racerID}/upload-links", s.handleCreateUploadLink)
+			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}/upload-links/{token}", s.handleDeleteUploadLink)
+			r.Put("/groups/{groupID}/events/{eventID}/racers/{racerID}/team", s.handleSetRacerTeam)
+
+			// Ghost Routes
+			r.Get("/groups/{groupID}/events/{eventID}/racers/{racerID}/ghost-candidates", s.handleGetGhostCandidates)
+			r.Get("/groups/{groupID}/events/{eventID}/racers/{racerID}/ghosts", s.handleGetGhosts)
+			r.Post("/groups/{groupID}/events/{eventID}/racers/{racerID}/ghosts", s.handleAddGhost)
+			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}/ghosts/{ghostID}", s.handleDeleteGhost)
+
+			// Registration Routes
+			r.Get("/groups/{groupID}/events/{eventID}/registration", s.handleGetRegistration)
+			r.Post("/groups/{groupID}/events/{eventID}/registration", s.handleRegister)
+			r.Delete("/groups/{groupID}/events/{eventID}/registration", s.handleWithdrawRegistration)
+			r.Get("/groups/{groupID}/events/{eventID}/registrations", s.handleGetRegistrations)
+			r.Post("/groups/{groupID}/events/{eventID}/registrations/{registrationID}/approve", s.handleApproveRegistration)
+			r.Post("/groups/{groupID}/events/{eventID}/registrations/{registrationID}/reject", s.handleRejectRegistration)
+
+			// Racer Claim Routes
+			r.Post("/groups/{groupID}/events/{eventID}/racers/{racerID}/claim", s.handleClaimRacer)
+			r.Delete("/groups/{groupID}/events/{eventID}/racers/{racerID}/user", s.handleUnlinkRacer)
+			r.Get("/groups/{groupID}/racer-claims", s.handleGetRacerClaims)
+			r.Post("/groups/{groupID}/racer-claims/{claimID}/approve", s.handleApproveRacerClaim)
+			r.Post("/groups/{groupID}/racer-claims/{claimID}/reject", s.handleRejectRacerClaim)
+
+			// Team Routes
+			r.Get("/groups/{groupID}/events/{eventID}/teams", s.handleGetTeams)
+			r.Post("/groups/{groupID}/events/{eventID}/teams", s.handleCreateTeam)
+			r.Patch("/groups/{groupID}/events/{eventID}/teams/{teamID}", s.handleUpdateTeam)
+			r.Delete("/groups/{groupID}/events/{eventID}/teams/{teamID}", s.handleDeleteTeam)
+
+			// Handicap Routes
+			r.Post("/groups/{groupID}/events/{eventID}/handicap/pursuit-starts", s.handleSetPursuitStarts)
+
+			// Official Results Routes
+			r.Post("/groups/{groupID}/events/{eventID}/official-results/compute", s.handleComputeOfficialResults)
+			r.Get("/groups/{groupID}/events/{eventID}/official-results/changes", s.handleGetResultChanges)
+			r.Put("/groups/{groupID}/events/{eventID}/official-results/{racerID}", s.handleSetOfficialResult)
+			r.Post("/groups/{groupID}/events/{eventID}/official-results/{racerID}/penalties", s.handleAddResultPenalty)
+			r.Delete("/groups/{groupID}/events/{eventID}/official-results/{racerID}/penalties/{penaltyID}", s.handleDeleteResultPenalty)
 		})
 	})
 }
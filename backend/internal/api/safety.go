@@ -0,0 +1,458 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/realtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Types of safety incident.
+const (
+	incidentStationary = "stationary"
+	incidentOffCourse  = "off_course"
+	incidentNoSignal   = "no_signal"
+)
+
+// Statuses of a safety incident.
+const (
+	incidentOpen         = "open"
+	incidentAcknowledged = "acknowledged"
+	incidentResolved     = "resolved"
+)
+
+// stationaryRadius is how far a racer may drift (including GPS noise) while
+// still being considered stationary.
+const stationaryRadius = 50.0 // Meters
+
+// safetyLookbackMargin is how much further back than the longest threshold
+// the safety checks look at a racer's positions, so that a position just before
+// the threshold began is still seen.
+const safetyLookbackMargin = time.Minute
+
+// resolveIncidentPayload defines the structure for resolving a safety incident.
+type resolveIncidentPayload struct {
+	Note string `json:"note"` // e.g. "Called the rider, taking a rest"
+}
+
+// --- HTTP Handlers ---
+
+// handleGetIncidents lists the safety incidents of an event, newest first.
+// An optional "status" query parameter filters by status. Only the event
+// creator can see incidents.
+func (s *Server) handleGetIncidents(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != incidentOpen && status != incidentAcknowledged && status != incidentResolved {
+		s.errorJSON(w, errors.New("status must be 'open', 'acknowledged' or 'resolved'"), http.StatusBadRequest)
+		return
+	}
+
+	incidents, err := s.db.GetSafetyIncidentsByEventID(groupDB, event.ID, status)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racerNames := make(map[int64]string, len(racers))
+	for _, racer := range racers {
+		racerNames[racer.ID] = racer.RacerName
+	}
+
+	responseList := make([]SafetyIncidentResponse, len(incidents))
+	for i, inc := range incidents {
+		responseList[i] = toSafetyIncidentResponse(inc, racerNames[inc.RacerID])
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"incidents": responseList})
+}
+
+// handleAcknowledgeIncident records that the event owner has seen an open incident.
+func (s *Server) handleAcknowledgeIncident(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	inc, ok := s.loadIncidentFromURL(w, r, groupDB, event)
+	if !ok {
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.AcknowledgeSafetyIncident(tx, inc.ID, userID, time.Now())
+	})
+	if err != nil {
+		s.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	s.writeIncident(w, groupDB, inc.ID)
+}
+
+// handleResolveIncident closes an incident, with an optional note describing
+// the outcome.
+func (s *Server) handleResolveIncident(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	inc, ok := s.loadIncidentFromURL(w, r, groupDB, event)
+	if !ok {
+		return
+	}
+
+	var payload resolveIncidentPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ResolveSafetyIncident(tx, inc.ID, userID, payload.Note, time.Now())
+	})
+	if err != nil {
+		s.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	s.writeIncident(w, groupDB, inc.ID)
+}
+
+// loadEventForOwner loads the event from the URL and checks that the requesting
+// user created it. If anything fails, the error response has already been
+// written and ok is false.
+func (s *Server) loadEventForOwner(w http.ResponseWriter, r *http.Request) (*sql.DB, *database.Event, bool) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	if event.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the event creator can manage this event"), http.StatusForbidden)
+		return nil, nil, false
+	}
+	return groupDB, event, true
+}
+
+// loadRacerForOwner loads the event and racer named in the URL and checks that
+// the requesting user created the event, e.g. to decide the racer's official
+// result or hand out an upload link for them. It also returns the user's ID. If
+// anything fails, the error response has already been written and ok is false.
+func (s *Server) loadRacerForOwner(w http.ResponseWriter, r *http.Request) (*sql.DB, *database.Event, *database.Racer, int64, bool) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return nil, nil, nil, 0, false
+	}
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, nil, nil, 0, false
+	}
+	racerID, err := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid racer ID"), http.StatusBadRequest)
+		return nil, nil, nil, 0, false
+	}
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return nil, nil, nil, 0, false
+	}
+	return groupDB, event, racer, userID, true
+}
+
+// loadIncidentFromURL parses the incidentID URL parameter and loads the
+// incident, checking that it belongs to the event.
+func (s *Server) loadIncidentFromURL(w http.ResponseWriter, r *http.Request, groupDB *sql.DB, event *database.Event) (*database.SafetyIncident, bool) {
+	incidentID, err := strconv.ParseInt(chi.URLParam(r, "incidentID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid incident ID"), http.StatusBadRequest)
+		return nil, false
+	}
+	inc, err := s.db.GetSafetyIncidentByID(groupDB, incidentID)
+	if err != nil || inc.EventID != event.ID {
+		s.errorJSON(w, errors.New("incident not found"), http.StatusNotFound)
+		return nil, false
+	}
+	return inc, true
+}
+
+// writeIncident reloads an incident after a change and writes it as the response.
+func (s *Server) writeIncident(w http.ResponseWriter, groupDB *sql.DB, incidentID int64) {
+	inc, err := s.db.GetSafetyIncidentByID(groupDB, incidentID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	var racerName string
+	if racer, err := s.db.GetRacerByID(groupDB, inc.RacerID); err == nil {
+		racerName = racer.RacerName
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"incident": toSafetyIncidentResponse(inc, racerName)})
+}
+
+// --- Safety Monitor ---
+
+// RunSafetyMonitor periodically checks the racers of running live events for
+// signs that they may need help, until ctx is cancelled.
+func (s *Server) RunSafetyMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.checkLiveSafety(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkLiveSafety checks every live event that is currently running or in its
+// grace period.
+func (s *Server) checkLiveSafety(now time.Time) {
+	groupIDs, err := s.db.GetAllGroupIDs(s.db.GetMainDB())
+	if err != nil {
+		log.Printf("ERROR: safety monitor could not list groups: %v", err)
+		return
+	}
+
+	for _, groupID := range groupIDs {
+		groupDB, err := s.db.GetGroupDB(groupID)
+		if err != nil {
+			log.Printf("ERROR: safety monitor could not open group %d: %v", groupID, err)
+			continue
+		}
+		events, err := s.db.GetUnfinalizedLiveEvents(groupDB)
+		if err != nil {
+			log.Printf("ERROR: safety monitor could not list events for group %d: %v", groupID, err)
+			continue
+		}
+
+		for _, event := range events {
+			// Watch racers for as long as their positions are accepted, grace
+			// period included, but not before the start.
+			if !eventAcceptsLiveData(event, now) || now.Before(event.StartDate.Time) {
+				continue
+			}
+			if err := s.checkEventSafety(groupDB, event, now); err != nil {
+				log.Printf("ERROR: safety check failed for event %d in group %d: %v", event.ID, groupID, err)
+			}
+		}
+	}
+}
+
+// checkEventSafety raises an incident for each racer still out on the course
+// who has stopped reporting, has been stationary or has left the course
+// corridor for longer than the event's thresholds allow. Only the positions of
+// the longest threshold are looked at, so a racer who is still stationary or
+// off course after their incident was resolved is raised again once that
+// window has moved past the incident.
+func (s *Server) checkEventSafety(groupDB *sql.DB, event *database.Event, now time.Time) error {
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		return err
+	}
+
+	// The corridor is only meaningful around a course line, not straight legs
+	// between checkpoints.
+	var course *live.Course
+	if event.CourseID.Valid && event.OffCourseAlertMeters > 0 {
+		if course, err = s.liveCourse(groupDB, event); err != nil {
+			return err
+		}
+	}
+
+	// The checks only need the positions from the longest threshold before each
+	// racer's latest position, not their whole live track.
+	stationary := time.Duration(event.StationaryAlertMinutes) * time.Minute
+	offCourse := time.Duration(event.OffCourseAlertMinutes) * time.Minute
+	lookback := max(stationary, offCourse) + safetyLookbackMargin
+	latestPositions, err := s.db.GetLatestLivePositions(groupDB, event.ID)
+	if err != nil {
+		return err
+	}
+	latestReceived := make(map[int64]time.Time, len(latestPositions))
+	for _, p := range latestPositions {
+		latestReceived[p.RacerID] = p.Timestamp
+	}
+
+	for _, racer := range racers {
+		if racer.LiveStatus != liveStatusStarted {
+			continue
+		}
+		received, ok := latestReceived[racer.ID]
+		if !ok {
+			continue
+		}
+		positions, err := s.db.GetLivePositionsSince(groupDB, racer.ID, received.Add(-lookback))
+		if err != nil {
+			return err
+		}
+		if len(positions) == 0 {
+			continue
+		}
+		latest := positions[len(positions)-1]
+		raise := func(incidentType string, since time.Time, distance sql.NullFloat64) error {
+			return s.raiseIncident(groupDB, event, racer, &database.SafetyIncident{
+				EventID:    event.ID,
+				RacerID:    racer.ID,
+				Type:       incidentType,
+				Since:      since,
+				DetectedAt: now,
+				Lat:        latest.Lat,
+				Lon:        latest.Lon,
+				Distance:   distance,
+			})
+		}
+
+		silence := time.Duration(event.SilenceAlertMinutes) * time.Minute
+		if silence > 0 && now.Sub(latest.Timestamp) >= silence {
+			if err := raise(incidentNoSignal, latest.Timestamp, sql.NullFloat64{}); err != nil {
+				return err
+			}
+			// Without new positions there is nothing more to learn about the racer.
+			continue
+		}
+
+		if since := stationarySince(positions); stationary > 0 && latest.Timestamp.Sub(since) >= stationary {
+			if err := raise(incidentStationary, since, sql.NullFloat64{}); err != nil {
+				return err
+			}
+		}
+
+		if course != nil {
+			if since, offset, off := offCourseSince(course, positions, event.OffCourseAlertMeters); off && latest.Timestamp.Sub(since) >= offCourse {
+				if err := raise(incidentOffCourse, since, sql.NullFloat64{Float64: offset, Valid: true}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// stationarySince returns the time of the earliest position from which the
+// racer has stayed within stationaryRadius of their latest position.
+func stationarySince(positions []*database.LivePosition) time.Time {
+	latest := positions[len(positions)-1]
+	here := gpx.TrackPoint{Lat: latest.Lat, Lon: latest.Lon}
+	since := latest.Timestamp
+	for i := len(positions) - 2; i >= 0; i-- {
+		p := gpx.TrackPoint{Lat: positions[i].Lat, Lon: positions[i].Lon}
+		if here.DistanceTo(&p) > stationaryRadius {
+			break
+		}
+		since = positions[i].Timestamp
+	}
+	return since
+}
+
+// offCourseSince reports whether the racer's latest position is further than
+// corridor meters from the course and, if so, how far and since when they have
+// been off course.
+func offCourseSince(course *live.Course, positions []*database.LivePosition, corridor float64) (since time.Time, offset float64, off bool) {
+	for i := len(positions) - 1; i >= 0; i-- {
+		p := gpx.TrackPoint{Lat: positions[i].Lat, Lon: positions[i].Lon}
+		_, o := course.Locate(p, 0, course.Length())
+		if o <= corridor {
+			break
+		}
+		if !off {
+			offset, off = o, true
+		}
+		since = positions[i].Timestamp
+	}
+	return since, offset, off
+}
+
+// raiseIncident records a new incident and notifies the event owner over SSE
+// and email, unless the racer already has an unresolved incident of the same
+// type or the condition was already reported before the last one was resolved.
+func (s *Server) raiseIncident(groupDB *sql.DB, event *database.Event, racer *database.Racer, inc *database.SafetyIncident) error {
+	previous, err := s.db.GetLatestSafetyIncident(groupDB, racer.ID, inc.Type)
+	if err != nil {
+		return err
+	}
+	if previous != nil && (previous.Status != incidentResolved || !inc.Since.After(previous.DetectedAt)) {
+		return nil
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.CreateSafetyIncident(tx, inc)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Raised %s incident %d for racer %d in event %d.", inc.Type, inc.ID, racer.ID, event.ID)
+
+	s.broker.NotifyUser(event.CreatorUserID, realtime.Message{
+		Type:    "safety_alert",
+		Payload: toSafetyIncidentResponse(inc, racer.RacerName),
+	})
+
+	owner, err := s.db.GetUserByID(s.db.GetMainDB(), event.CreatorUserID)
+	if err != nil {
+		log.Printf("ERROR: Could not look up owner of event %d for safety alert email: %v", event.ID, err)
+		return nil
+	}
+	eventLink := fmt.Sprintf("%s/groups/%d/events/%d/manage", s.config.FrontendURL, event.GroupID, event.ID)
+	// Send in the background so a slow mail server doesn't hold up the checks.
+	go func() {
+		if err := s.email.SendSafetyAlertEmail(owner.Email, event.Name, racer.RacerName, describeIncident(inc, racer.RacerName), eventLink); err != nil {
+			log.Printf("ERROR: Failed to send safety alert email for incident %d: %v", inc.ID, err)
+		}
+	}()
+	return nil
+}
+
+// describeIncident summarises an incident in a sentence for notifications.
+func describeIncident(inc *database.SafetyIncident, racerName string) string {
+	since := inc.Since.UTC().Format("15:04 MST")
+	var what string
+	switch inc.Type {
+	case incidentStationary:
+		what = fmt.Sprintf("%s has not moved since %s.", racerName, since)
+	case incidentOffCourse:
+		what = fmt.Sprintf("%s has been off course since %s and is %.0f m from the course.", racerName, since, inc.Distance.Float64)
+	case incidentNoSignal:
+		what = fmt.Sprintf("%s's tracker has not reported since %s.", racerName, since)
+	}
+	return fmt.Sprintf("%s Last known position: %.5f, %.5f.", what, inc.Lat, inc.Lon)
+}
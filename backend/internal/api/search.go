@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// defaultSearchRadius is used when a radius search does not specify one (in meters).
+const defaultSearchRadius = 25000.0
+
+// maxSearchRadius caps radius searches to keep the candidate set manageable (in meters).
+const maxSearchRadius = 1000000.0
+
+// eventSearchResultResponse is the DTO for a single event returned by a spatial search.
+type eventSearchResultResponse struct {
+	EventResponse
+	GroupName string   `json:"groupName"`
+	Distance  *float64 `json:"distance,omitempty"` // Meters from the search point; only set for radius searches
+}
+
+// handleSearchEvents finds events near a point or within a bounding box.
+// Results are limited to the groups the authenticated user is a member of.
+//
+// Radius search:       ?lat=..&lon=..&radius=..   (radius in meters, optional)
+// Bounding box search: ?minLat=..&minLon=..&maxLat=..&maxLon=..
+func (s *Server) handleSearchEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.getUserIDFromContext(r)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// --- 1. Parse the search area ---
+	var (
+		areas     []gpx.Bounds // Two boxes if the area crosses the antimeridian
+		isRadius  bool
+		centerLat float64
+		centerLon float64
+		radius    = defaultSearchRadius
+	)
+
+	switch {
+	case query.Get("lat") != "" || query.Get("lon") != "":
+		centerLat, err = strconv.ParseFloat(query.Get("lat"), 64)
+		if err != nil || !validLatitude(centerLat) {
+			s.errorJSON(w, errors.New("invalid lat"), http.StatusBadRequest)
+			return
+		}
+		centerLon, err = strconv.ParseFloat(query.Get("lon"), 64)
+		if err != nil || !validLongitude(centerLon) {
+			s.errorJSON(w, errors.New("invalid lon"), http.StatusBadRequest)
+			return
+		}
+		if query.Get("radius") != "" {
+			radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+			if err != nil || !(radius > 0 && radius <= maxSearchRadius) {
+				s.errorJSON(w, errors.New("radius must be a positive number of meters up to 1000000"), http.StatusBadRequest)
+				return
+			}
+		}
+		isRadius = true
+		areas = gpx.BoundsAround(centerLat, centerLon, radius)
+
+	case query.Get("minLat") != "":
+		values := make([]float64, 4)
+		for i, key := range []string{"minLat", "minLon", "maxLat", "maxLon"} {
+			values[i], err = strconv.ParseFloat(query.Get(key), 64)
+			valid := validLatitude
+			if i%2 == 1 {
+				valid = validLongitude
+			}
+			if err != nil || !valid(values[i]) {
+				s.errorJSON(w, errors.New("invalid "+key), http.StatusBadRequest)
+				return
+			}
+		}
+		area := gpx.Bounds{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}
+		if area.MinLat > area.MaxLat || area.MinLon > area.MaxLon {
+			s.errorJSON(w, errors.New("minLat/minLon must not exceed maxLat/maxLon"), http.StatusBadRequest)
+			return
+		}
+		areas = []gpx.Bounds{area}
+
+	default:
+		s.errorJSON(w, errors.New("either lat/lon or minLat/minLon/maxLat/maxLon is required"), http.StatusBadRequest)
+		return
+	}
+
+	// --- 2. Query the spatial index of every group the user belongs to ---
+	groups, err := s.db.GetGroupsByUserID(s.db.GetMainDB(), userID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	results := []eventSearchResultResponse{}
+	for _, group := range groups {
+		groupDB, err := s.db.GetGroupDB(group.ID)
+		if err != nil {
+			log.Printf("WARN: could not open database for group %d during search: %v", group.ID, err)
+			continue
+		}
+
+		var events []*database.Event
+		seen := make(map[int64]bool)
+		for _, area := range areas {
+			found, err := s.db.GetEventsInBounds(groupDB, group.ID, area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
+			if err != nil {
+				log.Printf("WARN: spatial search failed for group %d: %v", group.ID, err)
+				continue
+			}
+			// An event spanning the antimeridian can be found in both boxes.
+			for _, event := range found {
+				if !seen[event.ID] {
+					seen[event.ID] = true
+					events = append(events, event)
+				}
+			}
+		}
+
+		for _, event := range events {
+			result := eventSearchResultResponse{
+				EventResponse: toEventResponse(event),
+				GroupName:     group.Name,
+			}
+
+			// The R-tree only matches boxes, so refine radius searches with the exact distance.
+			if isRadius {
+				distance := result.Bounds.DistanceTo(centerLat, centerLon)
+				if distance > radius {
+					continue
+				}
+				result.Distance = &distance
+			}
+			results = append(results, result)
+		}
+	}
+
+	if isRadius {
+		sort.Slice(results, func(i, j int) bool { return *results[i].Distance < *results[j].Distance })
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{"events": results})
+}
+
+// validLatitude reports whether lat is a finite latitude in degrees. NaN fails
+// every comparison, so it is rejected along with the infinities.
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+// validLongitude reports whether lon is a finite longitude in degrees.
+func validLongitude(lon float64) bool {
+	return lon >= -180 && lon <= 180
+}
+
+// refreshRacerSpatialData updates a racer's contribution to their event's
+// bounding box and start location, and then the event's. It is called whenever
+// the racer's track changes.
+func (s *Server) refreshRacerSpatialData(groupDB database.DBorTx, event *database.Event, racerID int64) error {
+	if err := s.storeRacerSpatialData(groupDB, event, racerID); err != nil {
+		return err
+	}
+	return s.refreshEventSpatialData(groupDB, event)
+}
+
+// refreshEventSpatialData recalculates an event's bounding box and start location
+// from the stored contributions of its racers and updates the spatial index.
+// Only the tracks of racers whose contribution has not been stored yet are read.
+func (s *Server) refreshEventSpatialData(groupDB database.DBorTx, event *database.Event) error {
+	missing, err := s.db.GetRacersMissingSpatialData(groupDB, event.ID)
+	if err != nil {
+		return err
+	}
+	for _, racerID := range missing {
+		if err := s.storeRacerSpatialData(groupDB, event, racerID); err != nil {
+			return err
+		}
+	}
+	return s.db.RefreshEventSpatialData(groupDB, event.ID)
+}
+
+// storeRacerSpatialData reads a racer's track and stores its bounding box and
+// first point. A racer whose track cannot be read does not count.
+func (s *Server) storeRacerSpatialData(groupDB database.DBorTx, event *database.Event, racerID int64) error {
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil {
+		return err
+	}
+	path, err := s.readRacerTrack(groupDB, event, racer)
+	if err != nil || path == nil {
+		return s.db.SetRacerSpatialData(groupDB, racer.ID, event.ID, false, 0, 0, 0, 0, 0, 0, time.Time{})
+	}
+	bounds, ok := path.Bounds()
+	if !ok {
+		return s.db.SetRacerSpatialData(groupDB, racer.ID, event.ID, false, 0, 0, 0, 0, 0, 0, time.Time{})
+	}
+	start := path.Points[0]
+	return s.db.SetRacerSpatialData(groupDB, racer.ID, event.ID, true,
+		bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon, start.Lat, start.Lon, start.Timestamp)
+}
@@ -0,0 +1,605 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/series"
+	"github.com/intermernet/raceviz/internal/stagerace"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Ways of matching racers across the rounds of a series.
+const (
+	matchByName = "name" // By racer name, ignoring case and extra spaces
+	matchByUser = "user" // By the user linked to the racer, or else by name
+)
+
+// --- Structs for JSON Payloads ---
+
+// createSeriesPayload defines the structure for creating a series.
+type createSeriesPayload struct {
+	Name        string   `json:"name"`
+	PointsTable []int    `json:"pointsTable"` // Points for 1st, 2nd, ... place
+	DropWorst   int      `json:"dropWorst"`
+	TieBreakers []string `json:"tieBreakers"`
+	MatchBy     string   `json:"matchBy"` // "name" (default) or "user"
+}
+
+// updateSeriesPayload defines the fields that can be changed on a series.
+// Omitted fields are left unchanged.
+type updateSeriesPayload struct {
+	Name        *string   `json:"name"`
+	PointsTable *[]int    `json:"pointsTable"`
+	DropWorst   *int      `json:"dropWorst"`
+	TieBreakers *[]string `json:"tieBreakers"`
+	MatchBy     *string   `json:"matchBy"`
+}
+
+// setSeriesEventsPayload lists the events of a series.
+type setSeriesEventsPayload struct {
+	EventIDs []int64 `json:"eventIds"`
+}
+
+// setSeriesRiderPayload links a racer in one of the rounds to a user or a
+// rider name. Sending neither matches the racer by the series' rules again.
+type setSeriesRiderPayload struct {
+	RacerID int64  `json:"racerId"`
+	UserID  *int64 `json:"userId"`
+	Rider   string `json:"rider"`
+}
+
+// setSeriesCategoryPayload puts a rider of a series in a category.
+type setSeriesCategoryPayload struct {
+	Rider    string `json:"rider"`    // Rider key, as reported for the series' racers
+	Category string `json:"category"` // Empty to remove the rider from their category
+}
+
+// seriesRiderResponse shows which rider a racer in one of the rounds counts as.
+type seriesRiderResponse struct {
+	RacerID   int64  `json:"racerId"`
+	EventID   int64  `json:"eventId"`
+	RacerName string `json:"racerName"`
+	Rider     string `json:"rider"` // Key matching the racer's entries across rounds
+	Name      string `json:"name"`
+	UserID    *int64 `json:"userId,omitempty"`
+	Linked    bool   `json:"linked"` // Set explicitly rather than matched by the series' rules
+	Category  string `json:"category"`
+}
+
+// seriesRound is an event of a series with the rider each of its racers counts as.
+type seriesRound struct {
+	event  *database.Event
+	racers []*database.Racer
+	riders []seriesRiderResponse // In the same order as racers
+}
+
+// --- HTTP Handlers ---
+
+// handleGetAllSeries lists the series of a group.
+func (s *Server) handleGetAllSeries(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	list, err := s.db.GetAllSeries(groupDB)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"series": toSeriesResponseList(list)})
+}
+
+// handleCreateSeries creates a series without events.
+func (s *Server) handleCreateSeries(w http.ResponseWriter, r *http.Request) {
+	groupID, _, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var payload createSeriesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		s.errorJSON(w, errors.New("name is required"), http.StatusBadRequest)
+		return
+	}
+	if payload.MatchBy == "" {
+		payload.MatchBy = matchByName
+	}
+	newSeries := &database.Series{
+		Name:          payload.Name,
+		PointsTable:   payload.PointsTable,
+		DropWorst:     payload.DropWorst,
+		TieBreakers:   payload.TieBreakers,
+		MatchBy:       payload.MatchBy,
+		CreatorUserID: userID,
+	}
+	if err := validateSeriesRules(newSeries); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var created *database.Series
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		var err error
+		created, err = s.db.CreateSeries(tx, newSeries)
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to create series"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"series": toSeriesResponse(created)})
+}
+
+// handleGetSeries returns a series with its events and the rider every racer
+// in them counts as.
+func (s *Server) handleGetSeries(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+
+	rounds, err := s.seriesRounds(groupDB, current)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	events := make([]*database.Event, len(rounds))
+	riders := []seriesRiderResponse{}
+	for i, round := range rounds {
+		events[i] = round.event
+		riders = append(riders, round.riders...)
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"series": toSeriesResponse(current),
+		"events": toEventResponseList(events),
+		"riders": riders,
+	})
+}
+
+// handleUpdateSeries changes a series' name or scoring rules. Only the series
+// creator can change it.
+func (s *Server) handleUpdateSeries(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload updateSeriesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	if payload.Name != nil {
+		name := strings.TrimSpace(*payload.Name)
+		if name == "" {
+			s.errorJSON(w, errors.New("name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		current.Name = name
+	}
+	if payload.PointsTable != nil {
+		current.PointsTable = *payload.PointsTable
+	}
+	if payload.DropWorst != nil {
+		current.DropWorst = *payload.DropWorst
+	}
+	if payload.TieBreakers != nil {
+		current.TieBreakers = *payload.TieBreakers
+	}
+	if payload.MatchBy != nil {
+		current.MatchBy = *payload.MatchBy
+	}
+	if err := validateSeriesRules(current); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.UpdateSeries(tx, current)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to update series"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"series": toSeriesResponse(current)})
+}
+
+// handleDeleteSeries deletes a series. Its events are kept. Only the series
+// creator can delete it.
+func (s *Server) handleDeleteSeries(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.DeleteSeries(tx, current.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete series"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "series deleted successfully"})
+}
+
+// handleSetSeriesEvents replaces the events of a series. They are scored in
+// date order, whatever order they are listed in.
+func (s *Server) handleSetSeriesEvents(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload setSeriesEventsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	seen := make(map[int64]bool, len(payload.EventIDs))
+	for _, eventID := range payload.EventIDs {
+		if seen[eventID] {
+			s.errorJSON(w, fmt.Errorf("event %d is listed more than once", eventID), http.StatusBadRequest)
+			return
+		}
+		seen[eventID] = true
+		if _, err := s.db.GetEventByID(groupDB, eventID); err != nil {
+			s.errorJSON(w, fmt.Errorf("event %d not found", eventID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.SetSeriesEvents(tx, current.ID, payload.EventIDs)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to set series events"), http.StatusInternalServerError)
+		return
+	}
+
+	events, err := s.db.GetSeriesEvents(groupDB, current.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"events": toEventResponseList(events)})
+}
+
+// handleSetSeriesRider links a racer in one of the rounds to a group member or
+// a rider name, for racers that aren't matched correctly across rounds.
+func (s *Server) handleSetSeriesRider(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload setSeriesRiderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	link := database.SeriesRider{RacerID: payload.RacerID, Rider: strings.TrimSpace(payload.Rider)}
+	if payload.UserID != nil {
+		if link.Rider != "" {
+			s.errorJSON(w, errors.New("link the racer to either a user or a rider, not both"), http.StatusBadRequest)
+			return
+		}
+		isMember, err := s.db.IsUserGroupMember(s.db.GetMainDB(), groupID, *payload.UserID)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if !isMember {
+			s.errorJSON(w, errors.New("user is not a member of this group"), http.StatusBadRequest)
+			return
+		}
+		link.UserID = sql.NullInt64{Int64: *payload.UserID, Valid: true}
+	}
+
+	racer, err := s.db.GetRacerByID(groupDB, link.RacerID)
+	if err != nil {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return
+	}
+	events, err := s.db.GetSeriesEvents(groupDB, current.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	inSeries := false
+	for _, event := range events {
+		if event.ID == racer.EventID {
+			inSeries = true
+			break
+		}
+	}
+	if !inSeries {
+		s.errorJSON(w, errors.New("racer is not in an event of this series"), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.SetSeriesRider(tx, current.ID, link)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to link racer to rider"), http.StatusInternalServerError)
+		return
+	}
+
+	rounds, err := s.seriesRounds(groupDB, current)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	for _, round := range rounds {
+		for _, rider := range round.riders {
+			if rider.RacerID == racer.ID {
+				s.writeJSON(w, http.StatusOK, envelope{"rider": rider})
+				return
+			}
+		}
+	}
+	s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+}
+
+// handleSetSeriesCategory puts a rider of a series in a category. Riders are
+// placed and scored against the others in their category, as well as overall.
+func (s *Server) handleSetSeriesCategory(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	current, ok := s.loadSeriesForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload setSeriesCategoryPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	if payload.Rider == "" {
+		s.errorJSON(w, errors.New("rider is required"), http.StatusBadRequest)
+		return
+	}
+	category := strings.TrimSpace(payload.Category)
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.SetSeriesCategory(tx, current.ID, payload.Rider, category)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to set category"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"rider": payload.Rider, "category": category})
+}
+
+// handleGetSeriesStandings returns the standings of a series, overall and per
+// category. They are worked out from the events' current results, so they
+// change whenever a round's results do. Like the stage race standings, they
+// are public.
+func (s *Server) handleGetSeriesStandings(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid group ID"), http.StatusBadRequest)
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(groupID)
+	if err != nil {
+		s.errorJSON(w, fmt.Errorf("group database %d not found", groupID), http.StatusInternalServerError)
+		return
+	}
+	current, ok := s.loadSeriesFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+
+	rounds, err := s.seriesRounds(groupDB, current)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	scored := make([]series.Round, len(rounds))
+	for i, round := range rounds {
+		eventResults, err := s.eventResults(groupDB, round.event, round.racers)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		scored[i] = series.Round{EventID: round.event.ID, Name: round.event.Name, Date: round.event.StartDate.Time}
+		for j, rider := range round.riders {
+			scored[i].Entries = append(scored[i].Entries, series.Entry{
+				Rider:    rider.Rider,
+				Name:     rider.Name,
+				Category: rider.Category,
+				Result:   eventResults[j],
+			})
+		}
+	}
+
+	table := series.Compute(scored, series.Rules{
+		Points:      current.PointsTable,
+		DropWorst:   current.DropWorst,
+		TieBreakers: current.TieBreakers,
+	})
+	s.writeJSON(w, http.StatusOK, envelope{
+		"series":      toSeriesResponse(current),
+		"roundsRaced": table.RoundsRaced,
+		"rounds":      table.Rounds,
+		"overall":     table.Overall,
+		"categories":  table.Categories,
+	})
+}
+
+// seriesRounds loads the events of a series in date order, with their racers
+// and the rider each racer counts as.
+//
+// An explicit link decides the rider. Otherwise racers are matched by the user
+// linked to them if the series matches by user, or else by name. Riders
+// are scored in the category set for them in the series, or else in the
+// category of their entry.
+func (s *Server) seriesRounds(groupDB *sql.DB, current *database.Series) ([]seriesRound, error) {
+	events, err := s.db.GetSeriesEvents(groupDB, current.ID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.db.GetSeriesRiders(groupDB, current.ID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.db.GetSeriesCategories(groupDB, current.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rounds := make([]seriesRound, len(events))
+	userIDs := make(map[int64]struct{})
+	for i, event := range events {
+		racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		rounds[i] = seriesRound{event: event, racers: racers}
+		for _, racer := range racers {
+			if link, ok := links[racer.ID]; ok && link.UserID.Valid {
+				userIDs[link.UserID.Int64] = struct{}{}
+			} else if !ok && current.MatchBy == matchByUser && racer.UserID.Valid {
+				userIDs[racer.UserID.Int64] = struct{}{}
+			}
+		}
+	}
+	users, err := s.db.GetUsersByIDs(s.db.GetMainDB(), userIDs)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	for i := range rounds {
+		for _, racer := range rounds[i].racers {
+			rider := seriesRiderResponse{RacerID: racer.ID, EventID: racer.EventID, RacerName: racer.RacerName}
+			link, linked := links[racer.ID]
+			rider.Linked = linked
+			userID := racer.UserID.Int64
+			switch {
+			case linked && link.UserID.Valid:
+				userID = link.UserID.Int64
+				fallthrough
+			case !linked && current.MatchBy == matchByUser && racer.UserID.Valid:
+				rider.UserID = &userID
+				rider.Rider = fmt.Sprintf("user:%d", userID)
+				rider.Name = usernames[userID]
+			case linked:
+				rider.Name = link.Rider
+			default:
+				rider.Name = strings.TrimSpace(racer.RacerName)
+			}
+			if rider.Rider == "" {
+				rider.Rider = stagerace.RiderKey(rider.Name)
+			}
+			rider.Category = categories[rider.Rider]
+			if rider.Category == "" {
+				rider.Category = racer.Category
+			}
+			rounds[i].riders = append(rounds[i].riders, rider)
+		}
+	}
+	return rounds, nil
+}
+
+// loadSeriesFromURL loads the series named by the seriesID URL parameter. If
+// anything fails, the error response has already been written.
+func (s *Server) loadSeriesFromURL(w http.ResponseWriter, r *http.Request, groupDB *sql.DB) (*database.Series, bool) {
+	seriesID, err := strconv.ParseInt(chi.URLParam(r, "seriesID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid series ID"), http.StatusBadRequest)
+		return nil, false
+	}
+	current, err := s.db.GetSeriesByID(groupDB, seriesID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("series not found"), http.StatusNotFound)
+			return nil, false
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return current, true
+}
+
+// loadSeriesForOwner loads the series named in the URL and checks that the
+// user created it.
+func (s *Server) loadSeriesForOwner(w http.ResponseWriter, r *http.Request, groupDB *sql.DB, userID int64) (*database.Series, bool) {
+	current, ok := s.loadSeriesFromURL(w, r, groupDB)
+	if !ok {
+		return nil, false
+	}
+	if current.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the series creator can change it"), http.StatusForbidden)
+		return nil, false
+	}
+	return current, true
+}
+
+// validateSeriesRules checks a series' points table, drop rule, tie-breakers
+// and matching.
+func validateSeriesRules(current *database.Series) error {
+	for _, p := range current.PointsTable {
+		if p < 0 {
+			return errors.New("pointsTable cannot contain negative points")
+		}
+	}
+	if current.DropWorst < 0 {
+		return errors.New("dropWorst cannot be negative")
+	}
+	seen := make(map[string]bool, len(current.TieBreakers))
+	for _, tb := range current.TieBreakers {
+		if !series.IsTieBreaker(tb) {
+			return fmt.Errorf("unknown tie-breaker %q", tb)
+		}
+		if seen[tb] {
+			return fmt.Errorf("tie-breaker %q is listed more than once", tb)
+		}
+		seen[tb] = true
+	}
+	if current.MatchBy != matchByName && current.MatchBy != matchByUser {
+		return errors.New("matchBy must be 'name' or 'user'")
+	}
+	return nil
+}
@@ -3,10 +3,13 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	"github.com/intermernet/raceviz/internal/config"
 	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/dem"      // Optional terrain model for elevation correction
 	"github.com/intermernet/raceviz/internal/email"    // Import email package
+	"github.com/intermernet/raceviz/internal/mapmatch" // Optional road/trail network for map matching
 	"github.com/intermernet/raceviz/internal/realtime" // Import realtime package
 )
 
@@ -18,18 +21,29 @@ type Server struct {
 	db     *database.Service
 	broker *realtime.Broker
 	email  *email.EmailService
+	// mapNetwork is nil when no OpenStreetMap extract is configured.
+	mapNetwork *mapmatch.Network
+	// demSource is nil when no DEM tile directory is configured.
+	demSource *dem.Source
+
+	// ETA predictors for live events, built on first use (see eta.go).
+	predictorsMu sync.Mutex
+	predictors   map[realtime.EventKey]*predictorEntry
 	// Future dependencies like a WebSocket hub, email client, or logger can be added here.
 }
 
 // NewServer is a constructor function that creates and returns a new instance of the Server.
 // It takes the application's configuration and database service as arguments and
 // wires them into the newly created Server object.
-func NewServer(cfg *config.Config, db *database.Service, broker *realtime.Broker, email *email.EmailService) *Server {
+func NewServer(cfg *config.Config, db *database.Service, broker *realtime.Broker, email *email.EmailService, mapNetwork *mapmatch.Network, demSource *dem.Source) *Server {
 	return &Server{
-		config: cfg,
-		db:     db,
-		broker: broker,
-		email:  email,
+		config:     cfg,
+		db:         db,
+		broker:     broker,
+		email:      email,
+		mapNetwork: mapNetwork,
+		demSource:  demSource,
+		predictors: make(map[realtime.EventKey]*predictorEntry),
 	}
 }
 
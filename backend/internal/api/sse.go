@@ -1,8 +1,14 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/live"
+	"github.com/intermernet/raceviz/internal/realtime"
 )
 
 // handleSSE is the handler for Server-Sent Events.
@@ -52,3 +58,97 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// eventStreamHeartbeat is how often a comment is sent on an idle event stream,
+// so that proxies don't close the connection.
+const eventStreamHeartbeat = 15 * time.Second
+
+// handleEventStream is the public Server-Sent Events stream of a single event,
+// for anonymous spectators. It starts with a snapshot of every racer's latest
+// position, race state and ETA prediction, followed by throttled "positions"
+// and "predictions" updates and immediate "race_state" changes as they happen.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.errorJSON(w, fmt.Errorf("streaming unsupported"), http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the snapshot, so no update can fall between the two.
+	key := eventKey(event)
+	clientChan := s.broker.SubscribeEvent(key)
+	defer s.broker.UnsubscribeEvent(key, clientChan)
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	positions, err := s.db.GetLatestLivePositions(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	snapshot := struct {
+		Positions   []LivePositionResponse `json:"positions"`
+		States      []RaceStateResponse    `json:"states"`
+		Predictions []*live.Prediction     `json:"predictions"`
+	}{
+		Positions:   make([]LivePositionResponse, len(positions)),
+		States:      make([]RaceStateResponse, len(racers)),
+		Predictions: []*live.Prediction{},
+	}
+	for i, p := range positions {
+		snapshot.Positions[i] = toLivePositionResponse(p)
+	}
+	for i, racer := range racers {
+		snapshot.States[i] = toRaceStateResponse(racer)
+	}
+	if eventAcceptsLiveData(event, time.Now()) {
+		predictor, err := s.eventPredictor(groupDB, event)
+		if err != nil {
+			log.Printf("WARN: could not build ETA predictor for event %d: %v", event.ID, err)
+		} else if predictor != nil {
+			snapshot.Predictions = predictor.Predictions()
+		}
+	}
+	snapshotMsg, err := json.Marshal(realtime.Message{Type: "snapshot", Payload: snapshot})
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// The server's write timeout is meant for ordinary requests; lift it for
+	// this long-lived response.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("WARN: could not clear write deadline for event stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	fmt.Fprintf(w, "data: %s\n\n", snapshotMsg)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message := <-clientChan:
+			fmt.Fprintf(w, "data: %s\n\n", message)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/stagerace"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Structs for JSON Payloads ---
+
+// createStageRacePayload defines the structure for creating a stage race.
+type createStageRacePayload struct {
+	Name        string `json:"name"`
+	TimeBonuses []int  `json:"timeBonuses"` // Seconds for the first finishers of each stage
+}
+
+// updateStageRacePayload defines the fields that can be changed on a stage race.
+// Omitted fields are left unchanged.
+type updateStageRacePayload struct {
+	Name        *string `json:"name"`
+	TimeBonuses *[]int  `json:"timeBonuses"`
+}
+
+// setStagesPayload lists the events of a stage race in stage order.
+type setStagesPayload struct {
+	EventIDs []int64 `json:"eventIds"`
+}
+
+// setStageRiderPayload links a racer in one of the stages to a rider.
+type setStageRiderPayload struct {
+	RacerID int64  `json:"racerId"`
+	Rider   string `json:"rider"` // Empty to match the racer by name again
+}
+
+// stageRiderResponse shows which rider a racer in one of the stages counts as.
+type stageRiderResponse struct {
+	RacerID   int64  `json:"racerId"`
+	EventID   int64  `json:"eventId"`
+	RacerName string `json:"racerName"`
+	Rider     string `json:"rider"`
+	Linked    bool   `json:"linked"` // Set explicitly rather than matched by name
+}
+
+// --- HTTP Handlers ---
+
+// handleGetStageRaces lists the stage races of a group.
+func (s *Server) handleGetStageRaces(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRaces, err := s.db.GetStageRaces(groupDB)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"stageRaces": toStageRaceResponseList(stageRaces)})
+}
+
+// handleCreateStageRace creates a stage race without stages.
+func (s *Server) handleCreateStageRace(w http.ResponseWriter, r *http.Request) {
+	groupID, _, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var payload createStageRacePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		s.errorJSON(w, errors.New("name is required"), http.StatusBadRequest)
+		return
+	}
+	if err := validateTimeBonuses(payload.TimeBonuses); err != nil {
+		s.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var stageRace *database.StageRace
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		var err error
+		stageRace, err = s.db.CreateStageRace(tx, &database.StageRace{
+			Name:          payload.Name,
+			TimeBonuses:   payload.TimeBonuses,
+			CreatorUserID: userID,
+		})
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to create stage race"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"stageRace": toStageRaceResponse(stageRace)})
+}
+
+// handleGetStageRace returns a stage race with its stages and the rider every
+// racer in the stages counts as.
+func (s *Server) handleGetStageRace(w http.ResponseWriter, r *http.Request) {
+	_, groupDB, _, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRace, ok := s.loadStageRaceFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+
+	stages, err := s.db.GetStages(groupDB, stageRace.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	links, err := s.db.GetStageRaceRiders(groupDB, stageRace.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	riders := []stageRiderResponse{}
+	for _, stage := range stages {
+		racers, err := s.db.GetRacersByEventID(groupDB, stage.ID)
+		if err != nil {
+			s.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		for _, racer := range racers {
+			rider, linked := links[racer.ID]
+			if !linked {
+				rider = racer.RacerName
+			}
+			riders = append(riders, stageRiderResponse{
+				RacerID:   racer.ID,
+				EventID:   stage.ID,
+				RacerName: racer.RacerName,
+				Rider:     rider,
+				Linked:    linked,
+			})
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"stageRace": toStageRaceResponse(stageRace),
+		"stages":    toEventResponseList(stages),
+		"riders":    riders,
+	})
+}
+
+// handleUpdateStageRace changes a stage race's name or time bonuses. Only the
+// stage race creator can change it.
+func (s *Server) handleUpdateStageRace(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRace, ok := s.loadStageRaceForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload updateStageRacePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	if payload.Name != nil {
+		name := strings.TrimSpace(*payload.Name)
+		if name == "" {
+			s.errorJSON(w, errors.New("name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		stageRace.Name = name
+	}
+	if payload.TimeBonuses != nil {
+		if err := validateTimeBonuses(*payload.TimeBonuses); err != nil {
+			s.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		stageRace.TimeBonuses = *payload.TimeBonuses
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.UpdateStageRace(tx, stageRace)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to update stage race"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"stageRace": toStageRaceResponse(stageRace)})
+}
+
+// handleDeleteStageRace deletes a stage race. Its stages are kept as ordinary
+// events. Only the stage race creator can delete it.
+func (s *Server) handleDeleteStageRace(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRace, ok := s.loadStageRaceForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.DeleteStageRace(tx, stageRace.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete stage race"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "stage race deleted successfully"})
+}
+
+// handleSetStages replaces the stages of a stage race with the given events,
+// in stage order. An event can only be a stage of one stage race.
+func (s *Server) handleSetStages(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRace, ok := s.loadStageRaceForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload setStagesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	seen := make(map[int64]bool, len(payload.EventIDs))
+	for _, eventID := range payload.EventIDs {
+		if seen[eventID] {
+			s.errorJSON(w, fmt.Errorf("event %d is listed more than once", eventID), http.StatusBadRequest)
+			return
+		}
+		seen[eventID] = true
+		event, err := s.db.GetEventByID(groupDB, eventID)
+		if err != nil {
+			s.errorJSON(w, fmt.Errorf("event %d not found", eventID), http.StatusBadRequest)
+			return
+		}
+		if event.StageRaceID.Valid && event.StageRaceID.Int64 != stageRace.ID {
+			s.errorJSON(w, fmt.Errorf("event %d is already a stage of another stage race", eventID), http.StatusConflict)
+			return
+		}
+	}
+
+	err := s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.SetStages(tx, stageRace.ID, payload.EventIDs)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to set stages"), http.StatusInternalServerError)
+		return
+	}
+
+	stages, err := s.db.GetStages(groupDB, stageRace.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"stages": toEventResponseList(stages)})
+}
+
+// handleSetStageRider links a racer in one of the stages to a rider of the
+// stage race, for racers whose name differs between stages.
+func (s *Server) handleSetStageRider(w http.ResponseWriter, r *http.Request) {
+	groupID, groupDB, userID, ok := s.loadGroupForMember(w, r)
+	if !ok {
+		return
+	}
+	stageRace, ok := s.loadStageRaceForOwner(w, r, groupDB, userID)
+	if !ok {
+		return
+	}
+
+	var payload setStageRiderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	racer, err := s.db.GetRacerByID(groupDB, payload.RacerID)
+	if err != nil {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return
+	}
+	event, err := s.db.GetEventByID(groupDB, racer.EventID)
+	if err != nil || !event.StageRaceID.Valid || event.StageRaceID.Int64 != stageRace.ID {
+		s.errorJSON(w, errors.New("racer is not in a stage of this stage race"), http.StatusBadRequest)
+		return
+	}
+
+	rider := strings.TrimSpace(payload.Rider)
+	err = s.db.WriteToGroupDB(groupID, func(tx *sql.Tx) error {
+		return s.db.SetStageRaceRider(tx, stageRace.ID, racer.ID, rider)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to link racer to rider"), http.StatusInternalServerError)
+		return
+	}
+
+	linked := rider != ""
+	if !linked {
+		rider = racer.RacerName
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"rider": stageRiderResponse{
+		RacerID:   racer.ID,
+		EventID:   event.ID,
+		RacerName: racer.RacerName,
+		Rider:     rider,
+		Linked:    linked,
+	}})
+}
+
+// handleGetStageRaceStandings returns the general classification of a stage
+// race and the ranking of each stage. Like the event map data, it is public so
+// that spectators can follow the race.
+func (s *Server) handleGetStageRaceStandings(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid group ID"), http.StatusBadRequest)
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(groupID)
+	if err != nil {
+		s.errorJSON(w, fmt.Errorf("group database %d not found", groupID), http.StatusInternalServerError)
+		return
+	}
+	stageRace, ok := s.loadStageRaceFromURL(w, r, groupDB)
+	if !ok {
+		return
+	}
+
+	classification, err := s.stageRaceClassification(groupDB, stageRace)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{
+		"stageRace":   toStageRaceResponse(stageRace),
+		"stagesRaced": classification.StagesRaced,
+		"standings":   classification.Standings,
+		"stages":      classification.Stages,
+	})
+}
+
+// stageRaceClassification works out the results of every stage of a stage race
+// and the general classification. Racers are matched across stages by name,
+// unless they have been linked to a rider explicitly.
+func (s *Server) stageRaceClassification(groupDB *sql.DB, stageRace *database.StageRace) (*stagerace.Classification, error) {
+	events, err := s.db.GetStages(groupDB, stageRace.ID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.db.GetStageRaceRiders(groupDB, stageRace.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := make([]stagerace.Stage, len(events))
+	for i, event := range events {
+		racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		eventResults, err := s.eventResults(groupDB, event, racers)
+		if err != nil {
+			return nil, err
+		}
+		stage := stagerace.Stage{EventID: event.ID, Number: int(event.StageNumber.Int64), Name: event.Name}
+		for j, racer := range racers {
+			name, linked := links[racer.ID]
+			if !linked {
+				name = strings.TrimSpace(racer.RacerName)
+			}
+			stage.Entries = append(stage.Entries, stagerace.Entry{
+				Rider:  stagerace.RiderKey(name),
+				Name:   name,
+				Result: eventResults[j],
+			})
+		}
+		stages[i] = stage
+	}
+
+	bonuses := make([]time.Duration, len(stageRace.TimeBonuses))
+	for i, b := range stageRace.TimeBonuses {
+		bonuses[i] = time.Duration(b) * time.Second
+	}
+	return stagerace.Compute(stages, bonuses), nil
+}
+
+// loadStageRaceFromURL loads the stage race named by the stageRaceID URL
+// parameter. If anything fails, the error response has already been written.
+func (s *Server) loadStageRaceFromURL(w http.ResponseWriter, r *http.Request, groupDB *sql.DB) (*database.StageRace, bool) {
+	stageRaceID, err := strconv.ParseInt(chi.URLParam(r, "stageRaceID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid stage race ID"), http.StatusBadRequest)
+		return nil, false
+	}
+	stageRace, err := s.db.GetStageRaceByID(groupDB, stageRaceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("stage race not found"), http.StatusNotFound)
+			return nil, false
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return stageRace, true
+}
+
+// loadStageRaceForOwner loads the stage race named in the URL and checks that
+// the user created it.
+func (s *Server) loadStageRaceForOwner(w http.ResponseWriter, r *http.Request, groupDB *sql.DB, userID int64) (*database.StageRace, bool) {
+	stageRace, ok := s.loadStageRaceFromURL(w, r, groupDB)
+	if !ok {
+		return nil, false
+	}
+	if stageRace.CreatorUserID != userID {
+		s.errorJSON(w, errors.New("forbidden: only the stage race creator can change it"), http.StatusForbidden)
+		return nil, false
+	}
+	return stageRace, true
+}
+
+// validateTimeBonuses checks that time bonuses are not negative.
+func validateTimeBonuses(bonuses []int) error {
+	for _, b := range bonuses {
+		if b < 0 {
+			return errors.New("timeBonuses cannot be negative")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,692 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+)
+
+// maxStartListSize is the largest start list CSV accepted, in bytes.
+const maxStartListSize = 5 << 20
+
+// Start list columns, as written by exports. Imports also accept the aliases
+// in startListAliases, in any order and case.
+const (
+	columnName        = "name"
+	columnBib         = "bib"
+	columnCategory    = "category"
+	columnClub        = "club"
+	columnNationality = "nationality"
+	columnTeam        = "team"
+	columnColour      = "colour"
+	columnStartTime   = "start time"
+	columnEmail       = "email"
+)
+
+var startListColumns = []string{columnName, columnBib, columnCategory, columnClub, columnNationality, columnTeam, columnColour, columnStartTime, columnEmail}
+
+// startListAliases maps normalized header names (see startListKey) to columns.
+var startListAliases = map[string]string{
+	"name":            columnName,
+	"racer":           columnName,
+	"racername":       columnName,
+	"bib":             columnBib,
+	"bibnumber":       columnBib,
+	"number":          columnBib,
+	"category":        columnCategory,
+	"cat":             columnCategory,
+	"club":            columnClub,
+	"nationality":     columnNationality,
+	"country":         columnNationality,
+	"team":            columnTeam,
+	"colour":          columnColour,
+	"color":           columnColour,
+	"trackcolour":     columnColour,
+	"trackcolor":      columnColour,
+	"starttime":       columnStartTime,
+	"start":           columnStartTime,
+	"email":           columnEmail,
+	"useremail":       columnEmail,
+	"linkeduseremail": columnEmail,
+}
+
+// Start list import actions.
+const (
+	startListCreate = "create"
+	startListUpdate = "update"
+)
+
+// How a start list row found the racer it updates.
+const (
+	startListMatchBib  = "bib"
+	startListMatchName = "name"
+)
+
+// hexColorPattern matches a track colour such as '#1e90ff'.
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// startListRow is the preview of one row of a start list import.
+type startListRow struct {
+	Row     int      `json:"row"` // Line in the CSV, counting the header
+	Name    string   `json:"name"`
+	Bib     string   `json:"bib"`
+	Action  string   `json:"action"`          // "create" or "update"
+	Match   string   `json:"match,omitempty"` // "bib" or "name", for updates
+	RacerID int64    `json:"racerId,omitempty"`
+	Errors  []string `json:"errors"`
+
+	racer    *database.Racer // The racer as the row leaves them
+	previous *database.Racer // The racer before the row, if it updates one
+	color    string          // Track colour to set, if any
+	team     *string         // Team name to put the racer in, if the column is given
+	userID   *sql.NullInt64  // User to link the racer to, if the column is given
+}
+
+// --- HTTP Handlers ---
+
+// handleImportStartList creates and updates an event's racers from a CSV start
+// list, sent as the request body or as the 'file' field of a multipart form.
+// The first line names the columns: name, bib, category, club, nationality,
+// team, colour, start time and email, which links the racer to a group
+// member's account. Rows update the racer with the same bib, or else the only
+// racer with the same name (among racers without a bib when the row gives a
+// new bib), and create the others. Only the columns given
+// are changed, and an empty cell clears its field. Teams are created by name
+// when missing.
+//
+// With dryRun=true nothing is saved and each row is previewed with its errors.
+// Otherwise the start list is only imported if no row has errors.
+func (s *Server) handleImportStartList(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxStartListSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			s.errorJSON(w, errors.New("a CSV file is required in the 'file' field"), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		s.errorJSON(w, fmt.Errorf("could not read CSV: %w", err), http.StatusBadRequest)
+		return
+	}
+	if len(records) < 2 {
+		s.errorJSON(w, errors.New("the CSV needs a header line and at least one racer"), http.StatusBadRequest)
+		return
+	}
+
+	columns := make(map[string]int)
+	var ignored []string
+	for i, header := range records[0] {
+		column, ok := startListAliases[startListKey(header)]
+		if !ok {
+			ignored = append(ignored, header)
+			continue
+		}
+		if _, dup := columns[column]; dup {
+			s.errorJSON(w, fmt.Errorf("the %s column is given twice", column), http.StatusBadRequest)
+			return
+		}
+		columns[column] = i
+	}
+	if _, ok := columns[columnName]; !ok {
+		s.errorJSON(w, errors.New("the CSV needs a name column"), http.StatusBadRequest)
+		return
+	}
+
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	eventTeams, err := s.db.GetTeamsByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rows := s.planStartList(event, records, columns, racers)
+	var created, updated, failed int
+	for _, row := range rows {
+		switch {
+		case len(row.Errors) > 0:
+			failed++
+		case row.Action == startListCreate:
+			created++
+		default:
+			updated++
+		}
+	}
+	report := envelope{
+		"dryRun":         dryRun,
+		"created":        created,
+		"updated":        updated,
+		"failed":         failed,
+		"ignoredColumns": ignored,
+		"rows":           rows,
+	}
+	if failed > 0 && !dryRun {
+		report["error"] = fmt.Sprintf("%d rows have errors; nothing was imported", failed)
+		s.writeJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+	if dryRun {
+		s.writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	teamsByName := make(map[string]*database.Team, len(eventTeams))
+	teamColors := make(map[string]bool, len(eventTeams))
+	for _, team := range eventTeams {
+		teamsByName[strings.ToLower(team.Name)] = team
+		teamColors[team.Color] = true
+	}
+	linked := false
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		for _, row := range rows {
+			racer := row.racer
+			if row.Action == startListCreate {
+				added, err := s.db.AddRacerToEvent(tx, event.ID, event.CreatorUserID, racer.RacerName, row.color, sql.NullString{})
+				if err != nil {
+					return err
+				}
+				racer.ID, racer.TrackColor = added.ID, added.TrackColor
+			} else if row.color != "" {
+				if err := s.db.UpdateRacerColor(tx, racer.ID, row.color); err != nil {
+					return err
+				}
+				racer.TrackColor = row.color
+			}
+			if err := s.db.UpdateRacerDetails(tx, racer); err != nil {
+				return err
+			}
+			if err := s.recordScoringChanges(tx, event.CreatorUserID, row.previous, racer); err != nil {
+				return err
+			}
+
+			if row.team != nil {
+				var teamID, leg sql.NullInt64
+				if *row.team != "" {
+					team := teamsByName[strings.ToLower(*row.team)]
+					if team == nil {
+						color := distinctColor(teamColors)
+						var err error
+						if team, err = s.db.CreateTeam(tx, event.ID, *row.team, color); err != nil {
+							return err
+						}
+						teamsByName[strings.ToLower(team.Name)] = team
+						teamColors[color] = true
+					}
+					teamID = sql.NullInt64{Int64: team.ID, Valid: true}
+					if racer.TeamID == teamID {
+						leg = racer.Leg // Staying in the team keeps their leg.
+					}
+				}
+				if err := s.db.SetRacerTeam(tx, racer.ID, teamID, leg); err != nil {
+					return err
+				}
+				racer.TeamID, racer.Leg = teamID, leg
+			}
+
+			if row.userID != nil && *row.userID != racer.UserID {
+				if err := s.db.SetRacerUser(tx, racer.ID, *row.userID); err != nil {
+					return err
+				}
+				racer.UserID = *row.userID
+				linked = true
+			}
+			row.RacerID = racer.ID
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("ERROR: could not import start list of event %d: %v", event.ID, err)
+		s.errorJSON(w, errors.New("failed to import start list"), http.StatusInternalServerError)
+		return
+	}
+	if linked {
+		// Best efforts are kept per user, so follow the new links.
+		go s.refreshEventBestEfforts(groupDB, event)
+	}
+	s.writeJSON(w, http.StatusOK, report)
+}
+
+// handleExportStartList writes an event's racers as a CSV start list, in the
+// columns handleImportStartList reads.
+func (s *Server) handleExportStartList(w http.ResponseWriter, r *http.Request) {
+	if _, _, _, ok := s.loadGroupForMember(w, r); !ok {
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	teamNames, err := s.eventTeamNames(groupDB, event)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	lines := [][]string{startListColumns}
+	for _, racer := range racers {
+		var email string
+		if racer.UserID.Valid {
+			if user, err := s.db.GetUserByID(s.db.GetMainDB(), racer.UserID.Int64); err == nil {
+				email = user.Email
+			}
+		}
+		lines = append(lines, []string{
+			racer.RacerName,
+			racer.Bib,
+			racer.Category,
+			racer.Club,
+			racer.Nationality,
+			teamNames[racer.TeamID.Int64],
+			racer.TrackColor,
+			formatStartTime(event, racer.StartOffset),
+			email,
+		})
+	}
+	writeCSV(w, csvFileName(event, "start-list"), lines)
+}
+
+// handleExportResults writes an event's results as CSV, ranked as by
+// handleGetEventResults. Like the results themselves, the export is public.
+func (s *Server) handleExportResults(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+	timing, ok := s.resultTiming(w, r, event)
+	if !ok {
+		return
+	}
+	entries, err := s.resultTable(groupDB, event, timing)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racerTeams := make(map[int64]int64, len(racers))
+	for _, racer := range racers {
+		racerTeams[racer.ID] = racer.TeamID.Int64
+	}
+	teamNames, err := s.eventTeamNames(groupDB, event)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	lines := [][]string{{"rank", "category rank", "bib", "name", "category", "club", "nationality", "team", "status", "time", "raw time", "adjusted time", "gap", "category gap"}}
+	for _, e := range entries {
+		line := []string{
+			formatRank(e.Rank),
+			formatRank(e.CategoryRank),
+			e.Bib,
+			e.RacerName,
+			e.Category,
+			e.Club,
+			e.Nationality,
+			teamNames[racerTeams[e.RacerID]],
+			e.Status,
+			"", "", "", "", "",
+		}
+		if e.Rank > 0 {
+			line[9], line[10], line[11] = formatCSVDuration(e.Time), formatCSVDuration(e.RawTime), formatCSVDuration(e.AdjustedTime)
+			line[12], line[13] = formatCSVDuration(e.Gap), formatCSVDuration(e.CategoryGap)
+		}
+		lines = append(lines, line)
+	}
+	writeCSV(w, csvFileName(event, "results"), lines)
+}
+
+// --- Helpers ---
+
+// planStartList checks each row of a start list and works out the racer it
+// creates or updates, without saving anything.
+func (s *Server) planStartList(event *database.Event, records [][]string, columns map[string]int, racers []*database.Racer) []*startListRow {
+	byBib := make(map[string]*database.Racer)
+	byName := make(map[string][]*database.Racer)
+	unbibbed := make(map[string][]*database.Racer) // By name, racers without a bib
+	usedColors := make(map[string]bool, len(racers))
+	for _, racer := range racers {
+		if racer.Bib != "" {
+			byBib[racer.Bib] = racer
+		}
+		key := strings.ToLower(racer.RacerName)
+		byName[key] = append(byName[key], racer)
+		if racer.Bib == "" {
+			unbibbed[key] = append(unbibbed[key], racer)
+		}
+		usedColors[racer.TrackColor] = true
+	}
+	memberEmails := make(map[string]sql.NullInt64) // Looked up emails
+	rowOfBib := make(map[string]int)
+	matched := make(map[int64]int)
+
+	var rows []*startListRow
+	for i, record := range records[1:] {
+		row := &startListRow{Row: i + 2, Errors: []string{}}
+		rows = append(rows, row)
+		cell := func(column string) (string, bool) {
+			index, ok := columns[column]
+			if !ok {
+				return "", false
+			}
+			if index >= len(record) {
+				return "", true
+			}
+			return unescapeCSVCell(strings.TrimSpace(record[index])), true
+		}
+		fail := func(err error) { row.Errors = append(row.Errors, err.Error()) }
+
+		row.Name, _ = cell(columnName)
+		bib, hasBib := cell(columnBib)
+		row.Bib = bib
+		if row.Name == "" {
+			fail(errors.New("name is required"))
+		}
+		if bib != "" {
+			if other, dup := rowOfBib[bib]; dup {
+				fail(fmt.Errorf("bib %s is also on row %d", bib, other))
+			}
+			rowOfBib[bib] = row.Row
+		}
+
+		// Find the racer the row is for: by bib, or else by name. A new bib
+		// can only go to a racer that has none yet.
+		var existing *database.Racer
+		match := startListMatchBib
+		if bib != "" {
+			existing = byBib[bib]
+		}
+		if existing == nil && row.Name != "" {
+			same := byName[strings.ToLower(row.Name)]
+			if bib != "" {
+				same = unbibbed[strings.ToLower(row.Name)]
+			}
+			if len(same) == 1 {
+				existing, match = same[0], startListMatchName
+			} else if len(same) > 1 && bib != "" {
+				fail(fmt.Errorf("%d racers without a bib are named %s; set the bib on one first", len(same), row.Name))
+			} else if len(same) > 1 {
+				fail(fmt.Errorf("%d racers are named %s; give a bib to pick one", len(same), row.Name))
+			}
+		}
+		racer := &database.Racer{EventID: event.ID}
+		row.Action = startListCreate
+		if existing != nil {
+			if other, dup := matched[existing.ID]; dup && match == startListMatchName {
+				fail(fmt.Errorf("racer %s is also on row %d", existing.RacerName, other))
+			}
+			matched[existing.ID] = row.Row
+			copied := *existing
+			racer = &copied
+			row.Action, row.Match, row.RacerID, row.previous = startListUpdate, match, existing.ID, existing
+		}
+		if row.Name != "" {
+			racer.RacerName = row.Name
+		}
+		row.racer = racer
+
+		details := racerDetailsPayload{}
+		if hasBib {
+			details.Bib = &bib
+		}
+		if value, ok := cell(columnCategory); ok {
+			details.Category = &value
+		}
+		if value, ok := cell(columnClub); ok {
+			details.Club = &value
+		}
+		if value, ok := cell(columnNationality); ok {
+			details.Nationality = &value
+		}
+		if value, ok := cell(columnStartTime); ok {
+			offset, err := parseStartTime(event, value)
+			if err != nil {
+				fail(err)
+			} else {
+				details.StartOffset = &offset
+			}
+		}
+		if err := applyRacerDetails(racer, details, racers); err != nil {
+			fail(err)
+		}
+
+		if value, ok := cell(columnColour); ok && value != "" {
+			if !hexColorPattern.MatchString(value) {
+				fail(fmt.Errorf("colour %s is not a hex colour like #1e90ff", value))
+			} else {
+				row.color = strings.ToLower(value)
+			}
+		}
+		if row.color == "" && existing == nil {
+			row.color = distinctColor(usedColors)
+		}
+		if row.color != "" {
+			usedColors[row.color] = true
+		}
+
+		if value, ok := cell(columnTeam); ok {
+			row.team = &value
+		}
+		if value, ok := cell(columnEmail); ok {
+			userID, err := s.startListUser(event, value, memberEmails)
+			if err != nil {
+				fail(err)
+			} else {
+				row.userID = &userID
+			}
+		}
+	}
+	return rows
+}
+
+// startListUser returns the user a start list links a racer to by email, who
+// must be a member of the event's group. An empty email unlinks the racer.
+// Lookups are cached in seen.
+func (s *Server) startListUser(event *database.Event, email string, seen map[string]sql.NullInt64) (sql.NullInt64, error) {
+	email = strings.ToLower(email)
+	if email == "" {
+		return sql.NullInt64{}, nil
+	}
+	if userID, ok := seen[email]; ok {
+		if !userID.Valid {
+			return userID, fmt.Errorf("%s is not a member of this group", email)
+		}
+		return userID, nil
+	}
+	user, err := s.db.GetUserByEmail(s.db.GetMainDB(), email)
+	if err == nil {
+		var isMember bool
+		if isMember, err = s.db.IsUserGroupMember(s.db.GetMainDB(), event.GroupID, user.ID); err == nil && isMember {
+			seen[email] = sql.NullInt64{Int64: user.ID, Valid: true}
+			return seen[email], nil
+		}
+	}
+	seen[email] = sql.NullInt64{}
+	return sql.NullInt64{}, fmt.Errorf("%s is not a member of this group", email)
+}
+
+// eventTeamNames returns the names of an event's teams by ID.
+func (s *Server) eventTeamNames(groupDB *sql.DB, event *database.Event) (map[int64]string, error) {
+	eventTeams, err := s.db.GetTeamsByEventID(groupDB, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(eventTeams))
+	for _, team := range eventTeams {
+		names[team.ID] = team.Name
+	}
+	return names, nil
+}
+
+// startListKey normalizes a start list header for startListAliases.
+func startListKey(header string) string {
+	header = strings.TrimPrefix(header, "\ufeff") // Spreadsheets may start the file with a byte order mark.
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+// parseStartTime reads a racer's start time from a start list as seconds after
+// the event start. It may be a time of day on the event's start date, such as
+// '09:30:15', an RFC 3339 timestamp, or an offset such as '+0:01:30'. An empty
+// start time starts the racer with the event.
+func parseStartTime(event *database.Event, value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(value, "+") {
+		offset, ok := parseCSVDuration(value[1:])
+		if !ok {
+			return 0, fmt.Errorf("start time %s is not an offset like +0:01:30", value)
+		}
+		return offset, nil
+	}
+	if !event.StartDate.Valid {
+		return 0, errors.New("the event has no start date, so start times must be offsets like +0:01:30")
+	}
+	start := event.StartDate.Time.UTC()
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		clock, ok := parseCSVDuration(value)
+		if !ok || clock >= 24*60*60 || strings.Count(value, ":") == 0 {
+			return 0, fmt.Errorf("start time %s is not a time like 09:30:15", value)
+		}
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		t = day.Add(seconds(clock))
+	}
+	offset := t.Sub(start).Seconds()
+	if offset < 0 {
+		return 0, fmt.Errorf("start time %s is before the event starts", value)
+	}
+	return offset, nil
+}
+
+// parseCSVDuration reads a duration written as [[h:]mm:]ss[.s] into seconds.
+func parseCSVDuration(value string) (float64, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	var total float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i < len(parts)-1 && n != math.Trunc(n)) || (i > 0 && n >= 60) {
+			return 0, false
+		}
+		total = total*60 + n
+	}
+	return total, true
+}
+
+// formatCSVDuration writes seconds as h:mm:ss, with tenths if there are any.
+func formatCSVDuration(secs float64) string {
+	tenths := int64(math.Round(secs * 10))
+	h, m, s, t := tenths/36000, tenths/600%60, tenths/10%60, tenths%10
+	if t != 0 {
+		return fmt.Sprintf("%d:%02d:%02d.%d", h, m, s, t)
+	}
+	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+}
+
+// formatStartTime writes a racer's start offset for a start list: the time of
+// their start if the event has a start date, or else an offset.
+func formatStartTime(event *database.Event, offset float64) string {
+	if event.StartDate.Valid {
+		return event.StartDate.Time.UTC().Add(seconds(offset)).Format(time.RFC3339)
+	}
+	if offset > 0 {
+		return "+" + formatCSVDuration(offset)
+	}
+	return ""
+}
+
+// formatRank writes a rank, or nothing for racers who aren't ranked.
+func formatRank(rank int) string {
+	if rank == 0 {
+		return ""
+	}
+	return strconv.Itoa(rank)
+}
+
+// nonFileNameChars matches the runs of characters left out of download names.
+var nonFileNameChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// csvFileName names a CSV download after its event.
+func csvFileName(event *database.Event, suffix string) string {
+	name := strings.Trim(nonFileNameChars.ReplaceAllString(strings.ToLower(event.Name), "-"), "-")
+	if name == "" {
+		name = fmt.Sprintf("event-%d", event.ID)
+	}
+	return name + "-" + suffix + ".csv"
+}
+
+// writeCSV sends lines as a CSV download. Cells that spreadsheet apps would
+// run as formulas are escaped.
+func writeCSV(w http.ResponseWriter, fileName string, lines [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	for _, line := range lines {
+		for i, cell := range line {
+			line[i] = escapeCSVCell(cell)
+		}
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(lines); err != nil {
+		log.Printf("ERROR: could not write CSV %s: %v", fileName, err)
+	}
+}
+
+// csvFormulaPrefixes start the cells spreadsheet apps treat as formulas.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVCell quotes a cell that spreadsheet apps would run as a formula, so
+// that they show it as text. Racer names and other details come from uploads
+// and registrations, so they can't be trusted.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCSVCell undoes escapeCSVCell, so that exported lists import unchanged.
+func unescapeCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/results"
+	"github.com/intermernet/raceviz/internal/teams"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- Structs for JSON Payloads ---
+
+// teamPayload defines the fields of a team. For updates, an empty field is
+// left unchanged.
+type teamPayload struct {
+	Name  string `json:"name"`
+	Color string `json:"color"` // Picked at random if empty when creating a team
+}
+
+// setRacerTeamPayload puts a racer in a team.
+type setRacerTeamPayload struct {
+	TeamID int64 `json:"teamId"` // 0 takes the racer out of their team
+	Leg    int64 `json:"leg"`    // 1-based relay leg, or 0 for none
+}
+
+// --- HTTP Handlers ---
+
+// handleGetTeams lists the teams of an event with their members and the
+// current team standings.
+func (s *Server) handleGetTeams(w http.ResponseWriter, r *http.Request) {
+	if _, _, _, ok := s.loadGroupForMember(w, r); !ok {
+		return
+	}
+	groupDB, event, ok := s.loadEventFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	eventTeams, err := s.db.GetTeamsByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	racerPaths := make(map[int64]*gpx.TrackPath)
+	for _, racer := range racers {
+		if !racer.TeamID.Valid {
+			continue
+		}
+		path, err := s.processRacerTrack(event, racer)
+		if err != nil {
+			log.Printf("WARN: could not process track of racer %d for event %d: %v", racer.ID, event.ID, err)
+		}
+		racerPaths[racer.ID] = path
+	}
+	standings, err := s.teamStandings(groupDB, event, eventTeams, racers, racerPaths)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, envelope{
+		"teams":     toTeamResponseList(eventTeams, racers),
+		"standings": standings,
+	})
+}
+
+// handleCreateTeam adds a team to an event. Only the event creator can
+// manage teams.
+func (s *Server) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	_, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var payload teamPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		s.errorJSON(w, errors.New("name is required"), http.StatusBadRequest)
+		return
+	}
+	if payload.Color == "" {
+		payload.Color = fmt.Sprintf("#%06x", rand.Intn(0xFFFFFF))
+	}
+
+	var team *database.Team
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		var err error
+		team, err = s.db.CreateTeam(tx, event.ID, payload.Name, payload.Color)
+		return err
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to create team"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"team": toTeamResponse(team, nil)})
+}
+
+// handleUpdateTeam renames or recolours a team.
+func (s *Server) handleUpdateTeam(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	team, ok := s.loadTeamFromURL(w, r, groupDB, event)
+	if !ok {
+		return
+	}
+
+	var payload teamPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	if name := strings.TrimSpace(payload.Name); name != "" {
+		team.Name = name
+	}
+	if payload.Color != "" {
+		team.Color = payload.Color
+	}
+
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.UpdateTeam(tx, team)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to update team"), http.StatusInternalServerError)
+		return
+	}
+	racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"team": toTeamResponse(team, racers)})
+}
+
+// handleDeleteTeam deletes a team. Its members stay in the event as individuals.
+func (s *Server) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	team, ok := s.loadTeamFromURL(w, r, groupDB, event)
+	if !ok {
+		return
+	}
+
+	err := s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.DeleteTeam(tx, team.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete team"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "team deleted successfully"})
+}
+
+// handleSetRacerTeam puts a racer in one of the event's teams, for a relay leg
+// if given. Each leg of a team can only be raced by one racer.
+func (s *Server) handleSetRacerTeam(w http.ResponseWriter, r *http.Request) {
+	groupDB, event, ok := s.loadEventForOwner(w, r)
+	if !ok {
+		return
+	}
+	racerID, err := strconv.ParseInt(chi.URLParam(r, "racerID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid racer ID"), http.StatusBadRequest)
+		return
+	}
+	racer, err := s.db.GetRacerByID(groupDB, racerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return
+	}
+
+	var payload setRacerTeamPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	if payload.Leg < 0 {
+		s.errorJSON(w, errors.New("leg cannot be negative"), http.StatusBadRequest)
+		return
+	}
+
+	var teamID, leg sql.NullInt64
+	if payload.TeamID != 0 {
+		team, err := s.db.GetTeamByID(groupDB, payload.TeamID)
+		if err != nil || team.EventID != event.ID {
+			s.errorJSON(w, errors.New("team not found"), http.StatusBadRequest)
+			return
+		}
+		teamID = sql.NullInt64{Int64: team.ID, Valid: true}
+		if payload.Leg > 0 {
+			leg = sql.NullInt64{Int64: payload.Leg, Valid: true}
+			racers, err := s.db.GetRacersByEventID(groupDB, event.ID)
+			if err != nil {
+				s.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+			for _, other := range racers {
+				if other.ID != racer.ID && other.TeamID == teamID && other.Leg == leg {
+					s.errorJSON(w, fmt.Errorf("leg %d of this team is already raced by %s", payload.Leg, other.RacerName), http.StatusConflict)
+					return
+				}
+			}
+		}
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.SetRacerTeam(tx, racer.ID, teamID, leg)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to set racer's team"), http.StatusInternalServerError)
+		return
+	}
+	racer.TeamID, racer.Leg = teamID, leg
+	s.writeJSON(w, http.StatusOK, envelope{"racer": toRacerResponse(racer)})
+}
+
+// teamStandings scores the teams of an event by the event's team scoring.
+// racerPaths holds the processed track of each racer, nil for racers without
+// one. It returns nil if the event has no teams.
+func (s *Server) teamStandings(groupDB *sql.DB, event *database.Event, eventTeams []*database.Team, racers []*database.Racer, racerPaths map[int64]*gpx.TrackPath) ([]teams.Standing, error) {
+	if len(eventTeams) == 0 {
+		return nil, nil
+	}
+	checkpoints, err := s.resultCheckpoints(groupDB, event)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]teams.Team, len(eventTeams))
+	index := make(map[int64]int, len(eventTeams))
+	for i, team := range eventTeams {
+		list[i] = teams.Team{ID: team.ID, Name: team.Name}
+		index[team.ID] = i
+	}
+	for _, racer := range racers {
+		if !racer.TeamID.Valid {
+			continue
+		}
+		i, ok := index[racer.TeamID.Int64]
+		if !ok {
+			continue
+		}
+		path := racerPaths[racer.ID]
+		member := teams.Member{
+			RacerID: racer.ID,
+			Leg:     int(racer.Leg.Int64),
+			Result:  trackResult(event, racer, path, checkpoints),
+		}
+		if path != nil {
+			member.Points = path.Points
+		}
+		list[i].Members = append(list[i].Members, member)
+	}
+
+	rules := teams.Rules{Scoring: event.TeamScoring, Counted: event.TeamCounted}
+	if event.EventType == "race" && event.StartDate.Valid {
+		rules.RelayStart = event.StartDate.Time
+	}
+	if event.ExchangeLat.Valid && event.ExchangeLon.Valid {
+		rules.Exchange = &results.Checkpoint{Lat: event.ExchangeLat.Float64, Lon: event.ExchangeLon.Float64, Radius: event.ExchangeRadius}
+	}
+	return teams.Rank(list, rules), nil
+}
+
+// loadTeamFromURL parses the teamID URL parameter and loads the team, checking
+// that it belongs to the event.
+func (s *Server) loadTeamFromURL(w http.ResponseWriter, r *http.Request, groupDB *sql.DB, event *database.Event) (*database.Team, bool) {
+	teamID, err := strconv.ParseInt(chi.URLParam(r, "teamID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid team ID"), http.StatusBadRequest)
+		return nil, false
+	}
+	team, err := s.db.GetTeamByID(groupDB, teamID)
+	if err != nil || team.EventID != event.ID {
+		s.errorJSON(w, errors.New("team not found"), http.StatusNotFound)
+		return nil, false
+	}
+	return team, true
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// reorderTrackFilesPayload lists all of a racer's track file IDs in the new order.
+type reorderTrackFilesPayload struct {
+	FileIDs []int64 `json:"fileIds"`
+}
+
+// handleGetTrackFiles lists the files a racer's track is stitched from, in order.
+func (s *Server) handleGetTrackFiles(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+
+	files, err := s.db.GetTrackFilesByRacerID(groupDB, racer.ID)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not retrieve track files"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"trackFiles": toTrackFileResponseList(files)})
+}
+
+// handleDeleteTrackFile removes a single file from a racer's track.
+func (s *Server) handleDeleteTrackFile(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileID"), 10, 64)
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid file ID"), http.StatusBadRequest)
+		return
+	}
+	file, err := s.db.GetTrackFileByID(groupDB, fileID)
+	if err != nil || file.RacerID != racer.ID {
+		s.errorJSON(w, errors.New("track file not found"), http.StatusNotFound)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.DeleteTrackFile(tx, file.ID)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to delete track file"), http.StatusInternalServerError)
+		return
+	}
+
+	fullPath := filepath.Join(s.config.GpxPath, file.FilePath)
+	if err := os.Remove(fullPath); err != nil {
+		log.Printf("WARN: failed to delete gpx file %s: %v", fullPath, err)
+	}
+	if err := s.refreshRacerSpatialData(groupDB, event, racer.ID); err != nil {
+		log.Printf("WARN: could not update spatial data for event %d: %v", event.ID, err)
+	}
+	s.refreshBestEfforts(groupDB, event, racer.ID, false)
+
+	s.writeJSON(w, http.StatusOK, envelope{"message": "track file deleted successfully"})
+}
+
+// handleReorderTrackFiles changes the order the files of a racer's track are
+// stitched together in. The payload must list every one of the racer's files.
+func (s *Server) handleReorderTrackFiles(w http.ResponseWriter, r *http.Request) {
+	event, racer, ok := s.loadManagedRacer(w, r)
+	if !ok {
+		return
+	}
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+
+	var payload reorderTrackFilesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+
+	files, err := s.db.GetTrackFilesByRacerID(groupDB, racer.ID)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not retrieve track files"), http.StatusInternalServerError)
+		return
+	}
+	remaining := make(map[int64]bool, len(files))
+	for _, f := range files {
+		remaining[f.ID] = true
+	}
+	for _, id := range payload.FileIDs {
+		if !remaining[id] {
+			s.errorJSON(w, errors.New("fileIds must list each of the racer's track files once"), http.StatusBadRequest)
+			return
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		s.errorJSON(w, errors.New("fileIds must list each of the racer's track files once"), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.WriteToGroupDB(event.GroupID, func(tx *sql.Tx) error {
+		return s.db.ReorderTrackFiles(tx, racer.ID, payload.FileIDs)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("failed to reorder track files"), http.StatusInternalServerError)
+		return
+	}
+	if err := s.refreshRacerSpatialData(groupDB, event, racer.ID); err != nil {
+		log.Printf("WARN: could not update spatial data for event %d: %v", event.ID, err)
+	}
+	s.refreshBestEfforts(groupDB, event, racer.ID, false)
+
+	files, err = s.db.GetTrackFilesByRacerID(groupDB, racer.ID)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not retrieve track files"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"trackFiles": toTrackFileResponseList(files)})
+}
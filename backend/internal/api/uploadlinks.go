@@ -0,0 +1,316 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/database"
+	"github.com/intermernet/raceviz/internal/realtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultUploadLinkLifetime is how long a guest upload link works if the
+	// event owner doesn't say.
+	defaultUploadLinkLifetime = 7 * 24 * time.Hour
+	// maxUploadLinkLifetime is the longest a guest upload link can work.
+	maxUploadLinkLifetime = 30 * 24 * time.Hour
+)
+
+// --- Structs for JSON Payloads ---
+
+// createUploadLinkPayload sets how long a new guest upload link works.
+type createUploadLinkPayload struct {
+	ExpiresInHours float64 `json:"expiresInHours"` // 0 for the default of a week
+}
+
+// uploadLinkResponse is a guest upload link, as shown to the event owner.
+type uploadLinkResponse struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url"` // The page the guest opens to upload
+	RacerID   int64      `json:"racerId"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// guestUploadResponse describes what a guest upload link is for, without
+// anything a guest shouldn't see.
+type guestUploadResponse struct {
+	EventName string     `json:"eventName"`
+	EventType string     `json:"eventType"`
+	StartDate *time.Time `json:"startDate,omitempty"`
+	EndDate   *time.Time `json:"endDate,omitempty"`
+	RacerName string     `json:"racerName"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+}
+
+// --- HTTP Handlers ---
+
+// handleCreateUploadLink issues a single-use link with which a guest without an
+// account, e.g. someone who rode with the group, can upload a track file for a
+// racer. Only the event owner can issue links.
+func (s *Server) handleCreateUploadLink(w http.ResponseWriter, r *http.Request) {
+	_, event, racer, userID, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+	var payload createUploadLinkPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		s.errorJSON(w, errors.New("bad request: could not decode JSON"), http.StatusBadRequest)
+		return
+	}
+	lifetime := defaultUploadLinkLifetime
+	if payload.ExpiresInHours < 0 {
+		s.errorJSON(w, errors.New("expiresInHours cannot be negative"), http.StatusBadRequest)
+		return
+	} else if payload.ExpiresInHours > 0 {
+		lifetime = time.Duration(payload.ExpiresInHours * float64(time.Hour))
+	}
+	if lifetime > maxUploadLinkLifetime {
+		s.errorJSON(w, errors.New("upload links can work for at most 30 days"), http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		s.errorJSON(w, errors.New("could not generate upload link"), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	link := &database.UploadLink{
+		Token:     hex.EncodeToString(b),
+		GroupID:   event.GroupID,
+		EventID:   event.ID,
+		RacerID:   racer.ID,
+		CreatedBy: userID,
+		ExpiresAt: now.Add(lifetime),
+		CreatedAt: now,
+	}
+	err := s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.CreateUploadLink(tx, link)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("could not save upload link"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, envelope{"uploadLink": s.uploadLinkResponse(link)})
+}
+
+// handleGetUploadLinks lists the guest upload links issued for a racer.
+func (s *Server) handleGetUploadLinks(w http.ResponseWriter, r *http.Request) {
+	_, event, racer, _, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.db.GetUploadLinksForRacer(s.db.GetMainDB(), event.GroupID, racer.ID)
+	if err != nil {
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	list := make([]uploadLinkResponse, 0, len(links))
+	for _, link := range links {
+		list = append(list, s.uploadLinkResponse(link))
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"uploadLinks": list})
+}
+
+// handleDeleteUploadLink revokes a guest upload link.
+func (s *Server) handleDeleteUploadLink(w http.ResponseWriter, r *http.Request) {
+	_, event, racer, _, ok := s.loadRacerForOwner(w, r)
+	if !ok {
+		return
+	}
+	link, err := s.db.GetUploadLink(s.db.GetMainDB(), chi.URLParam(r, "token"))
+	if err != nil || link.GroupID != event.GroupID || link.RacerID != racer.ID {
+		s.errorJSON(w, errors.New("upload link not found"), http.StatusNotFound)
+		return
+	}
+	err = s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.DeleteUploadLink(tx, link.Token)
+	})
+	if err != nil {
+		s.errorJSON(w, errors.New("could not revoke upload link"), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"message": "upload link revoked"})
+}
+
+// handleGetGuestUpload tells the holder of a guest upload link which event and
+// racer it uploads for. The token is the only authentication.
+func (s *Server) handleGetGuestUpload(w http.ResponseWriter, r *http.Request) {
+	link, event, racer, ok := s.loadUploadLink(w, r)
+	if !ok {
+		return
+	}
+	resp := guestUploadResponse{
+		EventName: event.Name,
+		EventType: event.EventType,
+		RacerName: racer.RacerName,
+		ExpiresAt: link.ExpiresAt,
+	}
+	if event.StartDate.Valid {
+		resp.StartDate = &event.StartDate.Time
+	}
+	if event.EndDate.Valid {
+		resp.EndDate = &event.EndDate.Time
+	}
+	s.writeJSON(w, http.StatusOK, envelope{"upload": resp})
+}
+
+// handleGuestUpload takes a track file from the holder of a guest upload link
+// and adds it to the link's racer, as if the event owner who issued the link
+// had uploaded it. The file is validated like any other upload, and the link
+// only works once a file has been accepted. The event owner is notified.
+func (s *Server) handleGuestUpload(w http.ResponseWriter, r *http.Request) {
+	link, event, racer, ok := s.loadUploadLink(w, r)
+	if !ok {
+		return
+	}
+
+	// --- 1. Read & Validate the File ---
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB max file size
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		s.errorJSON(w, errors.New("file is too large (max 10MB)"), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("gpxFile")
+	if err != nil {
+		s.errorJSON(w, errors.New("invalid file upload"), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		s.errorJSON(w, errors.New("could not read uploaded file"), http.StatusInternalServerError)
+		return
+	}
+	upload, err := readTrackUpload(event, racer.RacerName, data)
+	if err != nil {
+		var uploadErr *trackUploadError
+		if errors.As(err, &uploadErr) {
+			s.errorJSON(w, uploadErr.err, uploadErr.status)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// --- 2. Use Up the Link ---
+	// Only one of two uploads racing on the same link gets past this.
+	err = s.db.WriteToMainDB(func(tx *sql.Tx) error {
+		return s.db.UseUploadLink(tx, link.Token, time.Now())
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrUploadLinkUsed) {
+			s.errorJSON(w, err, http.StatusGone)
+			return
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// --- 3. Store the File ---
+	trackFile, err := s.storeTrackFile(event, racer, link.CreatedBy, filepath.Base(header.Filename), upload.gpxBytes)
+	if err != nil {
+		// Let the guest try again.
+		if err := s.db.WriteToMainDB(func(tx *sql.Tx) error { return s.db.ReleaseUploadLink(tx, link.Token) }); err != nil {
+			log.Printf("WARN: could not release upload link for racer %d: %v", racer.ID, err)
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	groupDB, err := s.db.GetGroupDB(event.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return
+	}
+	if err := s.refreshRacerSpatialData(groupDB, event, racer.ID); err != nil {
+		log.Printf("WARN: could not update spatial data for event %d: %v", event.ID, err)
+	}
+	if len(upload.turnpoints) > 0 {
+		if err := s.applyDeclaredTask(groupDB, event, upload.turnpoints); err != nil {
+			log.Printf("WARN: could not set checkpoints of event %d from IGC task: %v", event.ID, err)
+		}
+	}
+	s.refreshBestEfforts(groupDB, event, racer.ID, true)
+
+	// --- 4. Notify the Event Owner ---
+	s.broker.NotifyUser(event.CreatorUserID, realtime.Message{
+		Type: "guest_upload",
+		Payload: map[string]interface{}{
+			"groupId":     event.GroupID,
+			"eventId":     event.ID,
+			"eventName":   event.Name,
+			"racerId":     racer.ID,
+			"racerName":   racer.RacerName,
+			"trackFileId": trackFile.ID,
+			"fileName":    trackFile.OriginalName,
+		},
+	})
+
+	s.writeJSON(w, http.StatusCreated, envelope{"message": "track file uploaded successfully"})
+}
+
+// --- Helpers ---
+
+// loadUploadLink loads the guest upload link named by the token in the URL,
+// with its event and racer. Links that were used or have expired are gone. On
+// failure the error response has already been written.
+func (s *Server) loadUploadLink(w http.ResponseWriter, r *http.Request) (*database.UploadLink, *database.Event, *database.Racer, bool) {
+	link, err := s.db.GetUploadLink(s.db.GetMainDB(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorJSON(w, errors.New("upload link not found"), http.StatusNotFound)
+			return nil, nil, nil, false
+		}
+		s.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+	if link.UsedAt.Valid || !time.Now().Before(link.ExpiresAt) {
+		s.errorJSON(w, database.ErrUploadLinkUsed, http.StatusGone)
+		return nil, nil, nil, false
+	}
+	groupDB, err := s.db.GetGroupDB(link.GroupID)
+	if err != nil {
+		s.errorJSON(w, errors.New("group database not found"), http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+	event, err := s.db.GetEventByID(groupDB, link.EventID)
+	if err != nil {
+		s.errorJSON(w, errors.New("event not found"), http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	racer, err := s.db.GetRacerByID(groupDB, link.RacerID)
+	if err != nil || racer.EventID != event.ID {
+		s.errorJSON(w, errors.New("racer not found"), http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	return link, event, racer, true
+}
+
+// uploadLinkResponse converts a guest upload link to its DTO, with the page
+// the guest opens to use it.
+func (s *Server) uploadLinkResponse(link *database.UploadLink) uploadLinkResponse {
+	resp := uploadLinkResponse{
+		Token:     link.Token,
+		URL:       s.config.FrontendURL + "/upload/" + link.Token,
+		RacerID:   link.RacerID,
+		ExpiresAt: link.ExpiresAt,
+		CreatedAt: link.CreatedAt,
+	}
+	if link.UsedAt.Valid {
+		resp.UsedAt = &link.UsedAt.Time
+	}
+	return resp
+}
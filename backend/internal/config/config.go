@@ -34,6 +34,22 @@ type Config struct {
 	GoogleOauthClientSecret string
 	GoogleOauthRedirectURL  string
 
+	// --- Optional Track Processing Data ---
+	// Path to a local OpenStreetMap extract (.osm.pbf) used to snap tracks to the
+	// road/trail network. Map matching is unavailable when this is empty.
+	OsmExtractPath string
+	// Path to a directory of SRTM (.hgt) or GeoTIFF DEM tiles used to correct track
+	// elevations. Elevation correction is unavailable when this is empty.
+	DemPath string
+
+	// --- Optional NMEA Listener ---
+	// TCP and/or UDP addresses (e.g. ":10110") on which raw NMEA 0183 streams are
+	// accepted. Fixes are recorded as live positions of the racer whose device
+	// token is NmeaDeviceToken. The listener is off when both addresses are empty.
+	NmeaTCPAddr     string
+	NmeaUDPAddr     string
+	NmeaDeviceToken string
+
 	// --- Parsed & Derived Fields ---
 	// Parsed version of FrontendURL for easy access to its components (scheme, host, etc.).
 	// This is used for WebSocket origin validation.
@@ -61,6 +77,11 @@ func New() (*Config, error) {
 		GoogleOauthClientID:     os.Getenv("GOOGLE_OAUTH_CLIENT_ID"),
 		GoogleOauthClientSecret: os.Getenv("GOOGLE_OAUTH_CLIENT_SECRET"),
 		GoogleOauthRedirectURL:  os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"),
+		OsmExtractPath:          os.Getenv("OSM_EXTRACT_PATH"),
+		DemPath:                 os.Getenv("DEM_PATH"),
+		NmeaTCPAddr:             os.Getenv("NMEA_TCP_ADDR"),
+		NmeaUDPAddr:             os.Getenv("NMEA_UDP_ADDR"),
+		NmeaDeviceToken:         os.Getenv("NMEA_DEVICE_TOKEN"),
 	}
 
 	// --- Provide sensible defaults for non-critical values ---
@@ -83,6 +104,10 @@ func New() (*Config, error) {
 		return nil, errors.New("FATAL: Google OAuth credentials are not set")
 	}
 
+	if (cfg.NmeaTCPAddr != "" || cfg.NmeaUDPAddr != "") && cfg.NmeaDeviceToken == "" {
+		return nil, errors.New("FATAL: NMEA_DEVICE_TOKEN must be set to use the NMEA listener")
+	}
+
 	// --- Parse and derive necessary fields ---
 	parsedURL, err := url.Parse(cfg.FrontendURL)
 	if err != nil {
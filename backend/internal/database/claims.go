@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrClaimDecided is returned when a claim was decided before it could be
+// approved or rejected.
+var ErrClaimDecided = errors.New("claim has already been decided")
+
+// ErrRacerLinked is returned when a racer is already linked to a user.
+var ErrRacerLinked = errors.New("racer is already linked to a user")
+
+// --- Racer Claim Queries (on groupDB) ---
+
+const racerClaimColumns = `id, racer_id, event_id, user_id, status, message, created_at, decided_by, decided_at`
+
+func scanRacerClaim(row rowScanner, c *RacerClaim) error {
+	return row.Scan(&c.ID, &c.RacerID, &c.EventID, &c.UserID, &c.Status, &c.Message, &c.CreatedAt, &c.DecidedBy, &c.DecidedAt)
+}
+
+// CreateRacerClaim inserts a new pending claim.
+func (s *Service) CreateRacerClaim(db DBorTx, racerID, eventID, userID int64, message string) (*RacerClaim, error) {
+	query := `INSERT INTO racer_claims (racer_id, event_id, user_id, message) VALUES (?, ?, ?, ?);`
+	res, err := db.Exec(query, racerID, eventID, userID, message)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetRacerClaimByID(db, id)
+}
+
+// GetRacerClaimByID returns a single claim.
+func (s *Service) GetRacerClaimByID(db DBorTx, id int64) (*RacerClaim, error) {
+	c := &RacerClaim{}
+	if err := scanRacerClaim(db.QueryRow(`SELECT `+racerClaimColumns+` FROM racer_claims WHERE id = ?;`, id), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetPendingRacerClaim returns a user's pending claim on a racer, or
+// sql.ErrNoRows if they have none.
+func (s *Service) GetPendingRacerClaim(db DBorTx, racerID, userID int64) (*RacerClaim, error) {
+	query := `SELECT ` + racerClaimColumns + ` FROM racer_claims
+		WHERE racer_id = ? AND user_id = ? AND status = 'pending';`
+	c := &RacerClaim{}
+	if err := scanRacerClaim(db.QueryRow(query, racerID, userID), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetRacerClaimsForUser returns the claims a user made, and the claims they
+// can decide: those on racers they added or in events they own. Pending
+// claims come first, then the newest.
+func (s *Service) GetRacerClaimsForUser(db DBorTx, userID int64) ([]*RacerClaim, error) {
+	query := `SELECT ` + racerClaimColumns + ` FROM racer_claims c
+		WHERE c.user_id = ?
+			OR c.racer_id IN (SELECT id FROM racers WHERE uploader_user_id = ?)
+			OR c.event_id IN (SELECT id FROM events WHERE creator_user_id = ?)
+		ORDER BY c.status != 'pending', c.created_at DESC, c.id DESC;`
+	rows, err := db.Query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claims []*RacerClaim
+	for rows.Next() {
+		c := &RacerClaim{}
+		if err := scanRacerClaim(rows, c); err != nil {
+			return nil, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// DecideRacerClaim approves or rejects a pending claim. Approving it links
+// the racer to the claiming user and rejects any other pending claims on the
+// racer.
+func (s *Service) DecideRacerClaim(db DBorTx, claim *RacerClaim, approve bool, decidedBy int64, at time.Time) error {
+	status := "rejected"
+	if approve {
+		status = "approved"
+	}
+	res, err := db.Exec(`UPDATE racer_claims SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = 'pending';`,
+		status, decidedBy, at, claim.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrClaimDecided
+	}
+	if !approve {
+		return nil
+	}
+	if err := s.LinkRacerUser(db, claim.RacerID, claim.UserID); err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE racer_claims SET status = 'rejected', decided_by = ?, decided_at = ?
+		WHERE racer_id = ? AND status = 'pending';`, decidedBy, at, claim.RacerID)
+	return err
+}
+
+// LinkRacerUser links a racer that is not linked yet to a user. It returns
+// ErrRacerLinked if the racer is already linked.
+func (s *Service) LinkRacerUser(db DBorTx, racerID, userID int64) error {
+	res, err := db.Exec(`UPDATE racers SET user_id = ? WHERE id = ? AND user_id IS NULL;`, userID, racerID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrRacerLinked
+	}
+	return nil
+}
+
+// SetRacerUser links a racer to the user who raced, or unlinks them.
+func (s *Service) SetRacerUser(db DBorTx, racerID int64, userID sql.NullInt64) error {
+	res, err := db.Exec(`UPDATE racers SET user_id = ? WHERE id = ?;`, userID, racerID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("racer not found")
+	}
+	return nil
+}
+
+// GetRacersByUserID returns the racers linked to a user, across all of the
+// group's events.
+func (s *Service) GetRacersByUserID(db DBorTx, userID int64) ([]*Racer, error) {
+	rows, err := db.Query(`SELECT `+racerColumns+` FROM racers WHERE user_id = ?;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var racers []*Racer
+	for rows.Next() {
+		racer := &Racer{}
+		if err := scanRacer(rows, racer); err != nil {
+			return nil, err
+		}
+		racers = append(racers, racer)
+	}
+	return racers, rows.Err()
+}
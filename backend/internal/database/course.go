@@ -0,0 +1,160 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// --- Checkpoint & Wind Queries (on groupDB) ---
+
+// GetCheckpointsByEventID returns an event's checkpoints in course order.
+func (s *Service) GetCheckpointsByEventID(db DBorTx, eventID int64) ([]*Checkpoint, error) {
+	query := `SELECT id, event_id, sequence, name, lat, lon, radius FROM checkpoints WHERE event_id = ? ORDER BY sequence;`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []*Checkpoint
+	for rows.Next() {
+		cp := &Checkpoint{}
+		if err := rows.Scan(&cp.ID, &cp.EventID, &cp.Sequence, &cp.Name, &cp.Lat, &cp.Lon, &cp.Radius); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// ReplaceCheckpoints replaces all of an event's checkpoints with the given list.
+// Sequence numbers are assigned from the order of the slice.
+func (s *Service) ReplaceCheckpoints(db DBorTx, eventID int64, checkpoints []*Checkpoint) error {
+	if _, err := db.Exec(`DELETE FROM checkpoints WHERE event_id = ?;`, eventID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO checkpoints (event_id, sequence, name, lat, lon, radius) VALUES (?, ?, ?, ?, ?, ?);`
+	for i, cp := range checkpoints {
+		res, err := db.Exec(query, eventID, i, cp.Name, cp.Lat, cp.Lon, cp.Radius)
+		if err != nil {
+			return err
+		}
+		cp.ID, _ = res.LastInsertId()
+		cp.EventID = eventID
+		cp.Sequence = i
+	}
+	return nil
+}
+
+// GetWindByEventID returns an event's wind samples in time order. A constant
+// wind is returned as a single sample without a timestamp.
+func (s *Service) GetWindByEventID(db DBorTx, eventID int64) ([]*WindSample, error) {
+	query := `SELECT id, event_id, timestamp, direction, speed FROM event_wind WHERE event_id = ? ORDER BY timestamp;`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*WindSample
+	for rows.Next() {
+		ws := &WindSample{}
+		if err := rows.Scan(&ws.ID, &ws.EventID, &ws.Timestamp, &ws.Direction, &ws.Speed); err != nil {
+			return nil, err
+		}
+		samples = append(samples, ws)
+	}
+	return samples, rows.Err()
+}
+
+// ReplaceWind replaces an event's wind data with the given samples. An empty
+// slice clears the wind.
+func (s *Service) ReplaceWind(db DBorTx, eventID int64, samples []*WindSample) error {
+	if _, err := db.Exec(`DELETE FROM event_wind WHERE event_id = ?;`, eventID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO event_wind (event_id, timestamp, direction, speed) VALUES (?, ?, ?, ?);`
+	for _, ws := range samples {
+		res, err := db.Exec(query, eventID, ws.Timestamp, ws.Direction, ws.Speed)
+		if err != nil {
+			return err
+		}
+		ws.ID, _ = res.LastInsertId()
+		ws.EventID = eventID
+	}
+	return nil
+}
+
+// --- Course Queries (on groupDB) ---
+
+// CreateCourse inserts a new course.
+func (s *Service) CreateCourse(db DBorTx, course *Course) (*Course, error) {
+	geometry, err := json.Marshal(course.Geometry)
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO courses (name, geometry, distance, creator_user_id) VALUES (?, ?, ?, ?);`
+	res, err := db.Exec(query, course.Name, string(geometry), course.Distance, course.CreatorUserID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetCourseByID(db, id)
+}
+
+// GetCourseByID returns a course including its geometry.
+func (s *Service) GetCourseByID(db DBorTx, id int64) (*Course, error) {
+	query := `SELECT id, name, geometry, distance, creator_user_id, created_at FROM courses WHERE id = ?;`
+	course := &Course{}
+	var geometry string
+	err := db.QueryRow(query, id).Scan(&course.ID, &course.Name, &geometry, &course.Distance, &course.CreatorUserID, &course.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(geometry), &course.Geometry); err != nil {
+		return nil, err
+	}
+	return course, nil
+}
+
+// GetCourses returns all courses of a group, without their geometry.
+func (s *Service) GetCourses(db DBorTx) ([]*Course, error) {
+	query := `SELECT id, name, distance, creator_user_id, created_at FROM courses ORDER BY name;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []*Course
+	for rows.Next() {
+		course := &Course{}
+		if err := rows.Scan(&course.ID, &course.Name, &course.Distance, &course.CreatorUserID, &course.CreatedAt); err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
+
+// DeleteCourse deletes a course and its best efforts, and detaches it from
+// any events run on it.
+func (s *Service) DeleteCourse(db DBorTx, id int64) error {
+	if _, err := db.Exec(`UPDATE events SET course_id = NULL WHERE course_id = ?;`, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM best_efforts WHERE kind = 'course' AND ref_id = ?;`, id); err != nil {
+		return err
+	}
+	res, err := db.Exec(`DELETE FROM courses WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("course not found")
+	}
+	return nil
+}
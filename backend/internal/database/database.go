@@ -82,6 +82,33 @@ func (s *Service) WriteToMainDB(writeFunc func(tx *sql.Tx) error) error {
 	return tx.Commit()
 }
 
+// WriteToGroupDB executes a multi-statement write operation on a group's database
+// within a transaction, protected by that database's mutex.
+func (s *Service) WriteToGroupDB(groupID int64, writeFunc func(tx *sql.Tx) error) error {
+	groupDB, err := s.GetGroupDB(groupID)
+	if err != nil {
+		return err
+	}
+
+	mutex := s.getMutex(fmt.Sprintf("group_%d.db", groupID))
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tx, err := groupDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := writeFunc(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("transaction error: %v, rollback error: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // GetMainDB provides a direct, read-only connection to the main database.
 func (s *Service) GetMainDB() *sql.DB {
 	return s.mainDB
@@ -195,6 +222,41 @@ func (s *Service) InitMainDB() error {
 			return err
 		}
 
+		// Device tokens for live tracking. Trackers only know their token, so this
+		// index in the main database maps it to the racer's group, event and record.
+		_, err = tx.Exec(`
+			CREATE TABLE IF NOT EXISTS device_tokens (
+				token TEXT PRIMARY KEY,
+				group_id INTEGER NOT NULL,
+				event_id INTEGER NOT NULL,
+				racer_id INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (group_id, racer_id),
+				FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE
+			);`)
+		if err != nil {
+			return err
+		}
+
+		// Guest upload links. Like device tokens, the token is all a guest has,
+		// so they are kept here with the racer's group, event and record.
+		_, err = tx.Exec(`
+			CREATE TABLE IF NOT EXISTS upload_links (
+				token TEXT PRIMARY KEY,
+				group_id INTEGER NOT NULL,
+				event_id INTEGER NOT NULL,
+				racer_id INTEGER NOT NULL,
+				created_by INTEGER NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+				FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE
+			);`)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
@@ -234,12 +296,568 @@ func (s *Service) InitGroupDB(groupID int64) error {
 			racer_name TEXT NOT NULL,
 			track_color TEXT NOT NULL,
 			track_avatar_url TEXT,
-			gpx_file_path TEXT, -- The filename of the GPX track
+			gpx_file_path TEXT, -- Superseded by track_files; moved there by InitGroupDB
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Teams table: teams of racers within an event. Racers are linked to their
+	// team by racers.team_id.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS teams (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			color TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Track files table: the ordered GPX files a racer's track is stitched from.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS track_files (
+			id INTEGER PRIMARY KEY,
+			racer_id INTEGER NOT NULL,
+			file_path TEXT NOT NULL, -- The filename of the GPX file
+			position INTEGER NOT NULL, -- Order within the racer's track
+			original_name TEXT NOT NULL DEFAULT '', -- Name of the file as uploaded
+			uploader_user_id INTEGER NOT NULL,
+			uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_track_files_racer ON track_files (racer_id, position);`)
+	if err != nil {
+		return err
+	}
+
+	// Courses table: reusable course lines that events in the group can be run on.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS courses (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			geometry TEXT NOT NULL, -- JSON array of [lat, lon] pairs along the course
+			distance REAL NOT NULL, -- Meters
+			creator_user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Stage races: multi-day races whose events are run as stages. Events are
+	// linked to their stage race by events.stage_race_id.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS stage_races (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			time_bonuses TEXT NOT NULL DEFAULT '[]', -- JSON array of seconds for the first finishers of a stage
+			creator_user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Stage race riders: links a racer in one of the stages to the rider of the
+	// stage race they are, for racers whose name doesn't match across stages.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS stage_race_riders (
+			racer_id INTEGER PRIMARY KEY,
+			stage_race_id INTEGER NOT NULL,
+			rider TEXT NOT NULL, -- The rider's name as used in the other stages
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (stage_race_id) REFERENCES stage_races (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Series: season-long championships scored with points over a number of
+	// the group's events.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS series (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			points_table TEXT NOT NULL DEFAULT '[]', -- JSON array of points for 1st, 2nd, ... place
+			drop_worst INTEGER NOT NULL DEFAULT 0, -- Number of worst rounds each rider doesn't count
+			tie_breakers TEXT NOT NULL DEFAULT '[]', -- JSON array of tie-breaker names, in order
+			match_by TEXT NOT NULL DEFAULT 'name', -- 'name' or 'user' (the user linked to the racer)
+			creator_user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Series events: the events (rounds) of each series. An event can count
+	// towards several series.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS series_events (
+			series_id INTEGER NOT NULL,
+			event_id INTEGER NOT NULL,
+			PRIMARY KEY (series_id, event_id),
+			FOREIGN KEY (series_id) REFERENCES series (id) ON DELETE CASCADE,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Series riders: links a racer in one of the rounds to a user or a rider
+	// name, for racers that the series' matching doesn't place correctly.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS series_riders (
+			series_id INTEGER NOT NULL,
+			racer_id INTEGER NOT NULL,
+			user_id INTEGER, -- Set to match the racer by user
+			rider TEXT NOT NULL DEFAULT '', -- Otherwise, the rider's name as used in the other rounds
+			PRIMARY KEY (series_id, racer_id),
+			FOREIGN KEY (series_id) REFERENCES series (id) ON DELETE CASCADE,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Series categories: the category each rider of a series is scored in.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS series_categories (
+			series_id INTEGER NOT NULL,
+			rider TEXT NOT NULL, -- Rider key, as reported in the series standings
+			category TEXT NOT NULL,
+			PRIMARY KEY (series_id, rider),
+			FOREIGN KEY (series_id) REFERENCES series (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Official results: a snapshot of each racer's computed result, with the
+	// officials' overrides. Penalties are kept in result_penalties.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS official_results (
+			racer_id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			computed_status TEXT NOT NULL, -- 'finished', 'dnf' or 'dns'
+			computed_time REAL NOT NULL DEFAULT 0, -- Seconds, finishers only
+			status_override TEXT NOT NULL DEFAULT '', -- 'finished', 'dnf', 'dns' or 'dsq'
+			time_override REAL, -- Seconds
+			computed_at DATETIME NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_official_results_event ON official_results (event_id);`)
+	if err != nil {
+		return err
+	}
+
+	// Result penalties: time penalties, or bonuses if negative, given to racers.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS result_penalties (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			racer_id INTEGER NOT NULL,
+			seconds REAL NOT NULL,
+			reason TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Result changes: the audit trail of every change made to official results.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS result_changes (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			racer_id INTEGER, -- NULL for changes to the whole event
+			user_id INTEGER NOT NULL,
+			field TEXT NOT NULL, -- 'computed', 'status', 'time', 'penalty' or a handicap detail or rule such as 'handicapFactor'
+			old_value TEXT NOT NULL DEFAULT '',
+			new_value TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_result_changes_event ON result_changes (event_id, created_at);`)
+	if err != nil {
+		return err
+	}
+
+	// Segments: stretches between two points, raced again and again across
+	// events, that best efforts are timed over.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS segments (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			start_lat REAL NOT NULL,
+			start_lon REAL NOT NULL,
+			end_lat REAL NOT NULL,
+			end_lon REAL NOT NULL,
+			radius REAL NOT NULL, -- Meters around the start and end
+			creator_user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Best efforts: each racer's fastest times over the standard distances, on
+	// the event's course and over each segment. Personal and course records
+	// are worked out from them.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS best_efforts (
+			id INTEGER PRIMARY KEY,
+			racer_id INTEGER NOT NULL,
+			event_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL, -- The user linked to the racer, or 0 if there is none
+			kind TEXT NOT NULL, -- 'distance', 'course' or 'segment'
+			ref_id INTEGER NOT NULL, -- Meters, or the course or segment ID
+			seconds REAL NOT NULL,
+			started_at DATETIME NOT NULL,
+			UNIQUE (racer_id, kind, ref_id),
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_best_efforts_ref ON best_efforts (kind, ref_id, seconds);`)
+	if err != nil {
+		return err
+	}
+
+	// Racer claims table: requests by group members to link a racer entry to
+	// their account, decided by the user who added the racer or the event owner.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS racer_claims (
+			id INTEGER PRIMARY KEY,
+			racer_id INTEGER NOT NULL,
+			event_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL, -- The claiming user
+			status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'approved' or 'rejected'
+			message TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			decided_by INTEGER,
+			decided_at DATETIME,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_racer_claims_racer ON racer_claims (racer_id, status);`)
+	if err != nil {
+		return err
+	}
+
+	// Registrations table: members entering an event themselves. Confirmed
+	// registrations have a racer linked to the registrant; the others wait for
+	// the owner's approval or a place, in order of registration.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS registrations (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			racer_id INTEGER, -- Set while the registration is confirmed
+			racer_name TEXT NOT NULL,
+			status TEXT NOT NULL, -- 'pending', 'confirmed', 'waitlisted', 'rejected' or 'withdrawn'
+			answers TEXT NOT NULL DEFAULT '{}', -- Answers to the event's registration questions, as JSON
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (event_id, user_id),
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE SET NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_registrations_racer ON registrations (racer_id);`)
+	if err != nil {
+		return err
+	}
+
+	// Ghosts table: past efforts a user races against in a time trial. Each
+	// is a racer from another event on the same course, replayed alongside
+	// one of the event's racers without being ranked.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS ghosts (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			racer_id INTEGER NOT NULL, -- The racer the ghost is aligned with
+			user_id INTEGER NOT NULL, -- The user who picked the ghost and sees it
+			source_racer_id INTEGER NOT NULL, -- The racer replayed as the ghost
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (racer_id, user_id, source_racer_id),
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE,
+			FOREIGN KEY (source_racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_ghosts_event_user ON ghosts (event_id, user_id);`)
+	if err != nil {
+		return err
+	}
+
+	// Checkpoints table: an ordered list of locations on an event's course.
+	// Depending on the sport these are marks, turnpoints or timing points.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS checkpoints (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			sequence INTEGER NOT NULL, -- 0-based order along the course
+			name TEXT NOT NULL,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			radius REAL NOT NULL, -- Meters; a racer within this distance has reached the checkpoint
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Event wind table. A single row without a timestamp is a constant wind;
+	// otherwise the rows form a time series.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS event_wind (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			timestamp DATETIME,
+			direction REAL NOT NULL, -- Degrees true the wind is blowing from
+			speed REAL, -- Knots, optional
 			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
 		);`)
 	if err != nil {
 		return err
 	}
 
+	// Live positions reported by racers' tracking devices during an event.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS live_positions (
+			id INTEGER PRIMARY KEY,
+			racer_id INTEGER NOT NULL,
+			timestamp DATETIME NOT NULL,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			altitude REAL, -- Meters
+			speed REAL, -- Meters per second
+			bearing REAL, -- Degrees true
+			accuracy REAL, -- Meters
+			battery REAL, -- Percent
+			received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_live_positions_racer_time ON live_positions (racer_id, timestamp);`)
+	if err != nil {
+		return err
+	}
+
+	// Safety incidents raised for racers during live tracking.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS safety_incidents (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			racer_id INTEGER NOT NULL,
+			type TEXT NOT NULL, -- 'stationary', 'off_course' or 'no_signal'
+			status TEXT NOT NULL DEFAULT 'open', -- 'open', 'acknowledged' or 'resolved'
+			since DATETIME NOT NULL,
+			detected_at DATETIME NOT NULL,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			distance REAL, -- Meters off course
+			acknowledged_by INTEGER,
+			acknowledged_at DATETIME,
+			resolved_by INTEGER,
+			resolved_at DATETIME,
+			note TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_safety_incidents_racer ON safety_incidents (racer_id, type);`)
+	if err != nil {
+		return err
+	}
+
+	// Spatial index over event bounding boxes, used by the "events near me" search.
+	// The R-tree's id column is the event ID; the box is stored as lon/lat ranges.
+	_, err = groupDB.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS event_spatial_index USING rtree(
+			id,
+			min_lon, max_lon,
+			min_lat, max_lat
+		);`)
+	if err != nil {
+		return err
+	}
+
+	// Each racer's contribution to their event's bounding box and start location,
+	// so that a change to one racer's track does not mean reading every track.
+	// A racer without a usable track has a row with NULL bounds.
+	_, err = groupDB.Exec(`
+		CREATE TABLE IF NOT EXISTS racer_spatial (
+			racer_id INTEGER PRIMARY KEY,
+			event_id INTEGER NOT NULL,
+			min_lat REAL,
+			min_lon REAL,
+			max_lat REAL,
+			max_lon REAL,
+			start_lat REAL, -- First point of the racer's track
+			start_lon REAL,
+			start_time DATETIME,
+			FOREIGN KEY (racer_id) REFERENCES racers (id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_racer_spatial_event ON racer_spatial (event_id);`)
+	if err != nil {
+		return err
+	}
+
+	// Bring databases created by older versions up to date with the current schema.
+	for _, m := range groupColumnMigrations {
+		if err := addColumnIfMissing(groupDB, m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("could not migrate %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	if _, err := groupDB.Exec(`CREATE INDEX IF NOT EXISTS idx_racers_user ON racers (user_id);`); err != nil {
+		return fmt.Errorf("could not index racer users: %w", err)
+	}
+	// Best efforts of racers without a linked user used to be credited to the
+	// user who added them.
+	_, err = groupDB.Exec(`UPDATE best_efforts SET user_id = 0 WHERE user_id != 0 AND racer_id IN (SELECT id FROM racers WHERE user_id IS NULL);`)
+	if err != nil {
+		return fmt.Errorf("could not migrate best efforts: %w", err)
+	}
+
+	// Racers used to have a single GPX file, stored on the racer itself. Both
+	// statements run in one transaction so that a crash can't copy a file twice.
+	if err := migrateRacerGpxFiles(groupDB); err != nil {
+		return fmt.Errorf("could not migrate racer GPX files: %w", err)
+	}
+
+	return nil
+}
+
+// migrateRacerGpxFiles moves the GPX file stored on each racer into track_files.
+func migrateRacerGpxFiles(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO track_files (racer_id, file_path, position, uploader_user_id)
+			SELECT id, gpx_file_path, 0, uploader_user_id FROM racers
+			WHERE gpx_file_path IS NOT NULL AND gpx_file_path != '';`)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE racers SET gpx_file_path = NULL WHERE gpx_file_path IS NOT NULL;`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// columnMigration describes a column added to a table after its initial release.
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// groupColumnMigrations lists columns added to group database tables since the
+// original schema. New columns are appended here so that existing group databases
+// are upgraded in place by InitGroupDB.
+var groupColumnMigrations = []columnMigration{
+	{"events", "min_lat", "REAL"},
+	{"events", "min_lon", "REAL"},
+	{"events", "max_lat", "REAL"},
+	{"events", "max_lon", "REAL"},
+	{"events", "start_lat", "REAL"},
+	{"events", "start_lon", "REAL"},
+	{"events", "map_matching", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "elevation_mode", "TEXT NOT NULL DEFAULT 'gps'"},
+	{"events", "sport", "TEXT NOT NULL DEFAULT 'generic'"},
+	{"events", "live_finalized_at", "DATETIME"},
+	{"events", "course_id", "INTEGER REFERENCES courses (id) ON DELETE SET NULL"},
+	{"events", "stationary_alert_minutes", "INTEGER NOT NULL DEFAULT 20"},
+	{"events", "off_course_alert_meters", "REAL NOT NULL DEFAULT 500"},
+	{"events", "silence_alert_minutes", "INTEGER NOT NULL DEFAULT 30"},
+	{"events", "stage_race_id", "INTEGER REFERENCES stage_races (id) ON DELETE SET NULL"},
+	{"events", "stage_number", "INTEGER"},
+	{"events", "team_scoring", "TEXT NOT NULL DEFAULT 'sum'"},
+	{"events", "team_counted", "INTEGER NOT NULL DEFAULT 3"},
+	{"events", "exchange_lat", "REAL"},
+	{"events", "exchange_lon", "REAL"},
+	{"events", "exchange_radius", "REAL NOT NULL DEFAULT 50"},
+	{"events", "handicap_system", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "age_grades", "TEXT NOT NULL DEFAULT '[]'"},
+	{"events", "class_coefficients", "TEXT NOT NULL DEFAULT '{}'"},
+	{"events", "registration_enabled", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "registration_opens_at", "DATETIME"},
+	{"events", "registration_closes_at", "DATETIME"},
+	{"events", "registration_capacity", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "registration_approval", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "registration_questions", "TEXT NOT NULL DEFAULT '[]'"},
+	{"events", "off_course_alert_minutes", "INTEGER NOT NULL DEFAULT 2"},
+	{"racers", "live_status", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "live_checkpoints", "INTEGER NOT NULL DEFAULT 0"},
+	{"racers", "live_status_at", "DATETIME"},
+	{"racers", "team_id", "INTEGER REFERENCES teams (id) ON DELETE SET NULL"},
+	{"racers", "leg", "INTEGER"},
+	{"racers", "bib", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "category", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "club", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "nationality", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "handicap_factor", "REAL"},
+	{"racers", "age", "INTEGER"},
+	{"racers", "class", "TEXT NOT NULL DEFAULT ''"},
+	{"racers", "start_offset", "REAL NOT NULL DEFAULT 0"},
+	{"racers", "user_id", "INTEGER"},
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists.
+// SQLite has no "ADD COLUMN IF NOT EXISTS", so we inspect the table first.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	return err
+}
+
+// MigrateGroupDBs runs InitGroupDB for every existing group so that databases
+// created by older versions of the application pick up new tables and columns.
+func (s *Service) MigrateGroupDBs() error {
+	groupIDs, err := s.GetAllGroupIDs(s.mainDB)
+	if err != nil {
+		return fmt.Errorf("could not list groups: %w", err)
+	}
+	for _, groupID := range groupIDs {
+		if err := s.InitGroupDB(groupID); err != nil {
+			return fmt.Errorf("could not migrate database for group %d: %w", groupID, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+)
+
+// --- Ghost Queries (on groupDB) ---
+
+const ghostColumns = `id, event_id, racer_id, user_id, source_racer_id, created_at`
+
+func scanGhost(row rowScanner, g *Ghost) error {
+	return row.Scan(&g.ID, &g.EventID, &g.RacerID, &g.UserID, &g.SourceRacerID, &g.CreatedAt)
+}
+
+// AddGhost inserts a new ghost.
+func (s *Service) AddGhost(db DBorTx, g *Ghost) (*Ghost, error) {
+	query := `INSERT INTO ghosts (event_id, racer_id, user_id, source_racer_id) VALUES (?, ?, ?, ?);`
+	res, err := db.Exec(query, g.EventID, g.RacerID, g.UserID, g.SourceRacerID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetGhostByID(db, id)
+}
+
+// GetGhostByID returns a single ghost.
+func (s *Service) GetGhostByID(db DBorTx, id int64) (*Ghost, error) {
+	g := &Ghost{}
+	if err := scanGhost(db.QueryRow(`SELECT `+ghostColumns+` FROM ghosts WHERE id = ?;`, id), g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// GetGhosts returns the ghosts a user picked in an event, oldest first. With a
+// racerID other than zero, only the ghosts aligned with that racer are returned.
+func (s *Service) GetGhosts(db DBorTx, eventID, userID, racerID int64) ([]*Ghost, error) {
+	query := `SELECT ` + ghostColumns + ` FROM ghosts
+		WHERE event_id = ? AND user_id = ? AND (? = 0 OR racer_id = ?) ORDER BY id;`
+	rows, err := db.Query(query, eventID, userID, racerID, racerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ghosts []*Ghost
+	for rows.Next() {
+		g := &Ghost{}
+		if err := scanGhost(rows, g); err != nil {
+			return nil, err
+		}
+		ghosts = append(ghosts, g)
+	}
+	return ghosts, rows.Err()
+}
+
+// DeleteGhost deletes a ghost.
+func (s *Service) DeleteGhost(db DBorTx, id int64) error {
+	res, err := db.Exec(`DELETE FROM ghosts WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("ghost not found")
+	}
+	return nil
+}
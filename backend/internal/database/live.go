@@ -0,0 +1,180 @@
+package database
+
+import (
+	"time"
+)
+
+// --- Device Token Queries (on mainDB) ---
+
+// ReplaceDeviceToken stores a racer's device token, replacing any previous token
+// for the same racer so that old devices stop being accepted.
+func (s *Service) ReplaceDeviceToken(db DBorTx, token *DeviceToken) error {
+	if err := s.DeleteDeviceTokenForRacer(db, token.GroupID, token.RacerID); err != nil {
+		return err
+	}
+	query := `INSERT INTO device_tokens (token, group_id, event_id, racer_id) VALUES (?, ?, ?, ?);`
+	_, err := db.Exec(query, token.Token, token.GroupID, token.EventID, token.RacerID)
+	return err
+}
+
+// GetDeviceToken looks up a device token. It returns sql.ErrNoRows if the token is unknown.
+func (s *Service) GetDeviceToken(db DBorTx, token string) (*DeviceToken, error) {
+	query := `SELECT token, group_id, event_id, racer_id, created_at FROM device_tokens WHERE token = ?;`
+	dt := &DeviceToken{}
+	err := db.QueryRow(query, token).Scan(&dt.Token, &dt.GroupID, &dt.EventID, &dt.RacerID, &dt.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// GetDeviceTokenForRacer returns the current device token of a racer, or
+// sql.ErrNoRows if none has been issued.
+func (s *Service) GetDeviceTokenForRacer(db DBorTx, groupID, racerID int64) (*DeviceToken, error) {
+	query := `SELECT token, group_id, event_id, racer_id, created_at FROM device_tokens WHERE group_id = ? AND racer_id = ?;`
+	dt := &DeviceToken{}
+	err := db.QueryRow(query, groupID, racerID).Scan(&dt.Token, &dt.GroupID, &dt.EventID, &dt.RacerID, &dt.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// DeleteDeviceTokenForRacer revokes a racer's device token, if any.
+func (s *Service) DeleteDeviceTokenForRacer(db DBorTx, groupID, racerID int64) error {
+	_, err := db.Exec(`DELETE FROM device_tokens WHERE group_id = ? AND racer_id = ?;`, groupID, racerID)
+	return err
+}
+
+// DeleteDeviceTokensForEvent revokes the device tokens of all racers in an event.
+func (s *Service) DeleteDeviceTokensForEvent(db DBorTx, groupID, eventID int64) error {
+	_, err := db.Exec(`DELETE FROM device_tokens WHERE group_id = ? AND event_id = ?;`, groupID, eventID)
+	return err
+}
+
+// --- Live Position Queries (on groupDB) ---
+
+// AddLivePosition appends a position to a racer's live track.
+func (s *Service) AddLivePosition(db DBorTx, p *LivePosition) error {
+	query := `INSERT INTO live_positions (racer_id, timestamp, lat, lon, altitude, speed, bearing, accuracy, battery) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, p.RacerID, p.Timestamp.UTC(), p.Lat, p.Lon, p.Altitude, p.Speed, p.Bearing, p.Accuracy, p.Battery)
+	if err != nil {
+		return err
+	}
+	p.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// GetLivePositions returns a racer's live track in time order.
+func (s *Service) GetLivePositions(db DBorTx, racerID int64) ([]*LivePosition, error) {
+	query := `
+		SELECT id, racer_id, timestamp, lat, lon, altitude, speed, bearing, accuracy, battery
+		FROM live_positions WHERE racer_id = ? ORDER BY timestamp, id;`
+	rows, err := db.Query(query, racerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []*LivePosition
+	for rows.Next() {
+		p := &LivePosition{}
+		if err := rows.Scan(&p.ID, &p.RacerID, &p.Timestamp, &p.Lat, &p.Lon,
+			&p.Altitude, &p.Speed, &p.Bearing, &p.Accuracy, &p.Battery); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// GetLivePositionsSince returns the part of a racer's live track from since
+// on, in time order.
+func (s *Service) GetLivePositionsSince(db DBorTx, racerID int64, since time.Time) ([]*LivePosition, error) {
+	query := `
+		SELECT id, racer_id, timestamp, lat, lon, altitude, speed, bearing, accuracy, battery
+		FROM live_positions WHERE racer_id = ? AND timestamp >= ? ORDER BY timestamp, id;`
+	rows, err := db.Query(query, racerID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []*LivePosition
+	for rows.Next() {
+		p := &LivePosition{}
+		if err := rows.Scan(&p.ID, &p.RacerID, &p.Timestamp, &p.Lat, &p.Lon,
+			&p.Altitude, &p.Speed, &p.Bearing, &p.Accuracy, &p.Battery); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// GetLatestLivePositions returns the most recently received position of each
+// racer in an event.
+func (s *Service) GetLatestLivePositions(db DBorTx, eventID int64) ([]*LivePosition, error) {
+	query := `
+		SELECT id, racer_id, timestamp, lat, lon, altitude, speed, bearing, accuracy, battery
+		FROM live_positions
+		WHERE id IN (
+			SELECT MAX(lp.id) FROM live_positions lp JOIN racers r ON r.id = lp.racer_id
+			WHERE r.event_id = ? GROUP BY lp.racer_id
+		);`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []*LivePosition
+	for rows.Next() {
+		p := &LivePosition{}
+		if err := rows.Scan(&p.ID, &p.RacerID, &p.Timestamp, &p.Lat, &p.Lon,
+			&p.Altitude, &p.Speed, &p.Bearing, &p.Accuracy, &p.Battery); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// UpdateRacerLiveState stores a racer's live race status and checkpoint progress.
+func (s *Service) UpdateRacerLiveState(db DBorTx, racer *Racer) error {
+	query := `UPDATE racers SET live_status = ?, live_checkpoints = ?, live_status_at = ? WHERE id = ?;`
+	_, err := db.Exec(query, racer.LiveStatus, racer.LiveCheckpoints, racer.LiveStatusAt, racer.ID)
+	return err
+}
+
+// GetUnfinalizedLiveEvents returns the events that have live positions which
+// have not yet been written to GPX files.
+func (s *Service) GetUnfinalizedLiveEvents(db DBorTx) ([]*Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE live_finalized_at IS NULL AND EXISTS (
+			SELECT 1 FROM live_positions lp JOIN racers r ON r.id = lp.racer_id WHERE r.event_id = events.id
+		);`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		if err := scanEvent(rows, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// SetEventLiveFinalized records that an event's live tracks have been written to files.
+func (s *Service) SetEventLiveFinalized(db DBorTx, eventID int64, at time.Time) error {
+	_, err := db.Exec(`UPDATE events SET live_finalized_at = ? WHERE id = ?;`, at.UTC(), eventID)
+	return err
+}
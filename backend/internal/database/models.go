@@ -27,26 +27,371 @@ type Group struct {
 
 // Event represents a record in an 'events' table within a specific group's database.
 type Event struct {
-	ID            int64        `json:"id"`
-	GroupID       int64        `json:"groupId"` // Foreign key to the group this event belongs to
-	Name          string       `json:"name"`
-	StartDate     sql.NullTime `json:"startDate"`
-	EndDate       sql.NullTime `json:"endDate"`
-	EventType     string       `json:"eventType"` // Can be 'race' or 'time_trial'
-	CreatorUserID int64        `json:"creatorUserId"`
-	HasGpxData    bool         `json:"-"` // Not a DB field, populated by query
+	ID            int64         `json:"id"`
+	GroupID       int64         `json:"groupId"` // Foreign key to the group this event belongs to
+	Name          string        `json:"name"`
+	StartDate     sql.NullTime  `json:"startDate"`
+	EndDate       sql.NullTime  `json:"endDate"`
+	EventType     string        `json:"eventType"` // Can be 'race' or 'time_trial'
+	Sport         string        `json:"sport"`     // e.g. 'running', 'cycling'; see the sport package
+	CreatorUserID int64         `json:"creatorUserId"`
+	MapMatching   bool          `json:"mapMatching"`   // Snap tracks to the road/trail network when processing
+	ElevationMode string        `json:"elevationMode"` // 'gps', 'dem' or 'blend'
+	CourseID      sql.NullInt64 `json:"courseId"`      // The course the event is run on, if any
+	StageRaceID   sql.NullInt64 `json:"stageRaceId"`   // The stage race the event is a stage of, if any
+	StageNumber   sql.NullInt64 `json:"stageNumber"`   // 1-based position within the stage race
+
+	// Team scoring: 'sum' or 'first' of the TeamCounted best finishers, or
+	// 'relay', with legs handed over at the exchange zone if it is set.
+	TeamScoring    string          `json:"teamScoring"`
+	TeamCounted    int             `json:"teamCounted"`
+	ExchangeLat    sql.NullFloat64 `json:"exchangeLat"`
+	ExchangeLon    sql.NullFloat64 `json:"exchangeLon"`
+	ExchangeRadius float64         `json:"exchangeRadius"` // Meters
+
+	// Handicapping: '' for none, 'factor', 'age', 'class' or 'pursuit'. Events
+	// without their own age-grading table use the default one.
+	HandicapSystem    string             `json:"handicapSystem"`
+	AgeGrades         []AgeGrade         `json:"ageGrades"`         // Stored as JSON
+	ClassCoefficients map[string]float64 `json:"classCoefficients"` // Stored as JSON
+
+	// Self-service registration by group members. Registration closes when the
+	// event starts unless it closes earlier. A zero capacity is unlimited.
+	RegistrationEnabled   bool                   `json:"registrationEnabled"`
+	RegistrationOpensAt   sql.NullTime           `json:"registrationOpensAt"`
+	RegistrationClosesAt  sql.NullTime           `json:"registrationClosesAt"`
+	RegistrationCapacity  int                    `json:"registrationCapacity"`
+	RegistrationApproval  bool                   `json:"registrationApproval"`  // Registrations wait for the owner's approval
+	RegistrationQuestions []RegistrationQuestion `json:"registrationQuestions"` // Stored as JSON
+
+	// Bounding box and start location of the event's tracks. These are NULL
+	// until at least one track has been processed for the event.
+	MinLat   sql.NullFloat64 `json:"-"`
+	MinLon   sql.NullFloat64 `json:"-"`
+	MaxLat   sql.NullFloat64 `json:"-"`
+	MaxLon   sql.NullFloat64 `json:"-"`
+	StartLat sql.NullFloat64 `json:"-"`
+	StartLon sql.NullFloat64 `json:"-"`
+
+	// Set once the live tracks of an event have been written to GPX files after it ended.
+	LiveFinalizedAt sql.NullTime `json:"-"`
+
+	// Safety alert thresholds for live tracking. Zero disables an alert.
+	StationaryAlertMinutes int     `json:"stationaryAlertMinutes"` // Racer hasn't moved for this long
+	OffCourseAlertMeters   float64 `json:"offCourseAlertMeters"`   // Racer is this far from the course line
+	OffCourseAlertMinutes  int     `json:"offCourseAlertMinutes"`  // ...for this long; zero alerts at once
+	SilenceAlertMinutes    int     `json:"silenceAlertMinutes"`    // Racer's device hasn't reported for this long
+
+	HasGpxData bool `json:"-"` // Not a DB field, populated by query
+}
+
+// AgeGrade is one row of an event's age-grading table.
+type AgeGrade struct {
+	MinAge int     `json:"minAge"`
+	MaxAge int     `json:"maxAge"`
+	Factor float64 `json:"factor"`
+}
+
+// RegistrationQuestion is a question registrants answer when entering an event.
+type RegistrationQuestion struct {
+	ID       string   `json:"id"`
+	Label    string   `json:"label"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"` // The allowed answers, if the question is multiple choice
 }
 
 // Racer represents a record in a 'racers' table within a group's database.
-// It links a user's uploaded GPX file to a specific event.
+// It links a user's uploaded GPX files to a specific event.
 type Racer struct {
 	ID             int64          `json:"id"`
 	EventID        int64          `json:"eventId"`
-	UploaderUserID int64          `json:"uploaderUserId"`
+	UploaderUserID int64          `json:"uploaderUserId"` // Who added the racer, not necessarily who raced
+	UserID         sql.NullInt64  `json:"userId"`         // The user who raced, once linked to their account
 	RacerName      string         `json:"racerName"`
 	TrackColor     string         `json:"trackColor"`
 	TrackAvatarURL sql.NullString `json:"trackAvatarUrl"`
-	GpxFilePath    sql.NullString `json:"gpxFilePath"`
+	GpxFilePath    sql.NullString `json:"gpxFilePath"`    // The racer's first track file, if any
+	TrackFileCount int            `json:"trackFileCount"` // Number of track files
+
+	// Entry details, as on a start list. All are optional and empty if unset.
+	Bib         string `json:"bib"`      // Unique within the event
+	Category    string `json:"category"` // e.g. an age group, gender or class; results are also ranked per category
+	Club        string `json:"club"`
+	Nationality string `json:"nationality"` // Country code, e.g. 'AUS'
+
+	// Handicap details, used by the event's handicap system.
+	HandicapFactor sql.NullFloat64 `json:"handicapFactor"` // Multiplies the racer's time
+	Age            sql.NullInt64   `json:"age"`
+	Class          string          `json:"class"`       // e.g. a bike or boat class
+	StartOffset    float64         `json:"startOffset"` // Seconds after the event start, for pursuits
+
+	// Live race state, maintained from the positions reported during a live event.
+	LiveStatus      string       `json:"liveStatus"`      // '', 'started', 'finished' or 'dnf'
+	LiveCheckpoints int          `json:"liveCheckpoints"` // Number of checkpoints reached, in course order
+	LiveStatusAt    sql.NullTime `json:"liveStatusAt"`    // When LiveStatus last changed
+
+	TeamID sql.NullInt64 `json:"teamId"` // The racer's team in the event, if any
+	Leg    sql.NullInt64 `json:"leg"`    // 1-based relay leg the racer races for their team
+}
+
+// Team represents a record in a 'teams' table within a group's database. Its
+// members are the racers linked to it.
+type Team struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"eventId"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TrackFile represents a record in a 'track_files' table within a group's
+// database: one of the GPX files a racer's track is stitched together from.
+type TrackFile struct {
+	ID             int64     `json:"id"`
+	RacerID        int64     `json:"racerId"`
+	FilePath       string    `json:"filePath"`
+	Position       int       `json:"position"`     // Order within the racer's track
+	OriginalName   string    `json:"originalName"` // Name of the file as uploaded
+	UploaderUserID int64     `json:"uploaderUserId"`
+	UploadedAt     time.Time `json:"uploadedAt"`
+}
+
+// Course represents a record in a 'courses' table within a group's database.
+// A course is a line that one or more of the group's events are run on.
+type Course struct {
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	Geometry      [][2]float64 `json:"geometry"` // [lat, lon] pairs, stored as JSON
+	Distance      float64      `json:"distance"` // Meters
+	CreatorUserID int64        `json:"creatorUserId"`
+	CreatedAt     time.Time    `json:"createdAt"`
+}
+
+// StageRace represents a record in a 'stage_races' table within a group's
+// database. Its stages are the events linked to it, in stage number order.
+type StageRace struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	TimeBonuses   []int     `json:"timeBonuses"` // Seconds for the first finishers of each stage, stored as JSON
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Series represents a record in a 'series' table within a group's database: a
+// championship scored with points over the events linked to it.
+type Series struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	PointsTable   []int     `json:"pointsTable"` // Points for 1st, 2nd, ... place, stored as JSON
+	DropWorst     int       `json:"dropWorst"`
+	TieBreakers   []string  `json:"tieBreakers"` // Stored as JSON
+	MatchBy       string    `json:"matchBy"`     // 'name' or 'user'
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// SeriesRider represents a record in a 'series_riders' table within a group's
+// database. Exactly one of UserID and Rider is set.
+type SeriesRider struct {
+	RacerID int64         `json:"racerId"`
+	UserID  sql.NullInt64 `json:"userId"`
+	Rider   string        `json:"rider"`
+}
+
+// OfficialResult represents a record in an 'official_results' table within a
+// group's database: a racer's computed result as of ComputedAt, with the
+// officials' overrides.
+type OfficialResult struct {
+	RacerID        int64           `json:"racerId"`
+	EventID        int64           `json:"eventId"`
+	ComputedStatus string          `json:"computedStatus"`
+	ComputedTime   float64         `json:"computedTime"`   // Seconds
+	StatusOverride string          `json:"statusOverride"` // Empty if not overridden
+	TimeOverride   sql.NullFloat64 `json:"timeOverride"`   // Seconds
+	ComputedAt     time.Time       `json:"computedAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+
+	Penalties float64 `json:"penalties"` // Not a DB field: total of the racer's penalties, in seconds
+}
+
+// ResultPenalty represents a record in a 'result_penalties' table within a
+// group's database. Negative penalties are time bonuses.
+type ResultPenalty struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"eventId"`
+	RacerID   int64     `json:"racerId"`
+	Seconds   float64   `json:"seconds"`
+	Reason    string    `json:"reason"`
+	UserID    int64     `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ResultChange represents a record in a 'result_changes' table within a
+// group's database: one entry in the audit trail of an event's results.
+type ResultChange struct {
+	ID        int64         `json:"id"`
+	EventID   int64         `json:"eventId"`
+	RacerID   sql.NullInt64 `json:"racerId"`
+	UserID    int64         `json:"userId"`
+	Field     string        `json:"field"`
+	OldValue  string        `json:"oldValue"`
+	NewValue  string        `json:"newValue"`
+	Reason    string        `json:"reason"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// RacerClaim represents a record in a 'racer_claims' table within a group's
+// database: a member's request to link a racer entry to their account.
+type RacerClaim struct {
+	ID        int64         `json:"id"`
+	RacerID   int64         `json:"racerId"`
+	EventID   int64         `json:"eventId"`
+	UserID    int64         `json:"userId"`
+	Status    string        `json:"status"` // 'pending', 'approved' or 'rejected'
+	Message   string        `json:"message"`
+	CreatedAt time.Time     `json:"createdAt"`
+	DecidedBy sql.NullInt64 `json:"decidedBy"`
+	DecidedAt sql.NullTime  `json:"decidedAt"`
+}
+
+// Registration represents a record in a 'registrations' table within a group's
+// database: a member's entry into an event.
+type Registration struct {
+	ID        int64             `json:"id"`
+	EventID   int64             `json:"eventId"`
+	UserID    int64             `json:"userId"`
+	RacerID   sql.NullInt64     `json:"racerId"` // Set while the registration is confirmed
+	RacerName string            `json:"racerName"`
+	Status    string            `json:"status"`  // 'pending', 'confirmed', 'waitlisted', 'rejected' or 'withdrawn'
+	Answers   map[string]string `json:"answers"` // By question ID; stored as JSON
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// Ghost represents a record in a 'ghosts' table within a group's database: a
+// past effort a user races against in a time trial.
+type Ghost struct {
+	ID            int64     `json:"id"`
+	EventID       int64     `json:"eventId"`
+	RacerID       int64     `json:"racerId"`
+	UserID        int64     `json:"userId"`
+	SourceRacerID int64     `json:"sourceRacerId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Segment represents a record in a 'segments' table within a group's
+// database: a stretch between two points that best efforts are timed over.
+type Segment struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	StartLat      float64   `json:"startLat"`
+	StartLon      float64   `json:"startLon"`
+	EndLat        float64   `json:"endLat"`
+	EndLon        float64   `json:"endLon"`
+	Radius        float64   `json:"radius"` // Meters
+	CreatorUserID int64     `json:"creatorUserId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// BestEffort represents a record in a 'best_efforts' table within a group's
+// database: a racer's fastest time over a standard distance, course or segment.
+type BestEffort struct {
+	ID        int64     `json:"id"`
+	RacerID   int64     `json:"racerId"`
+	EventID   int64     `json:"eventId"`
+	UserID    int64     `json:"userId"`
+	Kind      string    `json:"kind"`  // 'distance', 'course' or 'segment'
+	RefID     int64     `json:"refId"` // Meters, or the course or segment ID
+	Seconds   float64   `json:"seconds"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Not DB fields: the fastest earlier efforts over the same distance, course
+	// or segment in other events, by the same user and by anyone, and the
+	// fastest in the same event. Only set by GetBestEffortsByEventID.
+	UserBefore   sql.NullFloat64 `json:"-"`
+	RecordBefore sql.NullFloat64 `json:"-"`
+	EventBest    float64         `json:"-"`
+}
+
+// Checkpoint represents a record in a 'checkpoints' table within a group's database.
+// Checkpoints are ordered by Sequence along the event's course.
+type Checkpoint struct {
+	ID       int64   `json:"id"`
+	EventID  int64   `json:"eventId"`
+	Sequence int     `json:"sequence"`
+	Name     string  `json:"name"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Radius   float64 `json:"radius"` // Meters
+}
+
+// WindSample represents a record in an 'event_wind' table within a group's database.
+// A sample without a Timestamp describes a constant wind for the whole event.
+type WindSample struct {
+	ID        int64           `json:"id"`
+	EventID   int64           `json:"eventId"`
+	Timestamp sql.NullTime    `json:"timestamp"`
+	Direction float64         `json:"direction"` // Degrees true the wind is blowing from
+	Speed     sql.NullFloat64 `json:"speed"`     // Knots
+}
+
+// DeviceToken represents a record in the 'device_tokens' table in the main database.
+// It identifies the racer a live tracking device reports positions for.
+type DeviceToken struct {
+	Token     string    `json:"token"`
+	GroupID   int64     `json:"groupId"`
+	EventID   int64     `json:"eventId"`
+	RacerID   int64     `json:"racerId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UploadLink represents a record in the 'upload_links' table in the main
+// database. It lets a guest without an account upload one track file for a racer.
+type UploadLink struct {
+	Token     string       `json:"token"`
+	GroupID   int64        `json:"groupId"`
+	EventID   int64        `json:"eventId"`
+	RacerID   int64        `json:"racerId"`
+	CreatedBy int64        `json:"createdBy"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	UsedAt    sql.NullTime `json:"usedAt"` // When the link was used; links work once
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// LivePosition represents a record in a 'live_positions' table within a group's database.
+type LivePosition struct {
+	ID        int64           `json:"id"`
+	RacerID   int64           `json:"racerId"`
+	Timestamp time.Time       `json:"timestamp"`
+	Lat       float64         `json:"lat"`
+	Lon       float64         `json:"lon"`
+	Altitude  sql.NullFloat64 `json:"altitude"`
+	Speed     sql.NullFloat64 `json:"speed"`
+	Bearing   sql.NullFloat64 `json:"bearing"`
+	Accuracy  sql.NullFloat64 `json:"accuracy"`
+	Battery   sql.NullFloat64 `json:"battery"`
+}
+
+// SafetyIncident represents a record in a 'safety_incidents' table within a
+// group's database. An incident is raised when a racer in a live event stops
+// moving, leaves the course or stops reporting, and is then acknowledged and
+// resolved by the event owner.
+type SafetyIncident struct {
+	ID             int64           `json:"id"`
+	EventID        int64           `json:"eventId"`
+	RacerID        int64           `json:"racerId"`
+	Type           string          `json:"type"`   // 'stationary', 'off_course' or 'no_signal'
+	Status         string          `json:"status"` // 'open', 'acknowledged' or 'resolved'
+	Since          time.Time       `json:"since"`  // When the condition started
+	DetectedAt     time.Time       `json:"detectedAt"`
+	Lat            float64         `json:"lat"` // Racer's last known position
+	Lon            float64         `json:"lon"`
+	Distance       sql.NullFloat64 `json:"distance"` // Meters off course, for 'off_course' incidents
+	AcknowledgedBy sql.NullInt64   `json:"acknowledgedBy"`
+	AcknowledgedAt sql.NullTime    `json:"acknowledgedAt"`
+	ResolvedBy     sql.NullInt64   `json:"resolvedBy"`
+	ResolvedAt     sql.NullTime    `json:"resolvedAt"`
+	Note           string          `json:"note"`
 }
 
 // Invitation represents a record in the 'invitations' table.
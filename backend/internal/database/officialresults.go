@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// --- Official Result Queries (on groupDB) ---
+
+const officialResultColumns = `racer_id, event_id, computed_status, computed_time, status_override, time_override,
+	computed_at, updated_at,
+	(SELECT COALESCE(SUM(seconds), 0) FROM result_penalties p WHERE p.racer_id = official_results.racer_id)`
+
+func scanOfficialResult(row rowScanner, o *OfficialResult) error {
+	return row.Scan(&o.RacerID, &o.EventID, &o.ComputedStatus, &o.ComputedTime, &o.StatusOverride, &o.TimeOverride,
+		&o.ComputedAt, &o.UpdatedAt, &o.Penalties)
+}
+
+// GetOfficialResult returns the official result of a racer. It returns
+// sql.ErrNoRows if the racer's result hasn't been computed yet.
+func (s *Service) GetOfficialResult(db DBorTx, racerID int64) (*OfficialResult, error) {
+	o := &OfficialResult{}
+	query := `SELECT ` + officialResultColumns + ` FROM official_results WHERE racer_id = ?;`
+	if err := scanOfficialResult(db.QueryRow(query, racerID), o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetOfficialResultsByEventID returns the official results of an event, keyed by racer ID.
+func (s *Service) GetOfficialResultsByEventID(db DBorTx, eventID int64) (map[int64]*OfficialResult, error) {
+	rows, err := db.Query(`SELECT `+officialResultColumns+` FROM official_results WHERE event_id = ?;`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make(map[int64]*OfficialResult)
+	for rows.Next() {
+		o := &OfficialResult{}
+		if err := scanOfficialResult(rows, o); err != nil {
+			return nil, err
+		}
+		list[o.RacerID] = o
+	}
+	return list, rows.Err()
+}
+
+// SaveComputedResult records a racer's computed result, keeping any overrides
+// and penalties already given.
+func (s *Service) SaveComputedResult(db DBorTx, eventID, racerID int64, status string, seconds float64, computedAt time.Time) error {
+	query := `INSERT INTO official_results (racer_id, event_id, computed_status, computed_time, computed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (racer_id) DO UPDATE SET computed_status = excluded.computed_status,
+			computed_time = excluded.computed_time, computed_at = excluded.computed_at, updated_at = CURRENT_TIMESTAMP;`
+	_, err := db.Exec(query, racerID, eventID, status, seconds, computedAt)
+	return err
+}
+
+// SetResultOverrides saves the status and time overrides of a racer's official
+// result. An empty status and a NULL time remove the overrides.
+func (s *Service) SetResultOverrides(db DBorTx, racerID int64, status string, seconds sql.NullFloat64) error {
+	query := `UPDATE official_results SET status_override = ?, time_override = ?, updated_at = CURRENT_TIMESTAMP WHERE racer_id = ?;`
+	_, err := db.Exec(query, status, seconds, racerID)
+	return err
+}
+
+// AddResultPenalty gives a racer a time penalty, or a bonus if negative.
+func (s *Service) AddResultPenalty(db DBorTx, p *ResultPenalty) (*ResultPenalty, error) {
+	query := `INSERT INTO result_penalties (event_id, racer_id, seconds, reason, user_id) VALUES (?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, p.EventID, p.RacerID, p.Seconds, p.Reason, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetResultPenaltyByID(db, id)
+}
+
+// GetResultPenaltyByID returns a single penalty.
+func (s *Service) GetResultPenaltyByID(db DBorTx, id int64) (*ResultPenalty, error) {
+	p := &ResultPenalty{}
+	query := `SELECT id, event_id, racer_id, seconds, reason, user_id, created_at FROM result_penalties WHERE id = ?;`
+	err := db.QueryRow(query, id).Scan(&p.ID, &p.EventID, &p.RacerID, &p.Seconds, &p.Reason, &p.UserID, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetResultPenaltiesByEventID returns the penalties of an event in the order they were given.
+func (s *Service) GetResultPenaltiesByEventID(db DBorTx, eventID int64) ([]*ResultPenalty, error) {
+	query := `SELECT id, event_id, racer_id, seconds, reason, user_id, created_at FROM result_penalties
+		WHERE event_id = ? ORDER BY created_at, id;`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var penalties []*ResultPenalty
+	for rows.Next() {
+		p := &ResultPenalty{}
+		if err := rows.Scan(&p.ID, &p.EventID, &p.RacerID, &p.Seconds, &p.Reason, &p.UserID, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		penalties = append(penalties, p)
+	}
+	return penalties, rows.Err()
+}
+
+// DeleteResultPenalty removes a penalty.
+func (s *Service) DeleteResultPenalty(db DBorTx, id int64) error {
+	_, err := db.Exec(`DELETE FROM result_penalties WHERE id = ?;`, id)
+	return err
+}
+
+// AddResultChange adds an entry to the audit trail of an event's results.
+func (s *Service) AddResultChange(db DBorTx, c *ResultChange) error {
+	query := `INSERT INTO result_changes (event_id, racer_id, user_id, field, old_value, new_value, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	_, err := db.Exec(query, c.EventID, c.RacerID, c.UserID, c.Field, c.OldValue, c.NewValue, c.Reason)
+	return err
+}
+
+// GetResultChangesByEventID returns the audit trail of an event's results,
+// newest first.
+func (s *Service) GetResultChangesByEventID(db DBorTx, eventID int64) ([]*ResultChange, error) {
+	query := `SELECT id, event_id, racer_id, user_id, field, old_value, new_value, reason, created_at
+		FROM result_changes WHERE event_id = ? ORDER BY created_at DESC, id DESC;`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*ResultChange
+	for rows.Next() {
+		c := &ResultChange{}
+		err := rows.Scan(&c.ID, &c.EventID, &c.RacerID, &c.UserID, &c.Field, &c.OldValue, &c.NewValue, &c.Reason, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
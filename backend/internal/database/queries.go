@@ -2,9 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
-	"time"
 )
 
 // DBorTx is an interface that allows functions to accept either a `*sql.DB` for single queries
@@ -180,6 +180,26 @@ func (s *Service) GetGroupsByUserID(db DBorTx, userID int64) ([]*Group, error) {
 	return groups, nil
 }
 
+// GetAllGroupIDs returns the ID of every group, used for maintenance tasks
+// that need to visit each group database.
+func (s *Service) GetAllGroupIDs(db DBorTx) ([]int64, error) {
+	rows, err := db.Query(`SELECT id FROM groups ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (s *Service) GetMembersByGroupID(db DBorTx, groupID int64) ([]User, error) {
 	query := `
 		SELECT u.id, u.email, u.username, u.avatar_url, u.created_at
@@ -295,9 +315,11 @@ func (s *Service) UpdateInvitationStatus(tx *sql.Tx, invitationID int64, status
 
 // --- Event & Racer Queries (on groupDB) ---
 
-func (s *Service) CreateEvent(db DBorTx, groupID int64, name string, start, end *time.Time, eventType string, creatorID int64) (*Event, error) {
-	query := `INSERT INTO events (group_id, name, start_date, end_date, event_type, creator_user_id) VALUES (?, ?, ?, ?, ?, ?);`
-	res, err := db.Exec(query, groupID, name, start, end, eventType, creatorID)
+// CreateEvent inserts a new event. Only the user-editable fields of the given
+// event are used; spatial data is filled in later as tracks are processed.
+func (s *Service) CreateEvent(db DBorTx, event *Event) (*Event, error) {
+	query := `INSERT INTO events (group_id, name, start_date, end_date, event_type, creator_user_id, map_matching, elevation_mode, sport, course_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, event.GroupID, event.Name, event.StartDate, event.EndDate, event.EventType, event.CreatorUserID, event.MapMatching, event.ElevationMode, event.Sport, event.CourseID)
 	if err != nil {
 		return nil, err
 	}
@@ -305,23 +327,124 @@ func (s *Service) CreateEvent(db DBorTx, groupID int64, name string, start, end
 	return s.GetEventByID(db, id)
 }
 
+// UpdateEvent saves the user-editable settings of an existing event.
+func (s *Service) UpdateEvent(db DBorTx, event *Event) error {
+	query := `UPDATE events SET name = ?, map_matching = ?, elevation_mode = ?, sport = ?, course_id = ?,
+		stationary_alert_minutes = ?, off_course_alert_meters = ?, off_course_alert_minutes = ?, silence_alert_minutes = ?,
+		team_scoring = ?, team_counted = ?, exchange_lat = ?, exchange_lon = ?, exchange_radius = ?,
+		handicap_system = ?, age_grades = ?, class_coefficients = ?,
+		registration_enabled = ?, registration_opens_at = ?, registration_closes_at = ?,
+		registration_capacity = ?, registration_approval = ?, registration_questions = ? WHERE id = ?;`
+	ageGrades, classes, err := encodeHandicapTables(event)
+	if err != nil {
+		return err
+	}
+	questions := event.RegistrationQuestions
+	if questions == nil {
+		questions = []RegistrationQuestion{}
+	}
+	encodedQuestions, err := json.Marshal(questions)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(query, event.Name, event.MapMatching, event.ElevationMode, event.Sport, event.CourseID,
+		event.StationaryAlertMinutes, event.OffCourseAlertMeters, event.OffCourseAlertMinutes, event.SilenceAlertMinutes,
+		event.TeamScoring, event.TeamCounted, event.ExchangeLat, event.ExchangeLon, event.ExchangeRadius,
+		event.HandicapSystem, ageGrades, classes,
+		event.RegistrationEnabled, event.RegistrationOpensAt, event.RegistrationClosesAt,
+		event.RegistrationCapacity, event.RegistrationApproval, string(encodedQuestions), event.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("event not found")
+	}
+	return nil
+}
+
+// eventColumns lists the columns of the 'events' table in the order expected by scanEvent.
+// Queries that read events select these columns (optionally prefixed with a table alias).
+const eventColumns = `id, group_id, name, start_date, end_date, event_type, creator_user_id,
+	min_lat, min_lon, max_lat, max_lon, start_lat, start_lon, map_matching, elevation_mode, sport, live_finalized_at, course_id,
+	stationary_alert_minutes, off_course_alert_meters, off_course_alert_minutes, silence_alert_minutes, stage_race_id, stage_number,
+	team_scoring, team_counted, exchange_lat, exchange_lon, exchange_radius,
+	handicap_system, age_grades, class_coefficients,
+	registration_enabled, registration_opens_at, registration_closes_at,
+	registration_capacity, registration_approval, registration_questions`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEvent scans a row selected with eventColumns into an Event. Any extra
+// destinations are scanned after the event columns, for queries that append
+// computed values such as has_gpx_data.
+func scanEvent(row rowScanner, event *Event, extra ...interface{}) error {
+	var ageGrades, classes, questions string
+	dest := []interface{}{
+		&event.ID, &event.GroupID, &event.Name, &event.StartDate, &event.EndDate, &event.EventType, &event.CreatorUserID,
+		&event.MinLat, &event.MinLon, &event.MaxLat, &event.MaxLon, &event.StartLat, &event.StartLon,
+		&event.MapMatching, &event.ElevationMode, &event.Sport, &event.LiveFinalizedAt, &event.CourseID,
+		&event.StationaryAlertMinutes, &event.OffCourseAlertMeters, &event.OffCourseAlertMinutes, &event.SilenceAlertMinutes,
+		&event.StageRaceID, &event.StageNumber,
+		&event.TeamScoring, &event.TeamCounted, &event.ExchangeLat, &event.ExchangeLon, &event.ExchangeRadius,
+		&event.HandicapSystem, &ageGrades, &classes,
+		&event.RegistrationEnabled, &event.RegistrationOpensAt, &event.RegistrationClosesAt,
+		&event.RegistrationCapacity, &event.RegistrationApproval, &questions,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(ageGrades), &event.AgeGrades); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(questions), &event.RegistrationQuestions); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(classes), &event.ClassCoefficients)
+}
+
+// encodeHandicapTables returns an event's age-grading table and class
+// coefficients as stored.
+func encodeHandicapTables(event *Event) (ageGrades, classes string, err error) {
+	grades := event.AgeGrades
+	if grades == nil {
+		grades = []AgeGrade{}
+	}
+	g, err := json.Marshal(grades)
+	if err != nil {
+		return "", "", err
+	}
+	coefficients := event.ClassCoefficients
+	if coefficients == nil {
+		coefficients = map[string]float64{}
+	}
+	c, err := json.Marshal(coefficients)
+	if err != nil {
+		return "", "", err
+	}
+	return string(g), string(c), nil
+}
+
 func (s *Service) GetEventByID(db DBorTx, id int64) (*Event, error) {
-	query := `SELECT id, group_id, name, start_date, end_date, event_type, creator_user_id FROM events WHERE id = ?;`
+	query := `SELECT ` + eventColumns + ` FROM events WHERE id = ?;`
 	event := &Event{}
-	err := db.QueryRow(query, id).Scan(&event.ID, &event.GroupID, &event.Name, &event.StartDate, &event.EndDate, &event.EventType, &event.CreatorUserID)
+	err := scanEvent(db.QueryRow(query, id), event)
 	return event, err
 }
 
 func (s *Service) GetEventsByGroupID(db DBorTx, groupID int64) ([]*Event, error) {
 	// This query now joins with the racers table to determine if any racer
-	// in the event has a non-null gpx_file_path.
+	// in the event has a track file.
 	query := `
 		SELECT 
-			e.id, e.group_id, e.name, e.start_date, e.end_date, e.event_type, e.creator_user_id,
-			EXISTS(SELECT 1 FROM racers r WHERE r.event_id = e.id AND r.gpx_file_path IS NOT NULL AND r.gpx_file_path != '') as has_gpx_data
-		FROM events e
-		WHERE e.group_id = ?
-		ORDER BY e.start_date DESC;
+			` + eventColumns + `,
+			EXISTS(SELECT 1 FROM racers r JOIN track_files tf ON tf.racer_id = r.id WHERE r.event_id = events.id) as has_gpx_data
+		FROM events
+		WHERE group_id = ?
+		ORDER BY start_date DESC;
 	`
 
 	rows, err := db.Query(query, groupID)
@@ -333,7 +456,7 @@ func (s *Service) GetEventsByGroupID(db DBorTx, groupID int64) ([]*Event, error)
 	var events []*Event
 	for rows.Next() {
 		event := &Event{}
-		if err := rows.Scan(&event.ID, &event.GroupID, &event.Name, &event.StartDate, &event.EndDate, &event.EventType, &event.CreatorUserID, &event.HasGpxData); err != nil {
+		if err := scanEvent(rows, event, &event.HasGpxData); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
@@ -342,6 +465,14 @@ func (s *Service) GetEventsByGroupID(db DBorTx, groupID int64) ([]*Event, error)
 }
 
 func (s *Service) DeleteEvent(db DBorTx, eventID int64) error {
+	// Remove rows that belong to the event explicitly, so that nothing is left
+	// behind if foreign key enforcement is not enabled on the connection.
+	for _, dependent := range eventDependentDeletes {
+		if _, err := db.Exec(dependent, eventID); err != nil {
+			return err
+		}
+	}
+
 	query := `DELETE FROM events WHERE id = ?;`
 	res, err := db.Exec(query, eventID)
 	if err != nil {
@@ -351,7 +482,34 @@ func (s *Service) DeleteEvent(db DBorTx, eventID int64) error {
 	if rowsAffected == 0 {
 		return errors.New("event not found or already deleted")
 	}
-	return nil
+	// The R-tree is a virtual table and cannot take part in foreign key cascades.
+	_, err = db.Exec(`DELETE FROM event_spatial_index WHERE id = ?;`, eventID)
+	return err
+}
+
+// eventDependentDeletes remove the rows of group database tables that reference an
+// event, directly or through its racers. Each takes the event ID as its only argument.
+// The racers themselves go last, as the statements before them select by racer.
+var eventDependentDeletes = []string{
+	`DELETE FROM live_positions WHERE racer_id IN (SELECT id FROM racers WHERE event_id = ?);`,
+	`DELETE FROM track_files WHERE racer_id IN (SELECT id FROM racers WHERE event_id = ?);`,
+	`DELETE FROM stage_race_riders WHERE racer_id IN (SELECT id FROM racers WHERE event_id = ?);`,
+	`DELETE FROM series_riders WHERE racer_id IN (SELECT id FROM racers WHERE event_id = ?);`,
+	`DELETE FROM best_efforts WHERE event_id = ?;`,
+	`DELETE FROM racer_claims WHERE event_id = ?;`,
+	`DELETE FROM ghosts WHERE event_id = ?;`,
+	`DELETE FROM registrations WHERE event_id = ?;`,
+	`DELETE FROM ghosts WHERE source_racer_id IN (SELECT id FROM racers WHERE event_id = ?);`,
+	`DELETE FROM series_events WHERE event_id = ?;`,
+	`DELETE FROM checkpoints WHERE event_id = ?;`,
+	`DELETE FROM teams WHERE event_id = ?;`,
+	`DELETE FROM official_results WHERE event_id = ?;`,
+	`DELETE FROM result_penalties WHERE event_id = ?;`,
+	`DELETE FROM result_changes WHERE event_id = ?;`,
+	`DELETE FROM event_wind WHERE event_id = ?;`,
+	`DELETE FROM safety_incidents WHERE event_id = ?;`,
+	`DELETE FROM racer_spatial WHERE event_id = ?;`,
+	`DELETE FROM racers WHERE event_id = ?;`,
 }
 
 func (s *Service) AddRacerToEvent(db DBorTx, eventID, uploaderID int64, racerName, trackColor string, avatarURL sql.NullString) (*Racer, error) {
@@ -364,18 +522,34 @@ func (s *Service) AddRacerToEvent(db DBorTx, eventID, uploaderID int64, racerNam
 	return s.GetRacerByID(db, id)
 }
 
-func (s *Service) GetRacerByID(db DBorTx, id int64) (*Racer, error) {
-	query := `SELECT id, event_id, uploader_user_id, racer_name, track_color, track_avatar_url, gpx_file_path FROM racers WHERE id = ?;`
-	racer := &Racer{}
-	err := db.QueryRow(query, id).Scan(
+// racerColumns lists the columns of the racers table in the order expected by scanRacer.
+// The racer's track files are summarised from the track_files table.
+const racerColumns = `id, event_id, uploader_user_id, racer_name, track_color, track_avatar_url,
+	(SELECT file_path FROM track_files tf WHERE tf.racer_id = racers.id ORDER BY position, id LIMIT 1),
+	(SELECT COUNT(*) FROM track_files tf WHERE tf.racer_id = racers.id),
+	live_status, live_checkpoints, live_status_at, team_id, leg, bib, category, club, nationality,
+	handicap_factor, age, class, start_offset, user_id`
+
+// scanRacer scans a row selected with racerColumns into racer.
+func scanRacer(row rowScanner, racer *Racer) error {
+	return row.Scan(
 		&racer.ID, &racer.EventID, &racer.UploaderUserID,
-		&racer.RacerName, &racer.TrackColor, &racer.TrackAvatarURL, &racer.GpxFilePath,
+		&racer.RacerName, &racer.TrackColor, &racer.TrackAvatarURL, &racer.GpxFilePath, &racer.TrackFileCount,
+		&racer.LiveStatus, &racer.LiveCheckpoints, &racer.LiveStatusAt, &racer.TeamID, &racer.Leg,
+		&racer.Bib, &racer.Category, &racer.Club, &racer.Nationality,
+		&racer.HandicapFactor, &racer.Age, &racer.Class, &racer.StartOffset, &racer.UserID,
 	)
+}
+
+func (s *Service) GetRacerByID(db DBorTx, id int64) (*Racer, error) {
+	query := `SELECT ` + racerColumns + ` FROM racers WHERE id = ?;`
+	racer := &Racer{}
+	err := scanRacer(db.QueryRow(query, id), racer)
 	return racer, err
 }
 
 func (s *Service) GetRacersByEventID(db DBorTx, eventID int64) ([]*Racer, error) {
-	query := `SELECT id, event_id, uploader_user_id, racer_name, track_color, track_avatar_url, gpx_file_path FROM racers WHERE event_id = ?;`
+	query := `SELECT ` + racerColumns + ` FROM racers WHERE event_id = ?;`
 	rows, err := db.Query(query, eventID)
 	if err != nil {
 		return nil, err
@@ -385,10 +559,7 @@ func (s *Service) GetRacersByEventID(db DBorTx, eventID int64) ([]*Racer, error)
 	var racers []*Racer
 	for rows.Next() {
 		racer := &Racer{}
-		if err := rows.Scan(
-			&racer.ID, &racer.EventID, &racer.UploaderUserID,
-			&racer.RacerName, &racer.TrackColor, &racer.TrackAvatarURL, &racer.GpxFilePath,
-		); err != nil {
+		if err := scanRacer(rows, racer); err != nil {
 			return nil, err
 		}
 		racers = append(racers, racer)
@@ -409,6 +580,22 @@ func (s *Service) UpdateRacerColor(db DBorTx, racerID int64, newColor string) er
 	return nil
 }
 
+// UpdateRacerDetails saves a racer's entry and handicap details.
+func (s *Service) UpdateRacerDetails(db DBorTx, racer *Racer) error {
+	query := `UPDATE racers SET bib = ?, category = ?, club = ?, nationality = ?,
+		handicap_factor = ?, age = ?, class = ?, start_offset = ? WHERE id = ?;`
+	res, err := db.Exec(query, racer.Bib, racer.Category, racer.Club, racer.Nationality,
+		racer.HandicapFactor, racer.Age, racer.Class, racer.StartOffset, racer.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("racer not found")
+	}
+	return nil
+}
+
 // UpdateRacerAvatar updates the track_avatar_url for a specific racer.
 func (s *Service) UpdateRacerAvatar(db DBorTx, racerID int64, avatarURL string) error {
 	query := `UPDATE racers SET track_avatar_url = ? WHERE id = ?;`
@@ -425,6 +612,30 @@ func (s *Service) UpdateRacerAvatar(db DBorTx, racerID int64, avatarURL string)
 
 // DeleteRacer removes a single racer entry from the database.
 func (s *Service) DeleteRacer(db DBorTx, racerID int64) error {
+	if _, err := db.Exec(`DELETE FROM live_positions WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM safety_incidents WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM track_files WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM stage_race_riders WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM series_riders WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	for _, table := range []string{"official_results", "result_penalties", "result_changes", "best_efforts", "racer_claims", "ghosts", "racer_spatial"} {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE racer_id = ?;`, racerID); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM ghosts WHERE source_racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+
 	query := `DELETE FROM racers WHERE id = ?;`
 	res, err := db.Exec(query, racerID)
 	if err != nil {
@@ -436,9 +647,3 @@ func (s *Service) DeleteRacer(db DBorTx, racerID int64) error {
 	}
 	return nil
 }
-
-func (s *Service) UpdateRacerGpxFile(db DBorTx, racerID int64, filePath string) error {
-	query := `UPDATE racers SET gpx_file_path = ? WHERE id = ?;`
-	_, err := db.Exec(query, filePath, racerID)
-	return err
-}
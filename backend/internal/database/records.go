@@ -0,0 +1,173 @@
+package database
+
+import (
+	"errors"
+)
+
+// --- Segment & Best Effort Queries (on groupDB) ---
+
+const segmentColumns = `id, name, start_lat, start_lon, end_lat, end_lon, radius, creator_user_id, created_at`
+
+func scanSegment(row rowScanner, seg *Segment) error {
+	return row.Scan(&seg.ID, &seg.Name, &seg.StartLat, &seg.StartLon, &seg.EndLat, &seg.EndLon, &seg.Radius,
+		&seg.CreatorUserID, &seg.CreatedAt)
+}
+
+// CreateSegment inserts a new segment.
+func (s *Service) CreateSegment(db DBorTx, seg *Segment) (*Segment, error) {
+	query := `INSERT INTO segments (name, start_lat, start_lon, end_lat, end_lon, radius, creator_user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, seg.Name, seg.StartLat, seg.StartLon, seg.EndLat, seg.EndLon, seg.Radius, seg.CreatorUserID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetSegmentByID(db, id)
+}
+
+// GetSegmentByID returns a single segment.
+func (s *Service) GetSegmentByID(db DBorTx, id int64) (*Segment, error) {
+	seg := &Segment{}
+	if err := scanSegment(db.QueryRow(`SELECT `+segmentColumns+` FROM segments WHERE id = ?;`, id), seg); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// GetSegments returns all of a group's segments, sorted by name.
+func (s *Service) GetSegments(db DBorTx) ([]*Segment, error) {
+	rows, err := db.Query(`SELECT ` + segmentColumns + ` FROM segments ORDER BY name, id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []*Segment
+	for rows.Next() {
+		seg := &Segment{}
+		if err := scanSegment(rows, seg); err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, rows.Err()
+}
+
+// DeleteSegment deletes a segment and the best efforts timed over it.
+func (s *Service) DeleteSegment(db DBorTx, id int64) error {
+	if _, err := db.Exec(`DELETE FROM best_efforts WHERE kind = 'segment' AND ref_id = ?;`, id); err != nil {
+		return err
+	}
+	res, err := db.Exec(`DELETE FROM segments WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("segment not found")
+	}
+	return nil
+}
+
+const bestEffortColumns = `id, racer_id, event_id, user_id, kind, ref_id, seconds, started_at`
+
+func scanBestEffort(row rowScanner, e *BestEffort, extra ...interface{}) error {
+	dest := []interface{}{&e.ID, &e.RacerID, &e.EventID, &e.UserID, &e.Kind, &e.RefID, &e.Seconds, &e.StartedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// ReplaceBestEfforts replaces all of a racer's best efforts with the given list.
+func (s *Service) ReplaceBestEfforts(db DBorTx, racerID int64, efforts []*BestEffort) error {
+	if _, err := db.Exec(`DELETE FROM best_efforts WHERE racer_id = ?;`, racerID); err != nil {
+		return err
+	}
+	query := `INSERT INTO best_efforts (racer_id, event_id, user_id, kind, ref_id, seconds, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	for _, e := range efforts {
+		res, err := db.Exec(query, racerID, e.EventID, e.UserID, e.Kind, e.RefID, e.Seconds, e.StartedAt)
+		if err != nil {
+			return err
+		}
+		e.ID, _ = res.LastInsertId()
+		e.RacerID = racerID
+	}
+	return nil
+}
+
+// GetBestEffortsByEventID returns the best efforts of an event's racers, each
+// with the fastest earlier efforts over the same distance, course or segment
+// to tell whether it set a record.
+func (s *Service) GetBestEffortsByEventID(db DBorTx, eventID int64) ([]*BestEffort, error) {
+	query := `SELECT ` + bestEffortColumns + `,
+		(SELECT MIN(o.seconds) FROM best_efforts o WHERE o.kind = best_efforts.kind AND o.ref_id = best_efforts.ref_id
+			AND best_efforts.user_id != 0 AND o.user_id = best_efforts.user_id AND o.event_id != best_efforts.event_id AND o.started_at < best_efforts.started_at),
+		(SELECT MIN(o.seconds) FROM best_efforts o WHERE o.kind = best_efforts.kind AND o.ref_id = best_efforts.ref_id
+			AND o.event_id != best_efforts.event_id AND o.started_at < best_efforts.started_at),
+		(SELECT MIN(o.seconds) FROM best_efforts o WHERE o.kind = best_efforts.kind AND o.ref_id = best_efforts.ref_id
+			AND o.event_id = best_efforts.event_id)
+		FROM best_efforts WHERE event_id = ? ORDER BY racer_id, kind, ref_id;`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var efforts []*BestEffort
+	for rows.Next() {
+		e := &BestEffort{}
+		if err := scanBestEffort(rows, e, &e.UserBefore, &e.RecordBefore, &e.EventBest); err != nil {
+			return nil, err
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
+
+// GetRecordEfforts returns the fastest effort ever over each distance, course
+// and segment in the group, or only a user's fastest if userID isn't zero. On
+// a tie, the effort that set the time first is returned.
+func (s *Service) GetRecordEfforts(db DBorTx, userID int64) ([]*BestEffort, error) {
+	query := `SELECT ` + bestEffortColumns + ` FROM best_efforts
+		WHERE (? = 0 OR user_id = ?) AND id = (
+			SELECT o.id FROM best_efforts o WHERE o.kind = best_efforts.kind AND o.ref_id = best_efforts.ref_id
+				AND (? = 0 OR o.user_id = ?)
+			ORDER BY o.seconds, o.started_at, o.id LIMIT 1)
+		ORDER BY kind, ref_id;`
+	rows, err := db.Query(query, userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var efforts []*BestEffort
+	for rows.Next() {
+		e := &BestEffort{}
+		if err := scanBestEffort(rows, e); err != nil {
+			return nil, err
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
+
+// GetCourseEfforts returns the course efforts on a course from events other
+// than the given one, fastest first.
+func (s *Service) GetCourseEfforts(db DBorTx, courseID, excludeEventID int64) ([]*BestEffort, error) {
+	query := `SELECT ` + bestEffortColumns + ` FROM best_efforts
+		WHERE kind = 'course' AND ref_id = ? AND event_id != ? ORDER BY seconds, started_at, id;`
+	rows, err := db.Query(query, courseID, excludeEventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var efforts []*BestEffort
+	for rows.Next() {
+		e := &BestEffort{}
+		if err := scanBestEffort(rows, e); err != nil {
+			return nil, err
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
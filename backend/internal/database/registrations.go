@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// --- Registration Queries (on groupDB) ---
+
+const registrationColumns = `id, event_id, user_id, racer_id, racer_name, status, answers, created_at, updated_at`
+
+func scanRegistration(row rowScanner, r *Registration) error {
+	var answers string
+	if err := row.Scan(&r.ID, &r.EventID, &r.UserID, &r.RacerID, &r.RacerName, &r.Status, &answers, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(answers), &r.Answers)
+}
+
+func encodeAnswers(answers map[string]string) (string, error) {
+	if answers == nil {
+		answers = map[string]string{}
+	}
+	b, err := json.Marshal(answers)
+	return string(b), err
+}
+
+// CreateRegistration inserts a member's registration for an event. A member
+// who registered before, and withdrew or was rejected, registers again with
+// RenewRegistration.
+func (s *Service) CreateRegistration(db DBorTx, r *Registration) (*Registration, error) {
+	answers, err := encodeAnswers(r.Answers)
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO registrations (event_id, user_id, racer_id, racer_name, status, answers) VALUES (?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, r.EventID, r.UserID, r.RacerID, r.RacerName, r.Status, answers)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetRegistrationByID(db, id)
+}
+
+// RenewRegistration registers a member again, with a new registration time
+// that puts them at the back of any waitlist.
+func (s *Service) RenewRegistration(db DBorTx, r *Registration) (*Registration, error) {
+	answers, err := encodeAnswers(r.Answers)
+	if err != nil {
+		return nil, err
+	}
+	query := `UPDATE registrations SET racer_id = ?, racer_name = ?, status = ?, answers = ?,
+		created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?;`
+	if _, err := db.Exec(query, r.RacerID, r.RacerName, r.Status, answers, r.ID); err != nil {
+		return nil, err
+	}
+	return s.GetRegistrationByID(db, r.ID)
+}
+
+// GetRegistrationByID returns a single registration.
+func (s *Service) GetRegistrationByID(db DBorTx, id int64) (*Registration, error) {
+	r := &Registration{}
+	if err := scanRegistration(db.QueryRow(`SELECT `+registrationColumns+` FROM registrations WHERE id = ?;`, id), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetRegistration returns a user's registration for an event, or sql.ErrNoRows
+// if they never registered.
+func (s *Service) GetRegistration(db DBorTx, eventID, userID int64) (*Registration, error) {
+	r := &Registration{}
+	if err := scanRegistration(db.QueryRow(`SELECT `+registrationColumns+` FROM registrations WHERE event_id = ? AND user_id = ?;`, eventID, userID), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetRegistrationByRacerID returns the registration a racer was entered by,
+// or sql.ErrNoRows if the racer was added by someone else.
+func (s *Service) GetRegistrationByRacerID(db DBorTx, racerID int64) (*Registration, error) {
+	r := &Registration{}
+	if err := scanRegistration(db.QueryRow(`SELECT `+registrationColumns+` FROM registrations WHERE racer_id = ?;`, racerID), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetRegistrationsByEventID returns the registrations for an event in the
+// order they were made, which is also the order of the waitlist.
+func (s *Service) GetRegistrationsByEventID(db DBorTx, eventID int64) ([]*Registration, error) {
+	rows, err := db.Query(`SELECT `+registrationColumns+` FROM registrations WHERE event_id = ? ORDER BY created_at, id;`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var registrations []*Registration
+	for rows.Next() {
+		r := &Registration{}
+		if err := scanRegistration(rows, r); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, r)
+	}
+	return registrations, rows.Err()
+}
+
+// SetRegistrationStatus changes the status of a registration and the racer it
+// entered, if any.
+func (s *Service) SetRegistrationStatus(db DBorTx, id int64, status string, racerID sql.NullInt64) error {
+	res, err := db.Exec(`UPDATE registrations SET status = ?, racer_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;`, status, racerID, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("registration not found")
+	}
+	return nil
+}
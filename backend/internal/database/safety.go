@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// --- Safety Incident Queries (on groupDB) ---
+
+const safetyIncidentColumns = `id, event_id, racer_id, type, status, since, detected_at, lat, lon, distance,
+	acknowledged_by, acknowledged_at, resolved_by, resolved_at, note`
+
+func scanSafetyIncident(row rowScanner, inc *SafetyIncident) error {
+	return row.Scan(&inc.ID, &inc.EventID, &inc.RacerID, &inc.Type, &inc.Status, &inc.Since, &inc.DetectedAt,
+		&inc.Lat, &inc.Lon, &inc.Distance, &inc.AcknowledgedBy, &inc.AcknowledgedAt, &inc.ResolvedBy, &inc.ResolvedAt, &inc.Note)
+}
+
+// CreateSafetyIncident records a new open incident.
+func (s *Service) CreateSafetyIncident(db DBorTx, inc *SafetyIncident) error {
+	query := `INSERT INTO safety_incidents (event_id, racer_id, type, since, detected_at, lat, lon, distance) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, inc.EventID, inc.RacerID, inc.Type, inc.Since.UTC(), inc.DetectedAt.UTC(), inc.Lat, inc.Lon, inc.Distance)
+	if err != nil {
+		return err
+	}
+	inc.ID, _ = res.LastInsertId()
+	inc.Status = "open"
+	return nil
+}
+
+// GetSafetyIncidentByID returns a single incident.
+func (s *Service) GetSafetyIncidentByID(db DBorTx, id int64) (*SafetyIncident, error) {
+	query := `SELECT ` + safetyIncidentColumns + ` FROM safety_incidents WHERE id = ?;`
+	inc := &SafetyIncident{}
+	if err := scanSafetyIncident(db.QueryRow(query, id), inc); err != nil {
+		return nil, err
+	}
+	return inc, nil
+}
+
+// GetLatestSafetyIncident returns a racer's most recent incident of a type, or
+// nil if there has been none.
+func (s *Service) GetLatestSafetyIncident(db DBorTx, racerID int64, incidentType string) (*SafetyIncident, error) {
+	query := `SELECT ` + safetyIncidentColumns + ` FROM safety_incidents WHERE racer_id = ? AND type = ? ORDER BY detected_at DESC, id DESC LIMIT 1;`
+	inc := &SafetyIncident{}
+	err := scanSafetyIncident(db.QueryRow(query, racerID, incidentType), inc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inc, nil
+}
+
+// GetSafetyIncidentsByEventID returns an event's incidents, newest first. If
+// status is not empty only incidents with that status are returned.
+func (s *Service) GetSafetyIncidentsByEventID(db DBorTx, eventID int64, status string) ([]*SafetyIncident, error) {
+	query := `SELECT ` + safetyIncidentColumns + ` FROM safety_incidents
+		WHERE event_id = ? AND (? = '' OR status = ?) ORDER BY detected_at DESC, id DESC;`
+	rows, err := db.Query(query, eventID, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []*SafetyIncident
+	for rows.Next() {
+		inc := &SafetyIncident{}
+		if err := scanSafetyIncident(rows, inc); err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// AcknowledgeSafetyIncident records that a user has seen an open incident.
+func (s *Service) AcknowledgeSafetyIncident(db DBorTx, id, userID int64, at time.Time) error {
+	query := `UPDATE safety_incidents SET status = 'acknowledged', acknowledged_by = ?, acknowledged_at = ? WHERE id = ? AND status = 'open';`
+	res, err := db.Exec(query, userID, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("incident is not open")
+	}
+	return nil
+}
+
+// ResolveSafetyIncident closes an incident with an optional note. An incident
+// that was never acknowledged is acknowledged by the same user at the same time.
+func (s *Service) ResolveSafetyIncident(db DBorTx, id, userID int64, note string, at time.Time) error {
+	query := `
+		UPDATE safety_incidents SET
+			status = 'resolved',
+			acknowledged_by = COALESCE(acknowledged_by, ?),
+			acknowledged_at = COALESCE(acknowledged_at, ?),
+			resolved_by = ?, resolved_at = ?, note = ?
+		WHERE id = ? AND status != 'resolved';`
+	res, err := db.Exec(query, userID, at.UTC(), userID, at.UTC(), note, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("incident is already resolved")
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// --- Series Queries (on groupDB) ---
+
+const seriesColumns = `id, name, points_table, drop_worst, tie_breakers, match_by, creator_user_id, created_at`
+
+func scanSeries(row rowScanner, series *Series) error {
+	var points, tieBreakers string
+	err := row.Scan(&series.ID, &series.Name, &points, &series.DropWorst, &tieBreakers,
+		&series.MatchBy, &series.CreatorUserID, &series.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(points), &series.PointsTable); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(tieBreakers), &series.TieBreakers)
+}
+
+// encodeSeriesRules returns a series' points table and tie-breakers as stored.
+func encodeSeriesRules(series *Series) (points, tieBreakers string, err error) {
+	p, err := json.Marshal(nonNilInts(series.PointsTable))
+	if err != nil {
+		return "", "", err
+	}
+	tb := series.TieBreakers
+	if tb == nil {
+		tb = []string{}
+	}
+	t, err := json.Marshal(tb)
+	if err != nil {
+		return "", "", err
+	}
+	return string(p), string(t), nil
+}
+
+// CreateSeries inserts a new series without any events.
+func (s *Service) CreateSeries(db DBorTx, series *Series) (*Series, error) {
+	points, tieBreakers, err := encodeSeriesRules(series)
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO series (name, points_table, drop_worst, tie_breakers, match_by, creator_user_id)
+		VALUES (?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, series.Name, points, series.DropWorst, tieBreakers, series.MatchBy, series.CreatorUserID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetSeriesByID(db, id)
+}
+
+// GetSeriesByID returns a single series.
+func (s *Service) GetSeriesByID(db DBorTx, id int64) (*Series, error) {
+	query := `SELECT ` + seriesColumns + ` FROM series WHERE id = ?;`
+	series := &Series{}
+	if err := scanSeries(db.QueryRow(query, id), series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// GetAllSeries returns all series of a group, newest first.
+func (s *Service) GetAllSeries(db DBorTx) ([]*Series, error) {
+	query := `SELECT ` + seriesColumns + ` FROM series ORDER BY created_at DESC, id DESC;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Series
+	for rows.Next() {
+		series := &Series{}
+		if err := scanSeries(rows, series); err != nil {
+			return nil, err
+		}
+		list = append(list, series)
+	}
+	return list, rows.Err()
+}
+
+// UpdateSeries saves a series' name and scoring rules.
+func (s *Service) UpdateSeries(db DBorTx, series *Series) error {
+	points, tieBreakers, err := encodeSeriesRules(series)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE series SET name = ?, points_table = ?, drop_worst = ?, tie_breakers = ?, match_by = ? WHERE id = ?;`
+	res, err := db.Exec(query, series.Name, points, series.DropWorst, tieBreakers, series.MatchBy, series.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("series not found")
+	}
+	return nil
+}
+
+// DeleteSeries deletes a series. Its events are not affected.
+func (s *Service) DeleteSeries(db DBorTx, id int64) error {
+	for _, table := range []string{"series_events", "series_riders", "series_categories"} {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE series_id = ?;`, id); err != nil {
+			return err
+		}
+	}
+	res, err := db.Exec(`DELETE FROM series WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("series not found")
+	}
+	return nil
+}
+
+// GetSeriesEvents returns the events of a series in date order. Events without
+// a start date come last.
+func (s *Service) GetSeriesEvents(db DBorTx, seriesID int64) ([]*Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events
+		WHERE id IN (SELECT event_id FROM series_events WHERE series_id = ?)
+		ORDER BY start_date IS NULL, start_date, id;`
+	rows, err := db.Query(query, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		if err := scanEvent(rows, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// SetSeriesEvents makes the given events the rounds of a series. The rider
+// links of racers in events that are no longer rounds are removed.
+func (s *Service) SetSeriesEvents(db DBorTx, seriesID int64, eventIDs []int64) error {
+	if _, err := db.Exec(`DELETE FROM series_events WHERE series_id = ?;`, seriesID); err != nil {
+		return err
+	}
+	for _, eventID := range eventIDs {
+		if _, err := db.Exec(`INSERT INTO series_events (series_id, event_id) VALUES (?, ?);`, seriesID, eventID); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`DELETE FROM series_riders WHERE series_id = ? AND racer_id NOT IN (
+		SELECT r.id FROM racers r JOIN series_events se ON se.event_id = r.event_id WHERE se.series_id = ?);`, seriesID, seriesID)
+	return err
+}
+
+// GetSeriesRiders returns the explicit rider links of a series, keyed by racer ID.
+func (s *Service) GetSeriesRiders(db DBorTx, seriesID int64) (map[int64]SeriesRider, error) {
+	rows, err := db.Query(`SELECT racer_id, user_id, rider FROM series_riders WHERE series_id = ?;`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make(map[int64]SeriesRider)
+	for rows.Next() {
+		var link SeriesRider
+		if err := rows.Scan(&link.RacerID, &link.UserID, &link.Rider); err != nil {
+			return nil, err
+		}
+		links[link.RacerID] = link
+	}
+	return links, rows.Err()
+}
+
+// SetSeriesRider links a racer to a user or a rider name in a series. A link
+// with neither is removed, so the racer is matched by the series' rules again.
+func (s *Service) SetSeriesRider(db DBorTx, seriesID int64, link SeriesRider) error {
+	if !link.UserID.Valid && link.Rider == "" {
+		_, err := db.Exec(`DELETE FROM series_riders WHERE series_id = ? AND racer_id = ?;`, seriesID, link.RacerID)
+		return err
+	}
+	query := `INSERT INTO series_riders (series_id, racer_id, user_id, rider) VALUES (?, ?, ?, ?)
+		ON CONFLICT (series_id, racer_id) DO UPDATE SET user_id = excluded.user_id, rider = excluded.rider;`
+	_, err := db.Exec(query, seriesID, link.RacerID, link.UserID, link.Rider)
+	return err
+}
+
+// GetSeriesCategories returns the category of each rider of a series that has
+// one, keyed by rider.
+func (s *Service) GetSeriesCategories(db DBorTx, seriesID int64) (map[string]string, error) {
+	rows, err := db.Query(`SELECT rider, category FROM series_categories WHERE series_id = ?;`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[string]string)
+	for rows.Next() {
+		var rider, category string
+		if err := rows.Scan(&rider, &category); err != nil {
+			return nil, err
+		}
+		categories[rider] = category
+	}
+	return categories, rows.Err()
+}
+
+// SetSeriesCategory puts a rider of a series in a category. An empty category
+// removes the rider from their category.
+func (s *Service) SetSeriesCategory(db DBorTx, seriesID int64, rider, category string) error {
+	if category == "" {
+		_, err := db.Exec(`DELETE FROM series_categories WHERE series_id = ? AND rider = ?;`, seriesID, rider)
+		return err
+	}
+	query := `INSERT INTO series_categories (series_id, rider, category) VALUES (?, ?, ?)
+		ON CONFLICT (series_id, rider) DO UPDATE SET category = excluded.category;`
+	_, err := db.Exec(query, seriesID, rider, category)
+	return err
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// --- Spatial Queries (on groupDB) ---
+
+// UpdateEventSpatialData stores an event's bounding box and start location and
+// keeps the event_spatial_index R-tree in sync. Passing valid=false clears both,
+// which is used when the last track of an event is removed.
+func (s *Service) UpdateEventSpatialData(db DBorTx, eventID int64, valid bool, minLat, minLon, maxLat, maxLon, startLat, startLon float64) error {
+	if !valid {
+		query := `UPDATE events SET min_lat = NULL, min_lon = NULL, max_lat = NULL, max_lon = NULL, start_lat = NULL, start_lon = NULL WHERE id = ?;`
+		if _, err := db.Exec(query, eventID); err != nil {
+			return err
+		}
+		_, err := db.Exec(`DELETE FROM event_spatial_index WHERE id = ?;`, eventID)
+		return err
+	}
+
+	query := `UPDATE events SET min_lat = ?, min_lon = ?, max_lat = ?, max_lon = ?, start_lat = ?, start_lon = ? WHERE id = ?;`
+	if _, err := db.Exec(query, minLat, minLon, maxLat, maxLon, startLat, startLon, eventID); err != nil {
+		return err
+	}
+
+	query = `INSERT OR REPLACE INTO event_spatial_index (id, min_lon, max_lon, min_lat, max_lat) VALUES (?, ?, ?, ?, ?);`
+	_, err := db.Exec(query, eventID, minLon, maxLon, minLat, maxLat)
+	return err
+}
+
+// SetRacerSpatialData stores a racer's contribution to their event's bounding
+// box and start location. Passing valid=false records that the racer has no
+// usable track.
+func (s *Service) SetRacerSpatialData(db DBorTx, racerID, eventID int64, valid bool, minLat, minLon, maxLat, maxLon, startLat, startLon float64, startTime time.Time) error {
+	if !valid {
+		query := `INSERT OR REPLACE INTO racer_spatial (racer_id, event_id) VALUES (?, ?);`
+		_, err := db.Exec(query, racerID, eventID)
+		return err
+	}
+	query := `
+		INSERT OR REPLACE INTO racer_spatial (racer_id, event_id, min_lat, min_lon, max_lat, max_lon, start_lat, start_lon, start_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := db.Exec(query, racerID, eventID, minLat, minLon, maxLat, maxLon, startLat, startLon, startTime.UTC())
+	return err
+}
+
+// GetRacersMissingSpatialData returns the IDs of an event's racers with track
+// files whose spatial data has not been stored yet, such as racers uploaded
+// before it was kept per racer.
+func (s *Service) GetRacersMissingSpatialData(db DBorTx, eventID int64) ([]int64, error) {
+	query := `
+		SELECT id FROM racers
+		WHERE event_id = ?
+			AND EXISTS (SELECT 1 FROM track_files tf WHERE tf.racer_id = racers.id)
+			AND NOT EXISTS (SELECT 1 FROM racer_spatial rs WHERE rs.racer_id = racers.id);`
+	rows, err := db.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RefreshEventSpatialData combines the stored spatial data of an event's racers
+// into the event's bounding box and start location, which is the first point
+// of the earliest track.
+func (s *Service) RefreshEventSpatialData(db DBorTx, eventID int64) error {
+	var minLat, minLon, maxLat, maxLon sql.NullFloat64
+	query := `SELECT MIN(min_lat), MIN(min_lon), MAX(max_lat), MAX(max_lon) FROM racer_spatial WHERE event_id = ? AND min_lat IS NOT NULL;`
+	if err := db.QueryRow(query, eventID).Scan(&minLat, &minLon, &maxLat, &maxLon); err != nil {
+		return err
+	}
+	if !minLat.Valid {
+		return s.UpdateEventSpatialData(db, eventID, false, 0, 0, 0, 0, 0, 0)
+	}
+
+	var startLat, startLon float64
+	query = `SELECT start_lat, start_lon FROM racer_spatial WHERE event_id = ? AND min_lat IS NOT NULL ORDER BY start_time, racer_id LIMIT 1;`
+	if err := db.QueryRow(query, eventID).Scan(&startLat, &startLon); err != nil {
+		return err
+	}
+	return s.UpdateEventSpatialData(db, eventID, true,
+		minLat.Float64, minLon.Float64, maxLat.Float64, maxLon.Float64, startLat, startLon)
+}
+
+// GetEventsInBounds returns all events of a group whose bounding box intersects
+// the given box. The R-tree performs the coarse filtering; callers may refine
+// the result further (e.g. by exact distance).
+func (s *Service) GetEventsInBounds(db DBorTx, groupID int64, minLat, minLon, maxLat, maxLon float64) ([]*Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE group_id = ? AND id IN (
+			SELECT id FROM event_spatial_index
+			WHERE max_lon >= ? AND min_lon <= ? AND max_lat >= ? AND min_lat <= ?
+		);`
+
+	rows, err := db.Query(query, groupID, minLon, maxLon, minLat, maxLat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		if err := scanEvent(rows, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
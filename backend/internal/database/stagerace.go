@@ -0,0 +1,178 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// --- Stage Race Queries (on groupDB) ---
+
+const stageRaceColumns = `id, name, time_bonuses, creator_user_id, created_at`
+
+func scanStageRace(row rowScanner, sr *StageRace) error {
+	var bonuses string
+	if err := row.Scan(&sr.ID, &sr.Name, &bonuses, &sr.CreatorUserID, &sr.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(bonuses), &sr.TimeBonuses)
+}
+
+// CreateStageRace inserts a new stage race without any stages.
+func (s *Service) CreateStageRace(db DBorTx, sr *StageRace) (*StageRace, error) {
+	bonuses, err := json.Marshal(nonNilInts(sr.TimeBonuses))
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO stage_races (name, time_bonuses, creator_user_id) VALUES (?, ?, ?);`
+	res, err := db.Exec(query, sr.Name, string(bonuses), sr.CreatorUserID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetStageRaceByID(db, id)
+}
+
+// GetStageRaceByID returns a single stage race.
+func (s *Service) GetStageRaceByID(db DBorTx, id int64) (*StageRace, error) {
+	query := `SELECT ` + stageRaceColumns + ` FROM stage_races WHERE id = ?;`
+	sr := &StageRace{}
+	if err := scanStageRace(db.QueryRow(query, id), sr); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// GetStageRaces returns all stage races of a group, newest first.
+func (s *Service) GetStageRaces(db DBorTx) ([]*StageRace, error) {
+	query := `SELECT ` + stageRaceColumns + ` FROM stage_races ORDER BY created_at DESC, id DESC;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stageRaces []*StageRace
+	for rows.Next() {
+		sr := &StageRace{}
+		if err := scanStageRace(rows, sr); err != nil {
+			return nil, err
+		}
+		stageRaces = append(stageRaces, sr)
+	}
+	return stageRaces, rows.Err()
+}
+
+// UpdateStageRace saves a stage race's name and time bonuses.
+func (s *Service) UpdateStageRace(db DBorTx, sr *StageRace) error {
+	bonuses, err := json.Marshal(nonNilInts(sr.TimeBonuses))
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`UPDATE stage_races SET name = ?, time_bonuses = ? WHERE id = ?;`, sr.Name, string(bonuses), sr.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("stage race not found")
+	}
+	return nil
+}
+
+// DeleteStageRace deletes a stage race. Its stages remain as ordinary events.
+func (s *Service) DeleteStageRace(db DBorTx, id int64) error {
+	if _, err := db.Exec(`UPDATE events SET stage_race_id = NULL, stage_number = NULL WHERE stage_race_id = ?;`, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM stage_race_riders WHERE stage_race_id = ?;`, id); err != nil {
+		return err
+	}
+	res, err := db.Exec(`DELETE FROM stage_races WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("stage race not found")
+	}
+	return nil
+}
+
+// GetStages returns the events of a stage race in stage order.
+func (s *Service) GetStages(db DBorTx, stageRaceID int64) ([]*Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events WHERE stage_race_id = ? ORDER BY stage_number;`
+	rows, err := db.Query(query, stageRaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		if err := scanEvent(rows, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// SetStages makes the given events the stages of a stage race, numbered in
+// order from 1. Events that were stages before but are not in the list are
+// detached, along with the rider links of their racers.
+func (s *Service) SetStages(db DBorTx, stageRaceID int64, eventIDs []int64) error {
+	if _, err := db.Exec(`UPDATE events SET stage_race_id = NULL, stage_number = NULL WHERE stage_race_id = ?;`, stageRaceID); err != nil {
+		return err
+	}
+	for i, eventID := range eventIDs {
+		if _, err := db.Exec(`UPDATE events SET stage_race_id = ?, stage_number = ? WHERE id = ?;`, stageRaceID, i+1, eventID); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`DELETE FROM stage_race_riders WHERE stage_race_id = ? AND racer_id NOT IN (
+		SELECT r.id FROM racers r JOIN events e ON e.id = r.event_id WHERE e.stage_race_id = ?);`, stageRaceID, stageRaceID)
+	return err
+}
+
+// GetStageRaceRiders returns the rider each linked racer of a stage race is
+// matched to, keyed by racer ID.
+func (s *Service) GetStageRaceRiders(db DBorTx, stageRaceID int64) (map[int64]string, error) {
+	rows, err := db.Query(`SELECT racer_id, rider FROM stage_race_riders WHERE stage_race_id = ?;`, stageRaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	riders := make(map[int64]string)
+	for rows.Next() {
+		var racerID int64
+		var rider string
+		if err := rows.Scan(&racerID, &rider); err != nil {
+			return nil, err
+		}
+		riders[racerID] = rider
+	}
+	return riders, rows.Err()
+}
+
+// SetStageRaceRider links a racer to a rider of a stage race. An empty rider
+// removes the link, so the racer is matched by name again.
+func (s *Service) SetStageRaceRider(db DBorTx, stageRaceID, racerID int64, rider string) error {
+	if rider == "" {
+		_, err := db.Exec(`DELETE FROM stage_race_riders WHERE racer_id = ?;`, racerID)
+		return err
+	}
+	query := `INSERT INTO stage_race_riders (racer_id, stage_race_id, rider) VALUES (?, ?, ?)
+		ON CONFLICT (racer_id) DO UPDATE SET stage_race_id = excluded.stage_race_id, rider = excluded.rider;`
+	_, err := db.Exec(query, racerID, stageRaceID, rider)
+	return err
+}
+
+// nonNilInts returns an empty slice for nil, so that it is stored as "[]".
+func nonNilInts(v []int) []int {
+	if v == nil {
+		return []int{}
+	}
+	return v
+}
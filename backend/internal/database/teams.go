@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// --- Team Queries (on groupDB) ---
+
+const teamColumns = `id, event_id, name, color, created_at`
+
+func scanTeam(row rowScanner, team *Team) error {
+	return row.Scan(&team.ID, &team.EventID, &team.Name, &team.Color, &team.CreatedAt)
+}
+
+// CreateTeam inserts a new team without members.
+func (s *Service) CreateTeam(db DBorTx, eventID int64, name, color string) (*Team, error) {
+	res, err := db.Exec(`INSERT INTO teams (event_id, name, color) VALUES (?, ?, ?);`, eventID, name, color)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetTeamByID(db, id)
+}
+
+// GetTeamByID returns a single team.
+func (s *Service) GetTeamByID(db DBorTx, id int64) (*Team, error) {
+	team := &Team{}
+	if err := scanTeam(db.QueryRow(`SELECT `+teamColumns+` FROM teams WHERE id = ?;`, id), team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// GetTeamsByEventID returns the teams of an event in the order they were created.
+func (s *Service) GetTeamsByEventID(db DBorTx, eventID int64) ([]*Team, error) {
+	rows, err := db.Query(`SELECT `+teamColumns+` FROM teams WHERE event_id = ? ORDER BY id;`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []*Team
+	for rows.Next() {
+		team := &Team{}
+		if err := scanTeam(rows, team); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// UpdateTeam saves a team's name and colour.
+func (s *Service) UpdateTeam(db DBorTx, team *Team) error {
+	res, err := db.Exec(`UPDATE teams SET name = ?, color = ? WHERE id = ?;`, team.Name, team.Color, team.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("team not found")
+	}
+	return nil
+}
+
+// DeleteTeam deletes a team. Its members stay in the event without a team.
+func (s *Service) DeleteTeam(db DBorTx, id int64) error {
+	if _, err := db.Exec(`UPDATE racers SET team_id = NULL, leg = NULL WHERE team_id = ?;`, id); err != nil {
+		return err
+	}
+	res, err := db.Exec(`DELETE FROM teams WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("team not found")
+	}
+	return nil
+}
+
+// SetRacerTeam puts a racer in a team, optionally for a relay leg. A NULL team
+// takes the racer out of their team.
+func (s *Service) SetRacerTeam(db DBorTx, racerID int64, teamID, leg sql.NullInt64) error {
+	res, err := db.Exec(`UPDATE racers SET team_id = ?, leg = ? WHERE id = ?;`, teamID, leg, racerID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("racer not found")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+)
+
+// --- Track File Queries (on groupDB) ---
+
+const trackFileColumns = `id, racer_id, file_path, position, original_name, uploader_user_id, uploaded_at`
+
+func scanTrackFile(row rowScanner, f *TrackFile) error {
+	return row.Scan(&f.ID, &f.RacerID, &f.FilePath, &f.Position, &f.OriginalName, &f.UploaderUserID, &f.UploadedAt)
+}
+
+// AddTrackFile appends a file to the end of a racer's track.
+func (s *Service) AddTrackFile(db DBorTx, racerID, uploaderID int64, filePath, originalName string) (*TrackFile, error) {
+	query := `INSERT INTO track_files (racer_id, file_path, position, original_name, uploader_user_id)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM track_files WHERE racer_id = ?), ?, ?);`
+	res, err := db.Exec(query, racerID, filePath, racerID, originalName, uploaderID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return s.GetTrackFileByID(db, id)
+}
+
+// GetTrackFileByID returns a single track file.
+func (s *Service) GetTrackFileByID(db DBorTx, id int64) (*TrackFile, error) {
+	query := `SELECT ` + trackFileColumns + ` FROM track_files WHERE id = ?;`
+	f := &TrackFile{}
+	if err := scanTrackFile(db.QueryRow(query, id), f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GetTrackFilesByRacerID returns a racer's track files in track order.
+func (s *Service) GetTrackFilesByRacerID(db DBorTx, racerID int64) ([]*TrackFile, error) {
+	query := `SELECT ` + trackFileColumns + ` FROM track_files WHERE racer_id = ? ORDER BY position, id;`
+	return s.queryTrackFiles(db, query, racerID)
+}
+
+// GetTrackFilesByEventID returns the track files of all of an event's racers.
+func (s *Service) GetTrackFilesByEventID(db DBorTx, eventID int64) ([]*TrackFile, error) {
+	query := `SELECT ` + trackFileColumns + ` FROM track_files
+		WHERE racer_id IN (SELECT id FROM racers WHERE event_id = ?) ORDER BY racer_id, position, id;`
+	return s.queryTrackFiles(db, query, eventID)
+}
+
+func (s *Service) queryTrackFiles(db DBorTx, query string, args ...any) ([]*TrackFile, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*TrackFile
+	for rows.Next() {
+		f := &TrackFile{}
+		if err := scanTrackFile(rows, f); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// DeleteTrackFile removes a file from a racer's track. The files after it keep
+// their order.
+func (s *Service) DeleteTrackFile(db DBorTx, id int64) error {
+	res, err := db.Exec(`DELETE FROM track_files WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("track file not found or already deleted")
+	}
+	return nil
+}
+
+// ReorderTrackFiles puts a racer's track files in the order of fileIDs, which
+// should list each of them once.
+func (s *Service) ReorderTrackFiles(db DBorTx, racerID int64, fileIDs []int64) error {
+	for position, id := range fileIDs {
+		if _, err := db.Exec(`UPDATE track_files SET position = ? WHERE id = ? AND racer_id = ?;`, position, id, racerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUploadLinkUsed is returned when a guest upload link has already been used
+// or has expired.
+var ErrUploadLinkUsed = errors.New("upload link has already been used or has expired")
+
+// --- Upload Link Queries (on mainDB) ---
+
+const uploadLinkColumns = `token, group_id, event_id, racer_id, created_by, expires_at, used_at, created_at`
+
+func scanUploadLink(row rowScanner, l *UploadLink) error {
+	return row.Scan(&l.Token, &l.GroupID, &l.EventID, &l.RacerID, &l.CreatedBy, &l.ExpiresAt, &l.UsedAt, &l.CreatedAt)
+}
+
+// CreateUploadLink stores a new guest upload link.
+func (s *Service) CreateUploadLink(db DBorTx, link *UploadLink) error {
+	query := `INSERT INTO upload_links (token, group_id, event_id, racer_id, created_by, expires_at) VALUES (?, ?, ?, ?, ?, ?);`
+	_, err := db.Exec(query, link.Token, link.GroupID, link.EventID, link.RacerID, link.CreatedBy, link.ExpiresAt.UTC())
+	return err
+}
+
+// GetUploadLink looks up a guest upload link. It returns sql.ErrNoRows if the
+// token is unknown.
+func (s *Service) GetUploadLink(db DBorTx, token string) (*UploadLink, error) {
+	l := &UploadLink{}
+	if err := scanUploadLink(db.QueryRow(`SELECT `+uploadLinkColumns+` FROM upload_links WHERE token = ?;`, token), l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetUploadLinksForRacer returns the guest upload links issued for a racer, newest first.
+func (s *Service) GetUploadLinksForRacer(db DBorTx, groupID, racerID int64) ([]*UploadLink, error) {
+	rows, err := db.Query(`SELECT `+uploadLinkColumns+` FROM upload_links WHERE group_id = ? AND racer_id = ? ORDER BY created_at DESC, expires_at DESC;`, groupID, racerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []*UploadLink
+	for rows.Next() {
+		l := &UploadLink{}
+		if err := scanUploadLink(rows, l); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// UseUploadLink marks a guest upload link as used, so that it can't be used
+// again. It returns ErrUploadLinkUsed if the link was used or expired first.
+func (s *Service) UseUploadLink(db DBorTx, token string, now time.Time) error {
+	res, err := db.Exec(`UPDATE upload_links SET used_at = ? WHERE token = ? AND used_at IS NULL AND expires_at > ?;`, now.UTC(), token, now.UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUploadLinkUsed
+	}
+	return nil
+}
+
+// ReleaseUploadLink makes a used guest upload link usable again, e.g. when the
+// upload it was used for could not be saved.
+func (s *Service) ReleaseUploadLink(db DBorTx, token string) error {
+	_, err := db.Exec(`UPDATE upload_links SET used_at = NULL WHERE token = ?;`, token)
+	return err
+}
+
+// DeleteUploadLink revokes a guest upload link.
+func (s *Service) DeleteUploadLink(db DBorTx, token string) error {
+	res, err := db.Exec(`DELETE FROM upload_links WHERE token = ?;`, token)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUploadLinksForRacer revokes the guest upload links of a racer.
+func (s *Service) DeleteUploadLinksForRacer(db DBorTx, groupID, racerID int64) error {
+	_, err := db.Exec(`DELETE FROM upload_links WHERE group_id = ? AND racer_id = ?;`, groupID, racerID)
+	return err
+}
+
+// DeleteUploadLinksForEvent revokes the guest upload links of all racers in an event.
+func (s *Service) DeleteUploadLinksForEvent(db DBorTx, groupID, eventID int64) error {
+	_, err := db.Exec(`DELETE FROM upload_links WHERE group_id = ? AND event_id = ?;`, groupID, eventID)
+	return err
+}
@@ -0,0 +1,98 @@
+package dem
+
+import (
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Elevation modes for an event. They control how recorded elevations are combined
+// with DEM-derived elevations when tracks are processed.
+const (
+	// ModeGPS keeps the elevations recorded by each device (the default).
+	ModeGPS = "gps"
+	// ModeReplace discards recorded elevations and uses the DEM for every point.
+	ModeReplace = "dem"
+	// ModeBlend keeps the short-term detail of the recorded elevations but removes
+	// each device's slowly varying offset from the terrain model (barometric drift,
+	// calibration errors), anchoring every track to the same DEM.
+	ModeBlend = "blend"
+)
+
+// blendWindow is the number of points on either side used to estimate a device's
+// offset from the DEM in ModeBlend.
+const blendWindow = 60
+
+// ValidMode reports whether mode is a recognised elevation mode.
+func ValidMode(mode string) bool {
+	return mode == ModeGPS || mode == ModeReplace || mode == ModeBlend
+}
+
+// Apply corrects the elevations of a track in place according to mode and
+// recalculates its climbing statistics. Points that no DEM tile covers keep their
+// recorded elevation.
+func (s *Source) Apply(path *gpx.TrackPath, mode string) {
+	if path == nil || len(path.Points) == 0 || mode == ModeGPS || mode == "" {
+		return
+	}
+
+	demEle := make([]float64, len(path.Points))
+	hasDem := make([]bool, len(path.Points))
+	for i, p := range path.Points {
+		demEle[i], hasDem[i] = s.Elevation(p.Lat, p.Lon)
+	}
+
+	switch mode {
+	case ModeReplace:
+		for i := range path.Points {
+			if hasDem[i] {
+				ele := demEle[i]
+				path.Points[i].Ele = &ele
+			}
+		}
+
+	case ModeBlend:
+		// Offset between the device and the DEM at every point where both exist.
+		offsets := make([]float64, len(path.Points))
+		hasOffset := make([]bool, len(path.Points))
+		for i, p := range path.Points {
+			if hasDem[i] && p.Ele != nil {
+				offsets[i], hasOffset[i] = *p.Ele-demEle[i], true
+			}
+		}
+
+		// Smooth the offset with a moving average so only slow drift is removed.
+		// A running sum keeps this linear in the number of points.
+		var sum float64
+		var count int
+		lo, hi := 0, -1
+		for i := range path.Points {
+			for hi < i+blendWindow && hi < len(path.Points)-1 {
+				hi++
+				if hasOffset[hi] {
+					sum += offsets[hi]
+					count++
+				}
+			}
+			for lo < i-blendWindow {
+				if hasOffset[lo] {
+					sum -= offsets[lo]
+					count--
+				}
+				lo++
+			}
+
+			switch {
+			case !hasDem[i]:
+				// Keep the recorded value where the terrain model has no data.
+			case path.Points[i].Ele != nil && count > 0:
+				ele := *path.Points[i].Ele - sum/float64(count)
+				path.Points[i].Ele = &ele
+			default:
+				ele := demEle[i]
+				path.Points[i].Ele = &ele
+			}
+		}
+	}
+
+	path.ElevationSource = mode
+	path.CalculateElevationStats()
+}
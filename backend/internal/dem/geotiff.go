@@ -0,0 +1,369 @@
+package dem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags used when reading DEM GeoTIFFs.
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagGeoKeyDirectory = 34735
+	tagGDALNoData      = 42113
+)
+
+// GeoKeys used to check the raster is in geographic coordinates.
+const (
+	geoKeyModelType  = 1024 // 2 = geographic (lat/lon)
+	geoKeyRasterType = 1025 // 1 = PixelIsArea, 2 = PixelIsPoint
+)
+
+// Sample formats (TIFF tag 339).
+const (
+	sampleFormatUint  = 1
+	sampleFormatInt   = 2
+	sampleFormatFloat = 3
+)
+
+// tiffEntry is a decoded IFD entry. Numeric values are widened to float64/uint64.
+type tiffEntry struct {
+	ints   []uint64
+	floats []float64
+	ascii  string
+}
+
+// geoTIFF holds the parsed first image directory of a TIFF file.
+type geoTIFF struct {
+	order   binary.ByteOrder
+	entries map[uint16]tiffEntry
+}
+
+// readGeoTIFFBounds reads only the header of a GeoTIFF and returns the
+// area it covers as [minLat, minLon, maxLat, maxLon].
+func readGeoTIFFBounds(path string) ([4]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return [4]float64{}, err
+	}
+	defer f.Close()
+
+	gt, err := parseTIFF(f)
+	if err != nil {
+		return [4]float64{}, err
+	}
+	t, err := gt.grid()
+	if err != nil {
+		return [4]float64{}, err
+	}
+
+	return [4]float64{
+		t.originLat - (float64(t.height)-0.5)*t.stepLat,
+		t.originLon - 0.5*t.stepLon,
+		t.originLat + 0.5*t.stepLat,
+		t.originLon + (float64(t.width)-0.5)*t.stepLon,
+	}, nil
+}
+
+// loadGeoTIFF reads a single-band GeoTIFF in geographic coordinates. Uncompressed
+// and Deflate-compressed rasters, in strips or tiles, with 16/32-bit integer or
+// 32/64-bit float samples are supported.
+func loadGeoTIFF(path string) (*tile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+
+	gt, err := parseTIFF(r)
+	if err != nil {
+		return nil, err
+	}
+	t, err := gt.grid()
+	if err != nil {
+		return nil, err
+	}
+
+	if spp := gt.int(tagSamplesPerPixel, 1); spp != 1 {
+		return nil, fmt.Errorf("expected a single band, found %d samples per pixel", spp)
+	}
+	bits := int(gt.int(tagBitsPerSample, 1))
+	format := gt.int(tagSampleFormat, sampleFormatUint)
+	compression := gt.int(tagCompression, 1)
+	predictor := gt.int(tagPredictor, 1)
+
+	if compression != 1 && compression != 8 && compression != 32946 {
+		return nil, fmt.Errorf("unsupported compression %d", compression)
+	}
+	if predictor != 1 && !(predictor == 2 && format != sampleFormatFloat) {
+		return nil, fmt.Errorf("unsupported predictor %d", predictor)
+	}
+	decode, err := sampleDecoder(gt.order, bits, format)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := bits / 8
+
+	// Strips are treated as tiles that span the full image width.
+	blockWidth, blockHeight := t.width, int(gt.int(tagRowsPerStrip, uint64(t.height)))
+	offsets, counts := gt.entries[tagStripOffsets].ints, gt.entries[tagStripByteCounts].ints
+	if _, tiled := gt.entries[tagTileOffsets]; tiled {
+		blockWidth, blockHeight = int(gt.int(tagTileWidth, 0)), int(gt.int(tagTileLength, 0))
+		offsets, counts = gt.entries[tagTileOffsets].ints, gt.entries[tagTileByteCounts].ints
+	}
+	if blockWidth <= 0 || blockHeight <= 0 || len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, errors.New("missing or inconsistent strip/tile layout")
+	}
+	blocksAcross := (t.width + blockWidth - 1) / blockWidth
+
+	t.samples = make([]float32, t.width*t.height)
+	for i := range t.samples {
+		t.samples[i] = float32(math.NaN())
+	}
+
+	for b, offset := range offsets {
+		if offset+counts[b] > uint64(len(data)) {
+			return nil, fmt.Errorf("block %d extends beyond end of file", b)
+		}
+		raw := data[offset : offset+counts[b]]
+		if compression != 1 {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", b, err)
+			}
+			raw, err = io.ReadAll(zr)
+			zr.Close()
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", b, err)
+			}
+		}
+
+		originRow, originCol := (b/blocksAcross)*blockHeight, (b%blocksAcross)*blockWidth
+		for y := 0; y < blockHeight; y++ {
+			row := originRow + y
+			var prev float64
+			for x := 0; x < blockWidth; x++ {
+				idx := (y*blockWidth + x) * bytesPerSample
+				if idx+bytesPerSample > len(raw) {
+					break
+				}
+				v := decode(raw[idx:])
+				if predictor == 2 {
+					// Horizontal differencing: each sample stores the delta to its left neighbour.
+					if x > 0 {
+						v += prev
+					}
+					prev = v
+				}
+				col := originCol + x
+				if row < t.height && col < t.width {
+					t.samples[row*t.width+col] = float32(v)
+				}
+			}
+		}
+	}
+
+	if nd, ok := gt.entries[tagGDALNoData]; ok {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimRight(nd.ascii, "\x00")), 64); err == nil {
+			t.noData, t.hasNoData = float32(v), true
+		}
+	}
+	return t, nil
+}
+
+// grid derives the sample grid (without samples) from the GeoTIFF tags.
+func (gt *geoTIFF) grid() (*tile, error) {
+	width, height := int(gt.int(tagImageWidth, 0)), int(gt.int(tagImageLength, 0))
+	if width == 0 || height == 0 {
+		return nil, errors.New("missing image dimensions")
+	}
+
+	scale := gt.entries[tagModelPixelScale].floats
+	tie := gt.entries[tagModelTiepoint].floats
+	if len(scale) < 2 || len(tie) < 6 || scale[0] <= 0 || scale[1] <= 0 {
+		return nil, errors.New("missing ModelPixelScale or ModelTiepoint (only north-up GeoTIFFs are supported)")
+	}
+
+	modelType, rasterType := uint64(0), uint64(1)
+	if keys := gt.entries[tagGeoKeyDirectory].ints; len(keys) >= 4 {
+		for i := 4; i+3 < len(keys); i += 4 {
+			// Only keys stored directly in the directory (location 0) are needed here.
+			if keys[i+1] != 0 {
+				continue
+			}
+			switch keys[i] {
+			case geoKeyModelType:
+				modelType = keys[i+3]
+			case geoKeyRasterType:
+				rasterType = keys[i+3]
+			}
+		}
+	}
+	if modelType != 0 && modelType != 2 {
+		return nil, errors.New("only GeoTIFFs in geographic (lat/lon) coordinates are supported")
+	}
+
+	// The tie point maps raster position (I, J) to (lon, lat). For PixelIsArea
+	// rasters it refers to the corner of a pixel, so shift by half a pixel to get
+	// the sample centre.
+	i, j, lon, lat := tie[0], tie[1], tie[3], tie[4]
+	if rasterType == 1 {
+		i, j = i-0.5, j-0.5
+	}
+
+	return &tile{
+		originLat: lat + j*scale[1],
+		originLon: lon - i*scale[0],
+		stepLat:   scale[1],
+		stepLon:   scale[0],
+		width:     width,
+		height:    height,
+	}, nil
+}
+
+// int returns the first integer value of a tag, or def if the tag is absent.
+func (gt *geoTIFF) int(tag uint16, def uint64) uint64 {
+	if e, ok := gt.entries[tag]; ok && len(e.ints) > 0 {
+		return e.ints[0]
+	}
+	return def
+}
+
+// sampleDecoder returns a function that decodes one sample of the given format.
+func sampleDecoder(order binary.ByteOrder, bits int, format uint64) (func([]byte) float64, error) {
+	switch {
+	case bits == 16 && format == sampleFormatInt:
+		return func(b []byte) float64 { return float64(int16(order.Uint16(b))) }, nil
+	case bits == 16 && format == sampleFormatUint:
+		return func(b []byte) float64 { return float64(order.Uint16(b)) }, nil
+	case bits == 32 && format == sampleFormatInt:
+		return func(b []byte) float64 { return float64(int32(order.Uint32(b))) }, nil
+	case bits == 32 && format == sampleFormatUint:
+		return func(b []byte) float64 { return float64(order.Uint32(b)) }, nil
+	case bits == 32 && format == sampleFormatFloat:
+		return func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) }, nil
+	case bits == 64 && format == sampleFormatFloat:
+		return func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sample type: %d-bit format %d", bits, format)
+}
+
+// parseTIFF reads the header and first image file directory of a classic TIFF.
+func parseTIFF(r io.ReaderAt) (*geoTIFF, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("could not read TIFF header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+	if order.Uint16(header[2:]) != 42 {
+		return nil, errors.New("unsupported TIFF variant (BigTIFF is not supported)")
+	}
+
+	ifdOffset := int64(order.Uint32(header[4:]))
+	countBuf := make([]byte, 2)
+	if _, err := r.ReadAt(countBuf, ifdOffset); err != nil {
+		return nil, fmt.Errorf("could not read image directory: %w", err)
+	}
+	count := int(order.Uint16(countBuf))
+
+	entryBuf := make([]byte, 12*count)
+	if _, err := r.ReadAt(entryBuf, ifdOffset+2); err != nil {
+		return nil, fmt.Errorf("could not read image directory: %w", err)
+	}
+
+	gt := &geoTIFF{order: order, entries: make(map[uint16]tiffEntry, count)}
+	for i := 0; i < count; i++ {
+		raw := entryBuf[i*12 : (i+1)*12]
+		tag, typ, n := order.Uint16(raw), order.Uint16(raw[2:]), int(order.Uint32(raw[4:]))
+
+		size := tiffTypeSize(typ)
+		if size == 0 || n <= 0 || n > 1<<24 {
+			continue // Unknown type or implausible count; not needed for DEM data.
+		}
+
+		// Values that fit in 4 bytes are stored inline; larger ones are at an offset.
+		value := raw[8:12]
+		if size*n > 4 {
+			value = make([]byte, size*n)
+			if _, err := r.ReadAt(value, int64(order.Uint32(raw[8:]))); err != nil {
+				return nil, fmt.Errorf("could not read tag %d: %w", tag, err)
+			}
+		}
+		gt.entries[tag] = decodeTIFFValues(order, typ, n, value)
+	}
+	return gt, nil
+}
+
+// tiffTypeSize returns the size in bytes of a TIFF field type, or 0 if unsupported.
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+// decodeTIFFValues converts the raw bytes of an IFD entry into a tiffEntry.
+func decodeTIFFValues(order binary.ByteOrder, typ uint16, n int, b []byte) tiffEntry {
+	var e tiffEntry
+	for i := 0; i < n; i++ {
+		switch typ {
+		case 1, 6, 7:
+			e.ints = append(e.ints, uint64(b[i]))
+		case 2:
+			e.ascii = string(b[:n])
+			return e
+		case 3, 8:
+			e.ints = append(e.ints, uint64(order.Uint16(b[i*2:])))
+		case 4, 9:
+			e.ints = append(e.ints, uint64(order.Uint32(b[i*4:])))
+		case 11:
+			e.floats = append(e.floats, float64(math.Float32frombits(order.Uint32(b[i*4:]))))
+		case 12:
+			e.floats = append(e.floats, math.Float64frombits(order.Uint64(b[i*8:])))
+		case 5, 10:
+			num, den := order.Uint32(b[i*8:]), order.Uint32(b[i*8+4:])
+			if den != 0 {
+				e.floats = append(e.floats, float64(num)/float64(den))
+			}
+		}
+	}
+	return e
+}
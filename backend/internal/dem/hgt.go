@@ -0,0 +1,99 @@
+package dem
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hgtVoid marks missing samples in SRTM data.
+const hgtVoid = -32768
+
+// hgtName returns the SRTM tile name (e.g. "N37W122") of the 1x1 degree tile
+// containing a coordinate. Tiles are named after their south-west corner.
+func hgtName(lat, lon float64) string {
+	latFloor, lonFloor := int(math.Floor(lat)), int(math.Floor(lon))
+
+	ns, ew := "N", "E"
+	if latFloor < 0 {
+		ns, latFloor = "S", -latFloor
+	}
+	if lonFloor < 0 {
+		ew, lonFloor = "W", -lonFloor
+	}
+	return fmt.Sprintf("%s%02d%s%03d", ns, latFloor, ew, lonFloor)
+}
+
+// parseHGTName extracts the south-west corner from an SRTM tile name.
+func parseHGTName(name string) (lat, lon int, ok bool) {
+	if len(name) != 7 {
+		return 0, 0, false
+	}
+	lat, err := strconv.Atoi(name[1:3])
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err = strconv.Atoi(name[4:7])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	switch name[0] {
+	case 'N':
+	case 'S':
+		lat = -lat
+	default:
+		return 0, 0, false
+	}
+	switch name[3] {
+	case 'E':
+	case 'W':
+		lon = -lon
+	default:
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// loadHGT reads an SRTM `.hgt` tile: a square grid of big-endian signed 16-bit
+// elevations, 1201x1201 (3 arc-second) or 3601x3601 (1 arc-second) samples,
+// with the outer rows and columns overlapping the neighbouring tiles.
+func loadHGT(path string) (*tile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(math.Sqrt(float64(len(data) / 2)))
+	if size < 2 || size*size*2 != len(data) {
+		return nil, fmt.Errorf("unexpected .hgt file size %d", len(data))
+	}
+
+	name := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	lat, lon, ok := parseHGTName(name)
+	if !ok {
+		return nil, fmt.Errorf("unrecognised SRTM tile name %q", name)
+	}
+
+	samples := make([]float32, size*size)
+	for i := range samples {
+		samples[i] = float32(int16(binary.BigEndian.Uint16(data[i*2:])))
+	}
+
+	step := 1 / float64(size-1)
+	return &tile{
+		originLat: float64(lat + 1),
+		originLon: float64(lon),
+		stepLat:   step,
+		stepLon:   step,
+		width:     size,
+		height:    size,
+		samples:   samples,
+		noData:    hgtVoid,
+		hasNoData: true,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package dem
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tile is a loaded elevation grid covering a rectangular area.
+// Row 0 is the northern edge and column 0 the western edge.
+type tile struct {
+	// Coordinates of the centre of the top-left sample and the spacing between samples, in degrees.
+	originLat, originLon float64
+	stepLat, stepLon     float64
+	width, height        int
+	samples              []float32
+	noData               float32
+	hasNoData            bool
+}
+
+// tileSource describes a tile file on disk whose data is loaded on first use.
+type tileSource struct {
+	path   string
+	bounds [4]float64 // minLat, minLon, maxLat, maxLon
+	load   func(path string) (*tile, error)
+
+	once sync.Once
+	tile *tile
+	err  error
+}
+
+// Source provides elevation lookups from a directory of DEM tiles. SRTM `.hgt`
+// files and single-band GeoTIFF files are supported; tiles are indexed at startup
+// and their samples are loaded lazily the first time a point falls inside them.
+type Source struct {
+	hgt     map[string]*tileSource // Keyed by the SRTM tile name, e.g. "N37W122"
+	geoTiff []*tileSource
+}
+
+// Open indexes all DEM tiles found (recursively) in a directory.
+func Open(dir string) (*Source, error) {
+	src := &Source{hgt: make(map[string]*tileSource)}
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".hgt":
+			name := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+			if _, _, ok := parseHGTName(name); !ok {
+				log.Printf("WARN: skipping DEM file with unrecognised SRTM name: %s", path)
+				return nil
+			}
+			src.hgt[name] = &tileSource{path: path, load: loadHGT}
+		case ".tif", ".tiff":
+			bounds, err := readGeoTIFFBounds(path)
+			if err != nil {
+				log.Printf("WARN: skipping unreadable GeoTIFF DEM tile %s: %v", path, err)
+				return nil
+			}
+			src.geoTiff = append(src.geoTiff, &tileSource{path: path, bounds: bounds, load: loadGeoTIFF})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not scan DEM directory %s: %w", dir, err)
+	}
+	if src.TileCount() == 0 {
+		return nil, fmt.Errorf("no .hgt or GeoTIFF tiles found in %s", dir)
+	}
+	return src, nil
+}
+
+// TileCount returns the number of indexed tiles.
+func (s *Source) TileCount() int {
+	return len(s.hgt) + len(s.geoTiff)
+}
+
+// Elevation returns the terrain elevation in meters at a coordinate, using bilinear
+// interpolation between samples. The second return value is false if no tile
+// covers the coordinate or the tile has no data there.
+func (s *Source) Elevation(lat, lon float64) (float64, bool) {
+	if ts, ok := s.hgt[hgtName(lat, lon)]; ok {
+		if t := ts.get(); t != nil {
+			if v, ok := t.interpolate(lat, lon); ok {
+				return v, true
+			}
+		}
+	}
+
+	for _, ts := range s.geoTiff {
+		if lat < ts.bounds[0] || lon < ts.bounds[1] || lat > ts.bounds[2] || lon > ts.bounds[3] {
+			continue
+		}
+		if t := ts.get(); t != nil {
+			if v, ok := t.interpolate(lat, lon); ok {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// get loads the tile on first use. Load failures are logged once and the tile is
+// treated as missing from then on.
+func (ts *tileSource) get() *tile {
+	ts.once.Do(func() {
+		ts.tile, ts.err = ts.load(ts.path)
+		if ts.err != nil {
+			log.Printf("WARN: could not load DEM tile %s: %v", ts.path, ts.err)
+		}
+	})
+	return ts.tile
+}
+
+// sample returns the value at a grid position, or false for out-of-range or no-data samples.
+func (t *tile) sample(row, col int) (float64, bool) {
+	if row < 0 || col < 0 || row >= t.height || col >= t.width {
+		return 0, false
+	}
+	v := t.samples[row*t.width+col]
+	if (t.hasNoData && v == t.noData) || math.IsNaN(float64(v)) {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// interpolate performs bilinear interpolation between the four samples surrounding
+// a coordinate. If some of them are missing, the average of the remaining ones is used.
+func (t *tile) interpolate(lat, lon float64) (float64, bool) {
+	y := (t.originLat - lat) / t.stepLat
+	x := (lon - t.originLon) / t.stepLon
+	if y < -0.5 || x < -0.5 || y > float64(t.height)-0.5 || x > float64(t.width)-0.5 {
+		return 0, false
+	}
+
+	row, col := int(math.Floor(y)), int(math.Floor(x))
+	fy, fx := y-float64(row), x-float64(col)
+
+	var sum, weightSum float64
+	for _, c := range []struct {
+		dr, dc int
+		w      float64
+	}{
+		{0, 0, (1 - fy) * (1 - fx)},
+		{0, 1, (1 - fy) * fx},
+		{1, 0, fy * (1 - fx)},
+		{1, 1, fy * fx},
+	} {
+		if v, ok := t.sample(row+c.dr, col+c.dc); ok {
+			sum += v * c.w
+			weightSum += c.w
+		}
+	}
+	if weightSum == 0 {
+		return 0, false
+	}
+	return sum / weightSum, true
+}
@@ -63,3 +63,58 @@ func (s *EmailService) SendInvitationEmail(recipientEmail, inviterName, groupNam
 
 	return nil
 }
+
+// SendSafetyAlertEmail notifies an event owner that one of their racers may need help.
+func (s *EmailService) SendSafetyAlertEmail(recipientEmail, eventName, racerName, alert, eventLink string) error {
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+
+	subject := fmt.Sprintf("Safety alert for %s in '%s'", racerName, eventName)
+
+	body := fmt.Sprintf(
+		"Hi there,\n\nRaceViz has raised a safety alert during your live event '%s':\n\n%s\n\nOpen the event to see the racer's last known position and to acknowledge or resolve the alert:\n%s\n\nThe RaceViz Team",
+		eventName,
+		alert,
+		eventLink,
+	)
+
+	message := []byte(
+		"To: " + recipientEmail + "\r\n" +
+			"From: " + s.config.Sender + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"\r\n" +
+			body + "\r\n")
+
+	err := smtp.SendMail(addr, s.auth, s.config.Sender, []string{recipientEmail}, message)
+	if err != nil {
+		return fmt.Errorf("smtp error: %w", err)
+	}
+
+	return nil
+}
+
+// SendRegistrationEmail tells a member that their registration for an event has changed.
+func (s *EmailService) SendRegistrationEmail(recipientEmail, eventName, update, eventLink string) error {
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+
+	subject := fmt.Sprintf("Your registration for '%s'", eventName)
+
+	body := fmt.Sprintf(
+		"Hi there,\n\n%s\n\nOpen the event to see your registration:\n%s\n\nSee you on the track!\nThe RaceViz Team",
+		update,
+		eventLink,
+	)
+
+	message := []byte(
+		"To: " + recipientEmail + "\r\n" +
+			"From: " + s.config.Sender + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"\r\n" +
+			body + "\r\n")
+
+	err := smtp.SendMail(addr, s.auth, s.config.Sender, []string{recipientEmail}, message)
+	if err != nil {
+		return fmt.Errorf("smtp error: %w", err)
+	}
+
+	return nil
+}
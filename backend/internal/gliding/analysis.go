@@ -0,0 +1,205 @@
+// Package gliding analyses the climbs and glides of unpowered flights.
+package gliding
+
+import (
+	"math"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/sport"
+)
+
+const (
+	// varioWindow is the time (in seconds) either side of a point over which its
+	// climb rate is averaged, like the integrator of a glider's variometer.
+	varioWindow = 10.0
+	// A thermal is a stretch of climbing at minThermalClimb (m/s) or better,
+	// lasting at least minThermalDuration seconds and gaining at least
+	// minThermalGain meters. Climbs separated by less than maxThermalGap
+	// seconds, such as when leaving and re-centring a thermal, are merged.
+	minThermalClimb    = 0.3
+	minThermalDuration = 40.0
+	minThermalGain     = 20.0
+	maxThermalGap      = 20.0
+)
+
+// Thermal is a single climb.
+type Thermal struct {
+	StartIndex int       `json:"startIndex"`
+	EndIndex   int       `json:"endIndex"`
+	Timestamp  time.Time `json:"timestamp"`
+	Duration   float64   `json:"duration"` // Seconds
+	Gain       float64   `json:"gain"`     // Meters
+	AvgClimb   float64   `json:"avgClimb"` // m/s
+	Lat        float64   `json:"lat"`      // Centre of the climb
+	Lon        float64   `json:"lon"`
+}
+
+// Stats holds the gliding analysis of a single track.
+type Stats struct {
+	RacerID     int64     `json:"racerId"`
+	MaxAltitude float64   `json:"maxAltitude"` // Meters
+	MaxClimb    float64   `json:"maxClimb"`    // Best averaged climb rate, m/s
+	AvgClimb    float64   `json:"avgClimb"`    // Average climb rate in thermals, m/s
+	ThermalTime float64   `json:"thermalTime"` // Seconds spent climbing in thermals
+	Thermals    []Thermal `json:"thermals"`
+
+	// GlideRatio is the distance flown outside thermals divided by the height
+	// lost doing so. It is nil if no height was lost between thermals.
+	GlideRatio *float64 `json:"glideRatio"`
+}
+
+// Analyze detects the thermals in a track and measures the climb rates, glide
+// ratio and maximum altitude. The results are also stored in the track's
+// Metrics map. It returns nil if the track has no altitudes.
+func Analyze(path *gpx.TrackPath) *Stats {
+	if path == nil || len(path.Points) < 2 {
+		return nil
+	}
+	points := path.Points
+	for i := range points {
+		if points[i].Ele == nil {
+			return nil
+		}
+	}
+
+	stats := &Stats{RacerID: path.RacerID, Thermals: []Thermal{}, MaxAltitude: math.Inf(-1)}
+	for i := range points {
+		stats.MaxAltitude = math.Max(stats.MaxAltitude, *points[i].Ele)
+	}
+
+	rates := climbRates(points)
+	for _, r := range rates {
+		stats.MaxClimb = math.Max(stats.MaxClimb, r)
+	}
+	detectThermals(points, rates, stats)
+	measureGlides(points, stats)
+
+	if path.Metrics == nil {
+		path.Metrics = make(map[string]float64)
+	}
+	path.Metrics[sport.MetricMaxAltitude] = stats.MaxAltitude
+	path.Metrics[sport.MetricMaxClimb] = stats.MaxClimb
+	path.Metrics[sport.MetricAvgClimb] = stats.AvgClimb
+	path.Metrics[sport.MetricThermals] = float64(len(stats.Thermals))
+	path.Metrics[sport.MetricThermalTime] = stats.ThermalTime
+	if stats.GlideRatio != nil {
+		path.Metrics[sport.MetricGlideRatio] = *stats.GlideRatio
+	}
+	return stats
+}
+
+// climbRates returns the climb rate at every point, averaged over the points
+// within varioWindow seconds of it.
+func climbRates(points []gpx.TrackPoint) []float64 {
+	rates := make([]float64, len(points))
+	lo, hi := 0, 0
+	for i := range points {
+		t := points[i].Timestamp
+		for lo < i && t.Sub(points[lo].Timestamp).Seconds() > varioWindow {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi < len(points)-1 && points[hi+1].Timestamp.Sub(t).Seconds() <= varioWindow {
+			hi++
+		}
+		a, b := lo, hi
+		if a == b {
+			// Sparse track: fall back to the neighbouring points.
+			if a > 0 {
+				a--
+			}
+			if b < len(points)-1 {
+				b++
+			}
+		}
+		if dt := points[b].Timestamp.Sub(points[a].Timestamp).Seconds(); dt > 0 {
+			rates[i] = (*points[b].Ele - *points[a].Ele) / dt
+		}
+	}
+	return rates
+}
+
+// detectThermals finds the runs of climbing that are long and high enough to
+// be thermals.
+func detectThermals(points []gpx.TrackPoint, rates []float64, stats *Stats) {
+	var climbGain float64
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		duration := points[end].Timestamp.Sub(points[start].Timestamp).Seconds()
+		gain := *points[end].Ele - *points[start].Ele
+		if duration >= minThermalDuration && gain >= minThermalGain {
+			th := Thermal{
+				StartIndex: start,
+				EndIndex:   end,
+				Timestamp:  points[start].Timestamp,
+				Duration:   duration,
+				Gain:       gain,
+				AvgClimb:   gain / duration,
+			}
+			for j := start; j <= end; j++ {
+				th.Lat += points[j].Lat
+				th.Lon += points[j].Lon
+			}
+			n := float64(end - start + 1)
+			th.Lat /= n
+			th.Lon /= n
+			stats.Thermals = append(stats.Thermals, th)
+			stats.ThermalTime += duration
+			climbGain += gain
+		}
+		start, end = -1, -1
+	}
+
+	for i, r := range rates {
+		if r < minThermalClimb {
+			continue
+		}
+		if start >= 0 && points[i].Timestamp.Sub(points[end].Timestamp).Seconds() > maxThermalGap {
+			flush()
+		}
+		if start < 0 {
+			start = i
+		}
+		end = i
+	}
+	flush()
+
+	if stats.ThermalTime > 0 {
+		stats.AvgClimb = climbGain / stats.ThermalTime
+	}
+}
+
+// measureGlides computes the glide ratio over the parts of the track outside
+// thermals.
+func measureGlides(points []gpx.TrackPoint, stats *Stats) {
+	var distance, lost float64
+	glide := func(from, to int) {
+		if to <= from {
+			return
+		}
+		drop := *points[from].Ele - *points[to].Ele
+		if drop <= 0 {
+			return
+		}
+		distance += gpx.PathDistance(points[from : to+1])
+		lost += drop
+	}
+
+	from := 0
+	for _, th := range stats.Thermals {
+		glide(from, th.StartIndex)
+		from = th.EndIndex
+	}
+	glide(from, len(points)-1)
+
+	if lost > 0 {
+		ratio := distance / lost
+		stats.GlideRatio = &ratio
+	}
+}
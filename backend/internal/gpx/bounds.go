@@ -0,0 +1,93 @@
+package gpx
+
+import "math"
+
+// metersPerDegreeLat is the approximate length of one degree of latitude.
+const metersPerDegreeLat = 111320.0
+
+// Bounds is a latitude/longitude bounding box.
+type Bounds struct {
+	MinLat float64 `json:"minLat"`
+	MinLon float64 `json:"minLon"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLon float64 `json:"maxLon"`
+}
+
+// Bounds calculates the bounding box of all points in the track.
+// The second return value is false if the track has no points.
+func (t *TrackPath) Bounds() (Bounds, bool) {
+	if len(t.Points) == 0 {
+		return Bounds{}, false
+	}
+
+	b := Bounds{
+		MinLat: t.Points[0].Lat,
+		MinLon: t.Points[0].Lon,
+		MaxLat: t.Points[0].Lat,
+		MaxLon: t.Points[0].Lon,
+	}
+	for _, p := range t.Points[1:] {
+		b.MinLat = math.Min(b.MinLat, p.Lat)
+		b.MinLon = math.Min(b.MinLon, p.Lon)
+		b.MaxLat = math.Max(b.MaxLat, p.Lat)
+		b.MaxLon = math.Max(b.MaxLon, p.Lon)
+	}
+	return b, true
+}
+
+// Extend grows the bounding box so that it also covers another box.
+func (b *Bounds) Extend(other Bounds) {
+	b.MinLat = math.Min(b.MinLat, other.MinLat)
+	b.MinLon = math.Min(b.MinLon, other.MinLon)
+	b.MaxLat = math.Max(b.MaxLat, other.MaxLat)
+	b.MaxLon = math.Max(b.MaxLon, other.MaxLon)
+}
+
+// BoundsAround returns bounding boxes that together fully contain a circle of
+// the given radius (in meters) around a point. A circle that crosses the
+// antimeridian is covered by two boxes, one on each side of it; otherwise there
+// is one. They are intended for coarse spatial filtering; exact distances
+// should be checked with DistanceTo afterwards.
+func BoundsAround(lat, lon, radius float64) []Bounds {
+	deltaLat := radius / metersPerDegreeLat
+	minLat, maxLat := math.Max(-90, lat-deltaLat), math.Min(90, lat+deltaLat)
+
+	// Longitude degrees shrink towards the poles. Near a pole, just cover every longitude.
+	deltaLon := 180.0
+	if cosLat := math.Cos(lat * math.Pi / 180); cosLat > 1e-6 {
+		deltaLon = math.Min(180, radius/(metersPerDegreeLat*cosLat))
+	}
+	if deltaLon >= 180 {
+		return []Bounds{{MinLat: minLat, MinLon: -180, MaxLat: maxLat, MaxLon: 180}}
+	}
+
+	minLon, maxLon := lon-deltaLon, lon+deltaLon
+	switch {
+	case minLon < -180:
+		return []Bounds{
+			{MinLat: minLat, MinLon: -180, MaxLat: maxLat, MaxLon: maxLon},
+			{MinLat: minLat, MinLon: minLon + 360, MaxLat: maxLat, MaxLon: 180},
+		}
+	case maxLon > 180:
+		return []Bounds{
+			{MinLat: minLat, MinLon: minLon, MaxLat: maxLat, MaxLon: 180},
+			{MinLat: minLat, MinLon: -180, MaxLat: maxLat, MaxLon: maxLon - 360},
+		}
+	}
+	return []Bounds{{MinLat: minLat, MinLon: minLon, MaxLat: maxLat, MaxLon: maxLon}}
+}
+
+// DistanceTo returns the distance in meters from a point to the nearest point of
+// the bounding box, or 0 if the point lies inside it. The box may be nearest
+// across the antimeridian.
+func (b *Bounds) DistanceTo(lat, lon float64) float64 {
+	distance := math.Inf(1)
+	for _, shift := range []float64{0, -360, 360} {
+		nearest := TrackPoint{
+			Lat: math.Max(b.MinLat, math.Min(lat, b.MaxLat)),
+			Lon: math.Max(b.MinLon, math.Min(lon+shift, b.MaxLon)),
+		}
+		distance = math.Min(distance, nearest.DistanceTo(&TrackPoint{Lat: lat, Lon: lon + shift}))
+	}
+	return distance
+}
@@ -14,6 +14,7 @@ type TrackPoint struct {
 	Lat       float64   `json:"lat"`
 	Lon       float64   `json:"lon"`
 	Timestamp time.Time `json:"timestamp"`
+	Ele       *float64  `json:"ele,omitempty"` // Elevation in meters, if known
 }
 
 // TrackPath represents the complete, processed track for a single racer.
@@ -21,7 +22,92 @@ type TrackPath struct {
 	RacerID       int64        `json:"racerId"`
 	Points        []TrackPoint `json:"points"`
 	TrackColor    string       `json:"trackColor"`
-	TotalDistance float64      `json:"totalDistance"` // Total distance of the track in meters
+	TotalDistance float64      `json:"totalDistance"` // Total distance of the track in meters, as recorded
+
+	// Gaps are the unrecorded stretches of a track stitched together from several
+	// files, such as the days of a bikepacking race or a device restart. Each
+	// runs from the last point of one file to the first point of the next, and
+	// is left out of the distances.
+	Gaps []TrackSection `json:"gaps,omitempty"`
+
+	// Map matching results. These are only set when the track has been snapped to
+	// the road/trail network, in which case Points holds the snapped positions.
+	MatchedDistance   *float64       `json:"matchedDistance,omitempty"`   // Distance along the snapped track in meters
+	UnmatchedSections []TrackSection `json:"unmatchedSections,omitempty"` // Parts of the track that could not be snapped
+
+	// Climbing statistics, calculated from the point elevations.
+	ElevationSource string  `json:"elevationSource,omitempty"` // "gps", "dem" or "blend"; empty if the track has no elevations
+	TotalAscent     float64 `json:"totalAscent"`               // Meters climbed
+	TotalDescent    float64 `json:"totalDescent"`              // Meters descended
+
+	// Sport-specific statistics, keyed by metric name (see the sport package).
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// elevationHysteresis is the minimum elevation change (in meters) counted towards
+// ascent or descent. It stops GPS noise on flat ground from adding up to phantom climbing.
+const elevationHysteresis = 3.0
+
+// CalculateElevationStats recalculates TotalAscent and TotalDescent from the
+// elevations of the track's points. Points without an elevation are skipped.
+func (t *TrackPath) CalculateElevationStats() {
+	t.TotalAscent, t.TotalDescent = 0, 0
+
+	var reference *float64
+	for _, p := range t.Points {
+		if p.Ele == nil {
+			continue
+		}
+		if reference == nil {
+			ele := *p.Ele
+			reference = &ele
+			continue
+		}
+		// Only count a change once it exceeds the hysteresis band, then move the reference.
+		if diff := *p.Ele - *reference; diff >= elevationHysteresis {
+			t.TotalAscent += diff
+			*reference = *p.Ele
+		} else if diff <= -elevationHysteresis {
+			t.TotalDescent -= diff
+			*reference = *p.Ele
+		}
+	}
+}
+
+// TrackSection identifies a run of consecutive points within a TrackPath.
+// Both indexes are inclusive.
+type TrackSection struct {
+	StartIndex int `json:"startIndex"`
+	EndIndex   int `json:"endIndex"`
+}
+
+// PathDistance calculates the total distance in meters along a sequence of points.
+func PathDistance(points []TrackPoint) float64 {
+	var total float64
+	for i := 0; i < len(points)-1; i++ {
+		total += points[i].DistanceTo(&points[i+1])
+	}
+	return total
+}
+
+// Distance calculates the distance in meters along the track's points, leaving
+// out its gaps.
+func (t *TrackPath) Distance() float64 {
+	total := PathDistance(t.Points)
+	for _, gap := range t.Gaps {
+		total -= t.Points[gap.StartIndex].DistanceTo(&t.Points[gap.EndIndex])
+	}
+	return total
+}
+
+// IsGap reports whether the line from point i to point i+1 crosses a gap.
+func (t *TrackPath) IsGap(i int) bool {
+	for _, gap := range t.Gaps {
+		if gap.StartIndex == i {
+			return true
+		}
+	}
+	return false
 }
 
 // DistanceTo calculates the great-circle distance to another point using the Haversine formula.
@@ -40,9 +126,49 @@ func (p *TrackPoint) DistanceTo(p2 *TrackPoint) float64 {
 	return R * c
 }
 
-// ProcessFile reads a GPX file from a given path, validates it, and processes it
-// based on the event type. It returns a structured TrackPath ready for the frontend.
-func ProcessFile(filePath, eventType string, racerID int64) (*TrackPath, error) {
+// ProcessFiles reads a racer's GPX files, stitches their points together in the
+// order given and processes them based on the event type. Files without track
+// points are skipped. It returns a structured TrackPath ready for the frontend,
+// or nil if none of the files has any points.
+func ProcessFiles(filePaths []string, eventType string, racerID int64) (*TrackPath, error) {
+	var (
+		trackPoints []TrackPoint
+		gaps        []TrackSection
+	)
+	for _, filePath := range filePaths {
+		points, err := ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if len(trackPoints) > 0 {
+			gaps = append(gaps, TrackSection{StartIndex: len(trackPoints) - 1, EndIndex: len(trackPoints)})
+		}
+		trackPoints = append(trackPoints, points...)
+	}
+	if len(trackPoints) == 0 {
+		return nil, nil // Not an error, but an empty track that we can ignore.
+	}
+
+	// If the event is a "Time Trial", normalize the timestamps. This is done
+	// once for the stitched track so the time between files is kept.
+	if eventType == "time_trial" {
+		normalizeTime(trackPoints)
+	}
+
+	path := NewTrackPath(racerID, trackPoints)
+	if len(gaps) > 0 {
+		path.Gaps = gaps
+		path.TotalDistance = path.Distance()
+	}
+	return path, nil
+}
+
+// ReadFile reads a GPX file from a given path and returns all of its track
+// points, in file order.
+func ReadFile(filePath string) ([]TrackPoint, error) {
 	// 1. Read the GPX file from the filesystem.
 	gpxBytes, err := os.ReadFile(filePath)
 	if err != nil {
@@ -55,70 +181,90 @@ func ProcessFile(filePath, eventType string, racerID int64) (*TrackPath, error)
 		return nil, err
 	}
 
-	// 3. Validate that the GPX data contains at least one track with points.
-	if len(gpxData.Tracks) == 0 || len(gpxData.Tracks[0].Segments) == 0 || len(gpxData.Tracks[0].Segments[0].Points) == 0 {
-		return nil, nil // Not an error, but an empty track that we can ignore.
-	}
-
-	// 4. If the event is a "Time Trial", normalize the timestamps.
-	if eventType == "time_trial" {
-		normalizeGpxTime(gpxData)
-	}
-
-	// 5. Convert the library's GPX format into our simplified TrackPoint slice.
+	// 3. Convert the library's GPX format into our simplified TrackPoint slice.
 	var trackPoints []TrackPoint
 	for _, track := range gpxData.Tracks {
 		for _, segment := range track.Segments {
 			for _, point := range segment.Points {
-				trackPoints = append(trackPoints, TrackPoint{
+				trackPoint := TrackPoint{
 					Lat:       point.Latitude,
 					Lon:       point.Longitude,
 					Timestamp: point.Timestamp,
-				})
+				}
+				if point.Elevation.NotNull() {
+					ele := point.Elevation.Value()
+					trackPoint.Ele = &ele
+				}
+				trackPoints = append(trackPoints, trackPoint)
 			}
 		}
 	}
+	return trackPoints, nil
+}
 
-	// 7. Calculate total track distance
-	var totalDistance float64
-	for i := 0; i < len(trackPoints)-1; i++ {
-		totalDistance += trackPoints[i].DistanceTo(&trackPoints[i+1])
-	}
-
-	// 6. Assemble the final TrackPath object.
-	processedPath := &TrackPath{
+// NewTrackPath assembles a TrackPath from a racer's points, calculating the total
+// distance and, if any point has an elevation, the climbing statistics.
+func NewTrackPath(racerID int64, points []TrackPoint) *TrackPath {
+	path := &TrackPath{
 		RacerID:       racerID,
-		Points:        trackPoints,
+		Points:        points,
 		TrackColor:    "",
-		TotalDistance: totalDistance,
+		TotalDistance: PathDistance(points),
 	}
-
-	return processedPath, nil
+	for _, p := range points {
+		if p.Ele != nil {
+			path.ElevationSource = "gps"
+			path.CalculateElevationStats()
+			break
+		}
+	}
+	return path
 }
 
-// normalizeGpxTime modifies a GPX structure in-place. It finds the timestamp of the
+// normalizeTime modifies a track's points in-place. It finds the timestamp of the
 // very first point and then recalculates all other timestamps as durations
 // relative to that start time, anchored to the Unix epoch.
-func normalizeGpxTime(gpxData *gpx.GPX) {
+func normalizeTime(points []TrackPoint) {
 	// Find the objective start time (the timestamp of the very first point).
-	startTime := gpxData.Tracks[0].Segments[0].Points[0].Timestamp
+	startTime := points[0].Timestamp
 
 	// Define a common, absolute start point for all tracks (the Unix epoch).
 	epoch := time.Unix(0, 0).UTC()
 
-	// Iterate through every single point in the GPX data.
-	for i := range gpxData.Tracks {
-		for j := range gpxData.Tracks[i].Segments {
-			for k := range gpxData.Tracks[i].Segments[j].Points {
-				point := &gpxData.Tracks[i].Segments[j].Points[k]
+	for i := range points {
+		// Calculate how long after the start this point occurred.
+		durationSinceStart := points[i].Timestamp.Sub(startTime)
 
-				// Calculate how long after the start this point occurred.
-				durationSinceStart := point.Timestamp.Sub(startTime)
+		// Set the point's new timestamp to be the epoch plus that duration.
+		// Now, every track will start at "1970-01-01 00:00:00" and go from there.
+		points[i].Timestamp = epoch.Add(durationSinceStart)
+	}
+}
 
-				// Set the point's new timestamp to be the epoch plus that duration.
-				// Now, every track will start at "1970-01-01 00:00:00" and go from there.
-				point.Timestamp = epoch.Add(durationSinceStart)
+// ParseCourse reads the line of a course from GPX data. Routes are preferred,
+// as course files from planning tools usually contain one; otherwise all track
+// points are used in order. Timestamps are ignored.
+func ParseCourse(gpxBytes []byte) ([]TrackPoint, error) {
+	gpxData, err := gpx.ParseBytes(gpxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var line []TrackPoint
+	for _, route := range gpxData.Routes {
+		for _, point := range route.Points {
+			line = append(line, TrackPoint{Lat: point.Latitude, Lon: point.Longitude})
+		}
+	}
+	if len(line) > 0 {
+		return line, nil
+	}
+	for _, track := range gpxData.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				line = append(line, TrackPoint{Lat: point.Latitude, Lon: point.Longitude})
 			}
 		}
 	}
+	return line, nil
 }
@@ -0,0 +1,36 @@
+package gpx
+
+import (
+	"os"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// WriteFile writes a sequence of points to a new GPX 1.1 file as a single track.
+func WriteFile(filePath, trackName string, points []TrackPoint) error {
+	xmlBytes, err := Encode(trackName, points)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, xmlBytes, 0644)
+}
+
+// Encode returns a sequence of points as a GPX 1.1 document with a single track.
+func Encode(trackName string, points []TrackPoint) ([]byte, error) {
+	segment := gpx.GPXTrackSegment{Points: make([]gpx.GPXPoint, len(points))}
+	for i, p := range points {
+		segment.Points[i] = gpx.GPXPoint{
+			Point:     gpx.Point{Latitude: p.Lat, Longitude: p.Lon},
+			Timestamp: p.Timestamp,
+		}
+		if p.Ele != nil {
+			segment.Points[i].Elevation = *gpx.NewNullableFloat64(*p.Ele)
+		}
+	}
+
+	doc := &gpx.GPX{
+		Creator: "RaceViz",
+		Tracks:  []gpx.GPXTrack{{Name: trackName, Segments: []gpx.GPXTrackSegment{segment}}},
+	}
+	return doc.ToXml(gpx.ToXmlParams{Version: "1.1", Indent: true})
+}
@@ -0,0 +1,165 @@
+// Package handicap adjusts racers' times so that racers of different ages,
+// abilities and classes can compete on equal terms. Factor-based systems scale
+// a racer's time; pursuit handicaps start slower racers earlier, so that the
+// first across the line wins.
+package handicap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Handicap systems. An event without one is raced on raw times.
+const (
+	SystemNone    = ""
+	SystemFactor  = "factor"  // Each racer's own handicap factor
+	SystemAge     = "age"     // The factor of the racer's age in the age-grading table
+	SystemClass   = "class"   // The coefficient of the racer's class, e.g. a bike or boat class
+	SystemPursuit = "pursuit" // Staggered starts; times are counted from the first start
+)
+
+// ValidSystem reports whether system is a known handicap system.
+func ValidSystem(system string) bool {
+	switch system {
+	case SystemNone, SystemFactor, SystemAge, SystemClass, SystemPursuit:
+		return true
+	}
+	return false
+}
+
+// AgeGrade is the factor for racers from MinAge to MaxAge years old, inclusive.
+type AgeGrade struct {
+	MinAge int     `json:"minAge"`
+	MaxAge int     `json:"maxAge"`
+	Factor float64 `json:"factor"`
+}
+
+// DefaultAgeGrades is used by events that haven't set their own age-grading
+// table. It is a simple, sport-neutral table; clubs with their own standards
+// should set them on the event.
+var DefaultAgeGrades = []AgeGrade{
+	{0, 14, 0.88},
+	{15, 17, 0.95},
+	{18, 34, 1.00},
+	{35, 39, 0.98},
+	{40, 44, 0.96},
+	{45, 49, 0.94},
+	{50, 54, 0.91},
+	{55, 59, 0.88},
+	{60, 64, 0.85},
+	{65, 69, 0.82},
+	{70, 74, 0.78},
+	{75, 150, 0.74},
+}
+
+// ValidateAgeGrades checks that every grade has a positive factor and a valid
+// age range, and that no two ranges overlap.
+func ValidateAgeGrades(grades []AgeGrade) error {
+	sorted := make([]AgeGrade, len(grades))
+	copy(sorted, grades)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinAge < sorted[j].MinAge })
+	for i, g := range sorted {
+		if g.MinAge < 0 || g.MaxAge < g.MinAge {
+			return fmt.Errorf("invalid age range %d-%d", g.MinAge, g.MaxAge)
+		}
+		if g.Factor <= 0 {
+			return fmt.Errorf("factor for ages %d-%d must be positive", g.MinAge, g.MaxAge)
+		}
+		if i > 0 && g.MinAge <= sorted[i-1].MaxAge {
+			return fmt.Errorf("age ranges %d-%d and %d-%d overlap", sorted[i-1].MinAge, sorted[i-1].MaxAge, g.MinAge, g.MaxAge)
+		}
+	}
+	return nil
+}
+
+// ValidateClasses checks that every class coefficient is positive.
+func ValidateClasses(classes map[string]float64) error {
+	for class, c := range classes {
+		if class == "" {
+			return errors.New("class names cannot be empty")
+		}
+		if c <= 0 {
+			return fmt.Errorf("coefficient of class %s must be positive", class)
+		}
+	}
+	return nil
+}
+
+// Rules are how an event handicaps its racers.
+type Rules struct {
+	System    string
+	AgeGrades []AgeGrade         // For SystemAge; DefaultAgeGrades if empty
+	Classes   map[string]float64 // For SystemClass, the coefficient of each class
+}
+
+// Entrant is what a racer is handicapped on. Unset fields get no handicap.
+type Entrant struct {
+	Factor      float64 // Racer's own factor; 0 if unset
+	Age         int     // 0 if unknown
+	Class       string
+	StartOffset time.Duration // For pursuits, how long after the first start the racer starts
+}
+
+// Factor returns what an entrant's time is multiplied by under a factor-based
+// system, or the given basis system. Racers with nothing to go on get 1.
+func (r Rules) Factor(e Entrant) float64 {
+	return factor(r.System, r, e)
+}
+
+func factor(system string, r Rules, e Entrant) float64 {
+	switch system {
+	case SystemFactor:
+		if e.Factor > 0 {
+			return e.Factor
+		}
+	case SystemAge:
+		grades := r.AgeGrades
+		if len(grades) == 0 {
+			grades = DefaultAgeGrades
+		}
+		if e.Age > 0 {
+			for _, g := range grades {
+				if e.Age >= g.MinAge && e.Age <= g.MaxAge {
+					return g.Factor
+				}
+			}
+		}
+	case SystemClass:
+		if c, ok := r.Classes[e.Class]; ok {
+			return c
+		}
+	}
+	return 1
+}
+
+// Adjust returns an entrant's handicapped time from their raw time, which for
+// pursuits is counted from their own start.
+func (r Rules) Adjust(raw time.Duration, e Entrant) time.Duration {
+	if r.System == SystemPursuit {
+		return raw + e.StartOffset
+	}
+	return time.Duration(float64(raw) * r.Factor(e))
+}
+
+// PursuitStarts works out staggered starts from the factors of basis, a
+// factor-based system, so that racers who ride to their handicap finish
+// together. reference is the raw time expected of a racer with a factor of 1.
+// The slowest racer starts first, with an offset of zero; the others start
+// later by the difference between their expected times.
+func PursuitStarts(reference time.Duration, basis string, r Rules, entrants map[int64]Entrant) map[int64]time.Duration {
+	expected := make(map[int64]time.Duration, len(entrants))
+	var slowest time.Duration
+	for id, e := range entrants {
+		expected[id] = time.Duration(float64(reference) / factor(basis, r, e))
+		if expected[id] > slowest {
+			slowest = expected[id]
+		}
+	}
+	offsets := make(map[int64]time.Duration, len(entrants))
+	for id, t := range expected {
+		offsets[id] = (slowest - t).Round(time.Second)
+	}
+	return offsets
+}
@@ -0,0 +1,273 @@
+// Package igc decodes IGC flight logs, the format recorded by gliding and
+// paragliding flight recorders and used for competition scoring.
+package igc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Altitude sources. Flight recorders log both a barometric (pressure) altitude
+// and the GNSS altitude for every fix.
+const (
+	AltitudePressure = "pressure"
+	AltitudeGNSS     = "gnss"
+)
+
+// Fix is a single B record.
+type Fix struct {
+	Time        time.Time
+	Lat         float64
+	Lon         float64
+	Valid       bool // false for fixes without a 3D GNSS fix ("V")
+	PressureAlt int  // Meters, relative to the ISA sea level pressure
+	GNSSAlt     int  // Meters above the WGS84 ellipsoid
+}
+
+// Waypoint is a point of the declared task.
+type Waypoint struct {
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// Task is the task declared in the C records before the flight. Points lists
+// every declared point in order: takeoff, start, turnpoints, finish and landing.
+type Task struct {
+	Description string
+	Points      []Waypoint
+}
+
+// Turnpoints returns the points a pilot must fly through: the declared points
+// without the takeoff and landing, and without unset (0, 0) placeholders.
+func (t *Task) Turnpoints() []Waypoint {
+	if t == nil || len(t.Points) < 3 {
+		return nil
+	}
+	var tps []Waypoint
+	for _, p := range t.Points[1 : len(t.Points)-1] {
+		if p.Lat == 0 && p.Lon == 0 {
+			continue
+		}
+		tps = append(tps, p)
+	}
+	return tps
+}
+
+// Flight is a decoded IGC file.
+type Flight struct {
+	Date       time.Time // Midnight UTC of the day the flight started
+	Pilot      string
+	GliderType string
+	Fixes      []Fix
+	Task       *Task // nil if no task was declared
+}
+
+// IsFile reports whether data looks like an IGC file: it starts with the A
+// record that identifies the flight recorder.
+func IsFile(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && trimmed[0] == 'A' && bytes.Contains(trimmed, []byte("\nB"))
+}
+
+// Decode parses an IGC file. B records that can't be parsed are skipped. The
+// date comes from the HFDTE header; if the file has none, fallbackDate's day
+// is used, and if that is zero too an error is returned. Fixes after midnight
+// UTC are moved to the next day.
+func Decode(data []byte, fallbackDate time.Time) (*Flight, error) {
+	f := &Flight{}
+	var times []time.Duration
+	var fixes []Fix
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'H':
+			f.parseHeader(line)
+		case 'C':
+			f.parseTask(line)
+		case 'B':
+			tod, fix, err := parseB(line)
+			if err != nil {
+				continue
+			}
+			times = append(times, tod)
+			fixes = append(fixes, fix)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(fixes) == 0 {
+		return nil, errors.New("IGC file contains no fixes (B records)")
+	}
+
+	if f.Date.IsZero() {
+		if fallbackDate.IsZero() {
+			return nil, errors.New("IGC file has no date (HFDTE record)")
+		}
+		fallbackDate = fallbackDate.UTC()
+		f.Date = time.Date(fallbackDate.Year(), fallbackDate.Month(), fallbackDate.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	day := f.Date
+	for i := range fixes {
+		if i > 0 && times[i] < times[i-1]-12*time.Hour {
+			day = day.AddDate(0, 0, 1)
+		}
+		fixes[i].Time = day.Add(times[i])
+	}
+	f.Fixes = fixes
+	return f, nil
+}
+
+// PreferredAltitude returns the altitude source to use for the flight: the
+// pressure altitude, as used for scoring, unless the recorder has no pressure
+// sensor, in which case it logs zeros.
+func (f *Flight) PreferredAltitude() string {
+	for _, fix := range f.Fixes {
+		if fix.PressureAlt != 0 {
+			return AltitudePressure
+		}
+	}
+	return AltitudeGNSS
+}
+
+// TrackPoints returns the valid fixes of the flight as track points, with the
+// elevation taken from the given altitude source.
+func (f *Flight) TrackPoints(altitudeSource string) []gpx.TrackPoint {
+	points := make([]gpx.TrackPoint, 0, len(f.Fixes))
+	for _, fix := range f.Fixes {
+		if !fix.Valid {
+			continue
+		}
+		ele := float64(fix.GNSSAlt)
+		if altitudeSource == AltitudePressure {
+			ele = float64(fix.PressureAlt)
+		}
+		points = append(points, gpx.TrackPoint{Lat: fix.Lat, Lon: fix.Lon, Timestamp: fix.Time, Ele: &ele})
+	}
+	return points
+}
+
+// parseHeader reads the H records RaceViz uses: the date, pilot and glider type.
+// Both the old "HFDTE150723" and the newer "HFDTEDATE:150723,01" forms are accepted.
+func (f *Flight) parseHeader(line string) {
+	if len(line) < 5 {
+		return
+	}
+	code, value := line[2:5], line[5:]
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		value = value[i+1:]
+	}
+	value = strings.TrimSpace(value)
+
+	switch code {
+	case "DTE":
+		value, _, _ = strings.Cut(value, ",")
+		if d, err := time.Parse("020106", value); err == nil {
+			f.Date = d
+		}
+	case "PLT":
+		f.Pilot = value
+	case "GTY":
+		f.GliderType = value
+	}
+}
+
+// parseTask reads the C records. The first holds the declaration details, the
+// rest one waypoint each:
+//
+//	C150723101520000000000102 Triangle 75km
+//	C4617883N01052150ETakeoff Bassano
+func (f *Flight) parseTask(line string) {
+	if f.Task == nil {
+		f.Task = &Task{}
+		if len(line) > 25 {
+			f.Task.Description = strings.TrimSpace(line[25:])
+		}
+		return
+	}
+	if len(line) < 18 {
+		return
+	}
+	lat, lon, err := parsePosition(line[1:18])
+	if err != nil {
+		return
+	}
+	f.Task.Points = append(f.Task.Points, Waypoint{Name: strings.TrimSpace(line[18:]), Lat: lat, Lon: lon})
+}
+
+// parseB reads a fix record:
+//
+//	B1101355206343N00006198WA0058700558
+//
+// time (HHMMSS), latitude (DDMMmmm N/S), longitude (DDDMMmmm E/W), validity,
+// pressure altitude and GNSS altitude (5 digits each, possibly negative).
+func parseB(line string) (time.Duration, Fix, error) {
+	var fix Fix
+	if len(line) < 35 {
+		return 0, fix, errors.New("B record too short")
+	}
+	h, err1 := strconv.Atoi(line[1:3])
+	m, err2 := strconv.Atoi(line[3:5])
+	s, err3 := strconv.Atoi(line[5:7])
+	if err1 != nil || err2 != nil || err3 != nil || h > 23 || m > 59 || s > 60 {
+		return 0, fix, errors.New("invalid time")
+	}
+	tod := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+
+	var err error
+	if fix.Lat, fix.Lon, err = parsePosition(line[7:24]); err != nil {
+		return 0, fix, err
+	}
+	fix.Valid = line[24] == 'A'
+	if fix.PressureAlt, err = strconv.Atoi(line[25:30]); err != nil {
+		return 0, fix, errors.New("invalid pressure altitude")
+	}
+	if fix.GNSSAlt, err = strconv.Atoi(line[30:35]); err != nil {
+		return 0, fix, errors.New("invalid GNSS altitude")
+	}
+	return tod, fix, nil
+}
+
+// parsePosition reads "DDMMmmmNDDDMMmmmE": degrees and thousandths of minutes.
+func parsePosition(s string) (lat, lon float64, err error) {
+	latDeg, err1 := strconv.Atoi(s[0:2])
+	latMin, err2 := strconv.Atoi(s[2:7])
+	lonDeg, err3 := strconv.Atoi(s[8:11])
+	lonMin, err4 := strconv.Atoi(s[11:16])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || latMin >= 60000 || lonMin >= 60000 {
+		return 0, 0, errors.New("invalid position")
+	}
+	lat = float64(latDeg) + float64(latMin)/60000
+	lon = float64(lonDeg) + float64(lonMin)/60000
+	switch s[7] {
+	case 'N':
+	case 'S':
+		lat = -lat
+	default:
+		return 0, 0, errors.New("invalid latitude hemisphere")
+	}
+	switch s[16] {
+	case 'E':
+	case 'W':
+		lon = -lon
+	default:
+		return 0, 0, errors.New("invalid longitude hemisphere")
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, errors.New("invalid position")
+	}
+	return lat, lon, nil
+}
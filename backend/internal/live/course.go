@@ -0,0 +1,121 @@
+package live
+
+import (
+	"math"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Checkpoint is a location racers pass in order, as configured for an event.
+type Checkpoint struct {
+	Sequence int
+	Name     string
+	Lat      float64
+	Lon      float64
+}
+
+// CoursePoint is a checkpoint placed on the course line.
+type CoursePoint struct {
+	Sequence int
+	Name     string
+	Distance float64 // Meters from the start of the course
+}
+
+// Course is the line racers follow, used to measure their progress.
+type Course struct {
+	line        []gpx.TrackPoint
+	cumulative  []float64 // Distance from the start to each point of line
+	Checkpoints []CoursePoint
+}
+
+// NewCourse builds a course from a course line and the event's checkpoints. If
+// there is no line, the checkpoints are joined with straight legs instead. It
+// returns nil if neither gives a line of at least two points.
+func NewCourse(line []gpx.TrackPoint, checkpoints []Checkpoint) *Course {
+	if len(line) < 2 {
+		line = make([]gpx.TrackPoint, len(checkpoints))
+		for i, cp := range checkpoints {
+			line[i] = gpx.TrackPoint{Lat: cp.Lat, Lon: cp.Lon}
+		}
+	}
+	if len(line) < 2 {
+		return nil
+	}
+
+	c := &Course{line: line, cumulative: make([]float64, len(line))}
+	for i := 1; i < len(line); i++ {
+		c.cumulative[i] = c.cumulative[i-1] + line[i-1].DistanceTo(&line[i])
+	}
+
+	// Place each checkpoint at or after the previous one, so that courses which
+	// pass the same spot twice (laps, out-and-back) keep them in order.
+	from := 0.0
+	for _, cp := range checkpoints {
+		along, _ := c.Locate(gpx.TrackPoint{Lat: cp.Lat, Lon: cp.Lon}, from, c.Length())
+		c.Checkpoints = append(c.Checkpoints, CoursePoint{Sequence: cp.Sequence, Name: cp.Name, Distance: along})
+		from = along
+	}
+	return c
+}
+
+// Length returns the total length of the course in meters.
+func (c *Course) Length() float64 {
+	return c.cumulative[len(c.cumulative)-1]
+}
+
+// Locate finds the point of the course between the distances from and to that
+// is nearest to p. It returns that point's distance along the course and how
+// far p is from it, both in meters.
+func (c *Course) Locate(p gpx.TrackPoint, from, to float64) (along, offset float64) {
+	offset = math.Inf(1)
+	for i := 0; i < len(c.line)-1; i++ {
+		if c.cumulative[i+1] < from {
+			continue
+		}
+		if c.cumulative[i] > to {
+			break
+		}
+		t, d := projectOnSegment(p, c.line[i], c.line[i+1])
+		a := c.cumulative[i] + t*(c.cumulative[i+1]-c.cumulative[i])
+		if a < from || a > to {
+			// Only the end of the segment inside the range can be used.
+			a = math.Max(from, math.Min(to, a))
+			t = (a - c.cumulative[i]) / math.Max(c.cumulative[i+1]-c.cumulative[i], 1e-9)
+			d = distanceToFraction(p, c.line[i], c.line[i+1], t)
+		}
+		if d < offset {
+			along, offset = a, d
+		}
+	}
+	return along, offset
+}
+
+// projectOnSegment returns the fraction along the segment a-b of the point
+// nearest to p, and the distance to it. Distances are small, so a local flat
+// projection around a is accurate enough.
+func projectOnSegment(p, a, b gpx.TrackPoint) (t, dist float64) {
+	ax, ay := 0.0, 0.0
+	bx, by := toLocal(a, b)
+	px, py := toLocal(a, p)
+
+	dx, dy := bx-ax, by-ay
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lenSq))
+	}
+	return t, math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// distanceToFraction returns the distance from p to the point at fraction t along a-b.
+func distanceToFraction(p, a, b gpx.TrackPoint, t float64) float64 {
+	bx, by := toLocal(a, b)
+	px, py := toLocal(a, p)
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// toLocal converts p to meters east and north of origin.
+func toLocal(origin, p gpx.TrackPoint) (x, y float64) {
+	const metersPerDegree = 6371e3 * math.Pi / 180
+	x = (p.Lon - origin.Lon) * metersPerDegree * math.Cos(origin.Lat*math.Pi/180)
+	y = (p.Lat - origin.Lat) * metersPerDegree
+	return x, y
+}
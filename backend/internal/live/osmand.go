@@ -0,0 +1,186 @@
+// Package live decodes position reports sent by live tracking apps.
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knotsToMetersPerSecond converts the OsmAnd protocol's speed unit to m/s.
+const knotsToMetersPerSecond = 1852.0 / 3600.0
+
+// Report is a single position reported by a tracking device. Optional values
+// are nil when the device did not send them.
+type Report struct {
+	DeviceID string
+	Time     time.Time
+	Lat      float64
+	Lon      float64
+	Altitude *float64 // Meters
+	Speed    *float64 // Meters per second
+	Bearing  *float64 // Degrees true
+	Accuracy *float64 // Meters
+	Battery  *float64 // Percent
+}
+
+// ParseQuery decodes a report in the OsmAnd HTTP format used by OsmAnd's online
+// tracking and the Traccar Client apps, e.g.
+//
+//	?id=TOKEN&lat=-33.86&lon=151.21&timestamp=1718000000&speed=4.2&bearing=90&altitude=12&accuracy=5&batt=80
+//
+// As in the protocol, speed is in knots. Reports without a timestamp are
+// stamped with now. An hdop value is ignored: it has no unit and cannot stand in
+// for an accuracy in meters.
+func ParseQuery(values url.Values, now time.Time) (*Report, error) {
+	r := &Report{DeviceID: first(values, "id", "deviceid")}
+	if r.DeviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+
+	lat, lon := values.Get("lat"), values.Get("lon")
+	if loc := values.Get("location"); loc != "" && lat == "" && lon == "" {
+		lat, lon, _ = strings.Cut(loc, ",")
+	}
+	var err error
+	if r.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+		return nil, errors.New("invalid or missing latitude")
+	}
+	if r.Lon, err = strconv.ParseFloat(lon, 64); err != nil {
+		return nil, errors.New("invalid or missing longitude")
+	}
+
+	r.Time = now
+	if ts := values.Get("timestamp"); ts != "" {
+		if r.Time, err = parseTimestamp(ts); err != nil {
+			return nil, err
+		}
+	}
+
+	r.Altitude = optionalFloat(first(values, "altitude", "alt"))
+	r.Bearing = optionalFloat(first(values, "bearing", "heading"))
+	r.Accuracy = optionalFloat(values.Get("accuracy"))
+	r.Battery = optionalFloat(first(values, "batt", "battery"))
+	if speed := optionalFloat(values.Get("speed")); speed != nil {
+		ms := *speed * knotsToMetersPerSecond
+		r.Speed = &ms
+	}
+
+	return r, r.validate()
+}
+
+// jsonReport is the JSON body sent by recent versions of the Traccar Client apps.
+type jsonReport struct {
+	DeviceID string `json:"device_id"`
+	Location struct {
+		Timestamp string `json:"timestamp"`
+		Coords    struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+			Accuracy  *float64 `json:"accuracy"`
+			Speed     *float64 `json:"speed"` // m/s
+			Heading   *float64 `json:"heading"`
+			Altitude  *float64 `json:"altitude"`
+		} `json:"coords"`
+		Battery struct {
+			Level *float64 `json:"level"` // 0 to 1
+		} `json:"battery"`
+	} `json:"location"`
+}
+
+// ParseJSON decodes a report in the JSON format sent by recent Traccar Client
+// versions. Reports without a timestamp are stamped with now.
+func ParseJSON(body []byte, now time.Time) (*Report, error) {
+	var j jsonReport
+	if err := json.Unmarshal(body, &j); err != nil {
+		return nil, errors.New("invalid JSON position report")
+	}
+	if j.DeviceID == "" {
+		return nil, errors.New("missing device id")
+	}
+	c := j.Location.Coords
+	if c.Latitude == nil || c.Longitude == nil {
+		return nil, errors.New("missing coordinates")
+	}
+
+	r := &Report{
+		DeviceID: j.DeviceID,
+		Time:     now,
+		Lat:      *c.Latitude,
+		Lon:      *c.Longitude,
+		Altitude: c.Altitude,
+		Bearing:  c.Heading,
+		Accuracy: c.Accuracy,
+	}
+	// The apps report -1 for values they don't know.
+	if c.Speed != nil && *c.Speed >= 0 {
+		r.Speed = c.Speed
+	}
+	if r.Bearing != nil && *r.Bearing < 0 {
+		r.Bearing = nil
+	}
+	if j.Location.Battery.Level != nil && *j.Location.Battery.Level >= 0 {
+		pct := *j.Location.Battery.Level * 100
+		r.Battery = &pct
+	}
+	if j.Location.Timestamp != "" {
+		var err error
+		if r.Time, err = parseTimestamp(j.Location.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, r.validate()
+}
+
+// validate rejects reports with impossible coordinates.
+func (r *Report) validate() error {
+	if math.IsNaN(r.Lat) || math.IsNaN(r.Lon) || r.Lat < -90 || r.Lat > 90 || r.Lon < -180 || r.Lon > 180 {
+		return errors.New("coordinates out of range")
+	}
+	return nil
+}
+
+// parseTimestamp accepts Unix time in seconds or milliseconds, RFC 3339, or
+// "YYYY-MM-DD hh:mm:ss" in UTC, all of which are sent by different clients.
+func parseTimestamp(ts string) (time.Time, error) {
+	if n, err := strconv.ParseFloat(ts, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid timestamp")
+}
+
+// first returns the first non-empty value among the given query keys.
+func first(values url.Values, keys ...string) string {
+	for _, k := range keys {
+		if v := values.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// optionalFloat parses a value, returning nil if it is absent or malformed.
+func optionalFloat(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
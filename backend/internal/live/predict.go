@@ -0,0 +1,181 @@
+package live
+
+import (
+	"sync"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+const (
+	// paceWindow is the stretch of recent progress used to estimate a racer's
+	// pace. Shorter windows react faster to changes (a climb, a rest stop) but
+	// are noisier.
+	paceWindow = 5 * time.Minute
+	// minPaceWindow is the shortest span of progress a pace is estimated from.
+	minPaceWindow = 30 * time.Second
+	// minPredictionSpeed is the progress rate (m/s) below which no ETA is given,
+	// e.g. while a racer is stopped.
+	minPredictionSpeed = 0.1
+
+	// backtrackTolerance and lookahead bound where on the course a new position
+	// is matched, relative to the racer's current progress. This stops a position
+	// from being matched to a later or earlier pass of the same spot on courses
+	// that overlap themselves.
+	backtrackTolerance = 50.0  // Meters
+	lookahead          = 500.0 // Meters beyond what the racer could have covered since the last position
+	// offCourseDistance is how far from the expected part of the course a racer
+	// may be before the whole course is searched, e.g. after taking a shortcut.
+	offCourseDistance = 250.0 // Meters
+)
+
+// CheckpointETA is the predicted arrival at a checkpoint still ahead of a racer.
+type CheckpointETA struct {
+	Sequence  int        `json:"sequence"`
+	Name      string     `json:"name"`
+	Remaining float64    `json:"remaining"` // Meters along the course
+	ETA       *time.Time `json:"eta"`       // Null while the racer isn't making progress
+}
+
+// Prediction is a racer's progress along the course and predicted arrival
+// times, as of their latest position.
+type Prediction struct {
+	RacerID     int64           `json:"racerId"`
+	Timestamp   time.Time       `json:"timestamp"` // Time of the position the prediction is based on
+	Distance    float64         `json:"distance"`  // Meters covered along the course
+	Remaining   float64         `json:"remaining"` // Meters to the finish
+	Speed       float64         `json:"speed"`     // Recent progress along the course in m/s
+	FinishETA   *time.Time      `json:"finishEta"`
+	Checkpoints []CheckpointETA `json:"checkpoints"`
+}
+
+// progressSample is a racer's distance along the course at a point in time.
+type progressSample struct {
+	time     time.Time
+	distance float64
+}
+
+// racerProgress is the predictor's state for one racer.
+type racerProgress struct {
+	first      progressSample   // First position matched to the course
+	history    []progressSample // Samples within the pace window, oldest first
+	prediction *Prediction
+}
+
+// Predictor tracks the progress of every racer in an event along its course
+// and predicts when they will reach each checkpoint and the finish. It is safe
+// for concurrent use.
+type Predictor struct {
+	course   *Course
+	maxSpeed float64 // m/s, from the event's sport profile
+
+	mu     sync.Mutex
+	racers map[int64]*racerProgress
+}
+
+// NewPredictor creates a predictor for a course. maxSpeed is the fastest a
+// racer can plausibly move, which limits how far ahead positions are matched.
+func NewPredictor(course *Course, maxSpeed float64) *Predictor {
+	return &Predictor{course: course, maxSpeed: maxSpeed, racers: make(map[int64]*racerProgress)}
+}
+
+// Update records a racer's new position and returns the refined prediction.
+// Positions older than the racer's latest one are ignored and the current
+// prediction is returned unchanged.
+func (p *Predictor) Update(racerID int64, t time.Time, lat, lon float64) *Prediction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	point := gpx.TrackPoint{Lat: lat, Lon: lon}
+	rp, known := p.racers[racerID]
+	var distance float64
+	if !known {
+		distance, _ = p.course.Locate(point, 0, p.course.Length())
+		rp = &racerProgress{first: progressSample{t, distance}}
+		p.racers[racerID] = rp
+	} else {
+		last := rp.history[len(rp.history)-1]
+		if t.Before(last.time) {
+			return rp.prediction
+		}
+		reach := p.maxSpeed*t.Sub(last.time).Seconds() + lookahead
+		along, offset := p.course.Locate(point, last.distance-backtrackTolerance, last.distance+reach)
+		if offset > offCourseDistance {
+			if a, o := p.course.Locate(point, 0, p.course.Length()); o < offCourseDistance {
+				along = a
+			}
+		}
+		// Progress never goes backwards; small reversals are GPS noise.
+		distance = last.distance
+		if along > distance {
+			distance = along
+		}
+	}
+
+	rp.history = append(rp.history, progressSample{t, distance})
+	cutoff := t.Add(-paceWindow)
+	for len(rp.history) > 2 && rp.history[1].time.Before(cutoff) {
+		rp.history = rp.history[1:]
+	}
+
+	rp.prediction = p.predict(racerID, rp)
+	return rp.prediction
+}
+
+// Predictions returns the latest prediction for every racer with a position.
+func (p *Predictor) Predictions() []*Prediction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	predictions := make([]*Prediction, 0, len(p.racers))
+	for _, rp := range p.racers {
+		predictions = append(predictions, rp.prediction)
+	}
+	return predictions
+}
+
+// predict estimates the racer's pace from recent progress, falling back to the
+// average since their first position when the recent window is too short, and
+// projects it over the remaining distance to each checkpoint and the finish.
+func (p *Predictor) predict(racerID int64, rp *racerProgress) *Prediction {
+	latest := rp.history[len(rp.history)-1]
+	oldest := rp.history[0]
+	if latest.time.Sub(oldest.time) < minPaceWindow {
+		oldest = rp.first
+	}
+	var speed float64
+	if dt := latest.time.Sub(oldest.time).Seconds(); dt > 0 {
+		speed = (latest.distance - oldest.distance) / dt
+	}
+
+	eta := func(remaining float64) *time.Time {
+		if speed < minPredictionSpeed {
+			return nil
+		}
+		at := latest.time.Add(time.Duration(remaining / speed * float64(time.Second)))
+		return &at
+	}
+
+	pred := &Prediction{
+		RacerID:     racerID,
+		Timestamp:   latest.time,
+		Distance:    latest.distance,
+		Remaining:   p.course.Length() - latest.distance,
+		Speed:       speed,
+		Checkpoints: []CheckpointETA{},
+	}
+	pred.FinishETA = eta(pred.Remaining)
+	for _, cp := range p.course.Checkpoints {
+		if cp.Distance <= latest.distance {
+			continue
+		}
+		remaining := cp.Distance - latest.distance
+		pred.Checkpoints = append(pred.Checkpoints, CheckpointETA{
+			Sequence:  cp.Sequence,
+			Name:      cp.Name,
+			Remaining: remaining,
+			ETA:       eta(remaining),
+		})
+	}
+	return pred
+}
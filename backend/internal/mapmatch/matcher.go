@@ -0,0 +1,148 @@
+package mapmatch
+
+import (
+	"math"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Matching parameters. These follow the usual hidden Markov model formulation of
+// map matching (Newson & Krumm), using straight-line instead of routed distances
+// for transitions, which is sufficient for the dense sampling of sports trackers.
+const (
+	// searchRadius is how far from a GPS point (in meters) a road may be and still
+	// be considered. Points with no road within this radius are left unmatched.
+	searchRadius = 35.0
+	// maxCandidates limits the number of road positions considered per point.
+	maxCandidates = 8
+	// gpsSigma is the assumed standard deviation of GPS noise in meters.
+	gpsSigma = 8.0
+	// transitionBeta scales the penalty for snapped movement that differs from the
+	// recorded movement, in meters. Lower values resist jumping between parallel roads.
+	transitionBeta = 5.0
+	// switchPenalty is the cost of moving between two segments that are not connected.
+	switchPenalty = 6.0
+)
+
+// MatchPath snaps a track onto the network in place. Points that can be matched
+// are moved onto the road or trail they were most likely recorded on; points with
+// no nearby road keep their recorded position and are reported as unmatched
+// sections. TotalDistance keeps the recorded distance, and MatchedDistance is set
+// to the distance along the snapped track (using recorded positions for any
+// unmatched sections so that both figures cover the whole track).
+func (n *Network) MatchPath(path *gpx.TrackPath) {
+	if path == nil || len(path.Points) == 0 {
+		return
+	}
+
+	// 1. Find candidate road positions for every point.
+	layers := make([][]candidate, len(path.Points))
+	for i, p := range path.Points {
+		layers[i] = n.candidatesNear(p.Lat, p.Lon, searchRadius, maxCandidates)
+	}
+
+	// 2. Decode each run of points that have candidates independently; a point
+	// without candidates or a gap in the track breaks the chain.
+	chosen := make([]int, len(path.Points))
+	for i := range chosen {
+		chosen[i] = -1
+	}
+	for start := 0; start < len(layers); {
+		if len(layers[start]) == 0 {
+			start++
+			continue
+		}
+		end := start
+		for end+1 < len(layers) && len(layers[end+1]) > 0 && !path.IsGap(end) {
+			end++
+		}
+		n.viterbi(path.Points[start:end+1], layers[start:end+1], chosen[start:end+1])
+		start = end + 1
+	}
+
+	// 3. Apply the snapped positions and record unmatched sections.
+	snapped := make([]gpx.TrackPoint, len(path.Points))
+	var unmatched []gpx.TrackSection
+	for i, p := range path.Points {
+		snapped[i] = p
+		if chosen[i] < 0 {
+			if len(unmatched) > 0 && unmatched[len(unmatched)-1].EndIndex == i-1 {
+				unmatched[len(unmatched)-1].EndIndex = i
+			} else {
+				unmatched = append(unmatched, gpx.TrackSection{StartIndex: i, EndIndex: i})
+			}
+			continue
+		}
+		c := layers[i][chosen[i]]
+		snapped[i].Lat, snapped[i].Lon = c.lat, c.lon
+	}
+
+	path.Points = snapped
+	matchedDistance := path.Distance()
+	path.MatchedDistance = &matchedDistance
+	path.UnmatchedSections = unmatched
+}
+
+// viterbi finds the most likely sequence of candidates for a run of points and
+// writes the index of the chosen candidate for each point into chosen.
+func (n *Network) viterbi(points []gpx.TrackPoint, layers [][]candidate, chosen []int) {
+	// cost[i][j] is the lowest total cost of any path ending at candidate j of point i.
+	cost := make([][]float64, len(layers))
+	back := make([][]int, len(layers))
+
+	cost[0] = make([]float64, len(layers[0]))
+	for j, c := range layers[0] {
+		cost[0][j] = emissionCost(c)
+	}
+
+	for i := 1; i < len(layers); i++ {
+		recorded := points[i-1].DistanceTo(&points[i])
+		cost[i] = make([]float64, len(layers[i]))
+		back[i] = make([]int, len(layers[i]))
+
+		for j, cur := range layers[i] {
+			best, bestIdx := math.Inf(1), 0
+			for k, prev := range layers[i-1] {
+				total := cost[i-1][k] + n.transitionCost(prev, cur, recorded)
+				if total < best {
+					best, bestIdx = total, k
+				}
+			}
+			cost[i][j] = best + emissionCost(cur)
+			back[i][j] = bestIdx
+		}
+	}
+
+	// Backtrack from the cheapest final candidate.
+	last := len(layers) - 1
+	bestIdx := 0
+	for j := range cost[last] {
+		if cost[last][j] < cost[last][bestIdx] {
+			bestIdx = j
+		}
+	}
+	for i := last; i >= 0; i-- {
+		chosen[i] = bestIdx
+		if i > 0 {
+			bestIdx = back[i][bestIdx]
+		}
+	}
+}
+
+// emissionCost is the negative log-likelihood (up to a constant) of observing a
+// GPS point at the given distance from a road position.
+func emissionCost(c candidate) float64 {
+	z := c.distance / gpsSigma
+	return 0.5 * z * z
+}
+
+// transitionCost penalises moving between two road positions when the snapped
+// movement differs from the recorded movement, or when the segments are not connected.
+func (n *Network) transitionCost(prev, cur candidate, recorded float64) float64 {
+	snapped := (&gpx.TrackPoint{Lat: prev.lat, Lon: prev.lon}).DistanceTo(&gpx.TrackPoint{Lat: cur.lat, Lon: cur.lon})
+	cost := math.Abs(snapped-recorded) / transitionBeta
+	if prev.segment != cur.segment && !n.connected(prev.segment, cur.segment) {
+		cost += switchPenalty
+	}
+	return cost
+}
@@ -0,0 +1,258 @@
+package mapmatch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+)
+
+// metersPerDegree is the approximate length of one degree of latitude.
+const metersPerDegree = 111320.0
+
+// gridCellSize is the size of a spatial index cell in degrees (~110m of latitude).
+const gridCellSize = 0.001
+
+// excludedHighways lists `highway=*` values that are tagged on ways but are not
+// something a racer can actually travel along.
+var excludedHighways = map[string]bool{
+	"proposed":     true,
+	"construction": true,
+	"abandoned":    true,
+	"platform":     true,
+	"elevator":     true,
+	"bus_stop":     true,
+}
+
+// node is a single vertex of the road/trail network.
+type node struct {
+	lat, lon float64
+}
+
+// segment is a straight line between two consecutive nodes of an OSM way.
+type segment struct {
+	a, b int32 // Indexes into Network.nodes
+	way  int32 // Index of the way the segment belongs to
+}
+
+// cellKey identifies a cell of the spatial index grid.
+type cellKey struct {
+	lat, lon int32
+}
+
+// Network is an in-memory road and trail network built from an OpenStreetMap
+// extract, with a grid index for finding segments near a position.
+type Network struct {
+	nodes    []node
+	segments []segment
+	grid     map[cellKey][]int32 // Segment indexes per grid cell
+}
+
+// LoadPBF builds a Network from a local `.osm.pbf` extract. Every way with a
+// `highway` tag (roads, paths, tracks, cycleways, ...) becomes part of the network.
+//
+// The file is read twice: the first pass collects the ways and the node IDs they
+// reference, the second pass resolves only those nodes' coordinates. This keeps
+// memory proportional to the routable network rather than the whole extract.
+func LoadPBF(path string) (*Network, error) {
+	// --- Pass 1: Collect routable ways ---
+	var wayNodeIDs [][]osm.NodeID
+	nodeIndex := make(map[osm.NodeID]int32)
+
+	err := scanPBF(path, func(scanner *osmpbf.Scanner) {
+		scanner.SkipNodes = true
+		scanner.SkipRelations = true
+	}, func(obj osm.Object) {
+		way, ok := obj.(*osm.Way)
+		if !ok || len(way.Nodes) < 2 {
+			return
+		}
+		highway := way.Tags.Find("highway")
+		if highway == "" || excludedHighways[highway] {
+			return
+		}
+
+		ids := way.Nodes.NodeIDs()
+		for _, id := range ids {
+			if _, seen := nodeIndex[id]; !seen {
+				nodeIndex[id] = int32(len(nodeIndex))
+			}
+		}
+		wayNodeIDs = append(wayNodeIDs, ids)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read ways from %s: %w", path, err)
+	}
+	if len(wayNodeIDs) == 0 {
+		return nil, fmt.Errorf("no highway ways found in %s", path)
+	}
+
+	// --- Pass 2: Resolve node coordinates ---
+	nodes := make([]node, len(nodeIndex))
+	found := make([]bool, len(nodeIndex))
+
+	err = scanPBF(path, func(scanner *osmpbf.Scanner) {
+		scanner.SkipWays = true
+		scanner.SkipRelations = true
+	}, func(obj osm.Object) {
+		n, ok := obj.(*osm.Node)
+		if !ok {
+			return
+		}
+		if idx, ok := nodeIndex[n.ID]; ok {
+			nodes[idx] = node{lat: n.Lat, lon: n.Lon}
+			found[idx] = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read nodes from %s: %w", path, err)
+	}
+
+	// --- Build segments and the spatial index ---
+	network := &Network{
+		nodes: nodes,
+		grid:  make(map[cellKey][]int32),
+	}
+	for wayIdx, ids := range wayNodeIDs {
+		for i := 0; i < len(ids)-1; i++ {
+			a, b := nodeIndex[ids[i]], nodeIndex[ids[i+1]]
+			// Extracts are clipped, so ways may reference nodes outside the file.
+			if !found[a] || !found[b] {
+				continue
+			}
+			network.addSegment(segment{a: a, b: b, way: int32(wayIdx)})
+		}
+	}
+
+	return network, nil
+}
+
+// scanPBF opens a PBF file and calls handle for every object that the scanner,
+// configured by setup, returns.
+func scanPBF(path string, setup func(*osmpbf.Scanner), handle func(osm.Object)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, runtime.GOMAXPROCS(0))
+	defer scanner.Close()
+	setup(scanner)
+
+	for scanner.Scan() {
+		handle(scanner.Object())
+	}
+	return scanner.Err()
+}
+
+// SegmentCount returns the number of segments in the network.
+func (n *Network) SegmentCount() int {
+	return len(n.segments)
+}
+
+// addSegment stores a segment and registers it in every grid cell its bounding box touches.
+func (n *Network) addSegment(seg segment) {
+	idx := int32(len(n.segments))
+	n.segments = append(n.segments, seg)
+
+	a, b := n.nodes[seg.a], n.nodes[seg.b]
+	minCell := cellFor(math.Min(a.lat, b.lat), math.Min(a.lon, b.lon))
+	maxCell := cellFor(math.Max(a.lat, b.lat), math.Max(a.lon, b.lon))
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		for lon := minCell.lon; lon <= maxCell.lon; lon++ {
+			key := cellKey{lat: lat, lon: lon}
+			n.grid[key] = append(n.grid[key], idx)
+		}
+	}
+}
+
+// cellFor returns the grid cell containing a coordinate.
+func cellFor(lat, lon float64) cellKey {
+	return cellKey{
+		lat: int32(math.Floor(lat / gridCellSize)),
+		lon: int32(math.Floor(lon / gridCellSize)),
+	}
+}
+
+// candidate is a possible position of a GPS point on the network.
+type candidate struct {
+	segment  int32
+	lat, lon float64 // The point projected onto the segment
+	distance float64 // Distance in meters from the GPS point to the projection
+}
+
+// candidatesNear returns the projections of a position onto every segment within
+// radius meters, closest first, limited to maxCount entries.
+func (n *Network) candidatesNear(lat, lon, radius float64, maxCount int) []candidate {
+	cosLat := math.Max(math.Cos(lat*math.Pi/180), 1e-6)
+	latCells := int32(math.Ceil(radius / (gridCellSize * metersPerDegree)))
+	lonCells := int32(math.Ceil(radius / (gridCellSize * metersPerDegree * cosLat)))
+
+	center := cellFor(lat, lon)
+	seen := make(map[int32]bool)
+	var candidates []candidate
+
+	for dLat := -latCells; dLat <= latCells; dLat++ {
+		for dLon := -lonCells; dLon <= lonCells; dLon++ {
+			for _, segIdx := range n.grid[cellKey{lat: center.lat + dLat, lon: center.lon + dLon}] {
+				if seen[segIdx] {
+					continue
+				}
+				seen[segIdx] = true
+
+				c := n.project(segIdx, lat, lon, cosLat)
+				if c.distance <= radius {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	}
+
+	// Keep only the closest candidates. The lists are short, so insertion sort is fine.
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && candidates[j].distance < candidates[j-1].distance; j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+	if len(candidates) > maxCount {
+		candidates = candidates[:maxCount]
+	}
+	return candidates
+}
+
+// project finds the closest point on a segment to a position. It uses a local
+// equirectangular projection, which is accurate over the short distances involved.
+func (n *Network) project(segIdx int32, lat, lon, cosLat float64) candidate {
+	seg := n.segments[segIdx]
+	a, b := n.nodes[seg.a], n.nodes[seg.b]
+
+	// Coordinates in meters relative to the GPS point.
+	ax, ay := (a.lon-lon)*cosLat*metersPerDegree, (a.lat-lat)*metersPerDegree
+	bx, by := (b.lon-lon)*cosLat*metersPerDegree, (b.lat-lat)*metersPerDegree
+
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lenSq))
+	}
+	px, py := ax+t*dx, ay+t*dy
+
+	return candidate{
+		segment:  segIdx,
+		lat:      a.lat + t*(b.lat-a.lat),
+		lon:      a.lon + t*(b.lon-a.lon),
+		distance: math.Hypot(px, py),
+	}
+}
+
+// connected reports whether two segments belong to the same way or share a node,
+// i.e. whether a racer can move from one to the other without leaving the network.
+func (n *Network) connected(s1, s2 int32) bool {
+	a, b := n.segments[s1], n.segments[s2]
+	return a.way == b.way || a.a == b.a || a.a == b.b || a.b == b.a || a.b == b.b
+}
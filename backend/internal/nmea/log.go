@@ -0,0 +1,88 @@
+package nmea
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// IsLog reports whether data looks like an NMEA log rather than a GPX file:
+// its first non-blank character starts a sentence.
+func IsLog(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && (trimmed[0] == '$' || trimmed[0] == '!')
+}
+
+// ReadLog converts an NMEA log into track points. Malformed lines, which are
+// common in logs cut off mid-sentence, are skipped.
+//
+// Dates come from RMC sentences. Fixes without one are dated by counting the
+// midnights passed since (or before) the nearest dated fix, detected by the
+// time of day going backwards. If the log has no dates at all, fallbackDate's
+// day is used; if that is zero too, an error is returned.
+func ReadLog(r io.Reader, fallbackDate time.Time) ([]gpx.TrackPoint, error) {
+	var fixes []*Fix
+	var dec Decoder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		if f, err := dec.Decode(scanner.Text()); err == nil && f != nil {
+			fixes = append(fixes, f)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if f := dec.Flush(); f != nil {
+		fixes = append(fixes, f)
+	}
+	if len(fixes) == 0 {
+		return nil, errors.New("NMEA log contains no valid position fixes")
+	}
+
+	// Number the days of the log, starting at 0, and find which calendar day
+	// each number is from the dated fixes.
+	days := make([]int, len(fixes))
+	for i := 1; i < len(fixes); i++ {
+		days[i] = days[i-1]
+		if fixes[i].TimeOfDay < fixes[i-1].TimeOfDay-12*time.Hour {
+			days[i]++
+		}
+	}
+	var base time.Time // Calendar date of day 0
+	for i, f := range fixes {
+		if !f.Date.IsZero() {
+			base = f.Date.AddDate(0, 0, -days[i])
+			break
+		}
+	}
+	if base.IsZero() {
+		if fallbackDate.IsZero() {
+			return nil, errors.New("NMEA log has no dates (no RMC sentences)")
+		}
+		fallbackDate = fallbackDate.UTC()
+		base = time.Date(fallbackDate.Year(), fallbackDate.Month(), fallbackDate.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	points := make([]gpx.TrackPoint, 0, len(fixes))
+	for i, f := range fixes {
+		date := f.Date
+		if date.IsZero() {
+			date = base.AddDate(0, 0, days[i])
+		} else {
+			// Follow the receiver's dates, in case the log spans a gap of days.
+			base = date.AddDate(0, 0, -days[i])
+		}
+		points = append(points, gpx.TrackPoint{
+			Lat:       f.Lat,
+			Lon:       f.Lon,
+			Timestamp: date.Add(f.TimeOfDay),
+			Ele:       f.Altitude,
+		})
+	}
+	return points, nil
+}
@@ -0,0 +1,288 @@
+// Package nmea decodes position fixes from NMEA 0183 sentences, as produced by
+// GPS loggers and marine or motorsport receivers. Only the RMC and GGA
+// sentences are used; everything else is ignored.
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knotsToMetersPerSecond converts RMC speeds to m/s.
+const knotsToMetersPerSecond = 1852.0 / 3600.0
+
+// ErrChecksum is returned for a sentence whose checksum doesn't match its content.
+var ErrChecksum = errors.New("nmea: checksum mismatch")
+
+// Fix is a receiver's position at one moment, merged from all the sentences
+// reported for that moment.
+type Fix struct {
+	// Date is midnight UTC of the day of the fix. Only RMC sentences carry the
+	// date, so it is zero for fixes made up of GGA sentences alone.
+	Date      time.Time
+	TimeOfDay time.Duration // Since midnight UTC
+	Lat       float64
+	Lon       float64
+	Altitude  *float64 // Meters above mean sea level, from GGA
+	Speed     *float64 // Meters per second, from RMC
+	Course    *float64 // Degrees true, from RMC
+
+	hasPosition bool
+}
+
+// Decoder turns a stream of sentences into fixes. Receivers send several
+// sentences for every moment, so a fix is only complete once a sentence for a
+// later moment arrives, or the stream ends and Flush is called.
+type Decoder struct {
+	pending *Fix
+}
+
+// Decode processes one sentence. It returns the previous fix if the sentence
+// starts a new one, or nil. Sentences of other types are ignored; malformed
+// sentences return an error and are otherwise ignored.
+func (d *Decoder) Decode(line string) (*Fix, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, nil
+	}
+	fields, err := split(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields[0]) < 3 {
+		return nil, nil
+	}
+
+	var f *Fix
+	switch fields[0][len(fields[0])-3:] {
+	case "RMC":
+		f, err = parseRMC(fields)
+	case "GGA":
+		f, err = parseGGA(fields)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nmea: %s: %w", fields[0], err)
+	}
+
+	if d.pending != nil && d.pending.TimeOfDay == f.TimeOfDay {
+		d.pending.merge(f)
+		return nil, nil
+	}
+	done := d.Flush()
+	d.pending = f
+	return done, nil
+}
+
+// Flush returns the fix being assembled, if it has a position, and resets the decoder.
+func (d *Decoder) Flush() *Fix {
+	f := d.pending
+	d.pending = nil
+	if f == nil || !f.hasPosition {
+		return nil
+	}
+	return f
+}
+
+// merge adds the values from another sentence for the same moment.
+func (f *Fix) merge(o *Fix) {
+	if !o.Date.IsZero() {
+		f.Date = o.Date
+	}
+	if o.hasPosition && !f.hasPosition {
+		f.Lat, f.Lon, f.hasPosition = o.Lat, o.Lon, true
+	}
+	if o.Altitude != nil {
+		f.Altitude = o.Altitude
+	}
+	if o.Speed != nil {
+		f.Speed = o.Speed
+	}
+	if o.Course != nil {
+		f.Course = o.Course
+	}
+}
+
+// TimeNear returns the time of a fix. Fixes without a date are placed on the
+// day that brings them closest to ref, which suits live streams where ref is
+// the time the fix was received.
+func (f *Fix) TimeNear(ref time.Time) time.Time {
+	if !f.Date.IsZero() {
+		return f.Date.Add(f.TimeOfDay)
+	}
+	ref = ref.UTC()
+	t := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, time.UTC).Add(f.TimeOfDay)
+	switch {
+	case t.Sub(ref) > 12*time.Hour:
+		t = t.AddDate(0, 0, -1)
+	case ref.Sub(t) > 12*time.Hour:
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// split validates a sentence's checksum, if it has one, and returns its
+// comma-separated fields, starting with the address (e.g. "GPRMC").
+func split(line string) ([]string, error) {
+	if line[0] != '$' && line[0] != '!' {
+		return nil, errors.New("nmea: sentence must start with '$'")
+	}
+	body := line[1:]
+	if star := strings.LastIndexByte(body, '*'); star >= 0 {
+		want, err := strconv.ParseUint(body[star+1:], 16, 8)
+		if err != nil {
+			return nil, ErrChecksum
+		}
+		var sum byte
+		for i := 0; i < star; i++ {
+			sum ^= body[i]
+		}
+		if byte(want) != sum {
+			return nil, ErrChecksum
+		}
+		body = body[:star]
+	}
+	return strings.Split(body, ","), nil
+}
+
+// parseRMC decodes a Recommended Minimum sentence:
+//
+//	$GPRMC,hhmmss.ss,A,ddmm.mm,N,dddmm.mm,E,knots,course,ddmmyy,...
+func parseRMC(fields []string) (*Fix, error) {
+	if len(fields) < 10 {
+		return nil, errors.New("too few fields")
+	}
+	tod, err := parseTime(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	f := &Fix{TimeOfDay: tod}
+	if f.Date, err = parseDate(fields[9]); err != nil {
+		return nil, err
+	}
+	if fields[2] != "A" {
+		// Void: the receiver has no fix.
+		return f, nil
+	}
+	if f.Lat, f.Lon, err = parsePosition(fields[3:7]); err != nil {
+		return nil, err
+	}
+	f.hasPosition = true
+	if v, err := strconv.ParseFloat(fields[7], 64); err == nil {
+		speed := v * knotsToMetersPerSecond
+		f.Speed = &speed
+	}
+	if v, err := strconv.ParseFloat(fields[8], 64); err == nil {
+		f.Course = &v
+	}
+	return f, nil
+}
+
+// parseGGA decodes a Fix Data sentence:
+//
+//	$GPGGA,hhmmss.ss,ddmm.mm,N,dddmm.mm,E,quality,sats,hdop,altitude,M,...
+func parseGGA(fields []string) (*Fix, error) {
+	if len(fields) < 10 {
+		return nil, errors.New("too few fields")
+	}
+	tod, err := parseTime(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	f := &Fix{TimeOfDay: tod}
+	if fields[6] == "" || fields[6] == "0" {
+		// Quality 0: the receiver has no fix.
+		return f, nil
+	}
+	if f.Lat, f.Lon, err = parsePosition(fields[2:6]); err != nil {
+		return nil, err
+	}
+	f.hasPosition = true
+	if v, err := strconv.ParseFloat(fields[9], 64); err == nil {
+		f.Altitude = &v
+	}
+	return f, nil
+}
+
+// parseTime parses hhmmss or hhmmss.sss into a time of day.
+func parseTime(s string) (time.Duration, error) {
+	if len(s) < 6 {
+		return 0, errors.New("invalid time")
+	}
+	h, err1 := strconv.Atoi(s[0:2])
+	m, err2 := strconv.Atoi(s[2:4])
+	sec, err3 := strconv.ParseFloat(s[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil || h > 23 || m > 59 || sec >= 61 {
+		return 0, errors.New("invalid time")
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), nil
+}
+
+// parseDate parses ddmmyy into midnight UTC. Two-digit years from 80 onwards
+// are taken to be in the 1900s.
+func parseDate(s string) (time.Time, error) {
+	if len(s) != 6 {
+		return time.Time{}, errors.New("invalid date")
+	}
+	d, err1 := strconv.Atoi(s[0:2])
+	m, err2 := strconv.Atoi(s[2:4])
+	y, err3 := strconv.Atoi(s[4:6])
+	if err1 != nil || err2 != nil || err3 != nil || d < 1 || d > 31 || m < 1 || m > 12 {
+		return time.Time{}, errors.New("invalid date")
+	}
+	if y < 80 {
+		y += 2000
+	} else {
+		y += 1900
+	}
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC), nil
+}
+
+// parsePosition parses the four latitude/longitude fields, e.g.
+// "3351.6460", "S", "15112.5460", "E".
+func parsePosition(fields []string) (lat, lon float64, err error) {
+	lat, err = parseCoordinate(fields[0], 2)
+	if err != nil || lat > 90 {
+		return 0, 0, errors.New("invalid latitude")
+	}
+	lon, err = parseCoordinate(fields[2], 3)
+	if err != nil || lon > 180 {
+		return 0, 0, errors.New("invalid longitude")
+	}
+	switch fields[1] {
+	case "N":
+	case "S":
+		lat = -lat
+	default:
+		return 0, 0, errors.New("invalid latitude hemisphere")
+	}
+	switch fields[3] {
+	case "E":
+	case "W":
+		lon = -lon
+	default:
+		return 0, 0, errors.New("invalid longitude hemisphere")
+	}
+	return lat, lon, nil
+}
+
+// parseCoordinate parses degrees and decimal minutes, where the first
+// degreeDigits digits are the degrees.
+func parseCoordinate(s string, degreeDigits int) (float64, error) {
+	if len(s) < degreeDigits+2 {
+		return 0, errors.New("invalid coordinate")
+	}
+	deg, err := strconv.Atoi(s[:degreeDigits])
+	if err != nil {
+		return 0, err
+	}
+	min, err := strconv.ParseFloat(s[degreeDigits:], 64)
+	if err != nil || min >= 60 {
+		return 0, errors.New("invalid coordinate")
+	}
+	return float64(deg) + min/60, nil
+}
@@ -19,12 +19,16 @@ type Broker struct {
 	clients map[int64]chan []byte
 	// A mutex to protect concurrent access to the clients map.
 	mu sync.RWMutex
+
+	// Anonymous, event-scoped streams for spectators (see events.go).
+	events *eventTopics
 }
 
 // NewBroker creates a new Broker instance.
 func NewBroker() *Broker {
 	return &Broker{
 		clients: make(map[int64]chan []byte),
+		events:  newEventTopics(),
 	}
 }
 
@@ -0,0 +1,182 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventKey identifies an event across all groups.
+type EventKey struct {
+	GroupID int64
+	EventID int64
+}
+
+// eventSubscriberBuffer is the number of messages buffered for each event
+// subscriber. A subscriber that falls further behind misses messages rather
+// than slowing down delivery to everyone else.
+const eventSubscriberBuffer = 32
+
+// eventTopics holds the anonymous subscribers of each event and the updates
+// waiting to be sent to them.
+type eventTopics struct {
+	mu          sync.RWMutex
+	subscribers map[EventKey]map[chan []byte]struct{}
+
+	// Coalesced updates, by event, then message type, then item ID. Only the
+	// latest payload for each item is kept until the next flush.
+	pendingMu sync.Mutex
+	pending   map[EventKey]map[string]map[int64]interface{}
+}
+
+func newEventTopics() *eventTopics {
+	return &eventTopics{
+		subscribers: make(map[EventKey]map[chan []byte]struct{}),
+		pending:     make(map[EventKey]map[string]map[int64]interface{}),
+	}
+}
+
+// SubscribeEvent registers an anonymous subscriber to an event's stream. The
+// returned channel receives JSON encoded messages until UnsubscribeEvent is called.
+func (b *Broker) SubscribeEvent(key EventKey) chan []byte {
+	t := b.events
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan []byte, eventSubscriberBuffer)
+	if t.subscribers[key] == nil {
+		t.subscribers[key] = make(map[chan []byte]struct{})
+	}
+	t.subscribers[key][ch] = struct{}{}
+	return ch
+}
+
+// UnsubscribeEvent removes a subscriber from an event's stream and closes its channel.
+func (b *Broker) UnsubscribeEvent(key EventKey, ch chan []byte) {
+	t := b.events
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	subs, ok := t.subscribers[key]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; ok {
+		delete(subs, ch)
+		close(ch)
+	}
+	if len(subs) == 0 {
+		delete(t.subscribers, key)
+	}
+}
+
+// HasEventSubscribers reports whether anyone is watching an event's stream.
+func (b *Broker) HasEventSubscribers(key EventKey) bool {
+	t := b.events
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.subscribers[key]) > 0
+}
+
+// PublishEvent sends a message to every subscriber of an event immediately.
+// The message is encoded once and shared by all subscribers.
+func (b *Broker) PublishEvent(key EventKey, message Message) {
+	if !b.HasEventSubscribers(key) {
+		return
+	}
+	jsonMsg, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("ERROR: could not marshal event message for event %d: %v", key.EventID, err)
+		return
+	}
+	b.broadcastEvent(key, jsonMsg)
+}
+
+// QueueEventUpdate schedules an update about one item (e.g. a racer's position)
+// for the next flush of an event's stream. If the same item is updated again
+// before then, only the latest payload is sent. Updates for events nobody is
+// watching are discarded.
+func (b *Broker) QueueEventUpdate(key EventKey, messageType string, itemID int64, payload interface{}) {
+	if !b.HasEventSubscribers(key) {
+		return
+	}
+	t := b.events
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+
+	byType, ok := t.pending[key]
+	if !ok {
+		byType = make(map[string]map[int64]interface{})
+		t.pending[key] = byType
+	}
+	items, ok := byType[messageType]
+	if !ok {
+		items = make(map[int64]interface{})
+		byType[messageType] = items
+	}
+	items[itemID] = payload
+}
+
+// RunEventFlusher sends the queued updates every interval, as one message per
+// event and type whose payload is the list of updated items, until ctx is
+// cancelled. This throttles high-frequency sources to a fixed rate per viewer.
+func (b *Broker) RunEventFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.flushEventUpdates()
+		}
+	}
+}
+
+func (b *Broker) flushEventUpdates() {
+	t := b.events
+	t.pendingMu.Lock()
+	pending := t.pending
+	t.pending = make(map[EventKey]map[string]map[int64]interface{})
+	t.pendingMu.Unlock()
+
+	for key, byType := range pending {
+		for messageType, items := range byType {
+			ids := make([]int64, 0, len(items))
+			for id := range items {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+			payload := make([]interface{}, len(ids))
+			for i, id := range ids {
+				payload[i] = items[id]
+			}
+			b.PublishEvent(key, Message{Type: messageType, Payload: payload})
+		}
+	}
+}
+
+// broadcastEvent delivers an encoded message to every subscriber of an event
+// without blocking; subscribers whose buffer is full miss the message.
+func (b *Broker) broadcastEvent(key EventKey, jsonMsg []byte) {
+	t := b.events
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	dropped := 0
+	for ch := range t.subscribers[key] {
+		select {
+		case ch <- jsonMsg:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("WARN: %d slow subscribers of event %d missed a message.", dropped, key.EventID)
+	}
+}
@@ -0,0 +1,138 @@
+// Package records finds the best efforts within a track: the fastest times over
+// standard distances and over segments, stretches of road between two points
+// that are raced again and again. Efforts are compared across events to find
+// personal and course records.
+package records
+
+import (
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Kinds of effort.
+const (
+	KindDistance = "distance" // Fastest time over a standard distance, anywhere in a track
+	KindCourse   = "course"   // Result on an event's course
+	KindSegment  = "segment"  // Fastest time between a segment's start and end
+)
+
+// Distance is a standard distance best efforts are timed over.
+type Distance struct {
+	Meters int
+	Name   string
+}
+
+// Distances are the standard distances best efforts are timed over.
+var Distances = []Distance{
+	{1000, "1k"},
+	{5000, "5k"},
+	{10000, "10k"},
+	{21097, "Half marathon"},
+	{40000, "40k"},
+	{42195, "Marathon"},
+	{100000, "100k"},
+}
+
+// DistanceName returns the name of a standard distance.
+func DistanceName(meters int) string {
+	for _, d := range Distances {
+		if d.Meters == meters {
+			return d.Name
+		}
+	}
+	return ""
+}
+
+// Segment is a stretch between two points. A racer is at either point while
+// within Radius meters of it. Start and end may be the same point for a lap.
+type Segment struct {
+	ID     int64
+	Start  gpx.TrackPoint
+	End    gpx.TrackPoint
+	Radius float64 // Meters
+}
+
+// Effort is the time a track took over a distance, course or segment. RefID is
+// the distance in meters, or the ID of the course or segment.
+type Effort struct {
+	Kind  string
+	RefID int64
+	Start time.Time
+	Time  time.Duration
+}
+
+// DistanceEfforts returns the fastest time over each standard distance that
+// fits within a track, timing the end of each effort between track points.
+func DistanceEfforts(points []gpx.TrackPoint) []Effort {
+	if len(points) < 2 {
+		return nil
+	}
+	cumulative := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		cumulative[i] = cumulative[i-1] + points[i-1].DistanceTo(&points[i])
+	}
+
+	var efforts []Effort
+	for _, d := range Distances {
+		meters := float64(d.Meters)
+		if cumulative[len(cumulative)-1] < meters {
+			break
+		}
+		var best Effort
+		found := false
+		end := 1
+		for start := range points {
+			for end < len(points) && cumulative[end]-cumulative[start] < meters {
+				end++
+			}
+			if end == len(points) {
+				break
+			}
+			// Interpolate when the distance was reached between end-1 and end.
+			before := cumulative[end-1] - cumulative[start]
+			span := cumulative[end] - cumulative[end-1]
+			finish := points[end-1].Timestamp
+			if span > 0 {
+				step := points[end].Timestamp.Sub(points[end-1].Timestamp)
+				finish = finish.Add(time.Duration(float64(step) * (meters - before) / span))
+			}
+			elapsed := finish.Sub(points[start].Timestamp)
+			if !found || elapsed < best.Time {
+				best = Effort{Kind: KindDistance, RefID: int64(d.Meters), Start: points[start].Timestamp, Time: elapsed}
+				found = true
+			}
+		}
+		if found {
+			efforts = append(efforts, best)
+		}
+	}
+	return efforts
+}
+
+// SegmentEffort returns the fastest time a track took over a segment: from
+// the last point at its start to the next point at its end, after leaving the
+// start. It reports false if the track never rode the segment.
+func SegmentEffort(points []gpx.TrackPoint, seg Segment) (Effort, bool) {
+	var best Effort
+	found := false
+	var start time.Time
+	away := false
+	for i := range points {
+		p := &points[i]
+		if !start.IsZero() && away && p.DistanceTo(&seg.End) <= seg.Radius {
+			elapsed := p.Timestamp.Sub(start)
+			if !found || elapsed < best.Time {
+				best = Effort{Kind: KindSegment, RefID: seg.ID, Start: start, Time: elapsed}
+				found = true
+			}
+			start = time.Time{}
+		}
+		if p.DistanceTo(&seg.Start) <= seg.Radius {
+			start, away = p.Timestamp, false
+		} else if !start.IsZero() {
+			away = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,116 @@
+// Package results works out how racers placed in an event from their tracks.
+package results
+
+import (
+	"sort"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// Result statuses.
+const (
+	StatusFinished = "finished"
+	StatusDNF      = "dnf" // Started but did not finish
+	StatusDNS      = "dns" // No track at all
+	StatusDSQ      = "dsq" // Disqualified by the officials
+)
+
+// ValidStatus reports whether status is a known result status.
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusFinished, StatusDNF, StatusDNS, StatusDSQ:
+		return true
+	}
+	return false
+}
+
+// Checkpoint is a location a racer must pass within Radius meters of.
+type Checkpoint struct {
+	Lat    float64
+	Lon    float64
+	Radius float64 // Meters
+}
+
+// Result is a racer's outcome in a single event.
+type Result struct {
+	RacerID int64
+	Status  string
+	Start   time.Time
+	Finish  time.Time
+	Elapsed time.Duration // Finishers only
+	Rank    int           // 1-based, finishers only; equal times share a rank
+}
+
+// Finished reports whether the racer has a finishing time.
+func (r *Result) Finished() bool {
+	return r.Status == StatusFinished
+}
+
+// PassTimes returns the time a track first reached each checkpoint, visiting
+// them in order. Checkpoints the track never reached are left out, so the
+// track passed all of them if the result has one time per checkpoint.
+func PassTimes(points []gpx.TrackPoint, checkpoints []Checkpoint) []time.Time {
+	var times []time.Time
+	for i := range points {
+		if len(times) == len(checkpoints) {
+			break
+		}
+		cp := checkpoints[len(times)]
+		if points[i].DistanceTo(&gpx.TrackPoint{Lat: cp.Lat, Lon: cp.Lon}) <= cp.Radius {
+			times = append(times, points[i].Timestamp)
+		}
+	}
+	return times
+}
+
+// Decision is what the officials decided about a racer's computed result.
+type Decision struct {
+	Status    string        // Replaces the computed status if set
+	Elapsed   time.Duration // Replaces the computed time if not zero
+	Penalties time.Duration // Added to the time; negative for time bonuses
+}
+
+// Apply returns the official result of a racer from their computed result.
+// The time of a finisher never drops below zero.
+func (d Decision) Apply(computed *Result) *Result {
+	official := *computed
+	if d.Status != "" {
+		official.Status = d.Status
+	}
+	if d.Elapsed != 0 {
+		official.Elapsed = d.Elapsed
+	}
+	if !official.Finished() {
+		official.Elapsed = 0
+		return &official
+	}
+	official.Elapsed += d.Penalties
+	if official.Elapsed < 0 {
+		official.Elapsed = 0
+	}
+	return &official
+}
+
+// Rank sorts results with the finishers first, fastest first, followed by the
+// DNFs, the DNSs and the disqualified, and numbers the finishers.
+func Rank(results []*Result) {
+	order := map[string]int{StatusFinished: 0, StatusDNF: 1, StatusDNS: 2, StatusDSQ: 3}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if order[a.Status] != order[b.Status] {
+			return order[a.Status] < order[b.Status]
+		}
+		return a.Finished() && a.Elapsed < b.Elapsed
+	})
+	for i, r := range results {
+		r.Rank = 0
+		if !r.Finished() {
+			continue
+		}
+		r.Rank = i + 1
+		if i > 0 && results[i-1].Finished() && results[i-1].Elapsed == r.Elapsed {
+			r.Rank = results[i-1].Rank
+		}
+	}
+}
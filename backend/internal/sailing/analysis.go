@@ -0,0 +1,324 @@
+package sailing
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/sport"
+)
+
+// Manoeuvre types.
+const (
+	Tack = "tack"
+	Gybe = "gybe"
+)
+
+const (
+	// headingWindow is the time (in seconds) either side of a point used to
+	// estimate its course and speed over ground, smoothing out GPS jitter.
+	headingWindow = 2.0
+	// minSpeed is the speed (m/s) below which a boat's heading is ignored.
+	minSpeed = 0.5
+	// A boat is sailing on a tack when its true wind angle is between these
+	// limits. Outside them (head to wind, dead downwind) the side is ambiguous.
+	minSteadyAngle = 20.0
+	maxSteadyAngle = 170.0
+	// holdTime is how long (in seconds) a boat must stay on the new side before
+	// a tack or gybe is counted, so that a wobble through the wind is ignored.
+	holdTime = 10.0
+	// baselineWindow is how long (in seconds) before a manoeuvre the boat's VMG
+	// is measured, and settleTime how long after it the boat is given to
+	// recover. The loss is the distance the boat would have gained at its
+	// baseline VMG over the manoeuvre, minus what it actually gained.
+	baselineWindow = 30.0
+	settleTime     = 10.0
+)
+
+// Mark is a location on the course that boats must sail to in order.
+type Mark struct {
+	Name   string
+	Lat    float64
+	Lon    float64
+	Radius float64 // Meters; a boat within this distance has rounded the mark
+}
+
+// Manoeuvre is a single tack or gybe.
+type Manoeuvre struct {
+	Type       string    `json:"type"` // "tack" or "gybe"
+	StartIndex int       `json:"startIndex"`
+	EndIndex   int       `json:"endIndex"`
+	Timestamp  time.Time `json:"timestamp"`
+	Duration   float64   `json:"duration"` // Seconds from leaving the old tack to settling on the new one
+	Loss       float64   `json:"loss"`     // Meters lost along the wind axis compared to the baseline VMG
+}
+
+// Stats holds the sailing analysis of a single track.
+type Stats struct {
+	RacerID    int64       `json:"racerId"`
+	Tacks      int         `json:"tacks"`
+	Gybes      int         `json:"gybes"`
+	Manoeuvres []Manoeuvre `json:"manoeuvres"`
+	TotalLoss  float64     `json:"totalLoss"` // Meters
+
+	// Time-weighted average velocity made good in m/s, upwind and downwind.
+	VMGUpwind   float64 `json:"vmgUpwind"`
+	VMGDownwind float64 `json:"vmgDownwind"`
+
+	// Velocity made good towards the next mark, only present if the course has marks.
+	VMGToMark    *float64 `json:"vmgToMark,omitempty"`
+	MarksRounded int      `json:"marksRounded"`
+}
+
+// sample is the smoothed motion of the boat at one track point.
+type sample struct {
+	heading float64 // Course over ground, degrees true
+	speed   float64 // Speed over ground, m/s
+	twa     float64 // True wind angle, heading minus wind direction, in (-180, 180]
+	wind    float64 // Wind direction at this point
+}
+
+// Analyze detects tacks and gybes in a track, measures the distance lost in each
+// and computes the velocity made good upwind, downwind and towards the marks.
+// The results are also stored in the track's Metrics map. It returns nil if no
+// wind is known.
+func Analyze(path *gpx.TrackPath, wind *Wind, marks []Mark) *Stats {
+	if path == nil || wind == nil {
+		return nil
+	}
+	stats := &Stats{RacerID: path.RacerID, Manoeuvres: []Manoeuvre{}}
+	points := path.Points
+	if len(points) < 2 {
+		return stats
+	}
+
+	samples := motion(points, wind)
+	detectManoeuvres(points, samples, stats)
+	measureVMG(points, samples, marks, stats)
+
+	if path.Metrics == nil {
+		path.Metrics = make(map[string]float64)
+	}
+	path.Metrics[sport.MetricTacks] = float64(stats.Tacks)
+	path.Metrics[sport.MetricGybes] = float64(stats.Gybes)
+	path.Metrics[sport.MetricManoeuvreLoss] = stats.TotalLoss
+	path.Metrics[sport.MetricVMGUpwind] = stats.VMGUpwind
+	path.Metrics[sport.MetricVMGDownwind] = stats.VMGDownwind
+	if stats.VMGToMark != nil {
+		path.Metrics[sport.MetricVMGToMark] = *stats.VMGToMark
+	}
+	return stats
+}
+
+// motion estimates the heading, speed and true wind angle at every point from
+// the points within headingWindow seconds of it.
+func motion(points []gpx.TrackPoint, wind *Wind) []sample {
+	samples := make([]sample, len(points))
+	lo, hi := 0, 0
+	for i := range points {
+		t := points[i].Timestamp
+		for lo < i && t.Sub(points[lo].Timestamp).Seconds() > headingWindow {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi < len(points)-1 && points[hi+1].Timestamp.Sub(t).Seconds() <= headingWindow {
+			hi++
+		}
+
+		a, b := lo, hi
+		if a == b {
+			// Sparse track: fall back to the neighbouring points.
+			if a > 0 {
+				a--
+			}
+			if b < len(points)-1 {
+				b++
+			}
+		}
+
+		s := &samples[i]
+		s.wind = wind.DirectionAt(t)
+		if dt := points[b].Timestamp.Sub(points[a].Timestamp).Seconds(); dt > 0 {
+			s.heading = bearing(&points[a], &points[b])
+			s.speed = points[a].DistanceTo(&points[b]) / dt
+		}
+		s.twa = angleDiff(s.heading, s.wind)
+	}
+	return samples
+}
+
+// steadySide returns +1 when a sample is on port tack, -1 on starboard tack and
+// 0 when the boat is too slow or too close to head to wind or dead downwind.
+func steadySide(s sample) int {
+	abs := math.Abs(s.twa)
+	if s.speed < minSpeed || abs < minSteadyAngle || abs > maxSteadyAngle {
+		return 0
+	}
+	if s.twa > 0 {
+		return 1
+	}
+	return -1
+}
+
+// detectManoeuvres finds every change of side that is held for at least
+// holdTime and classifies it as a tack or a gybe.
+func detectManoeuvres(points []gpx.TrackPoint, samples []sample, stats *Stats) {
+	side, lastOnSide := 0, 0
+	candidate, candidateStart := 0, 0
+
+	for i, s := range samples {
+		cur := steadySide(s)
+		if cur == 0 {
+			continue
+		}
+		if cur == side {
+			lastOnSide = i
+			candidate = 0
+			continue
+		}
+		if cur != candidate {
+			candidate, candidateStart = cur, i
+		}
+		if points[i].Timestamp.Sub(points[candidateStart].Timestamp).Seconds() < holdTime {
+			continue
+		}
+
+		if side != 0 {
+			m := classify(points, samples, lastOnSide, candidateStart)
+			stats.Manoeuvres = append(stats.Manoeuvres, m)
+			stats.TotalLoss += m.Loss
+			if m.Type == Tack {
+				stats.Tacks++
+			} else {
+				stats.Gybes++
+			}
+		}
+		side, lastOnSide, candidate = cur, i, 0
+	}
+}
+
+// classify builds the Manoeuvre between leaving the old side at index start and
+// settling on the new side at index end. If the bow turned through the wind it
+// was a tack, otherwise the stern did and it was a gybe.
+func classify(points []gpx.TrackPoint, samples []sample, start, end int) Manoeuvre {
+	var turn float64
+	for j := start; j < end; j++ {
+		turn += angleDiff(samples[j+1].heading, samples[j].heading)
+	}
+	from := samples[start].twa
+	to := from + turn
+
+	m := Manoeuvre{
+		Type:       Gybe,
+		StartIndex: start,
+		EndIndex:   end,
+		Timestamp:  points[start].Timestamp,
+		Duration:   points[end].Timestamp.Sub(points[start].Timestamp).Seconds(),
+	}
+	if math.Min(from, to) < 0 && math.Max(from, to) > 0 {
+		m.Type = Tack
+	}
+
+	// Measure progress along the wind axis: towards the wind for a tack, away
+	// from it for a gybe.
+	axis := samples[start].wind
+	if m.Type == Gybe {
+		axis = normalize(axis + 180)
+	}
+	startTime := points[start].Timestamp
+	before := indexAt(points, startTime.Add(-time.Duration(baselineWindow*float64(time.Second))))
+	after := indexAt(points, points[end].Timestamp.Add(time.Duration(settleTime*float64(time.Second))))
+	if after >= len(points) {
+		after = len(points) - 1
+	}
+
+	baseDt := startTime.Sub(points[before].Timestamp).Seconds()
+	windowDt := points[after].Timestamp.Sub(startTime).Seconds()
+	if baseDt > 0 && windowDt > 0 {
+		baseVMG := progress(&points[before], &points[start], axis) / baseDt
+		gained := progress(&points[start], &points[after], axis)
+		m.Loss = math.Max(0, baseVMG*windowDt-gained)
+	}
+	return m
+}
+
+// measureVMG computes the time-weighted average velocity made good upwind,
+// downwind and towards the next mark. A mark counts as rounded once the boat
+// comes within its radius, after which the next mark becomes the target.
+func measureVMG(points []gpx.TrackPoint, samples []sample, marks []Mark, stats *Stats) {
+	var upSum, upTime, downSum, downTime, markSum, markTime float64
+	next := 0
+
+	for i := 0; i < len(points)-1; i++ {
+		dt := points[i+1].Timestamp.Sub(points[i].Timestamp).Seconds()
+		s := samples[i]
+
+		for next < len(marks) && distanceToMark(&points[i], marks[next]) <= marks[next].Radius {
+			next++
+		}
+		if dt <= 0 || s.speed < minSpeed {
+			continue
+		}
+
+		vmg := s.speed * math.Cos(s.twa*math.Pi/180)
+		if vmg >= 0 {
+			upSum += vmg * dt
+			upTime += dt
+		} else {
+			downSum -= vmg * dt
+			downTime += dt
+		}
+
+		if next < len(marks) {
+			target := gpx.TrackPoint{Lat: marks[next].Lat, Lon: marks[next].Lon}
+			markSum += s.speed * math.Cos(angleDiff(s.heading, bearing(&points[i], &target))*math.Pi/180) * dt
+			markTime += dt
+		}
+	}
+	for next < len(marks) && distanceToMark(&points[len(points)-1], marks[next]) <= marks[next].Radius {
+		next++
+	}
+
+	if upTime > 0 {
+		stats.VMGUpwind = upSum / upTime
+	}
+	if downTime > 0 {
+		stats.VMGDownwind = downSum / downTime
+	}
+	if len(marks) > 0 {
+		var avg float64
+		if markTime > 0 {
+			avg = markSum / markTime
+		}
+		stats.VMGToMark = &avg
+	}
+	stats.MarksRounded = next
+}
+
+// indexAt returns the index of the first point at or after t, or len(points)
+// if there is none.
+func indexAt(points []gpx.TrackPoint, t time.Time) int {
+	return sort.Search(len(points), func(i int) bool { return !points[i].Timestamp.Before(t) })
+}
+
+// progress returns the distance in meters travelled from a to b in the
+// direction of the given bearing.
+func progress(a, b *gpx.TrackPoint, direction float64) float64 {
+	return a.DistanceTo(b) * math.Cos(angleDiff(bearing(a, b), direction)*math.Pi/180)
+}
+
+// bearing returns the initial great-circle bearing from a to b in degrees true.
+func bearing(a, b *gpx.TrackPoint) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return normalize(math.Atan2(y, x) * 180 / math.Pi)
+}
+
+func distanceToMark(p *gpx.TrackPoint, m Mark) float64 {
+	return p.DistanceTo(&gpx.TrackPoint{Lat: m.Lat, Lon: m.Lon})
+}
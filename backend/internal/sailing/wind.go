@@ -0,0 +1,69 @@
+package sailing
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// WindSample is a wind direction observation. A sample with a zero Time applies
+// to the whole event.
+type WindSample struct {
+	Time      time.Time
+	Direction float64 // Degrees true the wind is blowing from
+}
+
+// Wind describes the wind over an event, either as a constant direction or as a
+// time series that is interpolated between samples.
+type Wind struct {
+	samples []WindSample
+}
+
+// NewWind builds a Wind from the given samples. It returns nil if there are none.
+func NewWind(samples []WindSample) *Wind {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := append([]WindSample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	return &Wind{samples: sorted}
+}
+
+// DirectionAt returns the wind direction at time t. Between samples the
+// direction is interpolated along the shorter arc; before the first and after
+// the last sample the nearest one is used.
+func (w *Wind) DirectionAt(t time.Time) float64 {
+	s := w.samples
+	if len(s) == 1 || !t.After(s[0].Time) {
+		return s[0].Direction
+	}
+	last := s[len(s)-1]
+	if !t.Before(last.Time) {
+		return last.Direction
+	}
+
+	i := sort.Search(len(s), func(i int) bool { return s[i].Time.After(t) })
+	a, b := s[i-1], s[i]
+	frac := t.Sub(a.Time).Seconds() / b.Time.Sub(a.Time).Seconds()
+	return normalize(a.Direction + angleDiff(b.Direction, a.Direction)*frac)
+}
+
+// angleDiff returns a-b in degrees, wrapped to the range (-180, 180].
+func angleDiff(a, b float64) float64 {
+	d := math.Mod(a-b, 360)
+	if d > 180 {
+		d -= 360
+	} else if d <= -180 {
+		d += 360
+	}
+	return d
+}
+
+// normalize wraps an angle in degrees to the range [0, 360).
+func normalize(a float64) float64 {
+	a = math.Mod(a, 360)
+	if a < 0 {
+		a += 360
+	}
+	return a
+}
@@ -0,0 +1,326 @@
+// Package series computes the standings of a season series: championship
+// points awarded by finishing position over a number of events (rounds),
+// overall and per category.
+package series
+
+import (
+	"sort"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/results"
+)
+
+// Tie-breakers, applied in the order a series lists them when riders have the
+// same number of points.
+const (
+	TieBreakCountback  = "countback"  // Most wins, then most second places, and so on
+	TieBreakLastRound  = "lastRound"  // Better placing in the latest round, then the one before
+	TieBreakHeadToHead = "headToHead" // Finished ahead of the other more often
+)
+
+// DefaultTieBreakers are used when a series doesn't list any.
+var DefaultTieBreakers = []string{TieBreakCountback, TieBreakLastRound}
+
+// IsTieBreaker reports whether name is a known tie-breaker.
+func IsTieBreaker(name string) bool {
+	return name == TieBreakCountback || name == TieBreakLastRound || name == TieBreakHeadToHead
+}
+
+// Rules are the scoring rules of a series.
+type Rules struct {
+	Points      []int    // Points for 1st, 2nd, ... place; places further down score nothing
+	DropWorst   int      // Number of worst rounds each rider doesn't count
+	TieBreakers []string // See the TieBreak constants
+}
+
+// Entry is a rider's result in one round.
+type Entry struct {
+	Rider    string // Identifies the rider across rounds
+	Name     string
+	Category string // Empty if the rider has no category
+	Result   *results.Result
+}
+
+// Round is one of the events of a series, with its riders' results.
+type Round struct {
+	EventID int64
+	Name    string
+	Date    time.Time
+	Entries []Entry
+}
+
+// RoundSummary describes a round of the series.
+type RoundSummary struct {
+	EventID int64     `json:"eventId"`
+	Name    string    `json:"name"`
+	Date    time.Time `json:"date"`
+	Raced   bool      `json:"raced"` // False until a rider has finished the round
+}
+
+// RoundScore is what a rider scored in one raced round.
+type RoundScore struct {
+	EventID  int64  `json:"eventId"`
+	Status   string `json:"status"`   // Empty if the rider didn't take part
+	Position int    `json:"position"` // Within the standings' category; 0 if not finished
+	Points   int    `json:"points"`
+	Dropped  bool   `json:"dropped"` // One of the rider's worst rounds, not counted
+}
+
+// Standing is a rider's place in the series. Rounds lists the raced rounds in
+// date order.
+type Standing struct {
+	Rank    int          `json:"rank"` // Riders tied on points and all tie-breakers share a rank
+	Rider   string       `json:"rider"`
+	Name    string       `json:"name"`
+	Points  int          `json:"points"`  // Counted points
+	Dropped int          `json:"dropped"` // Points of the dropped rounds
+	Wins    int          `json:"wins"`
+	Rounds  []RoundScore `json:"rounds"`
+}
+
+// CategoryStandings are the standings of the riders of one category, placed
+// against each other only.
+type CategoryStandings struct {
+	Category  string     `json:"category"`
+	Standings []Standing `json:"standings"`
+}
+
+// Table is the state of a series after the rounds raced so far.
+type Table struct {
+	RoundsRaced int                 `json:"roundsRaced"`
+	Rounds      []RoundSummary      `json:"rounds"`
+	Overall     []Standing          `json:"overall"`
+	Categories  []CategoryStandings `json:"categories"`
+}
+
+// Compute scores every raced round and builds the overall standings and the
+// standings of each category, in category order. rounds must be in date order.
+//
+// Rounds that no rider has finished yet are not raced and don't count. A rider
+// scores nothing for a raced round they didn't finish or didn't take part in,
+// and such rounds are the first to be dropped. At least one round always counts.
+func Compute(rounds []Round, rules Rules) *Table {
+	t := &Table{Rounds: make([]RoundSummary, len(rounds)), Categories: []CategoryStandings{}}
+	var raced []Round
+	categories := make(map[string]bool)
+	for i, round := range rounds {
+		t.Rounds[i] = RoundSummary{EventID: round.EventID, Name: round.Name, Date: round.Date}
+		for _, e := range round.Entries {
+			if e.Result.Finished() {
+				t.Rounds[i].Raced = true
+			}
+		}
+		if !t.Rounds[i].Raced {
+			continue
+		}
+		raced = append(raced, round)
+		for _, e := range round.Entries {
+			if e.Category != "" {
+				categories[e.Category] = true
+			}
+		}
+	}
+	t.RoundsRaced = len(raced)
+
+	t.Overall = standings(raced, rules, func(Entry) bool { return true })
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	for _, category := range names {
+		t.Categories = append(t.Categories, CategoryStandings{
+			Category:  category,
+			Standings: standings(raced, rules, func(e Entry) bool { return e.Category == category }),
+		})
+	}
+	return t
+}
+
+// standings ranks the riders of the entries that pass filter over the raced
+// rounds.
+func standings(raced []Round, rules Rules, filter func(Entry) bool) []Standing {
+	byRider := make(map[string]*Standing)
+	var riders []string
+	for i, round := range raced {
+		// Rank copies, so that each category is placed on its own.
+		var list []*results.Result
+		entries := make(map[*results.Result]Entry)
+		for _, e := range round.Entries {
+			if !filter(e) {
+				continue
+			}
+			res := *e.Result
+			list = append(list, &res)
+			entries[&res] = e
+		}
+		// A rider entered twice keeps their better result; the other entry
+		// mustn't take a place from the riders behind it.
+		results.Rank(list)
+		seen := make(map[string]bool)
+		unique := list[:0]
+		for _, res := range list {
+			if rider := entries[res].Rider; !seen[rider] {
+				seen[rider] = true
+				unique = append(unique, res)
+			}
+		}
+		list = unique
+		results.Rank(list)
+
+		for _, res := range list {
+			e := entries[res]
+			st, ok := byRider[e.Rider]
+			if !ok {
+				st = &Standing{Rider: e.Rider, Rounds: make([]RoundScore, len(raced))}
+				for j, r := range raced {
+					st.Rounds[j].EventID = r.EventID
+				}
+				byRider[e.Rider] = st
+				riders = append(riders, e.Rider)
+			}
+			st.Name = e.Name
+			score := &st.Rounds[i]
+			score.Status = res.Status
+			score.Position = res.Rank
+			if res.Rank >= 1 && res.Rank <= len(rules.Points) {
+				score.Points = rules.Points[res.Rank-1]
+			}
+			if res.Rank == 1 {
+				st.Wins++
+			}
+		}
+	}
+
+	list := make([]Standing, 0, len(riders))
+	for _, rider := range riders {
+		st := byRider[rider]
+		dropWorst(st, rules.DropWorst)
+		list = append(list, *st)
+	}
+
+	tieBreakers := rules.TieBreakers
+	if len(tieBreakers) == 0 {
+		tieBreakers = DefaultTieBreakers
+	}
+	compare := func(a, b *Standing) int {
+		if a.Points != b.Points {
+			return b.Points - a.Points
+		}
+		for _, tb := range tieBreakers {
+			if c := tieBreak(tb, a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if c := compare(&list[i], &list[j]); c != 0 {
+			return c < 0
+		}
+		return list[i].Name < list[j].Name
+	})
+	for i := range list {
+		list[i].Rank = i + 1
+		if i > 0 && compare(&list[i-1], &list[i]) == 0 {
+			list[i].Rank = list[i-1].Rank
+		}
+	}
+	return list
+}
+
+// dropWorst marks a rider's n lowest scoring rounds as dropped, keeping at
+// least one, and totals the points.
+func dropWorst(st *Standing, n int) {
+	if n > len(st.Rounds)-1 {
+		n = len(st.Rounds) - 1
+	}
+	order := make([]int, len(st.Rounds))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := st.Rounds[order[i]], st.Rounds[order[j]]
+		if a.Points != b.Points {
+			return a.Points < b.Points
+		}
+		// Drop rounds the rider missed before ones they rode.
+		return a.Status == "" && b.Status != ""
+	})
+	for k, i := range order {
+		score := &st.Rounds[i]
+		score.Dropped = k < n
+		if score.Dropped {
+			st.Dropped += score.Points
+		} else {
+			st.Points += score.Points
+		}
+	}
+}
+
+// tieBreak compares two riders on points with one tie-breaker. It returns a
+// negative number if a places ahead of b, positive if b does, and 0 if the
+// tie-breaker doesn't separate them.
+func tieBreak(name string, a, b *Standing) int {
+	switch name {
+	case TieBreakCountback:
+		for pos := 1; ; pos++ {
+			na, more := countPosition(a, pos)
+			nb, moreB := countPosition(b, pos)
+			if na != nb {
+				return nb - na
+			}
+			if !more && !moreB {
+				return 0
+			}
+		}
+	case TieBreakLastRound:
+		for i := len(a.Rounds) - 1; i >= 0; i-- {
+			if c := comparePositions(a.Rounds[i].Position, b.Rounds[i].Position); c != 0 {
+				return c
+			}
+		}
+	case TieBreakHeadToHead:
+		var ahead int
+		for i := range a.Rounds {
+			if a.Rounds[i].Status == "" || b.Rounds[i].Status == "" {
+				continue
+			}
+			switch comparePositions(a.Rounds[i].Position, b.Rounds[i].Position) {
+			case -1:
+				ahead++
+			case 1:
+				ahead--
+			}
+		}
+		return -ahead
+	}
+	return 0
+}
+
+// countPosition counts the rounds a rider placed pos in, and reports whether
+// they placed further down in any round.
+func countPosition(st *Standing, pos int) (n int, more bool) {
+	for _, score := range st.Rounds {
+		switch {
+		case score.Position == pos:
+			n++
+		case score.Position > pos:
+			more = true
+		}
+	}
+	return n, more
+}
+
+// comparePositions compares two placings in a round, where 0 (not finished)
+// is behind any finishing position.
+func comparePositions(a, b int) int {
+	switch {
+	case a == b:
+		return 0
+	case b == 0 || (a != 0 && a < b):
+		return -1
+	default:
+		return 1
+	}
+}
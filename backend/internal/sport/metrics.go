@@ -0,0 +1,154 @@
+package sport
+
+import (
+	"github.com/intermernet/raceviz/internal/gpx"
+)
+
+// maxSpeedWindow is the minimum duration (in seconds) over which speed is measured
+// for MetricMaxSpeed, so that a single noisy fix cannot produce the maximum.
+const maxSpeedWindow = 5.0
+
+// FilterSpikes removes GPS glitches from a track in place: any point that would
+// require moving faster than the profile's MaxSpeed from the last accepted point
+// is dropped. Distance and climbing statistics are recalculated afterwards.
+func (p *Profile) FilterSpikes(path *gpx.TrackPath) {
+	if path == nil || len(path.Points) < 2 {
+		return
+	}
+
+	// Gaps between stitched files are not travelled at a measurable speed, so
+	// the first point after a gap is always kept and the gap moved to it.
+	kept := path.Points[:1]
+	var gaps []gpx.TrackSection
+	for i := 1; i < len(path.Points); i++ {
+		prev, cur := &kept[len(kept)-1], &path.Points[i]
+		if path.IsGap(i - 1) {
+			gaps = append(gaps, gpx.TrackSection{StartIndex: len(kept) - 1, EndIndex: len(kept)})
+		} else if dt := cur.Timestamp.Sub(prev.Timestamp).Seconds(); dt > 0 && prev.DistanceTo(cur)/dt > p.MaxSpeed {
+			continue
+		}
+		kept = append(kept, *cur)
+	}
+
+	if len(kept) == len(path.Points) {
+		return
+	}
+	path.Points = kept
+	path.Gaps = gaps
+	path.TotalDistance = path.Distance()
+	path.CalculateElevationStats()
+}
+
+// CalculateMetrics computes the statistics listed in the profile and stores them
+// in the track's Metrics map. It should run after all other processing steps so
+// that the metrics reflect the final points and elevations.
+func (p *Profile) CalculateMetrics(path *gpx.TrackPath) {
+	if path == nil || len(path.Points) == 0 {
+		return
+	}
+
+	// Distances are measured along the final points (snapped, if map matching ran).
+	distance := path.TotalDistance
+	if path.MatchedDistance != nil {
+		distance = *path.MatchedDistance
+	}
+	elapsed := path.Points[len(path.Points)-1].Timestamp.Sub(path.Points[0].Timestamp).Seconds()
+	moving := p.movingTime(path)
+
+	metrics := make(map[string]float64, len(p.Metrics))
+	for _, metric := range p.Metrics {
+		switch metric {
+		case MetricDistance:
+			metrics[metric] = distance
+		case MetricElapsedTime:
+			metrics[metric] = elapsed
+		case MetricMovingTime:
+			metrics[metric] = moving
+		case MetricAvgSpeed:
+			if moving > 0 {
+				metrics[metric] = distance / moving
+			}
+		case MetricMaxSpeed:
+			metrics[metric] = maxSpeed(path)
+		case MetricAvgPace:
+			if distance > 0 {
+				metrics[metric] = moving / (distance / 1000)
+			}
+		case MetricAscent:
+			if path.ElevationSource != "" {
+				metrics[metric] = path.TotalAscent
+			}
+		case MetricDescent:
+			if path.ElevationSource != "" {
+				metrics[metric] = path.TotalDescent
+			}
+		}
+	}
+	path.Metrics = metrics
+}
+
+// movingTime sums the time spent moving. Slow stretches shorter than the
+// auto-pause delay (a junction, a turn buoy) still count as moving; longer ones
+// are treated as a pause and excluded entirely, as are gaps in the track.
+func (p *Profile) movingTime(path *gpx.TrackPath) float64 {
+	points := path.Points
+	var moving, slowRun float64
+	for i := 1; i < len(points); i++ {
+		if path.IsGap(i - 1) {
+			if slowRun < p.AutoPauseDelay {
+				moving += slowRun
+			}
+			slowRun = 0
+			continue
+		}
+		dt := points[i].Timestamp.Sub(points[i-1].Timestamp).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		if points[i-1].DistanceTo(&points[i])/dt >= p.AutoPauseSpeed {
+			if slowRun < p.AutoPauseDelay {
+				moving += slowRun
+			}
+			slowRun = 0
+			moving += dt
+		} else {
+			slowRun += dt
+		}
+	}
+	if slowRun < p.AutoPauseDelay {
+		moving += slowRun
+	}
+	return moving
+}
+
+// maxSpeed returns the highest speed sustained over at least maxSpeedWindow seconds.
+// Gaps in the track count as no distance.
+func maxSpeed(path *gpx.TrackPath) float64 {
+	points := path.Points
+	cumulative := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		cumulative[i] = cumulative[i-1]
+		if !path.IsGap(i - 1) {
+			cumulative[i] += points[i-1].DistanceTo(&points[i])
+		}
+	}
+
+	var best float64
+	j := 0
+	for i := range points {
+		if j < i {
+			j = i
+		}
+		for j < len(points)-1 && points[j].Timestamp.Sub(points[i].Timestamp).Seconds() < maxSpeedWindow {
+			j++
+		}
+		dt := points[j].Timestamp.Sub(points[i].Timestamp).Seconds()
+		if dt < maxSpeedWindow {
+			break // Not enough track left for a full window.
+		}
+		if speed := (cumulative[j] - cumulative[i]) / dt; speed > best {
+			best = speed
+		}
+	}
+	return best
+}
@@ -0,0 +1,181 @@
+package sport
+
+import "sort"
+
+// Sports supported by RaceViz. The value is stored in the events table.
+const (
+	Running  = "running"
+	Cycling  = "cycling"
+	MTB      = "mtb"
+	Swimming = "swimming"
+	Sailing  = "sailing"
+	Paddling = "paddling"
+	Skiing   = "skiing"
+	Driving  = "driving"
+	Gliding  = "gliding" // Gliders, paragliders and hang gliders
+	// Generic is used for events created before sports were introduced, and for
+	// anything that doesn't fit one of the specific sports.
+	Generic = "generic"
+)
+
+// Metric names. Values are reported in SI units: meters, seconds and meters per
+// second, with pace in seconds per kilometer. Profiles tell the frontend which
+// units to display them in.
+const (
+	MetricDistance    = "distance"
+	MetricElapsedTime = "elapsed_time"
+	MetricMovingTime  = "moving_time"
+	MetricAvgSpeed    = "avg_speed"
+	MetricMaxSpeed    = "max_speed"
+	MetricAvgPace     = "avg_pace"
+	MetricAscent      = "ascent"
+	MetricDescent     = "descent"
+
+	// Sailing metrics. These are computed by the sailing package once a wind
+	// direction has been entered for the event.
+	MetricTacks         = "tacks"
+	MetricGybes         = "gybes"
+	MetricManoeuvreLoss = "manoeuvre_loss"
+	MetricVMGUpwind     = "vmg_upwind"
+	MetricVMGDownwind   = "vmg_downwind"
+	MetricVMGToMark     = "vmg_mark"
+
+	// Gliding metrics, computed by the gliding package from the track's
+	// altitudes. Climb rates are in m/s; the glide ratio has no unit.
+	MetricMaxAltitude = "max_altitude"
+	MetricMaxClimb    = "max_climb"
+	MetricAvgClimb    = "avg_climb"
+	MetricThermals    = "thermals"
+	MetricThermalTime = "thermal_time"
+	MetricGlideRatio  = "glide_ratio"
+)
+
+// Profile holds the per-sport defaults used when processing and displaying tracks.
+type Profile struct {
+	Sport string `json:"sport"`
+	Name  string `json:"name"`
+
+	// Display settings for the frontend.
+	SpeedDisplay string `json:"speedDisplay"` // "pace" or "speed"
+	SpeedUnit    string `json:"speedUnit"`    // e.g. "km/h", "kn", "min/km", "min/100m"
+	DistanceUnit string `json:"distanceUnit"` // e.g. "km", "m", "nm"
+
+	// MaxSpeed is the spike filter limit in m/s. Points that would require moving
+	// faster than this from the previous point are treated as GPS glitches.
+	MaxSpeed float64 `json:"maxSpeed"`
+
+	// Auto-pause: time spent below AutoPauseSpeed (m/s) for longer than
+	// AutoPauseDelay (seconds) is not counted as moving time.
+	AutoPauseSpeed float64 `json:"autoPauseSpeed"`
+	AutoPauseDelay float64 `json:"autoPauseDelay"`
+
+	// Metrics lists the statistics computed for tracks in this sport.
+	Metrics []string `json:"metrics"`
+}
+
+// baseMetrics are computed for every sport.
+var baseMetrics = []string{MetricDistance, MetricElapsedTime, MetricMovingTime}
+
+var profiles = map[string]*Profile{
+	Running: {
+		Sport: Running, Name: "Running",
+		SpeedDisplay: "pace", SpeedUnit: "min/km", DistanceUnit: "km",
+		MaxSpeed: 12, AutoPauseSpeed: 0.8, AutoPauseDelay: 10,
+		Metrics: withBase(MetricAvgPace, MetricAscent, MetricDescent),
+	},
+	Cycling: {
+		Sport: Cycling, Name: "Cycling",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 33, AutoPauseSpeed: 1.0, AutoPauseDelay: 5,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed, MetricAscent, MetricDescent),
+	},
+	MTB: {
+		Sport: MTB, Name: "Mountain Biking",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 25, AutoPauseSpeed: 0.6, AutoPauseDelay: 10,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed, MetricAscent, MetricDescent),
+	},
+	Swimming: {
+		Sport: Swimming, Name: "Swimming",
+		SpeedDisplay: "pace", SpeedUnit: "min/100m", DistanceUnit: "m",
+		MaxSpeed: 4, AutoPauseSpeed: 0.15, AutoPauseDelay: 10,
+		Metrics: withBase(MetricAvgPace),
+	},
+	Sailing: {
+		Sport: Sailing, Name: "Sailing",
+		SpeedDisplay: "speed", SpeedUnit: "kn", DistanceUnit: "nm",
+		MaxSpeed: 25, AutoPauseSpeed: 0.25, AutoPauseDelay: 30,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed,
+			MetricTacks, MetricGybes, MetricManoeuvreLoss, MetricVMGUpwind, MetricVMGDownwind, MetricVMGToMark),
+	},
+	Paddling: {
+		Sport: Paddling, Name: "Paddling",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 8, AutoPauseSpeed: 0.3, AutoPauseDelay: 15,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed),
+	},
+	Skiing: {
+		Sport: Skiing, Name: "Skiing",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 45, AutoPauseSpeed: 0.5, AutoPauseDelay: 10,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed, MetricAscent, MetricDescent),
+	},
+	Driving: {
+		Sport: Driving, Name: "Driving",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 100, AutoPauseSpeed: 1.0, AutoPauseDelay: 5,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed),
+	},
+	Gliding: {
+		Sport: Gliding, Name: "Gliding",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 80, AutoPauseSpeed: 0.5, AutoPauseDelay: 30,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed,
+			MetricMaxAltitude, MetricMaxClimb, MetricAvgClimb, MetricThermals, MetricThermalTime, MetricGlideRatio),
+	},
+	Generic: {
+		Sport: Generic, Name: "Other",
+		SpeedDisplay: "speed", SpeedUnit: "km/h", DistanceUnit: "km",
+		MaxSpeed: 100, AutoPauseSpeed: 0.5, AutoPauseDelay: 10,
+		Metrics: withBase(MetricAvgSpeed, MetricMaxSpeed, MetricAscent, MetricDescent),
+	},
+}
+
+// withBase returns the base metrics followed by the given sport-specific ones.
+func withBase(metrics ...string) []string {
+	return append(append([]string{}, baseMetrics...), metrics...)
+}
+
+// Get returns the profile for a sport. Unknown sports fall back to the generic profile.
+func Get(sport string) *Profile {
+	if p, ok := profiles[sport]; ok {
+		return p
+	}
+	return profiles[Generic]
+}
+
+// Valid reports whether sport is a known sport.
+func Valid(sport string) bool {
+	_, ok := profiles[sport]
+	return ok
+}
+
+// All returns every profile, sorted by sport identifier.
+func All() []*Profile {
+	list := make([]*Profile, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Sport < list[j].Sport })
+	return list
+}
+
+// HasMetric reports whether the profile computes the given metric.
+func (p *Profile) HasMetric(metric string) bool {
+	for _, m := range p.Metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
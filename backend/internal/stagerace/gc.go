@@ -0,0 +1,202 @@
+// Package stagerace computes the general classification (GC) of a stage race:
+// the standings by cumulative time over its stages, less any time bonuses.
+package stagerace
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/results"
+)
+
+// Entry is a rider's result in one stage.
+type Entry struct {
+	Rider  string // Identifies the rider across stages; see RiderKey
+	Name   string
+	Result *results.Result
+}
+
+// Stage is one of the events of a stage race, with its riders' results.
+type Stage struct {
+	EventID int64
+	Number  int // 1-based
+	Name    string
+	Entries []Entry
+}
+
+// StageResult is a rider's placing in a single stage. Times are in seconds.
+type StageResult struct {
+	Rank    int     `json:"rank"` // 0 if the rider did not finish
+	Rider   string  `json:"rider"`
+	Name    string  `json:"name"`
+	RacerID int64   `json:"racerId"`
+	Status  string  `json:"status"`
+	Time    float64 `json:"time"`
+	Gap     float64 `json:"gap"` // Behind the stage winner
+	Bonus   float64 `json:"bonus"`
+}
+
+// StageRanking is the result of a stage.
+type StageRanking struct {
+	EventID int64         `json:"eventId"`
+	Number  int           `json:"number"`
+	Name    string        `json:"name"`
+	Raced   bool          `json:"raced"` // False until a rider has finished the stage
+	Results []StageResult `json:"results"`
+}
+
+// Standing is a rider's place in the general classification. Times are in seconds.
+type Standing struct {
+	Rank            int     `json:"rank"` // 0 for riders who abandoned
+	Rider           string  `json:"rider"`
+	Name            string  `json:"name"`
+	Time            float64 `json:"time"` // Sum of the stage times less the bonuses
+	Gap             float64 `json:"gap"`  // Behind the leader
+	Bonuses         float64 `json:"bonuses"`
+	StagesCompleted int     `json:"stagesCompleted"`
+	AbandonedStage  int     `json:"abandonedStage,omitempty"` // Number of the stage the rider did not finish
+}
+
+// Classification is the state of a stage race after the stages raced so far.
+type Classification struct {
+	StagesRaced int            `json:"stagesRaced"`
+	Standings   []Standing     `json:"standings"`
+	Stages      []StageRanking `json:"stages"`
+}
+
+// RiderKey returns the key that matches a rider's entries in different stages
+// by name: case and extra spaces are ignored.
+func RiderKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Compute ranks every stage and builds the general classification. bonuses are
+// taken off the GC times of a stage's first finishers, in order of placing.
+//
+// Stages that no rider has finished yet are considered not raced and don't
+// count. A rider who doesn't finish a raced stage, or has no entry in it, has
+// abandoned: they keep the stages completed before it but are no longer ranked.
+func Compute(stages []Stage, bonuses []time.Duration) *Classification {
+	c := &Classification{Standings: []Standing{}, Stages: make([]StageRanking, 0, len(stages))}
+
+	standings := make(map[string]*Standing)
+	var riders []string
+	for _, stage := range stages {
+		ranking, entries := rankStage(stage, bonuses)
+		c.Stages = append(c.Stages, ranking)
+		if !ranking.Raced {
+			continue
+		}
+		c.StagesRaced++
+
+		for _, e := range entries {
+			if _, ok := standings[e.Rider]; !ok {
+				standings[e.Rider] = &Standing{Rider: e.Rider, Name: e.Name}
+				riders = append(riders, e.Rider)
+				// Missing an earlier stage is an abandon too.
+				if c.StagesRaced > 1 {
+					standings[e.Rider].AbandonedStage = firstRacedStage(c.Stages)
+				}
+			}
+		}
+		for _, rider := range riders {
+			st := standings[rider]
+			if st.AbandonedStage != 0 {
+				continue
+			}
+			res, ok := findStageResult(ranking, rider)
+			if !ok || res.Status != results.StatusFinished {
+				st.AbandonedStage = stage.Number
+				continue
+			}
+			st.Time += res.Time - res.Bonus
+			st.Bonuses += res.Bonus
+			st.StagesCompleted++
+		}
+	}
+
+	for _, rider := range riders {
+		c.Standings = append(c.Standings, *standings[rider])
+	}
+	sort.SliceStable(c.Standings, func(i, j int) bool {
+		a, b := c.Standings[i], c.Standings[j]
+		if (a.AbandonedStage == 0) != (b.AbandonedStage == 0) {
+			return a.AbandonedStage == 0
+		}
+		if a.AbandonedStage != b.AbandonedStage {
+			return a.AbandonedStage > b.AbandonedStage
+		}
+		if a.StagesCompleted != b.StagesCompleted {
+			return a.StagesCompleted > b.StagesCompleted
+		}
+		return a.Time < b.Time
+	})
+	for i := range c.Standings {
+		st := &c.Standings[i]
+		if st.AbandonedStage != 0 {
+			continue
+		}
+		st.Rank = i + 1
+		if i > 0 && c.Standings[i-1].Time == st.Time {
+			st.Rank = c.Standings[i-1].Rank
+		}
+		st.Gap = st.Time - c.Standings[0].Time
+	}
+	return c
+}
+
+// rankStage ranks the entries of a stage and awards the time bonuses. It also
+// returns the entries in ranking order.
+func rankStage(stage Stage, bonuses []time.Duration) (StageRanking, []Entry) {
+	ranking := StageRanking{EventID: stage.EventID, Number: stage.Number, Name: stage.Name, Results: []StageResult{}}
+
+	byResult := make(map[*results.Result]Entry, len(stage.Entries))
+	list := make([]*results.Result, len(stage.Entries))
+	for i, e := range stage.Entries {
+		byResult[e.Result] = e
+		list[i] = e.Result
+	}
+	results.Rank(list)
+
+	entries := make([]Entry, len(list))
+	var winner float64
+	for i, res := range list {
+		e := byResult[res]
+		entries[i] = e
+		sr := StageResult{Rank: res.Rank, Rider: e.Rider, Name: e.Name, RacerID: res.RacerID, Status: res.Status}
+		if res.Finished() {
+			ranking.Raced = true
+			sr.Time = res.Elapsed.Seconds()
+			if i == 0 {
+				winner = sr.Time
+			}
+			sr.Gap = sr.Time - winner
+			if res.Rank <= len(bonuses) {
+				sr.Bonus = bonuses[res.Rank-1].Seconds()
+			}
+		}
+		ranking.Results = append(ranking.Results, sr)
+	}
+	return ranking, entries
+}
+
+// findStageResult returns a rider's result in a stage ranking.
+func findStageResult(ranking StageRanking, rider string) (StageResult, bool) {
+	for _, res := range ranking.Results {
+		if res.Rider == rider {
+			return res, true
+		}
+	}
+	return StageResult{}, false
+}
+
+// firstRacedStage returns the number of the first stage that has been raced.
+func firstRacedStage(rankings []StageRanking) int {
+	for _, r := range rankings {
+		if r.Raced {
+			return r.Number
+		}
+	}
+	return 0
+}
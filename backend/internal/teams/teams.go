@@ -0,0 +1,224 @@
+// Package teams scores the teams of an event: by the times of their first
+// finishers, or as relays where each member races one leg and the legs add up
+// to a single team time.
+package teams
+
+import (
+	"sort"
+	"time"
+
+	"github.com/intermernet/raceviz/internal/gpx"
+	"github.com/intermernet/raceviz/internal/results"
+)
+
+// Team scoring methods.
+const (
+	ScoringSum   = "sum"   // Sum of the times of the team's N fastest finishers
+	ScoringFirst = "first" // Time of the team's Nth finisher, i.e. once its first N are home
+	ScoringRelay = "relay" // Members race one leg each, handing over at the exchange zone
+)
+
+// ValidScoring reports whether scoring is a known team scoring method.
+func ValidScoring(scoring string) bool {
+	return scoring == ScoringSum || scoring == ScoringFirst || scoring == ScoringRelay
+}
+
+// Rules are how an event scores its teams.
+type Rules struct {
+	Scoring string
+	Counted int // N, for ScoringSum and ScoringFirst
+
+	// For relays: when the first leg starts, or zero to start it at the first
+	// point of its track, and where legs are handed over. Without an exchange
+	// zone every leg ends at its racer's own finish.
+	RelayStart time.Time
+	Exchange   *results.Checkpoint
+}
+
+// Member is a racer of a team with their individual result.
+type Member struct {
+	RacerID int64
+	Leg     int // Relay leg, 1-based; members without a leg don't race in a relay
+	Points  []gpx.TrackPoint
+	Result  *results.Result
+}
+
+// Team is a team with its members.
+type Team struct {
+	ID      int64
+	Name    string
+	Members []Member
+}
+
+// LegTime is when a relay leg was raced. Start and End are unset for legs that
+// never started or never finished.
+type LegTime struct {
+	Leg     int        `json:"leg"`
+	RacerID int64      `json:"racerId"`
+	Status  string     `json:"status"`
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+	Time    float64    `json:"time"` // Seconds, finished legs only
+}
+
+// Standing is a team's place in the team classification. Times are in seconds.
+type Standing struct {
+	Rank     int       `json:"rank"` // 0 if the team did not finish
+	TeamID   int64     `json:"teamId"`
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Time     float64   `json:"time"`
+	Gap      float64   `json:"gap"`      // Behind the winning team
+	RacerIDs []int64   `json:"racerIds"` // The members whose times count, in order
+	Legs     []LegTime `json:"legs,omitempty"`
+}
+
+// Rank scores every team and ranks them: finishers first, fastest first,
+// followed by the teams that did not finish and then those that did not start.
+// Teams with equal times share a rank.
+func Rank(teams []Team, rules Rules) []Standing {
+	standings := make([]Standing, len(teams))
+	for i, team := range teams {
+		if rules.Scoring == ScoringRelay {
+			standings[i] = relayStanding(team, rules)
+		} else {
+			standings[i] = finisherStanding(team, rules)
+		}
+	}
+
+	order := map[string]int{results.StatusFinished: 0, results.StatusDNF: 1, results.StatusDNS: 2}
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if order[a.Status] != order[b.Status] {
+			return order[a.Status] < order[b.Status]
+		}
+		return a.Status == results.StatusFinished && a.Time < b.Time
+	})
+	for i := range standings {
+		st := &standings[i]
+		if st.Status != results.StatusFinished {
+			continue
+		}
+		st.Rank = i + 1
+		if i > 0 && standings[i-1].Time == st.Time {
+			st.Rank = standings[i-1].Rank
+		}
+		st.Gap = st.Time - standings[0].Time
+	}
+	return standings
+}
+
+// finisherStanding scores a team by its N fastest finishers.
+func finisherStanding(team Team, rules Rules) Standing {
+	st := Standing{TeamID: team.ID, Name: team.Name, Status: results.StatusDNS, RacerIDs: []int64{}}
+
+	var finishers []*results.Result
+	for _, m := range team.Members {
+		switch {
+		case m.Result.Finished():
+			finishers = append(finishers, m.Result)
+		case m.Result.Status == results.StatusDNF:
+			st.Status = results.StatusDNF
+		}
+	}
+	if len(finishers) > 0 {
+		st.Status = results.StatusDNF
+	}
+	if len(finishers) < rules.Counted || rules.Counted < 1 {
+		return st
+	}
+
+	sort.SliceStable(finishers, func(i, j int) bool { return finishers[i].Elapsed < finishers[j].Elapsed })
+	for _, res := range finishers[:rules.Counted] {
+		st.RacerIDs = append(st.RacerIDs, res.RacerID)
+		if rules.Scoring == ScoringSum {
+			st.Time += res.Elapsed.Seconds()
+		}
+	}
+	if rules.Scoring == ScoringFirst {
+		st.Time = finishers[rules.Counted-1].Elapsed.Seconds()
+	}
+	st.Status = results.StatusFinished
+	return st
+}
+
+// relayStanding times a relay team's legs in order. Each leg starts when the
+// previous one ends, and all but the last end when the racer reaches the
+// exchange zone. The team finishes when its last leg does.
+func relayStanding(team Team, rules Rules) Standing {
+	st := Standing{TeamID: team.ID, Name: team.Name, Status: results.StatusDNS, RacerIDs: []int64{}, Legs: []LegTime{}}
+
+	var legs []Member
+	for _, m := range team.Members {
+		if m.Leg > 0 {
+			legs = append(legs, m)
+		}
+	}
+	sort.SliceStable(legs, func(i, j int) bool { return legs[i].Leg < legs[j].Leg })
+	if len(legs) == 0 {
+		return st
+	}
+
+	start := rules.RelayStart
+	if start.IsZero() && len(legs[0].Points) > 0 {
+		start = legs[0].Points[0].Timestamp
+	}
+	first := start
+	running := !start.IsZero()
+	for i, m := range legs {
+		st.RacerIDs = append(st.RacerIDs, m.RacerID)
+		leg := LegTime{Leg: m.Leg, RacerID: m.RacerID, Status: results.StatusDNS}
+		if len(m.Points) > 0 || m.Result.Status != results.StatusDNS {
+			leg.Status = results.StatusDNF
+			st.Status = results.StatusDNF
+		}
+		if !running {
+			st.Legs = append(st.Legs, leg)
+			continue
+		}
+
+		legStart := start
+		leg.Start = &legStart
+		var end time.Time
+		if i < len(legs)-1 && rules.Exchange != nil {
+			end = handover(m.Points, start, *rules.Exchange)
+		} else if m.Result.Finished() && m.Result.Finish.After(start) {
+			end = m.Result.Finish
+		}
+		if end.IsZero() {
+			running = false
+			st.Legs = append(st.Legs, leg)
+			continue
+		}
+		leg.Status = results.StatusFinished
+		leg.End = &end
+		leg.Time = end.Sub(start).Seconds()
+		st.Legs = append(st.Legs, leg)
+		start = end
+	}
+
+	if running {
+		st.Status = results.StatusFinished
+		st.Time = start.Sub(first).Seconds()
+	}
+	return st
+}
+
+// handover returns when a leg's racer reached the exchange zone: the first
+// time after the leg started that the track entered the zone from outside it.
+// It returns the zero time if the racer never did.
+func handover(points []gpx.TrackPoint, start time.Time, zone results.Checkpoint) time.Time {
+	center := &gpx.TrackPoint{Lat: zone.Lat, Lon: zone.Lon}
+	left := false
+	for i := range points {
+		if points[i].Timestamp.Before(start) {
+			continue
+		}
+		inside := points[i].DistanceTo(center) <= zone.Radius
+		if left && inside {
+			return points[i].Timestamp
+		}
+		left = left || !inside
+	}
+	return time.Time{}
+}